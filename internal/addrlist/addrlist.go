@@ -20,19 +20,22 @@ type AddrList struct {
 	maxItems   int
 	listenPort int
 	clientIP   *net.IP
+	clientIP6  *net.IP
 	blocklist  *blocklist.Blocklist
 
 	countBySource map[peersource.Source]int
 }
 
 // New returns a new AddrList.
-func New(maxItems int, blocklist *blocklist.Blocklist, listenPort int, clientIP *net.IP) *AddrList {
+// clientIP and clientIP6 are the external IPv4 and IPv6 addresses of the client that are used for calculating peer priorities.
+func New(maxItems int, blocklist *blocklist.Blocklist, listenPort int, clientIP, clientIP6 *net.IP) *AddrList {
 	return &AddrList{
 		peerByPriority: btree.New(2),
 
 		maxItems:      maxItems,
 		listenPort:    listenPort,
 		clientIP:      clientIP,
+		clientIP6:     clientIP6,
 		blocklist:     blocklist,
 		countBySource: make(map[peersource.Source]int),
 	}
@@ -79,7 +82,7 @@ func (d *AddrList) Push(addrs []*net.TCPAddr, source peersource.Source) {
 		// Discard own client
 		if ad.IP.IsLoopback() && ad.Port == d.listenPort {
 			continue
-		} else if d.clientIP.Equal(ad.IP) {
+		} else if d.clientIP.Equal(ad.IP) || d.clientIP6.Equal(ad.IP) {
 			continue
 		}
 		if externalip.IsExternal(ad.IP) {
@@ -92,7 +95,7 @@ func (d *AddrList) Push(addrs []*net.TCPAddr, source peersource.Source) {
 			addr:      ad,
 			timestamp: now,
 			source:    source,
-			priority:  peerpriority.Calculate(ad, d.clientAddr()),
+			priority:  peerpriority.Calculate(ad, d.clientAddr(ad.IP)),
 		}
 		item := d.peerByPriority.ReplaceOrInsert(p)
 		if item != nil {
@@ -139,10 +142,18 @@ func (d *AddrList) removeExcessItems(delta int) {
 	}
 }
 
-func (d *AddrList) clientAddr() *net.TCPAddr {
-	ip := *d.clientIP
-	if ip == nil {
-		ip = net.IPv4(0, 0, 0, 0)
+// clientAddr returns the address of the client in the same address family with ip.
+func (d *AddrList) clientAddr(ip net.IP) *net.TCPAddr {
+	if ip.To4() != nil {
+		ip = *d.clientIP
+		if ip == nil {
+			ip = net.IPv4(0, 0, 0, 0)
+		}
+	} else {
+		ip = *d.clientIP6
+		if ip == nil {
+			ip = net.IPv6zero
+		}
 	}
 	return &net.TCPAddr{
 		IP:   ip,
@@ -10,7 +10,8 @@ import (
 
 func TestAddrList(t *testing.T) {
 	clientIP := net.IPv4(1, 2, 3, 4)
-	al := New(2, nil, 5000, &clientIP)
+	var clientIP6 net.IP
+	al := New(2, nil, 5000, &clientIP, &clientIP6)
 
 	// Push 1st addr
 	al.Push([]*net.TCPAddr{newAddr("1.1.1.1")}, peersource.Tracker)
@@ -20,6 +20,25 @@ type Allocator struct {
 type File struct {
 	Storage storage.File
 	Name    string
+
+	file *file
+}
+
+// Reopen opens the file with the same name in another storage and closes the current one.
+// The file can be read and written while it is being reopened.
+func (f File) Reopen(sto storage.Storage) error {
+	return f.file.reopen(sto)
+}
+
+// PauseWrites waits for ongoing writes to finish and blocks new writes until ResumeWrites is called.
+// Used for keeping files unchanged while they are being copied.
+func (f File) PauseWrites() {
+	f.file.pauseWrites()
+}
+
+// ResumeWrites unblocks writes that are paused by PauseWrites.
+func (f File) ResumeWrites() {
+	f.file.resumeWrites()
 }
 
 // Progress about the allocation.
@@ -42,7 +61,8 @@ func (a *Allocator) Close() {
 }
 
 // Run the Allocator.
-func (a *Allocator) Run(info *metainfo.Info, sto storage.Storage, progressC chan Progress, resultC chan *Allocator) {
+// Files that are marked in skip are not allocated unless they exist. They are opened later when they are written for the first time.
+func (a *Allocator) Run(info *metainfo.Info, sto storage.Storage, skip []bool, progressC chan Progress, resultC chan *Allocator) {
 	defer close(a.doneC)
 
 	defer func() {
@@ -62,13 +82,31 @@ func (a *Allocator) Run(info *metainfo.Info, sto storage.Storage, progressC chan
 	var allocatedSize int64
 	a.Files = make([]File, len(info.Files))
 	for i, f := range info.Files {
+		if i < len(skip) && skip[i] {
+			// Skipped files that are already on disk are opened so that their pieces can be verified.
+			var exists bool
+			ex, canCheck := sto.(storage.Exister)
+			if canCheck {
+				exists, a.Error = ex.Exists(f.Path)
+				if a.Error != nil {
+					return
+				}
+			}
+			if !exists {
+				lf := newFile(sto, f.Path, f.Length, nil)
+				lf.missing = canCheck
+				a.Files[i] = File{Storage: lf, Name: f.Path, file: lf}
+				continue
+			}
+		}
 		var sf storage.File
 		var exists bool
 		sf, exists, a.Error = sto.Open(f.Path, f.Length)
 		if a.Error != nil {
 			return
 		}
-		a.Files[i] = File{Storage: sf, Name: f.Path}
+		wf := newFile(sto, f.Path, f.Length, sf)
+		a.Files[i] = File{Storage: wf, Name: f.Path, file: wf}
 		if exists {
 			a.HasExisting = true
 		} else {
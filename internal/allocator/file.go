@@ -0,0 +1,142 @@
+package allocator
+
+import (
+	"os"
+	"sync"
+
+	"github.com/cenkalti/rain/internal/storage"
+)
+
+// file wraps a storage.File so that it can be reopened from another storage while it is being read or written.
+// Files that are not wanted to be downloaded are opened on first access.
+// Such files may still be written if a piece overlaps with a wanted file.
+type file struct {
+	sto  storage.Storage
+	name string
+	size int64
+
+	file   storage.File
+	closed bool
+	// File did not exist in storage when it was skipped. Reads return zeros until it is opened for writing.
+	missing bool
+	m       sync.RWMutex
+
+	// Held for writing while writes are paused.
+	writeM sync.RWMutex
+}
+
+var _ storage.File = (*file)(nil)
+
+func newFile(sto storage.Storage, name string, size int64, sf storage.File) *file {
+	return &file{
+		sto:  sto,
+		name: name,
+		size: size,
+		file: sf,
+	}
+}
+
+// do calls fn with the underlying file. Reopen waits until fn returns.
+// Writes and opening a file are blocked while writes are paused because opening may create the file in storage.
+func (f *file) do(write bool, fn func(sf storage.File) (int, error)) (int, error) {
+	if write {
+		f.writeM.RLock()
+		defer f.writeM.RUnlock()
+	}
+	f.m.RLock()
+	if f.file != nil {
+		defer f.m.RUnlock()
+		return fn(f.file)
+	}
+	f.m.RUnlock()
+	if !write {
+		f.writeM.RLock()
+		defer f.writeM.RUnlock()
+	}
+	err := f.open()
+	if err != nil {
+		return 0, err
+	}
+	f.m.RLock()
+	defer f.m.RUnlock()
+	if f.file == nil {
+		// Closed after opening.
+		return 0, os.ErrClosed
+	}
+	return fn(f.file)
+}
+
+func (f *file) open() error {
+	f.m.Lock()
+	defer f.m.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	if f.file != nil {
+		return nil
+	}
+	sf, _, err := f.sto.Open(f.name, f.size)
+	if err != nil {
+		return err
+	}
+	f.file = sf
+	f.missing = false
+	return nil
+}
+
+func (f *file) ReadAt(p []byte, off int64) (int, error) {
+	f.m.RLock()
+	missing := f.missing
+	f.m.RUnlock()
+	if missing {
+		// Do not create the file just for reading it.
+		for i := range p {
+			p[i] = 0
+		}
+		return len(p), nil
+	}
+	return f.do(false, func(sf storage.File) (int, error) { return sf.ReadAt(p, off) })
+}
+
+func (f *file) WriteAt(p []byte, off int64) (int, error) {
+	return f.do(true, func(sf storage.File) (int, error) { return sf.WriteAt(p, off) })
+}
+
+func (f *file) Close() error {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.closed = true
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// pauseWrites blocks writes until resumeWrites is called.
+// Reads from already open files continue.
+func (f *file) pauseWrites() {
+	f.writeM.Lock()
+}
+
+func (f *file) resumeWrites() {
+	f.writeM.Unlock()
+}
+
+// reopen switches to the file with the same name in another storage.
+func (f *file) reopen(sto storage.Storage) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.sto = sto
+	if f.closed || f.file == nil {
+		return nil
+	}
+	sf, _, err := sto.Open(f.name, f.size)
+	if err != nil {
+		return err
+	}
+	old := f.file
+	f.file = sf
+	return old.Close()
+}
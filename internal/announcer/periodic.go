@@ -52,10 +52,14 @@ type PeriodicalAnnouncer struct {
 	lastAnnounce  time.Time
 	nextAnnounce  time.Time
 	HasAnnounced  bool
-	responseC     chan *tracker.AnnounceResponse
-	errC          chan error
-	closeC        chan struct{}
-	doneC         chan struct{}
+	// StatusChanged is called from the announcer goroutine when the tracker starts or stops working.
+	// Must be set before calling Run.
+	StatusChanged  func(Stats)
+	notifiedStatus Status
+	responseC      chan *tracker.AnnounceResponse
+	errC           chan error
+	closeC         chan struct{}
+	doneC          chan struct{}
 
 	needMorePeers  bool
 	mNeedMorePeers sync.RWMutex
@@ -175,6 +179,7 @@ func (a *PeriodicalAnnouncer) Run() {
 			}
 			a.HasAnnounced = true
 			a.lastError = nil
+			a.notifyStatus()
 			a.backoff.Reset()
 			interval := a.getNextInterval()
 			resetTimer(interval)
@@ -193,6 +198,7 @@ func (a *PeriodicalAnnouncer) Run() {
 			} else {
 				a.log.Debugln("announce error:", a.lastError.Err.Error())
 			}
+			a.notifyStatus()
 			interval := a.getNextIntervalFromError(a.lastError)
 			resetTimer(interval)
 		case <-a.needMorePeersC:
@@ -217,6 +223,16 @@ func (a *PeriodicalAnnouncer) Run() {
 	}
 }
 
+// notifyStatus calls StatusChanged if the status is different than the last notified one.
+// Contacting status is not notified because it is set on every announce.
+func (a *PeriodicalAnnouncer) notifyStatus() {
+	if a.StatusChanged == nil || a.status == a.notifiedStatus {
+		return
+	}
+	a.notifiedStatus = a.status
+	a.StatusChanged(a.stats())
+}
+
 func (a *PeriodicalAnnouncer) getNextInterval() time.Duration {
 	a.mNeedMorePeers.RLock()
 	need := a.needMorePeers
@@ -277,9 +293,9 @@ type AnnounceError struct {
 func (a *PeriodicalAnnouncer) newAnnounceError(err error) (e *AnnounceError) {
 	e = &AnnounceError{Err: err}
 	switch err {
-	case resolver.ErrNotIPv4Address:
+	case resolver.ErrNoAddress:
 		parsed, _ := url.Parse(a.Tracker.URL())
-		e.Message = "tracker has no IPv4 address: " + parsed.Hostname()
+		e.Message = "tracker has no IP address: " + parsed.Hostname()
 		return
 	case resolver.ErrBlocked:
 		e.Message = "tracker IP is blocked"
@@ -339,9 +355,9 @@ func (a *PeriodicalAnnouncer) newAnnounceError(err error) (e *AnnounceError) {
 			e.Message = "no route to host: " + parsed.Hostname()
 			return
 		}
-		if strings.HasSuffix(s, resolver.ErrNotIPv4Address.Error()) {
+		if strings.HasSuffix(s, resolver.ErrNoAddress.Error()) {
 			parsed, _ := url.Parse(a.Tracker.URL())
-			e.Message = "tracker has no IPv4 address: " + parsed.Hostname()
+			e.Message = "tracker has no IP address: " + parsed.Hostname()
 			return
 		}
 		if strings.HasSuffix(s, "connection reset by peer") {
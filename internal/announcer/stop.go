@@ -13,19 +13,20 @@ type StopAnnouncer struct {
 	log      logger.Logger
 	timeout  time.Duration
 	trackers []tracker.Tracker
-	torrent  tracker.Torrent
+	torrents []tracker.Torrent
 	resultC  chan struct{}
 	closeC   chan struct{}
 	doneC    chan struct{}
 }
 
 // NewStopAnnouncer returns a new StopAnnouncer.
-func NewStopAnnouncer(trackers []tracker.Tracker, tra tracker.Torrent, timeout time.Duration, resultC chan struct{}, l logger.Logger) *StopAnnouncer {
+// Each tracker is announced with the torrent at the same index.
+func NewStopAnnouncer(trackers []tracker.Tracker, torrents []tracker.Torrent, timeout time.Duration, resultC chan struct{}, l logger.Logger) *StopAnnouncer {
 	return &StopAnnouncer{
 		log:      l,
 		timeout:  timeout,
 		trackers: trackers,
-		torrent:  tra,
+		torrents: torrents,
 		resultC:  resultC,
 		closeC:   make(chan struct{}),
 		doneC:    make(chan struct{}),
@@ -43,6 +44,7 @@ func (a *StopAnnouncer) Run() {
 	defer close(a.doneC)
 
 	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(a.timeout))
+	defer cancel()
 	go func() {
 		select {
 		case <-ctx.Done():
@@ -52,15 +54,15 @@ func (a *StopAnnouncer) Run() {
 	}()
 
 	doneC := make(chan struct{})
-	for _, trk := range a.trackers {
-		go func(trk tracker.Tracker) {
+	for i, trk := range a.trackers {
+		go func(trk tracker.Tracker, tra tracker.Torrent) {
 			req := tracker.AnnounceRequest{
-				Torrent: a.torrent,
+				Torrent: tra,
 				Event:   tracker.EventStopped,
 			}
 			_, _ = trk.Announce(ctx, req)
 			doneC <- struct{}{}
-		}(trk)
+		}(trk, a.torrents[i])
 	}
 	for range a.trackers {
 		<-doneC
@@ -12,13 +12,12 @@ import (
 	"github.com/cenkalti/rain/internal/blocklist/stree"
 )
 
-var errNotIPv4Address = errors.New("address is not ipv4")
-
 // Blocklist holds a list of IP ranges in a Segment Tree structure for faster lookups.
 type Blocklist struct {
 	Logger Logger
 
 	tree  stree.Stree
+	tree6 stree.Tree[string]
 	m     sync.RWMutex
 	count int
 }
@@ -42,13 +41,14 @@ func (b *Blocklist) Blocked(ip net.IP) bool {
 	b.m.RLock()
 	defer b.m.RUnlock()
 
-	ip = ip.To4()
-	if ip == nil {
-		return false
+	if ip4 := ip.To4(); ip4 != nil {
+		val := binary.BigEndian.Uint32(ip4)
+		return b.tree.Contains(stree.ValueType(val))
 	}
-
-	val := binary.BigEndian.Uint32(ip)
-	return b.tree.Contains(stree.ValueType(val))
+	if ip6 := ip.To16(); ip6 != nil {
+		return b.tree6.Contains(string(ip6))
+	}
+	return false
 }
 
 // Reload the segment tree by reading new rules from a io.Reader.
@@ -56,18 +56,20 @@ func (b *Blocklist) Reload(r io.Reader) (int, error) {
 	b.m.Lock()
 	defer b.m.Unlock()
 
-	tree, n, err := load(r, b.Logger)
+	tree, tree6, n, err := load(r, b.Logger)
 	if err != nil {
 		return n, err
 	}
 
 	b.tree = *tree
+	b.tree6 = *tree6
 	b.count = n
 	return n, nil
 }
 
-func load(r io.Reader, logger Logger) (*stree.Stree, int, error) {
+func load(r io.Reader, logger Logger) (*stree.Stree, *stree.Tree[string], int, error) {
 	var tree stree.Stree
+	var tree6 stree.Tree[string]
 	var n int
 	var hasError bool
 	scanner := bufio.NewScanner(r)
@@ -87,23 +89,31 @@ func load(r io.Reader, logger Logger) (*stree.Stree, int, error) {
 			}
 			continue
 		}
-		tree.AddRange(stree.ValueType(r.first), stree.ValueType(r.last))
+		if r.ipv6 {
+			tree6.AddRange(string(r.first6[:]), string(r.last6[:]))
+		} else {
+			tree.AddRange(stree.ValueType(r.first), stree.ValueType(r.last))
+		}
 		n++
 	}
 	if err := scanner.Err(); err != nil {
-		return nil, 0, err
+		return nil, nil, 0, err
 	}
 	if n == 0 && hasError {
 		// Probably we couln't decode the stream correctly.
 		// At least one line must be correct before we consider the load operation as successful.
-		return nil, 0, errors.New("no valid rules")
+		return nil, nil, 0, errors.New("no valid rules")
 	}
 	tree.Build()
-	return &tree, n, nil
+	tree6.Build()
+	return &tree, &tree6, n, nil
 }
 
 type ipRange struct {
 	first, last uint32
+	// IPv6 ranges are kept as 16-byte arrays.
+	ipv6          bool
+	first6, last6 [net.IPv6len]byte
 }
 
 func parseCIDR(b []byte) (r ipRange, err error) {
@@ -111,12 +121,16 @@ func parseCIDR(b []byte) (r ipRange, err error) {
 	if err != nil {
 		return
 	}
-	if len(ipnet.IP) != 4 {
-		err = errNotIPv4Address
+	if len(ipnet.IP) == net.IPv6len && len(ipnet.Mask) == net.IPv6len {
+		r.ipv6 = true
+		for i := range ipnet.IP {
+			r.first6[i] = ipnet.IP[i]
+			r.last6[i] = ipnet.IP[i] | ^ipnet.Mask[i]
+		}
 		return
 	}
-	if len(ipnet.Mask) != 4 {
-		err = errNotIPv4Address
+	if len(ipnet.IP) != net.IPv4len || len(ipnet.Mask) != net.IPv4len {
+		err = errors.New("invalid address length")
 		return
 	}
 	r.first = binary.BigEndian.Uint32(ipnet.IP)
@@ -49,3 +49,18 @@ func TestEmptyList(t *testing.T) {
 	assert.False(t, b.Blocked(net.ParseIP("0.0.0.0")))
 	assert.False(t, b.Blocked(net.ParseIP("176.240.195.107")))
 }
+
+func TestContainsIPv6(t *testing.T) {
+	r := bytes.NewReader([]byte("2001:db8::/32\n1.2.3.0/24\n"))
+	b := New()
+	n, err := b.Reload(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, n)
+	assert.True(t, b.Blocked(net.ParseIP("2001:db8::1")))
+	assert.True(t, b.Blocked(net.ParseIP("2001:db8:ffff:ffff:ffff:ffff:ffff:ffff")))
+	assert.False(t, b.Blocked(net.ParseIP("2001:db9::1")))
+	assert.True(t, b.Blocked(net.ParseIP("1.2.3.4")))
+	assert.False(t, b.Blocked(net.ParseIP("1.2.4.4")))
+}
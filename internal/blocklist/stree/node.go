@@ -1,19 +1,21 @@
 package stree
 
-type node struct {
-	left, right *node
+import "golang.org/x/exp/constraints"
+
+type node[T constraints.Ordered] struct {
+	left, right *node[T]
 	// A segment is a interval represented by the node
-	segment segment
+	segment segment[T]
 	// All intervals that overlap with segment
-	overlap []interval
+	overlap []interval[T]
 }
 
 // Inserts interval into given tree structure
-func (n *node) insertInterval(intrvl interval) {
+func (n *node[T]) insertInterval(intrvl interval[T]) {
 	if n.segment.subsetOf(intrvl.segment) {
 		// interval of node is a subset of the specified interval or equal
 		if n.overlap == nil {
-			n.overlap = make([]interval, 0)
+			n.overlap = make([]interval[T], 0)
 		}
 		n.overlap = append(n.overlap, intrvl)
 	} else {
@@ -27,7 +29,7 @@ func (n *node) insertInterval(intrvl interval) {
 }
 
 // querySingle traverse tree in search of overlaps
-func (n node) querySingle(from, to ValueType, result map[ValueType]interval) {
+func (n node[T]) querySingle(from, to T, result map[int]interval[T]) {
 	if n.segment.Disjoint(from, to) {
 		return
 	}
@@ -42,26 +44,26 @@ func (n node) querySingle(from, to ValueType, result map[ValueType]interval) {
 	}
 }
 
-type interval struct {
-	ID ValueType // unique
-	segment
+type interval[T constraints.Ordered] struct {
+	ID int // unique
+	segment[T]
 }
 
-type segment struct {
-	From ValueType
-	To   ValueType
+type segment[T constraints.Ordered] struct {
+	From T
+	To   T
 }
 
-func (s segment) subsetOf(other segment) bool {
+func (s segment[T]) subsetOf(other segment[T]) bool {
 	return other.From <= s.From && other.To >= s.To
 }
 
-func (s segment) intersectsWith(other segment) bool {
+func (s segment[T]) intersectsWith(other segment[T]) bool {
 	return other.From <= s.To && s.From <= other.To ||
 		s.From <= other.To && other.From <= s.To
 }
 
 // Disjoint returns true if Segment does not overlap with interval
-func (s segment) Disjoint(from, to ValueType) bool {
+func (s segment[T]) Disjoint(from, to T) bool {
 	return from > s.To || to < s.From
 }
@@ -5,43 +5,52 @@
 // Package stree implements a segment tree and serial algorithm to query intervals
 package stree
 
-import "sort"
+import (
+	"sort"
 
-// ValueType is the type of a single value in the segment tree.
+	"golang.org/x/exp/constraints"
+)
+
+// ValueType is the type of a single value in the segment tree of IPv4 addresses.
 type ValueType uint32
 
-// Stree represents a Segment Tree.
-type Stree struct {
+// Stree represents a Segment Tree of IPv4 addresses.
+type Stree = Tree[ValueType]
+
+// Tree represents a Segment Tree of any ordered type.
+// IPv6 addresses can be stored as 16-byte strings because strings are compared byte by byte.
+type Tree[T constraints.Ordered] struct {
 	// Number of intervals
-	count ValueType
-	root  *node
+	count int
+	root  *node[T]
 	// Interval stack
-	base []interval
+	base []interval[T]
 	// Min and max value of all intervals
-	min, max ValueType
+	min, max T
 }
 
 // AddRange pushes new interval to stack
-func (t *Stree) AddRange(from, to ValueType) {
-	t.base = append(t.base, interval{t.count, segment{from, to}})
+func (t *Tree[T]) AddRange(from, to T) {
+	t.base = append(t.base, interval[T]{t.count, segment[T]{from, to}})
 	t.count++
 }
 
 // Clear the interval stack
-func (t *Stree) Clear() {
+func (t *Tree[T]) Clear() {
 	t.count = 0
 	t.root = nil
 	t.base = nil
-	t.min = 0
-	t.max = 0
+	var zero T
+	t.min = zero
+	t.max = zero
 }
 
 // Build segment tree out of interval stack
-func (t *Stree) Build() {
+func (t *Tree[T]) Build() {
 	if len(t.base) == 0 {
 		return
 	}
-	var es []ValueType
+	var es []T
 	es, t.min, t.max = endpoints(t.base)
 	// Create tree nodes from interval endpoints
 	t.root = t.insertNodes(elementaryIntervals(es))
@@ -54,21 +63,21 @@ func (t *Stree) Build() {
 // from a sorted slice of endpoints
 // Input: [p1, p2, ..., pn]
 // Output: [{p1 : p1}, {p1 : p2}, {p2 : p2},... , {pn : pn}]
-func elementaryIntervals(endpoints []ValueType) []segment {
-	intervals := make([]segment, len(endpoints)*2-1)
+func elementaryIntervals[T constraints.Ordered](endpoints []T) []segment[T] {
+	intervals := make([]segment[T], len(endpoints)*2-1)
 	for i := 0; i < len(endpoints); i++ {
-		intervals[i*2] = segment{endpoints[i], endpoints[i]}
+		intervals[i*2] = segment[T]{endpoints[i], endpoints[i]}
 		if i < len(endpoints)-1 { // don't store {pn, pn+1}
-			intervals[i*2+1] = segment{endpoints[i], endpoints[i+1]}
+			intervals[i*2+1] = segment[T]{endpoints[i], endpoints[i+1]}
 		}
 	}
 	return intervals
 }
 
 // endpoints returns a slice with all endpoints (sorted, unique)
-func endpoints(base []interval) (result []ValueType, min, max ValueType) {
+func endpoints[T constraints.Ordered](base []interval[T]) (result []T, min, max T) {
 	baseLen := len(base)
-	endpoints := make([]ValueType, baseLen*2)
+	endpoints := make([]T, baseLen*2)
 	for i, interval := range base {
 		endpoints[i] = interval.From
 		endpoints[i+baseLen] = interval.To
@@ -80,30 +89,28 @@ func endpoints(base []interval) (result []ValueType, min, max ValueType) {
 }
 
 // dedup removes duplicates from a given slice
-func dedup(sl []ValueType) []ValueType {
+func dedup[T constraints.Ordered](sl []T) []T {
 	sort.Slice(sl, func(i, j int) bool { return sl[i] < sl[j] })
-	prev := sl[0] + 1
 	j := 0
 	for i := range sl {
-		if sl[i] == prev {
+		if i > 0 && sl[i] == sl[j-1] {
 			continue
 		}
 		sl[j] = sl[i]
-		prev = sl[j]
 		j++
 	}
 	return sl[:j]
 }
 
 // insertNodes builds the tree structure from the elementary intervals
-func (t *Stree) insertNodes(leaves []segment) *node {
-	var n *node
+func (t *Tree[T]) insertNodes(leaves []segment[T]) *node[T] {
+	var n *node[T]
 	if len(leaves) == 1 {
-		n = &node{segment: leaves[0]}
+		n = &node[T]{segment: leaves[0]}
 		n.left = nil
 		n.right = nil
 	} else {
-		n = &node{segment: segment{leaves[0].From, leaves[len(leaves)-1].To}}
+		n = &node[T]{segment: segment[T]{leaves[0].From, leaves[len(leaves)-1].To}}
 		center := len(leaves) / 2
 		n.left = t.insertNodes(leaves[:center])
 		n.right = t.insertNodes(leaves[center:])
@@ -112,19 +119,19 @@ func (t *Stree) insertNodes(leaves []segment) *node {
 }
 
 // Contains returns truee if value is in segment tree.
-func (t Stree) Contains(value ValueType) bool {
+func (t Tree[T]) Contains(value T) bool {
 	return len(t.query(value, value)) > 0
 }
 
 // query interval
-func (t Stree) query(from, to ValueType) []interval {
-	result := make(map[ValueType]interval)
+func (t Tree[T]) query(from, to T) []interval[T] {
+	result := make(map[int]interval[T])
 	if t.root == nil {
 		return nil
 	}
 	t.root.querySingle(from, to, result)
 	// transform map to slice
-	sl := make([]interval, 0, len(result))
+	sl := make([]interval[T], 0, len(result))
 	for _, intrvl := range result {
 		sl = append(sl, intrvl)
 	}
@@ -118,3 +118,22 @@ func TestDedup(t *testing.T) {
 		t.Errorf("item: %d", l2[3])
 	}
 }
+
+func TestStringTree(t *testing.T) {
+	var tree Tree[string]
+	tree.AddRange("\x00\x02", "\x00\x04")
+	tree.AddRange("\x01\x00", "\x01\xff")
+	tree.Build()
+	if tree.Contains("\x00\x01") {
+		t.Errorf("fail")
+	}
+	if !tree.Contains("\x00\x03") {
+		t.Errorf("fail")
+	}
+	if tree.Contains("\x00\x05") {
+		t.Errorf("fail")
+	}
+	if !tree.Contains("\x01\x10") {
+		t.Errorf("fail")
+	}
+}
@@ -18,3 +18,24 @@ type rwConn struct {
 
 func (c *rwConn) Read(p []byte) (n int, err error)  { return c.rw.Read(p) }
 func (c *rwConn) Write(p []byte) (n int, err error) { return c.rw.Write(p) }
+
+// RemoteAddr returns the address of the peer as a TCP address.
+// uTP connections are converted to TCP addresses because peers listen both transports on the same port.
+func RemoteAddr(conn net.Conn) *net.TCPAddr {
+	switch addr := conn.RemoteAddr().(type) {
+	case *net.TCPAddr:
+		return addr
+	case *net.UDPAddr:
+		return &net.TCPAddr{IP: addr.IP, Port: addr.Port, Zone: addr.Zone}
+	default:
+		panic("unknown address type")
+	}
+}
+
+// Transport returns the name of the transport protocol of the connection: "tcp" or "utp".
+func Transport(conn net.Conn) string {
+	if _, ok := conn.RemoteAddr().(*net.UDPAddr); ok {
+		return "utp"
+	}
+	return "tcp"
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/cenkalti/rain/internal/mse"
+	"github.com/cenkalti/rain/internal/utp"
 )
 
 var (
@@ -17,6 +18,10 @@ var (
 	sKeyHash = mse.HashSKey(infoHash[:])
 )
 
+func getPeerID(ih [20]byte) ([20]byte, bool) {
+	return id2, ih == infoHash
+}
+
 func TestUnencrypted(t *testing.T) {
 	l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(0, 0, 0, 0), Port: 0})
 	if err != nil {
@@ -28,7 +33,7 @@ func TestUnencrypted(t *testing.T) {
 	var gerr error
 	go func() {
 		defer close(done)
-		conn, cipher, ext, id, err2 := Dial(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}, 10*time.Second, 10*time.Second, false, false, ext1, infoHash, id1, nil)
+		conn, cipher, ext, id, err2 := Dial(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}, nil, 10*time.Second, 10*time.Second, false, false, ext1, infoHash, id1, nil)
 		if err2 != nil {
 			gerr = err2
 			return
@@ -50,7 +55,7 @@ func TestUnencrypted(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, cipher, ext, id, ih, err := Accept(conn, 10*time.Second, nil, false, func(ih [20]byte) bool { return ih == infoHash }, ext2, id2)
+	_, cipher, ext, id, ih, err := Accept(conn, 10*time.Second, nil, false, getPeerID, ext2)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -83,7 +88,7 @@ func TestEncrypted(t *testing.T) {
 	var gerr error
 	go func() {
 		defer close(done)
-		conn, cipher, ext, id, err2 := Dial(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}, 10*time.Second, 10*time.Second, true, true, ext1, infoHash, id1, nil)
+		conn, cipher, ext, id, err2 := Dial(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}, nil, 10*time.Second, 10*time.Second, true, true, ext1, infoHash, id1, nil)
 		if err2 != nil {
 			gerr = err2
 			return
@@ -130,8 +135,8 @@ func TestEncrypted(t *testing.T) {
 			return nil
 		},
 		false,
-		func(ih [20]byte) bool { return ih == infoHash },
-		ext2, id2)
+		getPeerID,
+		ext2)
 	if err != nil {
 		conn.Close()
 		<-done
@@ -169,3 +174,48 @@ func TestEncrypted(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestUTP(t *testing.T) {
+	l, err := utp.Listen("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	port := l.Addr().(*net.UDPAddr).Port
+	done := make(chan struct{})
+	var gerr error
+	go func() {
+		defer close(done)
+		conn, _, _, id, err2 := Dial(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}, l, 10*time.Second, 10*time.Second, false, false, ext1, infoHash, id1, nil)
+		if err2 != nil {
+			gerr = err2
+			return
+		}
+		if id != id2 {
+			t.Errorf("id: %s", id)
+		}
+		if tr := Transport(conn); tr != "utp" {
+			t.Errorf("transport: %s", tr)
+		}
+		if addr := RemoteAddr(conn); addr.Port != port {
+			t.Errorf("addr: %s", addr)
+		}
+		conn.Close()
+	}()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, _, _, id, _, err := Accept(conn, 10*time.Second, nil, false, getPeerID, ext2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if gerr != nil {
+		t.Fatal(gerr)
+	}
+	if id != id1 {
+		t.Errorf("id: %s", id)
+	}
+}
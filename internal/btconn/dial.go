@@ -10,11 +10,18 @@ import (
 	"github.com/cenkalti/rain/internal/mse"
 )
 
+// Dialer makes connections to peers. It is implemented by *net.Dialer and *utp.Socket.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
 // Dial new connection to the address. Does the BitTorrent protocol handshake.
 // Handles encryption. May try to connect again if encryption does not match with given setting.
+// Connection is made with the dialer. If dialer is nil, a TCP connection is made.
 // Returns a net.Conn that is ready for sending/receiving BitTorrent peer protocol messages.
 func Dial(
 	addr net.Addr,
+	dialer Dialer,
 	dialTimeout, handshakeTimeout time.Duration,
 	enableEncryption,
 	forceEncryption bool,
@@ -36,10 +43,18 @@ func Dial(
 		}
 	}()
 
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	dial := func() (net.Conn, error) {
+		dctx, cancel := context.WithTimeout(ctx, dialTimeout)
+		defer cancel()
+		return dialer.DialContext(dctx, addr.Network(), addr.String())
+	}
+
 	// First connection
 	log.Debug("Connecting to peer...")
-	dialer := net.Dialer{Timeout: dialTimeout}
-	conn, err = dialer.DialContext(ctx, addr.Network(), addr.String())
+	conn, err = dial()
 	if err != nil {
 		return
 	}
@@ -97,7 +112,7 @@ func Dial(
 			// Close current connection and try again without encryption
 			conn.Close()
 			log.Debug("Connecting again without encryption...")
-			conn, err = dialer.DialContext(ctx, addr.Network(), addr.String())
+			conn, err = dial()
 			if err != nil {
 				return
 			}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -20,6 +21,8 @@ const (
 	torrents int = iota
 	sessionStats
 	addTorrent
+	seedLimits
+	filterLabel
 	help
 )
 
@@ -30,6 +33,7 @@ const (
 	trackers
 	peers
 	webseeds
+	files
 )
 
 // Console is for drawing a text user interface for a remote Session.
@@ -64,6 +68,7 @@ type Console struct {
 	trackers     []rpctypes.Tracker
 	peers        []rpctypes.Peer
 	webseeds     []rpctypes.Webseed
+	files        []rpctypes.File
 
 	// whether details tab is currently updating state
 	updatingDetails bool
@@ -79,6 +84,13 @@ type Console struct {
 	// state for updater goroutine for updating session-stats page
 	stopUpdatingSessionStatsC chan struct{}
 	updatingSessionStats      bool
+
+	// torrent and its current limits while editing seed limits
+	seedLimitsID    string
+	seedLimitsInput string
+
+	// only the torrents with this label are listed if not empty
+	labelFilter string
 }
 
 type Torrent struct {
@@ -98,7 +110,7 @@ func New(clt *rainrpc.Client, columns []string) *Console {
 }
 
 func columnsNeedStats(columns []string) bool {
-	l := []string{"ID", "Name", "InfoHash", "Port"}
+	l := []string{"ID", "Name", "InfoHash", "Port", "Labels"}
 	for _, c := range columns {
 		for _, d := range l {
 			if c != d {
@@ -134,6 +146,8 @@ func (c *Console) keybindings(g *gocui.Gui) {
 	_ = g.SetKeybinding("help", 'q', gocui.ModNone, c.quit)
 	_ = g.SetKeybinding("session-stats", 'q', gocui.ModNone, c.quit)
 	_ = g.SetKeybinding("add-torrent", gocui.KeyCtrlQ, gocui.ModNone, c.quit)
+	_ = g.SetKeybinding("seed-limits", gocui.KeyCtrlQ, gocui.ModNone, c.quit)
+	_ = g.SetKeybinding("label-filter", gocui.KeyCtrlQ, gocui.ModNone, c.quit)
 
 	// Navigation
 	_ = g.SetKeybinding("torrents", 'j', gocui.ModNone, c.cursorDown)
@@ -155,15 +169,26 @@ func (c *Console) keybindings(g *gocui.Gui) {
 	_ = g.SetKeybinding("torrents", 't', gocui.ModAlt, c.switchTrackers)
 	_ = g.SetKeybinding("torrents", 'p', gocui.ModAlt, c.switchPeers)
 	_ = g.SetKeybinding("torrents", 'w', gocui.ModAlt, c.switchWebseeds)
+	_ = g.SetKeybinding("torrents", 'f', gocui.ModAlt, c.switchFiles)
 
 	// Torrent control
 	_ = g.SetKeybinding("torrents", gocui.KeyCtrlS, gocui.ModNone, c.startTorrent)
 	_ = g.SetKeybinding("torrents", gocui.KeyCtrlS, gocui.ModAlt, c.stopTorrent)
+	_ = g.SetKeybinding("torrents", gocui.KeyCtrlF, gocui.ModNone, c.forceStartTorrent)
+	_ = g.SetKeybinding("torrents", '+', gocui.ModNone, c.moveUpInQueue)
+	_ = g.SetKeybinding("torrents", '-', gocui.ModNone, c.moveDownInQueue)
 	_ = g.SetKeybinding("torrents", gocui.KeyCtrlR, gocui.ModNone, c.removeTorrent)
+	_ = g.SetKeybinding("torrents", gocui.KeyCtrlR, gocui.ModAlt, c.removeTorrentKeepData)
 	_ = g.SetKeybinding("torrents", gocui.KeyCtrlA, gocui.ModAlt, c.announce)
 	_ = g.SetKeybinding("torrents", gocui.KeyCtrlV, gocui.ModNone, c.verify)
 	_ = g.SetKeybinding("torrents", gocui.KeyCtrlA, gocui.ModNone, c.switchAddTorrent)
 	_ = g.SetKeybinding("add-torrent", gocui.KeyEnter, gocui.ModNone, c.addTorrentHandleEnter)
+	_ = g.SetKeybinding("torrents", gocui.KeyCtrlL, gocui.ModNone, c.switchSeedLimits)
+	_ = g.SetKeybinding("torrents", gocui.KeyCtrlT, gocui.ModNone, c.toggleAltSpeedLimits)
+	_ = g.SetKeybinding("session-stats", gocui.KeyCtrlT, gocui.ModNone, c.toggleAltSpeedLimits)
+	_ = g.SetKeybinding("seed-limits", gocui.KeyEnter, gocui.ModNone, c.seedLimitsHandleEnter)
+	_ = g.SetKeybinding("torrents", 'L', gocui.ModNone, c.switchFilterLabel)
+	_ = g.SetKeybinding("label-filter", gocui.KeyEnter, gocui.ModNone, c.labelFilterHandleEnter)
 }
 
 func (c *Console) startUpdatingTorrents(g *gocui.Gui) {
@@ -221,6 +246,14 @@ func (c *Console) layout(g *gocui.Gui) error {
 	}
 	if c.selectedPage != addTorrent {
 		_ = g.DeleteView("add-torrent")
+	}
+	if c.selectedPage != seedLimits {
+		_ = g.DeleteView("seed-limits")
+	}
+	if c.selectedPage != filterLabel {
+		_ = g.DeleteView("label-filter")
+	}
+	if c.selectedPage != addTorrent && c.selectedPage != seedLimits && c.selectedPage != filterLabel {
 		g.Cursor = false
 	}
 	switch c.selectedPage {
@@ -253,6 +286,20 @@ func (c *Console) layout(g *gocui.Gui) error {
 		}
 		g.Cursor = true
 		_, err = g.SetCurrentView("add-torrent")
+	case seedLimits:
+		err = c.drawSeedLimits(g)
+		if err != nil {
+			return err
+		}
+		g.Cursor = true
+		_, err = g.SetCurrentView("seed-limits")
+	case filterLabel:
+		err = c.drawLabelFilter(g)
+		if err != nil {
+			return err
+		}
+		g.Cursor = true
+		_, err = g.SetCurrentView("label-filter")
 	}
 	return err
 }
@@ -297,15 +344,23 @@ func (c *Console) drawHelp(g *gocui.Gui) error {
 	fmt.Fprintln(v, "     alt+t  switch to Trackers tab")
 	fmt.Fprintln(v, "     alt+p  switch to Peers tab")
 	fmt.Fprintln(v, "     alt+w  switch to Webseeds tab")
+	fmt.Fprintln(v, "     alt+f  switch to Files tab")
 
 	fmt.Fprintln(v, "")
 
 	fmt.Fprintln(v, "    ctrl+s  Start torrent")
 	fmt.Fprintln(v, "ctrl+alt+s  Stop torrent")
+	fmt.Fprintln(v, "    ctrl+f  Force start torrent regardless of queue")
+	fmt.Fprintln(v, "         +  Move torrent up in queue")
+	fmt.Fprintln(v, "         -  Move torrent down in queue")
 	fmt.Fprintln(v, "    ctrl+R  Remove torrent")
+	fmt.Fprintln(v, "ctrl+alt+r  Remove torrent but keep files")
 	fmt.Fprintln(v, "ctrl+alt+a  Announce torrent")
 	fmt.Fprintln(v, "    ctrl+v  Verify torrent")
 	fmt.Fprintln(v, "    ctrl+a  Add new torrent")
+	fmt.Fprintln(v, "    ctrl+l  Edit seeding limits of torrent")
+	fmt.Fprintln(v, "    ctrl+t  Toggle alternative speed limits")
+	fmt.Fprintln(v, "         L  Filter torrents by label")
 
 	return nil
 }
@@ -325,6 +380,43 @@ func (c *Console) drawAddTorrent(g *gocui.Gui) error {
 	return nil
 }
 
+func (c *Console) drawSeedLimits(g *gocui.Gui) error {
+	maxX, maxY := g.Size()
+	v, err := g.SetView("seed-limits", 5, 2, maxX-6, maxY-3)
+	if err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Frame = true
+		v.Title = "Seed Limits (Press ctrl-q to close window, empty line resets to global limits)"
+		v.Editable = true
+		v.Wrap = true
+		fmt.Fprint(v, c.seedLimitsInput)
+		_ = v.SetCursor(len(c.seedLimitsInput), 0)
+	}
+	return nil
+}
+
+func (c *Console) drawLabelFilter(g *gocui.Gui) error {
+	maxX, maxY := g.Size()
+	v, err := g.SetView("label-filter", 5, 2, maxX-6, maxY-3)
+	if err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Frame = true
+		v.Title = "Filter by Label (Press ctrl-q to close window, empty line shows all torrents)"
+		v.Editable = true
+		v.Wrap = true
+		c.m.Lock()
+		filter := c.labelFilter
+		c.m.Unlock()
+		fmt.Fprint(v, filter)
+		_ = v.SetCursor(len(filter), 0)
+	}
+	return nil
+}
+
 func (c *Console) drawSessionStats(g *gocui.Gui) error {
 	maxX, maxY := g.Size()
 	v, err := g.SetView("session-stats", 5, 2, maxX-6, maxY-3)
@@ -376,6 +468,10 @@ func getHeader(columns []string) string {
 			header += fmt.Sprintf("%5s", column)
 		case "Size":
 			header += fmt.Sprintf("%8s", column)
+		case "Queue":
+			header += fmt.Sprintf("%5s", column)
+		case "Labels":
+			header += fmt.Sprintf("%-20s", column)
 		default:
 			panic(fmt.Sprintf("unsupported column %s", column))
 		}
@@ -444,6 +540,14 @@ func getRow(columns []string, t Torrent, index int) string {
 			} else {
 				row += fmt.Sprintf("%6d M", stats.Bytes.Total/(1<<20))
 			}
+		case "Queue":
+			if stats == nil {
+				row += fmt.Sprintf("%5s", "")
+			} else {
+				row += fmt.Sprintf("%5d", stats.QueuePosition+1)
+			}
+		case "Labels":
+			row += fmt.Sprintf("%-20.20s", strings.Join(t.Labels, ","))
 		default:
 			panic(fmt.Sprintf("unsupported column %s", column))
 		}
@@ -538,6 +642,8 @@ func (c *Console) drawDetails(g *gocui.Gui) error {
 			v.Title = "Peers"
 		case webseeds:
 			v.Title = "WebSeeds"
+		case files:
+			v.Title = "Files"
 		}
 		if c.selectedID == "" {
 			return nil
@@ -584,6 +690,9 @@ func (c *Console) drawDetails(g *gocui.Gui) error {
 					nextAnnounce = t.NextAnnounce.Time.Format(time.RFC3339)
 				}
 				fmt.Fprintf(v, "    Last announce: %s, Next announce: %s\n", t.LastAnnounce.Time.Format(time.RFC3339), nextAnnounce)
+				if !t.LastScrape.IsZero() {
+					fmt.Fprintf(v, "    Last scrape: %s, Downloaded: %d\n", t.LastScrape.Time.Format(time.RFC3339), t.Downloaded)
+				}
 			}
 		case peers:
 			format := "%2s %21s %7s %8s %6s %s\n"
@@ -615,6 +724,13 @@ func (c *Console) drawDetails(g *gocui.Gui) error {
 				}
 				fmt.Fprintf(v, format, num, p.URL, dl, errstr)
 			}
+		case files:
+			format := "%3s %8s %10s %s\n"
+			fmt.Fprintf(v, format, "#", "Priority", "Size", "Path")
+			for i, f := range c.files {
+				num := fmt.Sprintf("%d", i+1)
+				fmt.Fprintf(v, format, num, f.Priority, formatSize(f.Length), f.Path)
+			}
 		}
 	}
 	return nil
@@ -656,7 +772,17 @@ func (c *Console) updateSessionStatsLoop(g *gocui.Gui, stop chan struct{}) {
 }
 
 func (c *Console) updateTorrents(g *gocui.Gui) {
-	rpcTorrents, err := c.client.ListTorrents()
+	c.m.Lock()
+	filter := c.labelFilter
+	c.m.Unlock()
+
+	var rpcTorrents []rpctypes.Torrent
+	var err error
+	if filter != "" {
+		rpcTorrents, err = c.client.ListTorrentsWithLabel(filter)
+	} else {
+		rpcTorrents, err = c.client.ListTorrents()
+	}
 
 	sort.Slice(rpcTorrents, func(i, j int) bool {
 		a, b := rpcTorrents[i], rpcTorrents[j]
@@ -768,6 +894,12 @@ func (c *Console) updateDetails(g *gocui.Gui) {
 		c.webseeds = webseeds
 		c.errDetails = err
 		c.m.Unlock()
+	case files:
+		files, err := c.client.GetTorrentFiles(selectedID)
+		c.m.Lock()
+		c.files = files
+		c.errDetails = err
+		c.m.Unlock()
 	}
 
 	c.m.Lock()
@@ -835,6 +967,38 @@ func (c *Console) addTorrentHandleEnter(g *gocui.Gui, v *gocui.View) error {
 	return nil
 }
 
+func (c *Console) seedLimitsHandleEnter(g *gocui.Gui, v *gocui.View) error {
+	handleError := func(err error) error {
+		v.Clear()
+		_ = v.SetCursor(0, 0)
+		fmt.Fprintln(v, "error:", err)
+		return nil
+	}
+	limits, err := parseSeedLimits(strings.Join(v.BufferLines(), " "))
+	if err != nil {
+		return handleError(err)
+	}
+	err = c.client.SetTorrentSeedLimits(c.seedLimitsID, limits)
+	if err != nil {
+		return handleError(err)
+	}
+	v.Clear()
+	c.selectedPage = torrents
+	c.triggerUpdateDetails(false)
+	return nil
+}
+
+func (c *Console) labelFilterHandleEnter(g *gocui.Gui, v *gocui.View) error {
+	filter := strings.TrimSpace(strings.Join(v.BufferLines(), ""))
+	v.Clear()
+	c.m.Lock()
+	c.labelFilter = filter
+	c.m.Unlock()
+	c.selectedPage = torrents
+	c.triggerUpdateTorrents()
+	return nil
+}
+
 func (c *Console) switchRow(v *gocui.View, row int) error {
 	switch {
 	case len(c.torrents) == 0:
@@ -929,11 +1093,19 @@ func (c *Console) goBottom(g *gocui.Gui, v *gocui.View) error {
 }
 
 func (c *Console) removeTorrent(g *gocui.Gui, v *gocui.View) error {
+	return c.removeTorrentWithOptions(nil)
+}
+
+func (c *Console) removeTorrentKeepData(g *gocui.Gui, v *gocui.View) error {
+	return c.removeTorrentWithOptions(&rainrpc.RemoveTorrentOptions{KeepData: true})
+}
+
+func (c *Console) removeTorrentWithOptions(opt *rainrpc.RemoveTorrentOptions) error {
 	c.m.Lock()
 	id := c.selectedID
 	c.m.Unlock()
 
-	err := c.client.RemoveTorrent(id)
+	err := c.client.RemoveTorrentWithOptions(id, opt)
 	if err != nil {
 		return err
 	}
@@ -975,6 +1147,53 @@ func (c *Console) stopTorrent(g *gocui.Gui, v *gocui.View) error {
 	return nil
 }
 
+func (c *Console) forceStartTorrent(g *gocui.Gui, v *gocui.View) error {
+	c.m.Lock()
+	id := c.selectedID
+	c.m.Unlock()
+
+	err := c.client.ForceStartTorrent(id)
+	if err != nil {
+		return err
+	}
+	c.triggerUpdateDetails(true)
+	return nil
+}
+
+func (c *Console) toggleAltSpeedLimits(g *gocui.Gui, v *gocui.View) error {
+	stats, err := c.client.GetSessionStats()
+	if err != nil {
+		return err
+	}
+	return c.client.SetAltSpeedLimits(!stats.AltSpeedLimits)
+}
+
+func (c *Console) moveUpInQueue(g *gocui.Gui, v *gocui.View) error {
+	c.m.Lock()
+	id := c.selectedID
+	c.m.Unlock()
+
+	err := c.client.MoveTorrentUpInQueue(id)
+	if err != nil {
+		return err
+	}
+	c.triggerUpdateTorrents()
+	return nil
+}
+
+func (c *Console) moveDownInQueue(g *gocui.Gui, v *gocui.View) error {
+	c.m.Lock()
+	id := c.selectedID
+	c.m.Unlock()
+
+	err := c.client.MoveTorrentDownInQueue(id)
+	if err != nil {
+		return err
+	}
+	c.triggerUpdateTorrents()
+	return nil
+}
+
 func (c *Console) announce(g *gocui.Gui, v *gocui.View) error {
 	c.m.Lock()
 	id := c.selectedID
@@ -1059,6 +1278,14 @@ func (c *Console) switchWebseeds(g *gocui.Gui, v *gocui.View) error {
 	return nil
 }
 
+func (c *Console) switchFiles(g *gocui.Gui, v *gocui.View) error {
+	c.m.Lock()
+	c.selectedTab = files
+	c.m.Unlock()
+	c.triggerUpdateDetails(true)
+	return nil
+}
+
 func (c *Console) switchHelp(g *gocui.Gui, v *gocui.View) error {
 	c.selectedPage = help
 	return nil
@@ -1074,6 +1301,32 @@ func (c *Console) switchAddTorrent(g *gocui.Gui, v *gocui.View) error {
 	return nil
 }
 
+func (c *Console) switchSeedLimits(g *gocui.Gui, v *gocui.View) error {
+	c.m.Lock()
+	id := c.selectedID
+	c.m.Unlock()
+	if id == "" {
+		return nil
+	}
+
+	stats, err := c.client.GetTorrentStats(id)
+	if err != nil {
+		return err
+	}
+	c.seedLimitsID = id
+	c.seedLimitsInput = ""
+	if stats.SeedGoals.Custom {
+		c.seedLimitsInput = formatSeedLimits(stats.SeedGoals.Limits)
+	}
+	c.selectedPage = seedLimits
+	return nil
+}
+
+func (c *Console) switchFilterLabel(g *gocui.Gui, v *gocui.View) error {
+	c.selectedPage = filterLabel
+	return nil
+}
+
 func (c *Console) triggerUpdateDetails(clear bool) {
 	if clear {
 		c.updatingDetails = true
@@ -1093,7 +1346,7 @@ func (c *Console) triggerUpdateTorrents() {
 
 func flags(p rpctypes.Peer) string {
 	var sb strings.Builder
-	sb.Grow(6)
+	sb.Grow(7)
 	if p.ClientInterested {
 		if p.PeerChoking {
 			sb.WriteString("d")
@@ -1139,6 +1392,8 @@ func flags(p rpctypes.Peer) string {
 		sb.WriteString("I")
 	case "MANUAL":
 		sb.WriteString("M")
+	case "LSD":
+		sb.WriteString("L")
 	default:
 		sb.WriteString(" ")
 	}
@@ -1150,6 +1405,11 @@ func flags(p rpctypes.Peer) string {
 	default:
 		sb.WriteString(" ")
 	}
+	if p.Transport == "UTP" {
+		sb.WriteString("P")
+	} else {
+		sb.WriteString(" ")
+	}
 	return sb.String()
 }
 
@@ -1162,7 +1422,12 @@ func getProgress(stats *rpctypes.Stats) int {
 		case "Allocating":
 			progress = int(stats.Bytes.Allocated * 100 / stats.Bytes.Total)
 		default:
-			progress = int(stats.Pieces.Have * 100 / stats.Pieces.Total)
+			// Pieces of skipped files are not counted.
+			if stats.Pieces.Wanted > 0 {
+				progress = int((stats.Pieces.Wanted - stats.Pieces.Missing) * 100 / stats.Pieces.Wanted)
+			} else {
+				progress = 100
+			}
 		}
 	}
 	return progress
@@ -1177,14 +1442,18 @@ func getRatio(stats *rpctypes.Stats) float64 {
 }
 
 func getSize(stats *rpctypes.Stats) string {
+	return formatSize(stats.Bytes.Total)
+}
+
+func formatSize(n int64) string {
 	var size string
 	switch {
-	case stats.Bytes.Total < 1<<10:
-		size = fmt.Sprintf("%d bytes", stats.Bytes.Total)
-	case stats.Bytes.Total < 1<<20:
-		size = fmt.Sprintf("%d KiB", stats.Bytes.Total/(1<<10))
+	case n < 1<<10:
+		size = fmt.Sprintf("%d bytes", n)
+	case n < 1<<20:
+		size = fmt.Sprintf("%d KiB", n/(1<<10))
 	default:
-		size = fmt.Sprintf("%d MiB", stats.Bytes.Total/(1<<20))
+		size = fmt.Sprintf("%d MiB", n/(1<<20))
 	}
 	return size
 }
@@ -1197,6 +1466,13 @@ func getUploadSpeed(stats *rpctypes.Stats) string {
 	return fmt.Sprintf("%d KiB/s", stats.Speed.Upload/1024)
 }
 
+func getSpeedLimit(limit int64) string {
+	if limit <= 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d KiB/s", limit)
+}
+
 func getETA(stats *rpctypes.Stats) string {
 	var eta string
 	if stats.ETA != -1 {
@@ -1213,14 +1489,109 @@ func FormatStats(stats *rpctypes.Stats, v io.Writer) {
 	if status == "Stopped" && stats.Error != "" {
 		status = status + ": " + stats.Error
 	}
+	if stats.ForceStarted {
+		status += " (forced)"
+	}
 	fmt.Fprintf(v, "Status: %s\n", status)
+	fmt.Fprintf(v, "Queue position: %d\n", stats.QueuePosition+1)
+	if len(stats.Labels) > 0 {
+		fmt.Fprintf(v, "Labels: %s\n", strings.Join(stats.Labels, ", "))
+	}
 	fmt.Fprintf(v, "Progress: %d%%\n", getProgress(stats))
+	if stats.Moving && stats.Bytes.Total > 0 {
+		fmt.Fprintf(v, "Moving files: %d%%\n", stats.Bytes.Moved*100/stats.Bytes.Total)
+	}
+	fmt.Fprintf(v, "Data dir: %s\n", stats.DataDir)
 	fmt.Fprintf(v, "Ratio: %.2f\n", getRatio(stats))
 	fmt.Fprintf(v, "Size: %s\n", getSize(stats))
 	fmt.Fprintf(v, "Peers: %d in / %d out\n", stats.Peers.Incoming, stats.Peers.Outgoing)
 	fmt.Fprintf(v, "Download speed: %11s\n", getDownloadSpeed(stats))
 	fmt.Fprintf(v, "Upload speed:   %11s\n", getUploadSpeed(stats))
+	fmt.Fprintf(v, "Speed limits: %s down / %s up\n", getSpeedLimit(stats.SpeedLimit.Download), getSpeedLimit(stats.SpeedLimit.Upload))
 	fmt.Fprintf(v, "ETA: %s\n", getETA(stats))
+	fmt.Fprintf(v, "Seed goals: %s\n", getSeedGoals(stats))
+}
+
+// getSeedGoals returns the progress of torrent towards its seeding limits.
+func getSeedGoals(stats *rpctypes.Stats) string {
+	g := stats.SeedGoals
+	var parts []string
+	if g.RatioRemaining != -1 {
+		parts = append(parts, fmt.Sprintf("ratio %.2f/%.2f (%s)", g.Ratio, g.Limits.Ratio, g.Limits.RatioAction))
+	}
+	if g.TimeRemaining != -1 {
+		remaining := time.Duration(g.TimeRemaining) * time.Second
+		parts = append(parts, fmt.Sprintf("time %s left (%s)", remaining, g.Limits.TimeAction))
+	}
+	if g.IdleRemaining != -1 {
+		remaining := time.Duration(g.IdleRemaining) * time.Second
+		parts = append(parts, fmt.Sprintf("idle %s left (%s)", remaining, g.Limits.IdleAction))
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "none")
+	}
+	if !g.Custom {
+		parts = append(parts, "[global]")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatSeedLimits returns the limits in the format accepted by parseSeedLimits.
+func formatSeedLimits(l rpctypes.SeedLimits) string {
+	var parts []string
+	if l.Ratio > 0 {
+		parts = append(parts, "ratio="+strconv.FormatFloat(l.Ratio, 'f', -1, 64)+":"+l.RatioAction)
+	}
+	if l.Time > 0 {
+		parts = append(parts, "time="+(time.Duration(l.Time)*time.Second).String()+":"+l.TimeAction)
+	}
+	if l.Idle > 0 {
+		parts = append(parts, "idle="+(time.Duration(l.Idle)*time.Second).String()+":"+l.IdleAction)
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseSeedLimits parses the limits written in "ratio=2:stop time=48h:remove idle=6h:stop" format.
+// Action of a limit is "stop" if not given. Empty string returns nil limits.
+func parseSeedLimits(s string) (*rpctypes.SeedLimits, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	var l rpctypes.SeedLimits
+	for _, f := range fields {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid limit: %q", f)
+		}
+		value, action := kv[1], "stop"
+		if i := strings.IndexByte(value, ':'); i != -1 {
+			value, action = value[:i], value[i+1:]
+		}
+		switch kv[0] {
+		case "ratio":
+			ratio, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, err
+			}
+			l.Ratio, l.RatioAction = ratio, action
+		case "time":
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, err
+			}
+			l.Time, l.TimeAction = uint(d/time.Second), action
+		case "idle":
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, err
+			}
+			l.Idle, l.IdleAction = uint(d/time.Second), action
+		default:
+			return nil, fmt.Errorf("unknown limit: %q", kv[0])
+		}
+	}
+	return &l, nil
 }
 
 // FormatSessionStats returns the human readable representation of session stats object.
@@ -1232,4 +1603,12 @@ func FormatSessionStats(s *rpctypes.SessionStats, v io.Writer) {
 	fmt.Fprintf(v, "ReadCache Objects: %d, Size: %dMB, Utilization: %d%%\n", s.ReadCacheObjects, s.ReadCacheSize/(1<<20), s.ReadCacheUtilization)
 	fmt.Fprintf(v, "WriteCache Objects: %d, Size: %dMB, PendingKeys: %d\n", s.WriteCacheObjects, s.WriteCacheSize/(1<<20), s.WriteCachePendingKeys)
 	fmt.Fprintf(v, "DownloadSpeed: %dKB/s, UploadSpeed: %dKB/s\n", s.SpeedDownload/1024, s.SpeedUpload/1024)
+	profile := "normal"
+	if s.AltSpeedLimits {
+		profile = "alternative"
+	}
+	fmt.Fprintf(v, "SpeedLimits: %s down / %s up (%s)\n", getSpeedLimit(s.SpeedLimitDownload), getSpeedLimit(s.SpeedLimitUpload), profile)
+	if s.WatchDirErrors > 0 {
+		fmt.Fprintf(v, "WatchDir Errors: %d, Last: %s\n", s.WatchDirErrors, s.WatchDirLastError)
+	}
 }
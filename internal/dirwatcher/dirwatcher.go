@@ -0,0 +1,23 @@
+// Package dirwatcher provides notifications about the files that are written or moved into a directory.
+// Notifications are only available on Linux. New returns ErrNotSupported on other platforms, callers should fall back to polling.
+package dirwatcher
+
+import "errors"
+
+// ErrNotSupported is returned from New if file system notifications are not available on the platform.
+var ErrNotSupported = errors.New("file system notifications are not supported")
+
+// Watcher sends the names of the files in a directory when they are closed after writing or moved into the directory.
+type Watcher struct {
+	// Names of the changed files, relative to the directory.
+	// Empty name means that some notifications are dropped, the directory needs to be scanned.
+	// Closed when the Watcher is closed or an error occurs while reading notifications.
+	C <-chan string
+
+	closer interface{ Close() error }
+}
+
+// Close stops watching the directory.
+func (w *Watcher) Close() error {
+	return w.closer.Close()
+}
@@ -0,0 +1,61 @@
+package dirwatcher
+
+import (
+	"bytes"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// New starts watching the directory with inotify.
+func New(dir string) (*Watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	_, err = unix.InotifyAddWatch(fd, dir, unix.IN_CLOSE_WRITE|unix.IN_MOVED_TO)
+	if err != nil {
+		unix.Close(fd)
+		return nil, os.NewSyscallError("inotify_add_watch", err)
+	}
+	// File is non-blocking, reads are handled by the runtime poller and Close unblocks the pending Read.
+	f := os.NewFile(uintptr(fd), "inotify")
+	c := make(chan string, 100)
+	go readEvents(f, c)
+	return &Watcher{C: c, closer: f}, nil
+}
+
+func readEvents(f *os.File, c chan string) {
+	defer close(c)
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			return
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+unix.SizeofInotifyEvent : offset+unix.SizeofInotifyEvent+int(event.Len)]
+			offset += unix.SizeofInotifyEvent + int(event.Len)
+			var name string
+			switch {
+			case event.Mask&unix.IN_Q_OVERFLOW != 0:
+				name = ""
+			case event.Mask&unix.IN_ISDIR != 0 || event.Len == 0:
+				continue
+			default:
+				name = string(bytes.TrimRight(nameBytes, "\x00"))
+			}
+			select {
+			case c <- name:
+			default:
+				// Receiver is slow, ask for a scan instead of blocking the reader.
+				select {
+				case c <- "":
+				default:
+				}
+			}
+		}
+	}
+}
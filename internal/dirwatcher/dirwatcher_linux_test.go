@@ -0,0 +1,54 @@
+package dirwatcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	w, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	err = os.WriteFile(filepath.Join(dir, "written"), []byte("foo"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp := filepath.Join(t.TempDir(), "moved")
+	err = os.WriteFile(tmp, []byte("bar"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Rename(tmp, filepath.Join(dir, "moved"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"written", "moved"} {
+		select {
+		case name := <-w.C:
+			if name != expected {
+				t.Fatalf("expected %q, got %q", expected, name)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case _, ok := <-w.C:
+		if ok {
+			t.Fatal("channel must be closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package dirwatcher
+
+// New returns ErrNotSupported because file system notifications are only implemented for Linux.
+func New(dir string) (*Watcher, error) {
+	return nil, ErrNotSupported
+}
@@ -6,7 +6,7 @@ import (
 	"github.com/cenkalti/log"
 )
 
-var ips []net.IP
+var ips, ips6 []net.IP
 
 func init() {
 	addrs, err := net.InterfaceAddrs()
@@ -21,6 +21,9 @@ func init() {
 		}
 		i4 := in.IP.To4()
 		if i4 == nil {
+			if isPublicIPv6(in.IP) {
+				ips6 = append(ips6, in.IP)
+			}
 			continue
 		}
 		if !isPublicIP(i4) {
@@ -46,6 +49,14 @@ func isPublicIP(ip4 net.IP) bool {
 	}
 }
 
+func isPublicIPv6(ip6 net.IP) bool {
+	if !ip6.IsGlobalUnicast() {
+		return false
+	}
+	// Unique local addresses (fc00::/7) are not routable on the internet.
+	return ip6[0]&0xfe != 0xfc
+}
+
 // IsExternal returns true if the given IP matches one of the IP address of the external network interfaces on the server.
 func IsExternal(ip net.IP) bool {
 	for i := range ips {
@@ -53,13 +64,26 @@ func IsExternal(ip net.IP) bool {
 			return true
 		}
 	}
+	for i := range ips6 {
+		if ip.Equal(ips6[i]) {
+			return true
+		}
+	}
 	return false
 }
 
-// FirstExternalIP returns the first external IP of the network interfaces on the server.
+// FirstExternalIP returns the first external IPv4 address of the network interfaces on the server.
 func FirstExternalIP() net.IP {
 	if len(ips) == 0 {
 		return nil
 	}
 	return ips[0]
 }
+
+// FirstExternalIP6 returns the first external IPv6 address of the network interfaces on the server.
+func FirstExternalIP6() net.IP {
+	if len(ips6) == 0 {
+		return nil
+	}
+	return ips6[0]
+}
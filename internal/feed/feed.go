@@ -0,0 +1,96 @@
+// Package feed parses RSS and Atom feeds for finding the links of torrents.
+package feed
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Item is an entry in a feed that links to a torrent.
+type Item struct {
+	// Unique identifier of the item. Link of the torrent is used if the feed does not provide one.
+	ID    string
+	Title string
+	// Magnet link or HTTP URL of the torrent.
+	URL string
+}
+
+type document struct {
+	XMLName xml.Name
+	Items   []rssItem   `xml:"channel>item"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	Title     string `xml:"title"`
+	Link      string `xml:"link"`
+	GUID      string `xml:"guid"`
+	Enclosure struct {
+		URL string `xml:"url,attr"`
+	} `xml:"enclosure"`
+	MagnetURI string `xml:"magnetURI"`
+}
+
+type atomEntry struct {
+	Title string `xml:"title"`
+	ID    string `xml:"id"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"link"`
+}
+
+// Parse reads an RSS 2.0 or Atom feed from r. Items without a link are skipped.
+func Parse(r io.Reader) ([]Item, error) {
+	var doc document
+	err := xml.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	var items []Item
+	switch doc.XMLName.Local {
+	case "rss":
+		for _, i := range doc.Items {
+			items = appendItem(items, i.GUID, i.Title, i.MagnetURI, i.Enclosure.URL, i.Link)
+		}
+	case "feed":
+		for _, e := range doc.Entries {
+			var enclosure, link string
+			for _, l := range e.Links {
+				switch {
+				case l.Type == "application/x-bittorrent" || l.Rel == "enclosure":
+					enclosure = l.Href
+				case link == "" && (l.Rel == "" || l.Rel == "alternate"):
+					link = l.Href
+				}
+			}
+			items = appendItem(items, e.ID, e.Title, enclosure, link)
+		}
+	default:
+		return nil, errors.New("unknown feed format: " + doc.XMLName.Local)
+	}
+	return items, nil
+}
+
+// appendItem appends a new item with the first non-empty link in links.
+func appendItem(items []Item, id, title string, links ...string) []Item {
+	var url string
+	for _, l := range links {
+		l = strings.TrimSpace(l)
+		if l != "" {
+			url = l
+			break
+		}
+	}
+	if url == "" {
+		return items
+	}
+	id = strings.TrimSpace(id)
+	if id == "" {
+		id = url
+	}
+	return append(items, Item{ID: id, Title: strings.TrimSpace(title), URL: url})
+}
@@ -0,0 +1,77 @@
+package feed
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRSS(t *testing.T) {
+	const s = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:torrent="http://xmlns.ezrss.it/0.1/">
+<channel>
+	<title>Releases</title>
+	<item>
+		<title>Show S01E01</title>
+		<link>http://example.com/details/1</link>
+		<guid>1</guid>
+		<enclosure url="http://example.com/1.torrent" type="application/x-bittorrent" length="1000"/>
+	</item>
+	<item>
+		<title> Show S01E02 </title>
+		<torrent:magnetURI>magnet:?xt=urn:btih:2</torrent:magnetURI>
+		<link>http://example.com/details/2</link>
+	</item>
+	<item>
+		<title>Show S01E03</title>
+		<link>magnet:?xt=urn:btih:3</link>
+	</item>
+	<item>
+		<title>No link</title>
+	</item>
+</channel>
+</rss>`
+	items, err := Parse(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []Item{
+		{ID: "1", Title: "Show S01E01", URL: "http://example.com/1.torrent"},
+		{ID: "magnet:?xt=urn:btih:2", Title: "Show S01E02", URL: "magnet:?xt=urn:btih:2"},
+		{ID: "magnet:?xt=urn:btih:3", Title: "Show S01E03", URL: "magnet:?xt=urn:btih:3"},
+	}, items)
+}
+
+func TestParseAtom(t *testing.T) {
+	const s = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+	<title>Releases</title>
+	<entry>
+		<title>Movie</title>
+		<id>urn:uuid:1</id>
+		<link href="http://example.com/details/1"/>
+		<link rel="enclosure" type="application/x-bittorrent" href="http://example.com/1.torrent"/>
+	</entry>
+	<entry>
+		<title>Other movie</title>
+		<id>urn:uuid:2</id>
+		<link rel="alternate" href="magnet:?xt=urn:btih:2"/>
+	</entry>
+</feed>`
+	items, err := Parse(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []Item{
+		{ID: "urn:uuid:1", Title: "Movie", URL: "http://example.com/1.torrent"},
+		{ID: "urn:uuid:2", Title: "Other movie", URL: "magnet:?xt=urn:btih:2"},
+	}, items)
+}
+
+func TestParseUnknown(t *testing.T) {
+	_, err := Parse(strings.NewReader("<html></html>"))
+	if err == nil {
+		t.Fatal("error expected")
+	}
+}
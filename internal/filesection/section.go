@@ -7,7 +7,7 @@ type FileSection struct {
 	File   ReadWriterAt
 	Offset int64
 	Length int64
-	Name   string
+	Name   string // empty for padding between files
 }
 
 // ReadWriterAt combines the io.ReaderAt and io.WriterAt interfaces.
@@ -13,6 +13,7 @@ import (
 // IncomingHandshaker does the BitTorrent protocol handshake on an incoming connection.
 type IncomingHandshaker struct {
 	Conn       net.Conn
+	InfoHash   [20]byte
 	PeerID     [20]byte
 	Extensions [8]byte
 	Cipher     mse.CryptoMethod
@@ -38,7 +39,7 @@ func (h *IncomingHandshaker) Close() {
 }
 
 // Run the handshaker goroutine.
-func (h *IncomingHandshaker) Run(peerID [20]byte, getSKeyFunc func([20]byte) []byte, checkInfoHashFunc func([20]byte) bool, resultC chan *IncomingHandshaker, timeout time.Duration, ourExtensions [8]byte, forceIncomingEncryption bool) {
+func (h *IncomingHandshaker) Run(getPeerIDFunc func([20]byte) ([20]byte, bool), getSKeyFunc func([20]byte) []byte, resultC chan *IncomingHandshaker, timeout time.Duration, ourExtensions [8]byte, forceIncomingEncryption bool) {
 	defer close(h.doneC)
 	defer func() {
 		select {
@@ -50,8 +51,8 @@ func (h *IncomingHandshaker) Run(peerID [20]byte, getSKeyFunc func([20]byte) []b
 
 	log := logger.New("conn <- " + h.Conn.RemoteAddr().String())
 
-	conn, cipher, peerExtensions, peerID, _, err := btconn.Accept(
-		h.Conn, timeout, getSKeyFunc, forceIncomingEncryption, checkInfoHashFunc, ourExtensions, peerID)
+	conn, cipher, peerExtensions, peerID, infoHash, err := btconn.Accept(
+		h.Conn, timeout, getSKeyFunc, forceIncomingEncryption, getPeerIDFunc, ourExtensions)
 	if err != nil {
 		if err == io.EOF {
 			log.Debug("peer has closed the connection: EOF")
@@ -70,6 +71,7 @@ func (h *IncomingHandshaker) Run(peerID [20]byte, getSKeyFunc func([20]byte) []b
 	log.Debugf("Connection accepted. (cipher=%s extensions=%x client=%q)", cipher, peerExtensions, peerID[:8])
 
 	h.Conn = conn
+	h.InfoHash = infoHash
 	h.PeerID = peerID
 	h.Extensions = peerExtensions
 	h.Cipher = cipher
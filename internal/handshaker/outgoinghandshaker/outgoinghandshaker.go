@@ -42,11 +42,32 @@ func (h *OutgoingHandshaker) Close() {
 }
 
 // Run the handshaker.
-func (h *OutgoingHandshaker) Run(dialTimeout, handshakeTimeout time.Duration, peerID, infoHash [20]byte, resultC chan *OutgoingHandshaker, ourExtensions [8]byte, disableOutgoingEncryption, forceOutgoingEncryption bool) {
+// If utpDialer is not nil, uTP connection is tried first and TCP is used if it fails.
+func (h *OutgoingHandshaker) Run(dialTimeout, handshakeTimeout time.Duration, peerID, infoHash [20]byte, resultC chan *OutgoingHandshaker, ourExtensions [8]byte, disableOutgoingEncryption, forceOutgoingEncryption bool, utpDialer btconn.Dialer) {
 	defer close(h.doneC)
 	log := logger.New("peer -> " + h.Addr.String())
 
-	conn, cipher, peerExtensions, peerID, err := btconn.Dial(h.Addr, dialTimeout, handshakeTimeout, !disableOutgoingEncryption, forceOutgoingEncryption, ourExtensions, infoHash, peerID, h.closeC)
+	dial := func(dialer btconn.Dialer) (net.Conn, mse.CryptoMethod, [8]byte, [20]byte, error) {
+		return btconn.Dial(h.Addr, dialer, dialTimeout, handshakeTimeout, !disableOutgoingEncryption, forceOutgoingEncryption, ourExtensions, infoHash, peerID, h.closeC)
+	}
+	var conn net.Conn
+	var cipher mse.CryptoMethod
+	var peerExtensions [8]byte
+	var err error
+	if utpDialer != nil {
+		conn, cipher, peerExtensions, peerID, err = dial(utpDialer)
+		if err != nil {
+			select {
+			case <-h.closeC:
+				return
+			default:
+			}
+			log.Debugln("cannot connect with uTP, trying TCP:", err)
+		}
+	}
+	if conn == nil {
+		conn, cipher, peerExtensions, peerID, err = dial(nil)
+	}
 	if err != nil {
 		if err == io.EOF {
 			log.Debug("peer has closed the connection: EOF")
@@ -66,7 +87,7 @@ func (h *OutgoingHandshaker) Run(dialTimeout, handshakeTimeout time.Duration, pe
 		}
 		return
 	}
-	log.Debugf("Connected to peer. (cipher=%s extensions=%x client=%q)", cipher, peerExtensions, peerID[:8])
+	log.Debugf("Connected to peer. (transport=%s cipher=%s extensions=%x client=%q)", btconn.Transport(conn), cipher, peerExtensions, peerID[:8])
 
 	h.Conn = conn
 	h.PeerID = peerID
@@ -0,0 +1,286 @@
+// Package lsd implements Local Service Discovery as specified in BEP 14.
+// Torrents are announced to multicast groups on the local network and peers announcing the same torrents are discovered.
+package lsd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/rain/internal/logger"
+)
+
+const (
+	// Multicast groups in BEP 14.
+	multicastAddr4 = "239.192.152.143:6771"
+	multicastAddr6 = "[ff15::efc0:988f]:6771"
+
+	// Each torrent is announced again after this duration.
+	announceInterval = 5 * time.Minute
+	// Period of checking the torrents that need to be announced.
+	tickInterval = time.Second
+	// Limits the size of announce message below the typical MTU.
+	maxInfoHashesPerMessage = 20
+	// Maximum size of the UDP packets read from the socket.
+	readBufferSize = 1500
+)
+
+// Peer is a peer found on the local network.
+type Peer struct {
+	InfoHash [20]byte
+	Addr     *net.TCPAddr
+}
+
+type registration struct {
+	infoHash [20]byte
+	port     int
+}
+
+type multicastConn struct {
+	// Joined to multicast group for receiving announces.
+	conn *net.UDPConn
+	// Announces are sent from a separate socket because multicast loopback is disabled on conn.
+	// Other clients on the same host would not receive our announces otherwise.
+	sendConn *net.UDPConn
+	group    *net.UDPAddr
+}
+
+// LSD announces torrents to the local network and listens for the announces of other peers.
+type LSD struct {
+	// Peers found on the local network are sent to this channel.
+	// Announces are dropped if the channel is not read fast enough.
+	PeersC chan Peer
+
+	conns  []multicastConn
+	cookie string
+	log    logger.Logger
+
+	// Registered torrents and their next announce times.
+	torrents map[registration]time.Time
+	m        sync.Mutex
+
+	closeC chan struct{}
+	wg     sync.WaitGroup
+}
+
+// New returns a new LSD listening on IPv4 and IPv6 multicast groups.
+// An error is returned only if none of the groups can be joined.
+func New() (*LSD, error) {
+	return newLSD(multicastAddr4, multicastAddr6)
+}
+
+func newLSD(addrs ...string) (*LSD, error) {
+	cookie := make([]byte, 8)
+	_, err := rand.Read(cookie)
+	if err != nil {
+		return nil, err
+	}
+	d := &LSD{
+		PeersC:   make(chan Peer, 100),
+		cookie:   hex.EncodeToString(cookie),
+		log:      logger.New("lsd"),
+		torrents: make(map[registration]time.Time),
+		closeC:   make(chan struct{}),
+	}
+	for _, addr := range addrs {
+		mc, err := listen(addr)
+		if err != nil {
+			d.log.Debugf("cannot join multicast group %s: %s", addr, err)
+			continue
+		}
+		d.conns = append(d.conns, mc)
+	}
+	if len(d.conns) == 0 {
+		return nil, errors.New("cannot join any of the LSD multicast groups")
+	}
+	for _, mc := range d.conns {
+		d.wg.Add(1)
+		go d.readLoop(mc.conn)
+	}
+	d.wg.Add(1)
+	go d.announceLoop()
+	return d, nil
+}
+
+func listen(addr string) (mc multicastConn, err error) {
+	mc.group, err = net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return
+	}
+	network := "udp4"
+	if mc.group.IP.To4() == nil {
+		network = "udp6"
+	}
+	mc.conn, err = net.ListenMulticastUDP(network, nil, mc.group)
+	if err != nil {
+		return
+	}
+	mc.sendConn, err = net.ListenUDP(network, nil)
+	if err != nil {
+		mc.conn.Close()
+	}
+	return
+}
+
+// Close stops announcing and listening.
+func (d *LSD) Close() {
+	close(d.closeC)
+	for _, mc := range d.conns {
+		mc.conn.Close()
+		mc.sendConn.Close()
+	}
+	d.wg.Wait()
+}
+
+// Register the torrent for announcing to the local network periodically.
+// Torrent is announced in a second after registration.
+func (d *LSD) Register(infoHash [20]byte, port int) {
+	d.m.Lock()
+	d.torrents[registration{infoHash, port}] = time.Time{}
+	d.m.Unlock()
+}
+
+// Unregister the torrent. Torrent is not announced anymore.
+func (d *LSD) Unregister(infoHash [20]byte, port int) {
+	d.m.Lock()
+	delete(d.torrents, registration{infoHash, port})
+	d.m.Unlock()
+}
+
+func (d *LSD) announceLoop() {
+	defer d.wg.Done()
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			d.announce(now)
+		case <-d.closeC:
+			return
+		}
+	}
+}
+
+// announce sends the messages for torrents that are due.
+// Torrents on the same port are grouped into a single message.
+func (d *LSD) announce(now time.Time) {
+	byPort := make(map[int][][20]byte)
+	d.m.Lock()
+	for r, next := range d.torrents {
+		if now.Before(next) {
+			continue
+		}
+		byPort[r.port] = append(byPort[r.port], r.infoHash)
+		d.torrents[r] = now.Add(announceInterval)
+	}
+	d.m.Unlock()
+	for port, infoHashes := range byPort {
+		for len(infoHashes) > 0 {
+			n := len(infoHashes)
+			if n > maxInfoHashesPerMessage {
+				n = maxInfoHashesPerMessage
+			}
+			for _, mc := range d.conns {
+				msg := newMessage(mc.group.String(), port, infoHashes[:n], d.cookie)
+				_, err := mc.sendConn.WriteToUDP(msg, mc.group)
+				if err != nil {
+					d.log.Debugf("cannot send announce to %s: %s", mc.group, err)
+				}
+			}
+			infoHashes = infoHashes[n:]
+		}
+	}
+}
+
+func (d *LSD) readLoop(conn *net.UDPConn) {
+	defer d.wg.Done()
+	buf := make([]byte, readBufferSize)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-d.closeC:
+				return
+			default:
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			d.log.Debugln("cannot read from multicast socket:", err)
+			continue
+		}
+		port, infoHashes, cookie, err := parseMessage(buf[:n])
+		if err != nil {
+			d.log.Debugf("invalid announce from %s: %s", addr, err)
+			continue
+		}
+		if cookie == d.cookie {
+			// Our own announce is looped back.
+			continue
+		}
+		for _, ih := range infoHashes {
+			select {
+			case d.PeersC <- Peer{InfoHash: ih, Addr: &net.TCPAddr{IP: addr.IP, Port: port, Zone: addr.Zone}}:
+			default:
+			}
+		}
+	}
+}
+
+func newMessage(host string, port int, infoHashes [][20]byte, cookie string) []byte {
+	var b bytes.Buffer
+	b.WriteString("BT-SEARCH * HTTP/1.1\r\n")
+	b.WriteString("Host: " + host + "\r\n")
+	b.WriteString("Port: " + strconv.Itoa(port) + "\r\n")
+	for _, ih := range infoHashes {
+		b.WriteString("Infohash: " + hex.EncodeToString(ih[:]) + "\r\n")
+	}
+	b.WriteString("cookie: " + cookie + "\r\n")
+	b.WriteString("\r\n\r\n")
+	return b.Bytes()
+}
+
+func parseMessage(b []byte) (port int, infoHashes [][20]byte, cookie string, err error) {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(b)))
+	if err != nil {
+		return
+	}
+	if req.Method != "BT-SEARCH" {
+		err = errors.New("invalid method: " + req.Method)
+		return
+	}
+	port, err = strconv.Atoi(req.Header.Get("Port"))
+	if err != nil {
+		return
+	}
+	if port <= 0 || port > 65535 {
+		err = errors.New("invalid port: " + strconv.Itoa(port))
+		return
+	}
+	for _, s := range req.Header.Values("Infohash") {
+		var ih [20]byte
+		s = strings.TrimSpace(s)
+		if hex.DecodedLen(len(s)) != len(ih) {
+			err = errors.New("invalid infohash: " + s)
+			return
+		}
+		if _, err = hex.Decode(ih[:], []byte(s)); err != nil {
+			return
+		}
+		infoHashes = append(infoHashes, ih)
+	}
+	if len(infoHashes) == 0 {
+		err = errors.New("no infohash in message")
+		return
+	}
+	cookie = req.Header.Get("Cookie")
+	return
+}
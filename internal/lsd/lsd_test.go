@@ -0,0 +1,62 @@
+package lsd
+
+import (
+	"testing"
+	"time"
+)
+
+// Use a different port than the default in tests so they don't interfere with other clients on the network.
+const testAddr = "239.192.152.143:16771"
+
+func TestAnnounce(t *testing.T) {
+	d1, err := newLSD(testAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d1.Close()
+	d2, err := newLSD(testAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d2.Close()
+
+	d1.Register([20]byte{1}, 1111)
+	select {
+	case p := <-d2.PeersC:
+		if p.InfoHash != [20]byte{1} {
+			t.Fatalf("invalid infohash: %x", p.InfoHash)
+		}
+		if p.Addr.Port != 1111 {
+			t.Fatalf("invalid port: %d", p.Addr.Port)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("announce is not received")
+	}
+	// Own announces are ignored.
+	select {
+	case p := <-d1.PeersC:
+		t.Fatalf("unexpected peer: %v", p)
+	default:
+	}
+}
+
+func TestMessage(t *testing.T) {
+	infoHashes := [][20]byte{{1}, {2}}
+	msg := newMessage(testAddr, 1234, infoHashes, "foo")
+	port, ihs, cookie, err := parseMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port != 1234 {
+		t.Fatal(port)
+	}
+	if len(ihs) != 2 || ihs[0] != infoHashes[0] || ihs[1] != infoHashes[1] {
+		t.Fatal(ihs)
+	}
+	if cookie != "foo" {
+		t.Fatal(cookie)
+	}
+	if _, _, _, err = parseMessage([]byte("BT-SEARCH * HTTP/1.1\r\nPort: 1234\r\n\r\n")); err == nil {
+		t.Fatal("message without infohash must be rejected")
+	}
+}
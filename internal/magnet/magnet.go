@@ -15,7 +15,12 @@ import (
 
 // Magnet link contains the information to download torrent metadata from network.
 type Magnet struct {
+	// InfoHash is the truncated InfoHashV2 if the magnet has only v2 info hash.
 	InfoHash [20]byte
+	// SHA-256 hash of the info dictionary of v2 and hybrid torrents. Zero if the magnet has only v1 info hash.
+	InfoHashV2 [32]byte
+	// HasV1 is true if the magnet contains v1 info hash.
+	HasV1    bool
 	Name     string
 	Trackers [][]string
 	Peers    []string
@@ -41,12 +46,26 @@ func New(s string) (*Magnet, error) {
 	if len(xts) == 0 {
 		return nil, errors.New("empty xt param")
 	}
-	xt := xts[0]
 
 	var magnet Magnet
-	magnet.InfoHash, err = infoHashString(xt)
-	if err != nil {
-		return nil, err
+	var hasV2 bool
+	// Hybrid torrents have both v1 and v2 info hashes in separate xt params.
+	for _, xt := range xts {
+		ih, err := infoHashString(xt)
+		if err != nil {
+			return nil, err
+		}
+		switch len(ih) {
+		case 20:
+			copy(magnet.InfoHash[:], ih)
+			magnet.HasV1 = true
+		case 32:
+			copy(magnet.InfoHashV2[:], ih)
+			hasV2 = true
+		}
+	}
+	if !magnet.HasV1 && hasV2 {
+		copy(magnet.InfoHash[:], magnet.InfoHashV2[:])
 	}
 
 	names := params["dn"]
@@ -83,8 +102,18 @@ func New(s string) (*Magnet, error) {
 func (m *Magnet) String() string {
 	var b strings.Builder
 	b.Grow(2048)
-	b.WriteString("magnet:?xt=urn:btih:")
-	b.WriteString(hex.EncodeToString(m.InfoHash[:]))
+	b.WriteString("magnet:?")
+	if m.HasV1 {
+		b.WriteString("xt=urn:btih:")
+		b.WriteString(hex.EncodeToString(m.InfoHash[:]))
+	}
+	if m.InfoHashV2 != [32]byte{} {
+		if m.HasV1 {
+			b.WriteString("&")
+		}
+		b.WriteString("xt=urn:btmh:1220")
+		b.WriteString(hex.EncodeToString(m.InfoHashV2[:]))
+	}
 	if m.Name != "" {
 		b.WriteString("&dn=")
 		b.WriteString(url.QueryEscape(m.Name))
@@ -115,9 +144,10 @@ type trackerTier struct {
 }
 
 // infoHashString returns a new info hash value from a string.
-// s must be 40 (hex encoded) or 32 (base32 encoded) characters, otherwise it returns error.
-func infoHashString(xt string) ([20]byte, error) {
-	var ih [20]byte
+// For "urn:btih:", s must be 40 (hex encoded) or 32 (base32 encoded) characters.
+// For "urn:btmh:", s must be a hex encoded SHA-1 or SHA-256 multihash.
+// Returned hash is 20 bytes for v1 and 32 bytes for v2 info hashes.
+func infoHashString(xt string) ([]byte, error) {
 	var b []byte
 	var err error
 	switch {
@@ -129,23 +159,30 @@ func infoHashString(xt string) ([20]byte, error) {
 		case 32:
 			b, err = base32.StdEncoding.DecodeString(xt)
 		default:
-			return ih, errors.New("info hash must be 32 or 40 characters")
+			return nil, errors.New("info hash must be 32 or 40 characters")
 		}
 		if err != nil {
-			return ih, err
+			return nil, err
 		}
 	case strings.HasPrefix(xt, "urn:btmh:"):
 		xt = xt[9:]
-		b, err = multihash.FromHexString(xt)
+		mh, err := multihash.FromHexString(xt)
 		if err != nil {
-			return ih, err
+			return nil, err
 		}
-		if len(b) != 20 {
-			return ih, errors.New("invalid multihash (len != 20)")
+		dmh, err := multihash.Decode(mh)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case dmh.Code == multihash.SHA1 && len(dmh.Digest) == 20:
+		case dmh.Code == multihash.SHA2_256 && len(dmh.Digest) == 32:
+		default:
+			return nil, errors.New("invalid multihash: must be SHA-1 or SHA-256")
 		}
+		b = dmh.Digest
 	default:
-		return ih, errors.New("invalid xt param: must start with \"urn:btih:\" or \"urn:btmh\"")
+		return nil, errors.New("invalid xt param: must start with \"urn:btih:\" or \"urn:btmh\"")
 	}
-	copy(ih[:], b)
-	return ih, nil
+	return b, nil
 }
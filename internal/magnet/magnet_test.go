@@ -31,3 +31,34 @@ func TestParse(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestParseV2(t *testing.T) {
+	const v1 = "631a31dd0a46257d5078c0dee4e66e26f73e42ac"
+	const v2 = "d8dd32ac93357c368556af3ac1d95c9d76bd0dff6fa9833ecdac3d53134efabb"
+	u := "magnet:?xt=urn:btih:" + v1 + "&xt=urn:btmh:1220" + v2 + "&dn=bittorrent-v1-v2-hybrid-test"
+	m, err := New(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.HasV1 || hex.EncodeToString(m.InfoHash[:]) != v1 {
+		t.Fatal("invalid v1 info hash")
+	}
+	if hex.EncodeToString(m.InfoHashV2[:]) != v2 {
+		t.Fatal("invalid v2 info hash")
+	}
+	if s := m.String(); s != u {
+		t.Fatalf("invalid string: %s", s)
+	}
+
+	u = "magnet:?xt=urn:btmh:1220" + v2
+	m, err = New(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.HasV1 || hex.EncodeToString(m.InfoHash[:]) != v2[:40] {
+		t.Fatal("info hash must be truncated v2 hash")
+	}
+	if s := m.String(); s != u {
+		t.Fatalf("invalid string: %s", s)
+	}
+}
@@ -0,0 +1,147 @@
+// Package merkle implements the SHA-256 merkle trees used in BitTorrent v2 (BEP 52).
+package merkle
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/bits"
+)
+
+// BlockSize is the size of data that is hashed to make a leaf of the tree.
+const BlockSize = 16 << 10
+
+// HashSize is the size of a node in the tree.
+const HashSize = sha256.Size
+
+var errInvalidProof = errors.New("invalid merkle proof")
+
+// NumLeaves returns the number of leaves in a tree for data of length n.
+func NumLeaves(n int64) int {
+	return int((n + BlockSize - 1) / BlockSize)
+}
+
+// NextPowerOfTwo returns the smallest power of two that is greater than or equal to n.
+func NextPowerOfTwo(n int) int {
+	if n <= 1 {
+		return 1
+	}
+	return 1 << bits.Len(uint(n-1))
+}
+
+// Log2 returns the base 2 logarithm of n. n must be a power of two.
+func Log2(n int) int {
+	return bits.TrailingZeros(uint(n))
+}
+
+// PadHash returns the hash of a subtree that has numLeaves leaves which are all zero.
+// It is used for padding the upper layers of the tree.
+func PadHash(numLeaves int) []byte {
+	h := make([]byte, HashSize)
+	for ; numLeaves > 1; numLeaves /= 2 {
+		h = hashPair(h, h)
+	}
+	return h
+}
+
+// Root returns the merkle root of data.
+// Data is split into blocks, and the leaves after the last block are padded with zeros until there are numLeaves leaves.
+func Root(data []byte, numLeaves int) []byte {
+	hashes := make([]byte, 0, NumLeaves(int64(len(data)))*HashSize)
+	for len(data) > 0 {
+		n := BlockSize
+		if len(data) < n {
+			n = len(data)
+		}
+		sum := sha256.Sum256(data[:n])
+		hashes = append(hashes, sum[:]...)
+		data = data[n:]
+	}
+	return RootOfLayer(hashes, numLeaves, make([]byte, HashSize))
+}
+
+// RootOfLayer returns the merkle root of the tree that has the hashes in its bottom layer.
+// Hashes are concatenated in a single slice.
+// The layer is padded with pad until there are width hashes. width must be a power of two.
+func RootOfLayer(hashes []byte, width int, pad []byte) []byte {
+	layer := hashes
+	for ; width > 1; width /= 2 {
+		next := make([]byte, 0, (len(layer)/HashSize+1)/2*HashSize)
+		for i := 0; i < len(layer); i += 2 * HashSize {
+			left := layer[i : i+HashSize]
+			right := pad
+			if i+HashSize < len(layer) {
+				right = layer[i+HashSize : i+2*HashSize]
+			}
+			next = append(next, hashPair(left, right)...)
+		}
+		if len(next) == 0 {
+			next = hashPair(pad, pad)
+		}
+		layer = next
+		pad = hashPair(pad, pad)
+	}
+	if len(layer) == 0 {
+		return pad
+	}
+	return layer[:HashSize]
+}
+
+// Proof returns the uncle hashes for verifying the subtree with length hashes starting at index in layer.
+// The layer is padded with pad until there are width hashes.
+// At most numLayers hashes are returned, starting from the one closest to the subtree.
+func Proof(layer []byte, width int, pad []byte, index, length, numLayers int) [][]byte {
+	var proof [][]byte
+	for ; length < width && len(proof) < numLayers; length *= 2 {
+		sibling := index ^ length
+		proof = append(proof, subtreeRoot(layer, pad, sibling, length))
+		index &^= length
+	}
+	return proof
+}
+
+// Verify checks that the hashes in the bottom layer of a subtree starting at index belong to the tree with root.
+// The number of hashes must be a power of two.
+// Proof must contain all the uncle hashes up to the root of the tree which has width hashes in its bottom layer.
+func Verify(root []byte, width int, hashes []byte, index int, proof [][]byte) error {
+	length := len(hashes) / HashSize
+	if length == 0 || length&(length-1) != 0 || index%length != 0 || length > width {
+		return errInvalidProof
+	}
+	if len(proof) != Log2(width)-Log2(length) {
+		return errInvalidProof
+	}
+	h := RootOfLayer(hashes, length, nil)
+	for _, uncle := range proof {
+		if index&length == 0 {
+			h = hashPair(h, uncle)
+		} else {
+			h = hashPair(uncle, h)
+		}
+		index &^= length
+		length *= 2
+	}
+	if string(h) != string(root) {
+		return errInvalidProof
+	}
+	return nil
+}
+
+// subtreeRoot returns the root of the subtree with length hashes starting at index in the padded layer.
+func subtreeRoot(layer, pad []byte, index, length int) []byte {
+	begin := index * HashSize
+	if begin >= len(layer) {
+		return RootOfLayer(nil, length, pad)
+	}
+	end := begin + length*HashSize
+	if end > len(layer) {
+		end = len(layer)
+	}
+	return RootOfLayer(layer[begin:end], length, pad)
+}
+
+func hashPair(a, b []byte) []byte {
+	h := sha256.New()
+	_, _ = h.Write(a)
+	_, _ = h.Write(b)
+	return h.Sum(nil)
+}
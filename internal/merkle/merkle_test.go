@@ -0,0 +1,58 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestRoot(t *testing.T) {
+	data := bytes.Repeat([]byte{1}, 3*BlockSize+100)
+	var leaves [4][]byte
+	for i := range leaves[:3] {
+		sum := sha256.Sum256(data[i*BlockSize : (i+1)*BlockSize])
+		leaves[i] = sum[:]
+	}
+	sum := sha256.Sum256(data[3*BlockSize:])
+	leaves[3] = sum[:]
+	expected := hashPair(hashPair(leaves[0], leaves[1]), hashPair(leaves[2], leaves[3]))
+	if root := Root(data, 4); !bytes.Equal(root, expected) {
+		t.Fatalf("invalid root: %x", root)
+	}
+
+	zero := make([]byte, HashSize)
+	padded := hashPair(expected, hashPair(hashPair(zero, zero), hashPair(zero, zero)))
+	if root := Root(data, 8); !bytes.Equal(root, padded) {
+		t.Fatalf("invalid padded root: %x", root)
+	}
+	if !bytes.Equal(PadHash(4), hashPair(hashPair(zero, zero), hashPair(zero, zero))) {
+		t.Fatal("invalid pad hash")
+	}
+}
+
+func TestProof(t *testing.T) {
+	const width = 16
+	pad := PadHash(4)
+	var layer []byte
+	for i := 0; i < 11; i++ {
+		sum := sha256.Sum256([]byte{byte(i)})
+		layer = append(layer, sum[:]...)
+	}
+	root := RootOfLayer(layer, width, pad)
+	for _, length := range []int{2, 4, 8, 16} {
+		for index := 0; index < width; index += length {
+			hashes := make([]byte, 0, length*HashSize)
+			for i := index; i < index+length; i++ {
+				hashes = append(hashes, subtreeRoot(layer, pad, i, 1)...)
+			}
+			proof := Proof(layer, width, pad, index, length, width)
+			if err := Verify(root, width, hashes, index, proof); err != nil {
+				t.Fatalf("index: %d, length: %d, error: %s", index, length, err)
+			}
+			hashes[0] ^= 1
+			if err := Verify(root, width, hashes, index, proof); err == nil {
+				t.Fatalf("index: %d, length: %d, modified hashes are verified", index, length)
+			}
+		}
+	}
+}
@@ -1,18 +1,24 @@
 package metainfo
 
 import (
+	"bytes"
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"unicode"
 
 	"github.com/cenkalti/rain/internal/logger"
+	"github.com/cenkalti/rain/internal/merkle"
 	"github.com/zeebo/bencode"
 )
 
@@ -21,6 +27,11 @@ var (
 	errZeroPieceLength  = errors.New("torrent has zero piece length")
 	errZeroPieces       = errors.New("torrent has zero pieces")
 	errPieceLength      = errors.New("piece length must be multiple of 16K")
+	errPieceLengthV2    = errors.New("piece length must be a power of two and at least 16K")
+	errInvalidFileTree  = errors.New("invalid file tree")
+	errInvalidHybrid    = errors.New("v1 and v2 parts of hybrid torrent do not match")
+	errInvalidPadding   = errors.New("invalid padding file")
+	errInvalidLayer     = errors.New("invalid piece layer")
 )
 
 // Info contains information about torrent.
@@ -28,23 +39,42 @@ type Info struct {
 	PieceLength uint32
 	Name        string
 	Hash        [20]byte
-	Length      int64
-	NumPieces   uint32
-	Bytes       []byte
-	Private     bool
-	Files       []File
-	pieces      []byte
+	// SHA-256 hash of the info dictionary. Zero for v1-only torrents.
+	HashV2 [32]byte
+	// Total length of the piece data.
+	// Includes padding between files if the torrent has v1 pieces.
+	Length    int64
+	NumPieces uint32
+	Bytes     []byte
+	Private   bool
+	Files     []File
+	pieces    []byte
+	v2        bool
+	// Piece layers of files that are larger than a piece, keyed by pieces root.
+	pieceLayers map[string][]byte
 }
 
 // File represents a file inside a Torrent.
 type File struct {
 	Length int64
 	Path   string
+	// Number of zero bytes after the file that aligns the next file to a piece boundary.
+	Padding int64
+	// Merkle root of the file data in v2 torrents. Empty for v1-only torrents and empty files.
+	PiecesRoot []byte
 }
 
 type file struct {
 	Length int64    `bencode:"length"`
 	Path   []string `bencode:"path"`
+	Attr   string   `bencode:"attr,omitempty"`
+}
+
+// fileV2 is a file in the "file tree" of a v2 torrent.
+type fileV2 struct {
+	Length     int64  `bencode:"length"`
+	PiecesRoot []byte `bencode:"pieces root,omitempty"`
+	path       []string
 }
 
 // NewInfo returns info from bencoded bytes in b.
@@ -54,8 +84,10 @@ func NewInfo(b []byte) (*Info, error) {
 		Pieces      []byte             `bencode:"pieces"`
 		Name        string             `bencode:"name"`
 		Private     bencode.RawMessage `bencode:"private"`
-		Length      int64              `bencode:"length"` // Single File Mode
-		Files       []file             `bencode:"files"`  // Multiple File mode
+		Length      int64              `bencode:"length"`       // Single File Mode
+		Files       []file             `bencode:"files"`        // Multiple File mode
+		MetaVersion int                `bencode:"meta version"` // 2 for v2 and hybrid torrents
+		FileTree    bencode.RawMessage `bencode:"file tree"`
 	}
 	if err := bencode.DecodeBytes(b, &ib); err != nil {
 		return nil, err
@@ -63,12 +95,21 @@ func NewInfo(b []byte) (*Info, error) {
 	if ib.PieceLength == 0 {
 		return nil, errZeroPieceLength
 	}
+	switch ib.MetaVersion {
+	case 0, 1, 2:
+	default:
+		return nil, fmt.Errorf("unsupported meta version: %d", ib.MetaVersion)
+	}
+	hasV1 := len(ib.Pieces) > 0
+	hasV2 := ib.MetaVersion == 2
+	if !hasV1 && !hasV2 {
+		return nil, errZeroPieces
+	}
 	if len(ib.Pieces)%sha1.Size != 0 {
 		return nil, errInvalidPieceData
 	}
-	numPieces := len(ib.Pieces) / sha1.Size
-	if numPieces == 0 {
-		return nil, errZeroPieces
+	if hasV2 && (ib.PieceLength < 16<<10 || ib.PieceLength&(ib.PieceLength-1) != 0) {
+		return nil, errPieceLengthV2
 	}
 	// ".." is not allowed in file names
 	for _, file := range ib.Files {
@@ -78,32 +119,36 @@ func NewInfo(b []byte) (*Info, error) {
 			}
 		}
 	}
+	var filesV2 []fileV2
+	if hasV2 {
+		var err error
+		filesV2, err = parseFileTree(ib.FileTree, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(filesV2) == 0 {
+			return nil, errInvalidFileTree
+		}
+	}
 	i := Info{
 		PieceLength: ib.PieceLength,
-		NumPieces:   uint32(numPieces),
 		pieces:      ib.Pieces,
 		Name:        ib.Name,
 		Private:     parsePrivateField(ib.Private),
+		v2:          hasV2,
+		Bytes:       b,
 	}
-	multiFile := len(ib.Files) > 0
-	if multiFile {
-		for _, f := range ib.Files {
-			i.Length += f.Length
-		}
-	} else {
-		i.Length = ib.Length
-	}
-	totalPieceDataLength := int64(i.PieceLength) * int64(i.NumPieces)
-	delta := totalPieceDataLength - i.Length
-	if delta >= int64(i.PieceLength) || delta < 0 {
-		return nil, errInvalidPieceData
-	}
-	i.Bytes = b
 
 	// calculate info hash
-	hash := sha1.New()
-	_, _ = hash.Write(b)
-	copy(i.Hash[:], hash.Sum(nil))
+	if hasV2 {
+		i.HashV2 = sha256.Sum256(b)
+	}
+	if hasV1 {
+		i.Hash = sha1.Sum(b)
+	} else {
+		// v2-only torrents use truncated SHA-256 hash in places where a 20 bytes hash is needed.
+		copy(i.Hash[:], i.HashV2[:])
+	}
 
 	// name field is optional
 	if ib.Name != "" {
@@ -113,25 +158,256 @@ func NewInfo(b []byte) (*Info, error) {
 	}
 
 	// construct files
-	if multiFile {
-		i.Files = make([]File, len(ib.Files))
-		for j, f := range ib.Files {
-			parts := make([]string, 0, len(f.Path)+1)
-			parts = append(parts, cleanName(i.Name))
-			for _, p := range f.Path {
-				parts = append(parts, cleanName(p))
-			}
-			i.Files[j] = File{
-				Path:   filepath.Join(parts...),
-				Length: f.Length,
+	if hasV1 {
+		var err error
+		i.Files, err = i.filesV1(ib.Files, ib.Length)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range i.Files {
+			i.Length += f.Length + f.Padding
+		}
+		i.NumPieces = uint32(len(ib.Pieces) / sha1.Size)
+		totalPieceDataLength := int64(i.PieceLength) * int64(i.NumPieces)
+		delta := totalPieceDataLength - i.Length
+		if delta >= int64(i.PieceLength) || delta < 0 {
+			return nil, errInvalidPieceData
+		}
+		if hasV2 {
+			err = i.setPiecesRoots(filesV2)
+			if err != nil {
+				return nil, err
 			}
 		}
 	} else {
-		i.Files = []File{{Path: cleanName(i.Name), Length: i.Length}}
+		i.Files = i.filesV2(filesV2)
+		for _, f := range i.Files {
+			i.Length += f.Length
+			i.NumPieces += uint32((f.Length + int64(i.PieceLength) - 1) / int64(i.PieceLength))
+		}
+		if i.NumPieces == 0 {
+			return nil, errZeroPieces
+		}
 	}
 	return &i, nil
 }
 
+// filesV1 returns the files in v1 torrent.
+// Padding files are not returned, their length is added to the padding of the previous file.
+func (i *Info) filesV1(files []file, length int64) ([]File, error) {
+	if len(files) == 0 {
+		return []File{{Path: cleanName(i.Name), Length: length}}, nil
+	}
+	ret := make([]File, 0, len(files))
+	for _, f := range files {
+		if strings.Contains(f.Attr, "p") {
+			if len(ret) == 0 || f.Length < 0 {
+				return nil, errInvalidPadding
+			}
+			ret[len(ret)-1].Padding += f.Length
+			continue
+		}
+		parts := make([]string, 0, len(f.Path)+1)
+		parts = append(parts, cleanName(i.Name))
+		for _, p := range f.Path {
+			parts = append(parts, cleanName(p))
+		}
+		ret = append(ret, File{
+			Path:   filepath.Join(parts...),
+			Length: f.Length,
+		})
+	}
+	return ret, nil
+}
+
+// filesV2 returns the files of a v2-only torrent.
+// All files, except the last one, are padded to piece boundary.
+func (i *Info) filesV2(files []fileV2) []File {
+	singleFile := len(files) == 1 && len(files[0].path) == 1
+	ret := make([]File, len(files))
+	for j, f := range files {
+		var path string
+		if singleFile {
+			path = cleanName(f.path[0])
+		} else {
+			parts := make([]string, 0, len(f.path)+1)
+			parts = append(parts, cleanName(i.Name))
+			for _, p := range f.path {
+				parts = append(parts, cleanName(p))
+			}
+			path = filepath.Join(parts...)
+		}
+		ret[j] = File{
+			Path:       path,
+			Length:     f.Length,
+			PiecesRoot: f.PiecesRoot,
+		}
+		if j < len(files)-1 {
+			ret[j].Padding = i.paddingLength(f.Length)
+		}
+	}
+	return ret
+}
+
+// setPiecesRoots sets pieces roots of files in hybrid torrents after checking that v1 and v2 files match.
+func (i *Info) setPiecesRoots(files []fileV2) error {
+	if len(files) != len(i.Files) {
+		return errInvalidHybrid
+	}
+	var offset int64
+	for j, f := range files {
+		if f.Length != i.Files[j].Length {
+			return errInvalidHybrid
+		}
+		if f.Length > 0 && offset%int64(i.PieceLength) != 0 {
+			return errInvalidHybrid
+		}
+		i.Files[j].PiecesRoot = f.PiecesRoot
+		offset += i.Files[j].Length + i.Files[j].Padding
+	}
+	return nil
+}
+
+func (i *Info) paddingLength(length int64) int64 {
+	if mod := length % int64(i.PieceLength); mod != 0 {
+		return int64(i.PieceLength) - mod
+	}
+	return 0
+}
+
+// parseFileTree walks the "file tree" dictionary of v2 torrents and appends the files to the list in order.
+func parseFileTree(b bencode.RawMessage, path []string, files []fileV2) ([]fileV2, error) {
+	var dir map[string]bencode.RawMessage
+	err := bencode.DecodeBytes(b, &dir)
+	if err != nil {
+		return nil, err
+	}
+	if value, ok := dir[""]; ok {
+		if len(path) == 0 || len(dir) != 1 {
+			return nil, errInvalidFileTree
+		}
+		var f fileV2
+		err = bencode.DecodeBytes(value, &f)
+		if err != nil {
+			return nil, err
+		}
+		if f.Length < 0 || (f.Length > 0 && len(f.PiecesRoot) != sha256.Size) {
+			return nil, errInvalidFileTree
+		}
+		f.path = append([]string(nil), path...)
+		return append(files, f), nil
+	}
+	names := make([]string, 0, len(dir))
+	for name := range dir {
+		if strings.TrimSpace(name) == ".." {
+			return nil, fmt.Errorf("invalid file name: %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		files, err = parseFileTree(dir[name], append(path, name), files)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// HasV1 returns true if torrent has SHA-1 piece hashes.
+func (i *Info) HasV1() bool {
+	return len(i.pieces) > 0
+}
+
+// HasV2 returns true if torrent has merkle trees of files. Hybrid torrents have both v1 and v2 hashes.
+func (i *Info) HasV2() bool {
+	return i.v2
+}
+
+// SetPieceLayers sets the piece layers from the bencoded "piece layers" dictionary in the torrent file.
+// Layers that do not belong to any file are ignored.
+func (i *Info) SetPieceLayers(b []byte) error {
+	if len(b) == 0 || !i.v2 {
+		return nil
+	}
+	var layers map[string][]byte
+	err := bencode.DecodeBytes(b, &layers)
+	if err != nil {
+		return err
+	}
+	for _, f := range i.Files {
+		layer, ok := layers[string(f.PiecesRoot)]
+		if !ok || f.Length <= int64(i.PieceLength) {
+			continue
+		}
+		err = i.SetPieceLayer(f.PiecesRoot, layer)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetPieceLayer sets the piece layer of the file with the pieces root after verifying it.
+func (i *Info) SetPieceLayer(root, layer []byte) error {
+	for _, f := range i.Files {
+		if f.Length <= int64(i.PieceLength) || !bytes.Equal(f.PiecesRoot, root) {
+			continue
+		}
+		numPieces := i.NumFilePieces(f)
+		if len(layer) != numPieces*merkle.HashSize {
+			return errInvalidLayer
+		}
+		padHash := merkle.PadHash(int(i.PieceLength / merkle.BlockSize))
+		if !bytes.Equal(merkle.RootOfLayer(layer, merkle.NextPowerOfTwo(numPieces), padHash), root) {
+			return errInvalidLayer
+		}
+		if i.pieceLayers == nil {
+			i.pieceLayers = make(map[string][]byte)
+		}
+		i.pieceLayers[string(root)] = layer
+		return nil
+	}
+	return errInvalidLayer
+}
+
+// PieceLayer returns the piece layer of the file with pieces root.
+// Returns nil if the piece layer is not known or the file is not larger than a piece.
+func (i *Info) PieceLayer(root []byte) []byte {
+	return i.pieceLayers[string(root)]
+}
+
+// PieceLayers returns the bencoded "piece layers" dictionary. Returns nil if there are no piece layers.
+func (i *Info) PieceLayers() []byte {
+	if len(i.pieceLayers) == 0 {
+		return nil
+	}
+	b, _ := bencode.EncodeBytes(i.pieceLayers)
+	return b
+}
+
+// MissingPieceLayers returns the pieces roots of files that their piece layers are not known.
+func (i *Info) MissingPieceLayers() [][]byte {
+	if !i.v2 {
+		return nil
+	}
+	var roots [][]byte
+	for _, f := range i.Files {
+		if f.Length <= int64(i.PieceLength) {
+			continue
+		}
+		if _, ok := i.pieceLayers[string(f.PiecesRoot)]; !ok {
+			roots = append(roots, f.PiecesRoot)
+		}
+	}
+	return roots
+}
+
+// NumFilePieces returns the number of pieces that the file occupies in v2 torrents.
+func (i *Info) NumFilePieces(f File) int {
+	return int((f.Length + int64(i.PieceLength) - 1) / int64(i.PieceLength))
+}
+
 func cleanName(s string) string {
 	return cleanNameN(s, 255)
 }
@@ -181,142 +457,320 @@ func parsePrivateField(s bencode.RawMessage) bool {
 	return !(stringVal == "" || stringVal == "0")
 }
 
+// Version of the torrent to be created.
+type Version int
+
+const (
+	// V1 torrents have SHA-1 hashes of pieces.
+	V1 Version = iota + 1
+	// V2 torrents have SHA-256 merkle trees of files as described in BEP 52.
+	V2
+	// Hybrid torrents have both v1 and v2 hashes. They can be downloaded from v1-only peers too.
+	Hybrid
+)
+
+// ParseVersion parses the version string given in command line.
+func ParseVersion(s string) (Version, error) {
+	switch s {
+	case "v1", "1", "":
+		return V1, nil
+	case "v2", "2":
+		return V2, nil
+	case "hybrid":
+		return Hybrid, nil
+	default:
+		return 0, fmt.Errorf("invalid torrent version: %q", s)
+	}
+}
+
+// inputFile is a file on the disk that is going to be added to the torrent.
+type inputFile struct {
+	path   string
+	parts  []string
+	length int64
+}
+
 // NewInfoBytes creates a new Info dictionary by reading and hashing the files on the disk.
-func NewInfoBytes(root string, paths []string, private bool, pieceLength uint32, name string, log logger.Logger) ([]byte, error) {
+// For v2 and hybrid torrents, bencoded piece layers are returned too. They must be put in the torrent file with NewBytes.
+func NewInfoBytes(root string, paths []string, private bool, pieceLength uint32, name string, version Version, log logger.Logger) (info, pieceLayers []byte, err error) {
 	var singleFileTorrent bool
 	switch len(paths) {
 	case 0:
-		return nil, errors.New("no path specified")
+		return nil, nil, errors.New("no path specified")
 	case 1:
 		if name == "" {
 			name = filepath.Base(paths[0])
 		}
 		fi, err := os.Stat(paths[0])
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		singleFileTorrent = !fi.IsDir()
 	default:
 		if root == "" {
-			return nil, errors.New("no root specified")
+			return nil, nil, errors.New("no root specified")
 		}
 		if name == "" {
-			return nil, errors.New("no name specified")
+			return nil, nil, errors.New("no name specified")
 		}
 	}
-	totalLength, err := findTotalLength(paths)
+	files, err := findFiles(root, paths)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	var totalLength int64
+	for _, f := range files {
+		totalLength += f.length
 	}
 	if totalLength == 0 {
-		return nil, errors.New("no files")
+		return nil, nil, errors.New("no files")
 	}
+	hasV1 := version != V2
+	hasV2 := version == V2 || version == Hybrid
 	if pieceLength == 0 {
 		pieceLength = calculatePieceLength(totalLength)
 		log.Infof("Calculated piece length: %d K", pieceLength>>10)
 	} else if pieceLength%(16<<10) != 0 {
-		return nil, errPieceLength
+		return nil, nil, errPieceLength
+	} else if hasV2 && pieceLength&(pieceLength-1) != 0 {
+		return nil, nil, errPieceLengthV2
 	}
+	if hasV2 {
+		// Files must be in the same order with the file tree.
+		sort.Slice(files, func(i, j int) bool { return lessPath(files[i].parts, files[j].parts) })
+	}
+	hasher := newPieceHasher(pieceLength)
 	buf := make([]byte, pieceLength)
-	offset := 0
-	remaining := func() []byte { return buf[offset:] }
-	hash := sha1.New()
-	var files []file
-	var pieces []byte
-	for _, path := range paths {
-		relroot := path
-		if root != "" {
-			relroot = root
-		}
-		visit := func(vpath string, fi os.FileInfo, err error) error {
-			if err != nil {
-				return err
+	leavesPerPiece := int(pieceLength / merkle.BlockSize)
+	padHash := merkle.PadHash(leavesPerPiece)
+	var filesV1 []file
+	fileTree := make(map[string]interface{})
+	layers := make(map[string][]byte)
+	for i, f := range files {
+		log.Infof("Adding %q", filepath.Join(f.parts...))
+		var layer []byte
+		err = readFile(f.path, buf, func(b []byte) {
+			if hasV1 {
+				hasher.Write(b)
 			}
-			if fi.IsDir() {
-				return nil
+			if hasV2 {
+				layer = append(layer, merkle.Root(b, leavesPerPiece)...)
 			}
-			f, err := os.Open(vpath)
-			if err != nil {
-				return err
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		filesV1 = append(filesV1, file{Path: f.parts, Length: f.length})
+		if hasV1 && hasV2 && i < len(files)-1 {
+			// Align next file to piece boundary.
+			if n := hasher.Pad(); n > 0 {
+				filesV1 = append(filesV1, file{Path: []string{".pad", strconv.FormatInt(n, 10)}, Length: n, Attr: "p"})
 			}
-			defer f.Close()
-			relpath, err := filepath.Rel(relroot, vpath)
-			log.Infof("Adding %q", relpath)
+		}
+		if !hasV2 {
+			continue
+		}
+		fv2 := fileV2{Length: f.length}
+		switch numPieces := len(layer) / merkle.HashSize; {
+		case numPieces == 1:
+			// Root of a file that is not larger than a piece is calculated without padding to piece size.
+			fv2.PiecesRoot, err = fileRoot(f.path, f.length)
 			if err != nil {
-				return err
-			}
-			files = append(files, file{Path: strings.Split(relpath, string(os.PathSeparator)), Length: fi.Size()})
-			for {
-				n, err := io.ReadFull(f, remaining())
-				offset += n
-				if err == io.ErrUnexpectedEOF || err == io.EOF {
-					return nil // file finished, continue with next file
-				}
-				if err != nil {
-					return err
-				}
-				// buffer finished, calculate piece hash and append to pieces
-				_, _ = hash.Write(buf)
-				pieces = hash.Sum(pieces)
-				hash.Reset()
-				offset = 0
+				return nil, nil, err
 			}
+		case numPieces > 1:
+			fv2.PiecesRoot = merkle.RootOfLayer(layer, merkle.NextPowerOfTwo(numPieces), padHash)
+			layers[string(fv2.PiecesRoot)] = layer
 		}
-		err = filepath.Walk(path, visit)
-		if err != nil {
-			return nil, err
+		parts := f.parts
+		if singleFileTorrent {
+			parts = []string{name}
 		}
+		addToFileTree(fileTree, parts, fv2)
 	}
-	// hash remaining buffer
-	if offset > 0 {
-		_, _ = hash.Write(buf[:offset])
-		pieces = hash.Sum(pieces)
-	}
+	hasher.Flush()
 	b := struct {
-		Name        string `bencode:"name"`
-		Private     bool   `bencode:"private"`
-		PieceLength uint32 `bencode:"piece length"`
-		Pieces      []byte `bencode:"pieces"`
-		Length      int64  `bencode:"length,omitempty"` // Single File Mode
-		Files       []file `bencode:"files,omitempty"`  // Multiple File mode
+		Name        string                 `bencode:"name"`
+		Private     bool                   `bencode:"private"`
+		PieceLength uint32                 `bencode:"piece length"`
+		Pieces      []byte                 `bencode:"pieces,omitempty"`
+		Length      int64                  `bencode:"length,omitempty"`       // Single File Mode
+		Files       []file                 `bencode:"files,omitempty"`        // Multiple File mode
+		MetaVersion int                    `bencode:"meta version,omitempty"` // v2 and hybrid torrents
+		FileTree    map[string]interface{} `bencode:"file tree,omitempty"`    // v2 and hybrid torrents
 	}{
 		Name:        name,
 		Private:     private,
 		PieceLength: pieceLength,
-		Pieces:      pieces,
 	}
-	if singleFileTorrent {
-		b.Length = totalLength
-	} else {
-		b.Files = files
+	if hasV1 {
+		b.Pieces = hasher.pieces
+		if singleFileTorrent {
+			b.Length = totalLength
+		} else {
+			b.Files = filesV1
+		}
 	}
-	return bencode.EncodeBytes(b)
-}
-
-// PieceHash returns the hash of a piece at index.
-func (i *Info) PieceHash(index uint32) []byte {
-	begin := index * sha1.Size
-	end := begin + sha1.Size
-	return i.pieces[begin:end]
+	if hasV2 {
+		b.MetaVersion = 2
+		b.FileTree = fileTree
+	}
+	info, err = bencode.EncodeBytes(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(layers) > 0 {
+		pieceLayers, err = bencode.EncodeBytes(layers)
+	}
+	return info, pieceLayers, err
 }
 
-func findTotalLength(paths []string) (n int64, err error) {
+// findFiles walks the paths and returns the files in them.
+func findFiles(root string, paths []string) ([]inputFile, error) {
+	var files []inputFile
 	for _, path := range paths {
-		err = filepath.Walk(path, func(path string, fi os.FileInfo, err error) error {
+		relroot := path
+		if root != "" {
+			relroot = root
+		}
+		err := filepath.Walk(path, func(vpath string, fi os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
 			if fi.IsDir() {
 				return nil
 			}
-			n += fi.Size()
+			relpath, err := filepath.Rel(relroot, vpath)
+			if err != nil {
+				return err
+			}
+			files = append(files, inputFile{
+				path:   vpath,
+				parts:  strings.Split(relpath, string(os.PathSeparator)),
+				length: fi.Size(),
+			})
 			return nil
 		})
 		if err != nil {
-			return
+			return nil, err
 		}
 	}
-	return
+	return files, nil
+}
+
+// readFile reads the file in chunks of buffer size and calls fn for each chunk.
+func readFile(path string, buf []byte, fn func(b []byte)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			fn(buf[:n])
+		}
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// fileRoot calculates the merkle root of a file that is not larger than a piece.
+func fileRoot(path string, length int64) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != length {
+		return nil, fmt.Errorf("file size changed: %s", path)
+	}
+	return merkle.Root(data, merkle.NextPowerOfTwo(merkle.NumLeaves(length))), nil
+}
+
+func addToFileTree(tree map[string]interface{}, parts []string, f fileV2) {
+	for _, p := range parts[:len(parts)-1] {
+		sub, ok := tree[p].(map[string]interface{})
+		if !ok {
+			sub = make(map[string]interface{})
+			tree[p] = sub
+		}
+		tree = sub
+	}
+	tree[parts[len(parts)-1]] = map[string]interface{}{"": f}
+}
+
+func lessPath(a, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// pieceHasher calculates SHA-1 hashes of v1 pieces from the data written to it.
+type pieceHasher struct {
+	buf    []byte
+	offset int
+	hash   hash.Hash
+	pieces []byte
+}
+
+func newPieceHasher(pieceLength uint32) *pieceHasher {
+	return &pieceHasher{
+		buf:  make([]byte, pieceLength),
+		hash: sha1.New(),
+	}
+}
+
+func (h *pieceHasher) Write(b []byte) {
+	for len(b) > 0 {
+		n := copy(h.buf[h.offset:], b)
+		h.offset += n
+		b = b[n:]
+		if h.offset == len(h.buf) {
+			h.Flush()
+		}
+	}
+}
+
+// Pad fills the rest of the current piece with zeros and returns the number of bytes added.
+func (h *pieceHasher) Pad() int64 {
+	if h.offset == 0 {
+		return 0
+	}
+	n := len(h.buf) - h.offset
+	for i := h.offset; i < len(h.buf); i++ {
+		h.buf[i] = 0
+	}
+	h.offset = len(h.buf)
+	h.Flush()
+	return int64(n)
+}
+
+// Flush hashes the remaining data in the buffer as a piece.
+func (h *pieceHasher) Flush() {
+	if h.offset == 0 {
+		return
+	}
+	_, _ = h.hash.Write(h.buf[:h.offset])
+	h.pieces = h.hash.Sum(h.pieces)
+	h.hash.Reset()
+	h.offset = 0
+}
+
+// PieceHash returns the hash of a piece at index.
+func (i *Info) PieceHash(index uint32) []byte {
+	if !i.HasV1() {
+		return nil
+	}
+	begin := index * sha1.Size
+	end := begin + sha1.Size
+	return i.pieces[begin:end]
 }
 
 func calculatePieceLength(totalLength int64) uint32 {
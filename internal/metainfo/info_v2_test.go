@@ -0,0 +1,75 @@
+package metainfo
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cenkalti/rain/internal/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestFiles(t *testing.T) string {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "test")
+	lengths := map[string]int{"a": 100 << 10, "b": 10 << 10, "c/d": 70 << 10}
+	for name, length := range lengths {
+		name = filepath.Join(root, name)
+		err := os.MkdirAll(filepath.Dir(name), 0750)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(name, bytes.Repeat([]byte(filepath.Base(name)), length), 0640)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestNewInfoBytesV2(t *testing.T) {
+	root := createTestFiles(t)
+	for _, version := range []Version{V2, Hybrid} {
+		info, pieceLayers, err := NewInfoBytes("", []string{root}, false, 32<<10, "", version, logger.New("test"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := NewBytes(info, pieceLayers, nil, nil, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		mi, err := New(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		i := mi.Info
+		assert.Equal(t, version == Hybrid, i.HasV1())
+		assert.True(t, i.HasV2())
+		assert.Empty(t, i.MissingPieceLayers())
+		assert.NotEqual(t, [32]byte{}, i.HashV2)
+		assert.Equal(t, 3, len(i.Files))
+		assert.Equal(t, filepath.Join("test", "a"), i.Files[0].Path)
+		assert.Equal(t, int64(100<<10), i.Files[0].Length)
+		assert.Equal(t, int64(28<<10), i.Files[0].Padding)
+		assert.Equal(t, int64(22<<10), i.Files[1].Padding)
+		assert.Equal(t, int64(0), i.Files[2].Padding)
+		assert.Equal(t, filepath.Join("test", "c", "d"), i.Files[2].Path)
+		assert.Equal(t, uint32(4+1+3), i.NumPieces)
+		if version == Hybrid {
+			assert.Equal(t, int64(100<<10+28<<10+10<<10+22<<10+70<<10), i.Length)
+		} else {
+			assert.Equal(t, int64(100<<10+10<<10+70<<10), i.Length)
+		}
+		for _, f := range i.Files {
+			assert.Len(t, f.PiecesRoot, 32)
+		}
+
+		// Piece layers of the files must be verified.
+		layer := i.PieceLayer(i.Files[0].PiecesRoot)
+		assert.Len(t, layer, 4*32)
+		layer = append([]byte{}, layer...)
+		layer[0] ^= 1
+		assert.Error(t, i.SetPieceLayer(i.Files[0].PiecesRoot, layer))
+	}
+}
@@ -0,0 +1,189 @@
+// Package mover moves torrent files from one directory to another.
+package mover
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+var errClosed = errors.New("mover is closed")
+
+// Progress is reported after each chunk of this size is copied.
+const copyBufferSize = 1 << 20
+
+// Mover moves the files of a torrent to another directory.
+type Mover struct {
+	Error error
+
+	closeC chan struct{}
+	doneC  chan struct{}
+}
+
+// Progress about the move.
+type Progress struct {
+	MovedSize int64
+}
+
+type movedFile struct {
+	src, dest string
+	// If true, file is renamed. Otherwise, it is copied and the source file still exists.
+	renamed bool
+}
+
+// New returns a new Mover.
+func New() *Mover {
+	return &Mover{
+		closeC: make(chan struct{}),
+		doneC:  make(chan struct{}),
+	}
+}
+
+// Close the Mover. Files that are moved so far are restored to their original location.
+func (m *Mover) Close() {
+	close(m.closeC)
+	<-m.doneC
+}
+
+// Run moves the files with the names from src directory to dest directory.
+// Files are renamed if possible. Otherwise, they are copied to the destination and synced to disk.
+// Source files are not deleted after copying, so the caller can keep reading them until switching to the new files.
+// Files that do not exist in the source directory are skipped.
+// If an error occurs, moved files are restored to their original location.
+func (m *Mover) Run(src, dest string, names []string, perm fs.FileMode, progressC chan Progress, resultC chan *Mover) {
+	defer close(m.doneC)
+
+	var moved []movedFile
+	var movedSize int64
+	defer func() {
+		if m.Error != nil {
+			rollback(moved)
+		}
+		select {
+		case resultC <- m:
+		case <-m.closeC:
+		}
+	}()
+
+	for _, name := range names {
+		select {
+		case <-m.closeC:
+			m.Error = errClosed
+			return
+		default:
+		}
+		mf := movedFile{
+			src:  filepath.Join(src, name),
+			dest: filepath.Join(dest, name),
+		}
+		fi, err := os.Lstat(mf.src)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			m.Error = err
+			return
+		}
+		err = os.MkdirAll(filepath.Dir(mf.dest), os.ModeDir|perm)
+		if err != nil {
+			m.Error = err
+			return
+		}
+		err = os.Rename(mf.src, mf.dest)
+		if err == nil {
+			mf.renamed = true
+			moved = append(moved, mf)
+			movedSize += fi.Size()
+			m.sendProgress(progressC, movedSize)
+			continue
+		}
+		// Rename fails if directories are on different file systems.
+		err = m.copyFile(mf.src, mf.dest, perm&^0111, func(n int64) {
+			movedSize += n
+			m.sendProgress(progressC, movedSize)
+		})
+		if err != nil {
+			m.Error = err
+			return
+		}
+		moved = append(moved, mf)
+	}
+}
+
+func (m *Mover) sendProgress(progressC chan Progress, size int64) {
+	select {
+	case progressC <- Progress{MovedSize: size}:
+	case <-m.closeC:
+	}
+}
+
+// copyFile copies the file to a temporary file in the destination directory, then renames it to the destination name.
+// onCopy is called with the number of bytes after each chunk is copied.
+func (m *Mover) copyFile(src, dest string, perm fs.FileMode, onCopy func(n int64)) error {
+	sf, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+	df, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".*")
+	if err != nil {
+		return err
+	}
+	tmp := df.Name()
+	defer func() {
+		if err != nil {
+			_ = df.Close()
+			_ = os.Remove(tmp)
+		}
+	}()
+	_, err = io.CopyBuffer(df, &closableReader{r: sf, closeC: m.closeC, onRead: onCopy}, make([]byte, copyBufferSize))
+	if err != nil {
+		return err
+	}
+	err = df.Chmod(perm)
+	if err != nil {
+		return err
+	}
+	err = df.Sync()
+	if err != nil {
+		return err
+	}
+	err = df.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, dest)
+	return err
+}
+
+func rollback(moved []movedFile) {
+	for _, mf := range moved {
+		if mf.renamed {
+			_ = os.Rename(mf.dest, mf.src)
+		} else {
+			_ = os.Remove(mf.dest)
+		}
+	}
+}
+
+// closableReader stops reading when closeC is closed.
+type closableReader struct {
+	r      io.Reader
+	closeC chan struct{}
+	onRead func(n int64)
+}
+
+func (r *closableReader) Read(p []byte) (int, error) {
+	select {
+	case <-r.closeC:
+		return 0, errClosed
+	default:
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.onRead(int64(n))
+	}
+	return n, err
+}
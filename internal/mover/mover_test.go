@@ -0,0 +1,73 @@
+package mover
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMover(t *testing.T) {
+	src := t.TempDir()
+	dest := t.TempDir()
+	err := os.MkdirAll(filepath.Join(src, "dir"), 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(src, "dir", "file1"), []byte("foo"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{filepath.Join("dir", "file1"), "missing"}
+
+	m := New()
+	resultC := make(chan *Mover, 1)
+	progressC := make(chan Progress, 10)
+	go m.Run(src, dest, names, 0750, progressC, resultC)
+	res := <-resultC
+	if res.Error != nil {
+		t.Fatal(res.Error)
+	}
+	m.Close()
+	if p := <-progressC; p.MovedSize != 3 {
+		t.Fatalf("unexpected moved size: %d", p.MovedSize)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dest, "dir", "file1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "foo" {
+		t.Fatalf("unexpected content: %q", b)
+	}
+	if _, err = os.Stat(filepath.Join(src, "dir", "file1")); !os.IsNotExist(err) {
+		t.Fatal("source file must not exist")
+	}
+	if _, err = os.Stat(filepath.Join(dest, "missing")); !os.IsNotExist(err) {
+		t.Fatal("missing file must be skipped")
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "file1")
+	dest := filepath.Join(t.TempDir(), "file1")
+	err := os.WriteFile(src, []byte("foo"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New()
+	var copied int64
+	err = m.copyFile(src, dest, 0640, func(n int64) { copied += n })
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "foo" {
+		t.Fatalf("unexpected content: %q", b)
+	}
+	if copied != 3 {
+		t.Fatalf("unexpected copied size: %d", copied)
+	}
+}
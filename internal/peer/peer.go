@@ -18,8 +18,8 @@ import (
 	"github.com/cenkalti/rain/internal/pexlist"
 	"github.com/cenkalti/rain/internal/piece"
 	"github.com/cenkalti/rain/internal/sliceset"
+	"github.com/cenkalti/rain/internal/speedlimit"
 	"github.com/cenkalti/rain/internal/stringutil"
-	"github.com/juju/ratelimit"
 	"github.com/rcrowley/go-metrics"
 )
 
@@ -39,6 +39,7 @@ type Peer struct {
 	ExtensionsEnabled bool
 	FastEnabled       bool
 	DHTEnabled        bool
+	V2Enabled         bool
 	EncryptionCipher  mse.CryptoMethod
 
 	ClientInterested bool
@@ -87,11 +88,12 @@ type PieceMessage struct {
 }
 
 // New wraps the net.Conn and returns a new Peer.
-func New(conn net.Conn, source peersource.Source, id [20]byte, extensions [8]byte, cipher mse.CryptoMethod, pieceReadTimeout, snubTimeout time.Duration, maxRequestsIn int, br, bw *ratelimit.Bucket) *Peer {
+func New(conn net.Conn, source peersource.Source, id [20]byte, extensions [8]byte, cipher mse.CryptoMethod, pieceReadTimeout, snubTimeout time.Duration, maxRequestsIn int, br, bw *speedlimit.Limiter) *Peer {
 	bf, _ := bitfield.NewBytes(extensions[:], 64)
 	fastEnabled := bf.Test(61)
 	extensionsEnabled := bf.Test(43)
 	dhtEnabled := bf.Test(63)
+	v2Enabled := bf.Test(59)
 
 	t := time.NewTimer(math.MaxInt64)
 	t.Stop()
@@ -105,6 +107,7 @@ func New(conn net.Conn, source peersource.Source, id [20]byte, extensions [8]byt
 		ExtensionsEnabled: extensionsEnabled,
 		FastEnabled:       fastEnabled,
 		DHTEnabled:        dhtEnabled,
+		V2Enabled:         v2Enabled,
 		EncryptionCipher:  cipher,
 		snubTimeout:       snubTimeout,
 		snubTimer:         t,
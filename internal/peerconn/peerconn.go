@@ -5,11 +5,12 @@ import (
 	"net"
 	"time"
 
+	"github.com/cenkalti/rain/internal/btconn"
 	"github.com/cenkalti/rain/internal/logger"
 	"github.com/cenkalti/rain/internal/peerconn/peerreader"
 	"github.com/cenkalti/rain/internal/peerconn/peerwriter"
 	"github.com/cenkalti/rain/internal/peerprotocol"
-	"github.com/juju/ratelimit"
+	"github.com/cenkalti/rain/internal/speedlimit"
 )
 
 // Conn is a peer connection that provides a channel for receiving messages and methods for sending messages.
@@ -24,7 +25,7 @@ type Conn struct {
 }
 
 // New returns a new PeerConn by wrapping a net.Conn.
-func New(conn net.Conn, l logger.Logger, pieceTimeout time.Duration, maxRequestsIn int, fastEnabled bool, br, bw *ratelimit.Bucket) *Conn {
+func New(conn net.Conn, l logger.Logger, pieceTimeout time.Duration, maxRequestsIn int, fastEnabled bool, br, bw *speedlimit.Limiter) *Conn {
 	return &Conn{
 		conn:     conn,
 		reader:   peerreader.New(conn, l, pieceTimeout, br),
@@ -38,12 +39,17 @@ func New(conn net.Conn, l logger.Logger, pieceTimeout time.Duration, maxRequests
 
 // Addr returns the net.TCPAddr of the peer.
 func (p *Conn) Addr() *net.TCPAddr {
-	return p.conn.RemoteAddr().(*net.TCPAddr)
+	return btconn.RemoteAddr(p.conn)
 }
 
 // IP returns the string representation of IP address.
 func (p *Conn) IP() string {
-	return p.conn.RemoteAddr().(*net.TCPAddr).IP.String()
+	return p.Addr().IP.String()
+}
+
+// Transport returns the name of the transport protocol: "tcp" or "utp".
+func (p *Conn) Transport() string {
+	return btconn.Transport(p.conn)
 }
 
 // String returns the remote address as string.
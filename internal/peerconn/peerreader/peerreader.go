@@ -14,7 +14,7 @@ import (
 	"github.com/cenkalti/rain/internal/logger"
 	"github.com/cenkalti/rain/internal/peerprotocol"
 	"github.com/cenkalti/rain/internal/piece"
-	"github.com/juju/ratelimit"
+	"github.com/cenkalti/rain/internal/speedlimit"
 )
 
 const (
@@ -24,6 +24,8 @@ const (
 	readTimeout = 2 * time.Minute
 	// length + msgid + requestmsg
 	readBufferSize = 4 + 1 + 12
+	// Max number of hashes allowed in "hashes" messages, including the uncle hashes.
+	maxHashes = 512 + 64
 )
 
 var blockPool = bufferpool.New(piece.BlockSize)
@@ -34,20 +36,20 @@ type PeerReader struct {
 	r            io.Reader
 	log          logger.Logger
 	pieceTimeout time.Duration
-	bucket       *ratelimit.Bucket
+	limiter      *speedlimit.Limiter
 	messages     chan interface{}
 	stopC        chan struct{}
 	doneC        chan struct{}
 }
 
 // New returns a new PeerReader by wrapping a net.Conn.
-func New(conn net.Conn, l logger.Logger, pieceTimeout time.Duration, b *ratelimit.Bucket) *PeerReader {
+func New(conn net.Conn, l logger.Logger, pieceTimeout time.Duration, limiter *speedlimit.Limiter) *PeerReader {
 	return &PeerReader{
 		conn:         conn,
 		r:            bufio.NewReaderSize(conn, readBufferSize),
 		log:          l,
 		pieceTimeout: pieceTimeout,
-		bucket:       b,
+		limiter:      limiter,
 		messages:     make(chan interface{}),
 		stopC:        make(chan struct{}),
 		doneC:        make(chan struct{}),
@@ -226,6 +228,37 @@ func (p *PeerReader) Run() {
 				return
 			}
 			msg = pm
+		case peerprotocol.HashRequest:
+			var hm peerprotocol.HashRequestMessage
+			err = binary.Read(p.r, binary.BigEndian, &hm)
+			if err != nil {
+				return
+			}
+			msg = hm
+		case peerprotocol.HashReject:
+			var hm peerprotocol.HashRejectMessage
+			err = binary.Read(p.r, binary.BigEndian, &hm.HashRequestMessage)
+			if err != nil {
+				return
+			}
+			msg = hm
+		case peerprotocol.Hashes:
+			if length < 48 || (length-48)%32 != 0 || (length-48)/32 > maxHashes {
+				err = fmt.Errorf("invalid hashes message length: %d", length)
+				return
+			}
+			var hm peerprotocol.HashesMessage
+			err = binary.Read(p.r, binary.BigEndian, &hm.HashRequestMessage)
+			if err != nil {
+				return
+			}
+			length -= 48
+			hm.Hashes = make([]byte, length)
+			_, err = io.ReadFull(p.r, hm.Hashes)
+			if err != nil {
+				return
+			}
+			msg = hm
 		case peerprotocol.Extension:
 			buf := make([]byte, length)
 			_, err = io.ReadFull(p.r, buf)
@@ -268,8 +301,8 @@ func (p *PeerReader) readPiece(length uint32) (buf bufferpool.Buffer, err error)
 
 	var n, m int
 	for {
-		if p.bucket != nil {
-			d := p.bucket.Take(int64(length))
+		if p.limiter.Limited() {
+			d := p.limiter.Take(int64(length))
 			select {
 			case <-time.After(d):
 			case <-p.stopC:
@@ -302,7 +335,7 @@ func (p *PeerReader) readPiece(length uint32) (buf bufferpool.Buffer, err error)
 	}
 }
 
-var errStoppedWhileWaitingBucket = errors.New("peer reader stopped while waiting for bucket")
+var errStoppedWhileWaitingBucket = errors.New("peer reader stopped while waiting for speed limiter")
 
 type blockSizeError struct {
 	messageID  peerprotocol.MessageID
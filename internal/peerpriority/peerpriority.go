@@ -38,9 +38,18 @@ func calculateBytes(a, b *net.TCPAddr) (ret [2][]byte) {
 	}
 	a4 := a.IP.To4()
 	b4 := b.IP.To4()
-	m := ipv4Mask(a4, b4)
-	ret[0] = a4.Mask(m)
-	ret[1] = b4.Mask(m)
+	if a4 != nil && b4 != nil {
+		m := ipv4Mask(a4, b4)
+		ret[0] = a4.Mask(m)
+		ret[1] = b4.Mask(m)
+		return
+	}
+	// Only the first 64 bits of IPv6 addresses are used.
+	a6 := a.IP.To16()[:8]
+	b6 := b.IP.To16()[:8]
+	m := ipv6Mask(a6, b6)
+	ret[0] = a6.Mask(m)
+	ret[1] = b6.Mask(m)
 	return
 }
 
@@ -54,6 +63,16 @@ func ipv4Mask(a, b net.IP) net.IPMask {
 	return net.IPv4Mask(0xff, 0xff, 0xff, 0xff)
 }
 
+func ipv6Mask(a, b net.IP) net.IPMask {
+	if !bytes.Equal(a[:4], b[:4]) {
+		return net.IPMask{0xff, 0xff, 0xff, 0xff, 0x55, 0x55, 0x55, 0x55}
+	}
+	if a[4] != b[4] {
+		return net.IPMask{0xff, 0xff, 0xff, 0xff, 0xff, 0x55, 0x55, 0x55}
+	}
+	return net.IPMask{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+}
+
 func sameSubnet(ones, bits int, a, b net.IP) bool {
 	mask := net.CIDRMask(ones, bits)
 	return a.Mask(mask).Equal(b.Mask(mask))
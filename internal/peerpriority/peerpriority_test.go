@@ -22,6 +22,21 @@ func TestPeerPriority(t *testing.T) {
 	))
 }
 
+func TestPeerPriorityIPv6(t *testing.T) {
+	assert.EqualValues(t, 0xbde21f14, Calculate(
+		newAddr("2001:db8:1::1"),
+		newAddr("2a00:1450::1"),
+	))
+	assert.EqualValues(t, 0xbde21f14, Calculate(
+		newAddr("2a00:1450::1"),
+		newAddr("2001:db8:1::1"),
+	))
+	assert.EqualValues(t, 0x82cbdd49, Calculate(
+		newAddr("2001:db8:1::1"),
+		newAddr("2001:db8:2::1"),
+	))
+}
+
 func newAddr(ip string) *net.TCPAddr {
 	return &net.TCPAddr{IP: net.ParseIP(ip)}
 }
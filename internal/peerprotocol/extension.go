@@ -139,8 +139,10 @@ type ExtensionMetadataMessage struct {
 
 // ExtensionPEXMessage is the message for the PEX extension.
 type ExtensionPEXMessage struct {
-	Added   string `bencode:"added"`
-	Dropped string `bencode:"dropped"`
+	Added    string `bencode:"added"`
+	Dropped  string `bencode:"dropped"`
+	Added6   string `bencode:"added6,omitempty"`
+	Dropped6 string `bencode:"dropped6,omitempty"`
 }
 
 func truncateIP(ip net.IP) net.IP {
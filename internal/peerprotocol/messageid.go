@@ -23,6 +23,9 @@ const (
 	Reject      = 16
 	AllowedFast = 17
 	Extension   = 20
+	HashRequest = 21
+	Hashes      = 22
+	HashReject  = 23
 )
 
 var messageIDStrings = map[MessageID]string{
@@ -42,6 +45,9 @@ var messageIDStrings = map[MessageID]string{
 	16: "reject",
 	17: "allowed fast",
 	20: "extension",
+	21: "hash request",
+	22: "hashes",
+	23: "hash reject",
 }
 
 func (m MessageID) String() string {
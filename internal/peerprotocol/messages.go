@@ -88,6 +88,66 @@ func (m PortMessage) Read(b []byte) (n int, err error) {
 	return 2, io.EOF
 }
 
+// HashRequestMessage is sent to request hashes in a layer of the merkle tree of a file in v2 torrents.
+type HashRequestMessage struct {
+	PiecesRoot  [32]byte
+	BaseLayer   uint32
+	Index       uint32
+	Length      uint32
+	ProofLayers uint32
+}
+
+// ID returns the peer protocol message type.
+func (m HashRequestMessage) ID() MessageID { return HashRequest }
+
+// Read message data into buffer b.
+func (m HashRequestMessage) Read(b []byte) (int, error) {
+	copy(b[0:32], m.PiecesRoot[:])
+	binary.BigEndian.PutUint32(b[32:36], m.BaseLayer)
+	binary.BigEndian.PutUint32(b[36:40], m.Index)
+	binary.BigEndian.PutUint32(b[40:44], m.Length)
+	binary.BigEndian.PutUint32(b[44:48], m.ProofLayers)
+	return 48, io.EOF
+}
+
+// HashesMessage is sent in response to HashRequestMessage.
+// Hashes contains the requested hashes followed by the uncle hashes for verifying them.
+type HashesMessage struct {
+	HashRequestMessage
+	Hashes []byte
+	pos    int
+}
+
+// ID returns the peer protocol message type.
+func (m HashesMessage) ID() MessageID { return Hashes }
+
+// Read message data into buffer b.
+func (m *HashesMessage) Read(b []byte) (n int, err error) {
+	const headerSize = 48
+	if m.pos < headerSize {
+		var header [headerSize]byte
+		_, _ = m.HashRequestMessage.Read(header[:])
+		n = copy(b, header[m.pos:])
+		m.pos += n
+		b = b[n:]
+	}
+	if m.pos >= headerSize {
+		o := copy(b, m.Hashes[m.pos-headerSize:])
+		m.pos += o
+		n += o
+	}
+	if m.pos == headerSize+len(m.Hashes) {
+		err = io.EOF
+	}
+	return
+}
+
+// HashRejectMessage is sent to peer to tell that we are rejecting a hash request from you.
+type HashRejectMessage struct{ HashRequestMessage }
+
+// ID returns the peer protocol message type.
+func (m HashRejectMessage) ID() MessageID { return HashReject }
+
 type emptyMessage struct{}
 
 func (m emptyMessage) Read(b []byte) (int, error) {
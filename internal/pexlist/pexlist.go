@@ -14,32 +14,42 @@ const (
 )
 
 // PEXList contains the list of peer address for sending them to a peer at certain interval.
-// List contains 2 separate lists for added and dropped addresses.
+// List contains separate lists for added and dropped addresses of each address family.
 type PEXList struct {
-	added   map[tracker.CompactPeer]struct{}
-	dropped map[tracker.CompactPeer]struct{}
-	flushed bool
+	added    map[tracker.CompactPeer]struct{}
+	dropped  map[tracker.CompactPeer]struct{}
+	added6   map[tracker.CompactPeer6]struct{}
+	dropped6 map[tracker.CompactPeer6]struct{}
+	flushed  bool
 }
 
 // New returns a new empty PEXList.
 func New() *PEXList {
 	return &PEXList{
-		added:   make(map[tracker.CompactPeer]struct{}),
-		dropped: make(map[tracker.CompactPeer]struct{}),
+		added:    make(map[tracker.CompactPeer]struct{}),
+		dropped:  make(map[tracker.CompactPeer]struct{}),
+		added6:   make(map[tracker.CompactPeer6]struct{}),
+		dropped6: make(map[tracker.CompactPeer6]struct{}),
 	}
 }
 
 // NewWithRecentlySeen returns a new PEXList with given peers added to the dropped part.
-func NewWithRecentlySeen(rs []tracker.CompactPeer) *PEXList {
+func NewWithRecentlySeen(rs []*net.TCPAddr) *PEXList {
 	l := New()
-	for _, cp := range rs {
-		l.dropped[cp] = struct{}{}
+	for _, addr := range rs {
+		l.Drop(addr)
 	}
 	return l
 }
 
 // Add adds the address to the added part and removes from dropped part.
 func (l *PEXList) Add(addr *net.TCPAddr) {
+	if addr.IP.To4() == nil {
+		p := tracker.NewCompactPeer6(addr)
+		l.added6[p] = struct{}{}
+		delete(l.dropped6, p)
+		return
+	}
 	p := tracker.NewCompactPeer(addr)
 	l.added[p] = struct{}{}
 	delete(l.dropped, p)
@@ -47,32 +57,51 @@ func (l *PEXList) Add(addr *net.TCPAddr) {
 
 // Drop adds the address to the dropped part and removes from added part.
 func (l *PEXList) Drop(addr *net.TCPAddr) {
+	if addr.IP.To4() == nil {
+		peer := tracker.NewCompactPeer6(addr)
+		l.dropped6[peer] = struct{}{}
+		delete(l.added6, peer)
+		return
+	}
 	peer := tracker.NewCompactPeer(addr)
 	l.dropped[peer] = struct{}{}
 	delete(l.added, peer)
 }
 
-// Flush returns added and dropped parts and empty the list.
-func (l *PEXList) Flush() (added, dropped string) {
-	added = l.flush(l.added, l.flushed)
-	dropped = l.flush(l.dropped, l.flushed)
+// Flush returns added and dropped parts for IPv4 and IPv6 addresses and empty the list.
+func (l *PEXList) Flush() (added, dropped, added6, dropped6 string) {
+	limit := -1
+	if l.flushed {
+		limit = maxPeers
+	}
+	added, n := flush(l.added, limit)
+	added6, _ = flush(l.added6, limit-n)
+	dropped, n = flush(l.dropped, limit)
+	dropped6, _ = flush(l.dropped6, limit-n)
 	l.flushed = true
 	return
 }
 
-func (l *PEXList) flush(m map[tracker.CompactPeer]struct{}, limit bool) string {
+type compactPeer interface {
+	comparable
+	MarshalBinary() ([]byte, error)
+}
+
+// flush removes at most limit items from the map and returns them in compact format with the number of items.
+// All items are returned if limit is negative.
+func flush[T compactPeer](m map[T]struct{}, limit int) (string, int) {
 	count := len(m)
-	if limit && count > maxPeers {
-		count = maxPeers
+	if limit >= 0 && count > limit {
+		count = limit
 	}
 
 	var s strings.Builder
-	s.Grow(count * 6)
+	var n int
 	for p := range m {
-		if count == 0 {
+		if n == count {
 			break
 		}
-		count--
+		n++
 
 		b, err := p.MarshalBinary()
 		if err != nil {
@@ -81,5 +110,5 @@ func (l *PEXList) flush(m map[tracker.CompactPeer]struct{}, limit bool) string {
 		s.Write(b)
 		delete(m, p)
 	}
-	return s.String()
+	return s.String(), n
 }
@@ -0,0 +1,38 @@
+package pexlist
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPEXListIPv6(t *testing.T) {
+	l := New()
+	l.Add(newAddr("1.1.1.1"))
+	l.Add(newAddr("2001:db8::1"))
+	l.Drop(newAddr("2001:db8::2"))
+	added, dropped, added6, dropped6 := l.Flush()
+	assert.Len(t, added, 6)
+	assert.Len(t, dropped, 0)
+	assert.Len(t, added6, 18)
+	assert.Len(t, dropped6, 18)
+
+	// Combined amount of added v4/v6 addresses is limited after the first flush.
+	for i := 0; i < 40; i++ {
+		l.Add(newAddr("1.1.1." + strconv.Itoa(i)))
+		l.Add(newAddr("2001:db8::" + strconv.Itoa(i)))
+	}
+	added, _, added6, _ = l.Flush()
+	assert.Equal(t, maxPeers, len(added)/6+len(added6)/18)
+}
+
+func TestRecentlySeenIPv6(t *testing.T) {
+	var l RecentlySeen
+	l.Add(&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1})
+	l.Add(&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1})
+	assert.Equal(t, 1, l.Len())
+	_, _, _, dropped6 := NewWithRecentlySeen(l.Peers()).Flush()
+	assert.Len(t, dropped6, 18)
+}
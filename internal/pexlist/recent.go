@@ -2,8 +2,6 @@ package pexlist
 
 import (
 	"net"
-
-	"github.com/cenkalti/rain/internal/tracker"
 )
 
 // MaxLength is the maximum number of items to keep in the RecentlySeen list.
@@ -11,29 +9,28 @@ const MaxLength = 25
 
 // RecentlySeen is a peer address list that keeps the last `MaxLength` items.
 type RecentlySeen struct {
-	peers  []tracker.CompactPeer
+	peers  []*net.TCPAddr
 	offset int
 	length int
 }
 
 // Add a new address to the list.
 func (l *RecentlySeen) Add(addr *net.TCPAddr) {
-	cp := tracker.NewCompactPeer(addr)
-	if l.has(cp) {
+	if l.has(addr) {
 		return
 	}
 	if l.length >= MaxLength {
-		l.peers[l.offset] = cp
+		l.peers[l.offset] = addr
 	} else {
-		l.peers = append(l.peers, cp)
+		l.peers = append(l.peers, addr)
 		l.length++
 	}
 	l.offset = (l.offset + 1) % MaxLength
 }
 
-func (l *RecentlySeen) has(cp tracker.CompactPeer) bool {
+func (l *RecentlySeen) has(addr *net.TCPAddr) bool {
 	for _, p := range l.peers {
-		if p == cp {
+		if p.IP.Equal(addr.IP) && p.Port == addr.Port {
 			return true
 		}
 	}
@@ -41,7 +38,7 @@ func (l *RecentlySeen) has(cp tracker.CompactPeer) bool {
 }
 
 // Peers returns the addresses in the list.
-func (l *RecentlySeen) Peers() []tracker.CompactPeer {
+func (l *RecentlySeen) Peers() []*net.TCPAddr {
 	return l.peers
 }
 
@@ -6,6 +6,7 @@ import (
 
 	"github.com/cenkalti/rain/internal/allocator"
 	"github.com/cenkalti/rain/internal/filesection"
+	"github.com/cenkalti/rain/internal/merkle"
 	"github.com/cenkalti/rain/internal/metainfo"
 	"golang.org/x/exp/constraints"
 )
@@ -13,14 +14,36 @@ import (
 // BlockSize is the size of smallest piece data that we are going to request from peers.
 const BlockSize = 16 * 1024
 
+// Priority of a piece for downloading. Pieces with higher priority are downloaded first.
+// Zero value is the normal priority.
+type Priority int
+
+const (
+	// PrioritySkip pieces are not downloaded.
+	PrioritySkip Priority = iota - 2
+	// PriorityLow pieces are downloaded after all other pieces.
+	PriorityLow
+	// PriorityNormal is the default priority.
+	PriorityNormal
+	// PriorityHigh pieces are downloaded before all other pieces.
+	PriorityHigh
+)
+
 // Piece of a torrent.
 type Piece struct {
-	Index   uint32            // index in torrent
-	Length  uint32            // always equal to Info.PieceLength except last piece
-	Data    filesection.Piece // the place to write downloaded bytes
-	Hash    []byte
-	Writing bool
-	Done    bool
+	Index    uint32            // index in torrent
+	Length   uint32            // always equal to Info.PieceLength except last piece and last pieces of files in v2-only torrents
+	Data     filesection.Piece // the place to write downloaded bytes
+	Hash     []byte            // SHA-1 hash of the piece, nil for v2-only torrents
+	HashV2   []byte            // merkle hash of the file data in the piece, nil if piece layer is not known
+	Priority Priority          // highest priority of the files that the piece belongs to
+	Writing  bool
+	Done     bool
+
+	// Length of the file data at the beginning of the piece that is covered by HashV2.
+	lengthV2 uint32
+	// Number of leaves in the merkle tree of the piece.
+	leavesV2 int
 }
 
 // Block is part of a Piece that is specified in peerprotocol.Request messages.
@@ -32,28 +55,28 @@ type Block struct {
 
 // NewPieces returns a slice of Pieces by mapping files to the pieces.
 func NewPieces(info *metainfo.Info, files []allocator.File) []Piece {
-	var (
-		fileIndex  int   // index of the current file in torrent
-		fileLength int64 // length of the file in fileIndex
-		fileEnd    int64 // absolute position of end of the file among all pieces
-		fileOffset int64 // offset in file: [0, fileLength)
-	)
-
-	nextFile := func() {
-		fileIndex++
-		fileLength = info.Files[fileIndex].Length
-		fileEnd += fileLength
-		fileOffset = 0
+	// Parts of the torrent data in order, including the padding between files.
+	type part struct {
+		fileIndex int // -1 for padding
+		file      filesection.ReadWriterAt
+		name      string
+		length    int64
+	}
+	parts := make([]part, 0, len(info.Files))
+	for i, f := range info.Files {
+		parts = append(parts, part{fileIndex: i, file: files[i].Storage, name: files[i].Name, length: f.Length})
+		if f.Padding > 0 {
+			parts = append(parts, part{fileIndex: -1, file: padding{}, length: f.Padding})
+		}
 	}
 
-	// Init first file
-	fileIndex = -1
-	nextFile()
-
-	fileLeft := func() int64 { return fileLength - fileOffset }
+	var (
+		partIndex  int   // index of the current part
+		partOffset int64 // offset in part: [0, part.length)
+	)
 
 	// Construct pieces
-	var total int64
+	pieceLength := int64(info.PieceLength)
 	pieces := make([]Piece, info.NumPieces)
 	for i := uint32(0); i < info.NumPieces; i++ {
 		p := Piece{
@@ -63,31 +86,30 @@ func NewPieces(info *metainfo.Info, files []allocator.File) []Piece {
 
 		var sections filesection.Piece
 
-		// Construct p.Files
-		var pieceOffset uint32
-		pieceLeft := func() uint32 { return info.PieceLength - pieceOffset }
-		for left := pieceLeft(); left > 0; {
-			n := uint32(min(int64(left), fileLeft())) // number of bytes to write
-
-			file := filesection.FileSection{
-				File:   files[fileIndex].Storage,
-				Offset: fileOffset,
-				Length: int64(n),
-				Name:   files[fileIndex].Name,
+		for left := pieceLength; left > 0 && partIndex < len(parts); {
+			pa := parts[partIndex]
+			n := min(left, pa.length-partOffset) // number of bytes to write
+
+			// Padding is not a part of the piece data in v2-only torrents.
+			if pa.fileIndex >= 0 || info.HasV1() {
+				file := filesection.FileSection{
+					File:   pa.file,
+					Offset: partOffset,
+					Length: n,
+					Name:   pa.name,
+				}
+				sections = append(sections, file)
+				p.Length += uint32(n)
+			}
+			if pa.fileIndex >= 0 && n > 0 && info.HasV2() {
+				p.setHashV2(info, &info.Files[pa.fileIndex], partOffset, uint32(n))
 			}
-			sections = append(sections, file)
 
 			left -= n
-			p.Length += n
-			pieceOffset += n
-			fileOffset += int64(n)
-			total += int64(n)
-
-			if total == info.Length {
-				break
-			}
-			if fileLeft() == 0 {
-				nextFile()
+			partOffset += n
+			if partOffset == pa.length {
+				partIndex++
+				partOffset = 0
 			}
 		}
 
@@ -97,6 +119,25 @@ func NewPieces(info *metainfo.Info, files []allocator.File) []Piece {
 	return pieces
 }
 
+// setHashV2 sets the merkle hash of the file data in piece.
+// Files in v2 torrents are aligned to piece boundaries, so the file data is always at the beginning of the piece.
+func (p *Piece) setHashV2(info *metainfo.Info, f *metainfo.File, offset int64, length uint32) {
+	p.lengthV2 = length
+	if f.Length <= int64(info.PieceLength) {
+		// Pieces root is the hash of the piece if the file is not larger than a piece.
+		p.HashV2 = f.PiecesRoot
+		p.leavesV2 = merkle.NextPowerOfTwo(merkle.NumLeaves(f.Length))
+		return
+	}
+	p.leavesV2 = int(info.PieceLength / merkle.BlockSize)
+	layer := info.PieceLayer(f.PiecesRoot)
+	if layer == nil {
+		return
+	}
+	begin := offset / int64(info.PieceLength) * merkle.HashSize
+	p.HashV2 = layer[begin : begin+merkle.HashSize]
+}
+
 // NumBlocks returns the number of blocks in the piece.
 func (p *Piece) NumBlocks() int {
 	div, mod := divmod(p.Length, BlockSize)
@@ -148,13 +189,43 @@ func (p *Piece) FindBlock(begin, length uint32) (b Block, ok bool) {
 }
 
 // VerifyHash returns true if hash of piece data in buffer `buf` matches the hash of Piece.
+// h must be a SHA-1 hash. In v2 torrents, merkle hash of the file data in the piece is verified too.
 func (p *Piece) VerifyHash(buf []byte, h hash.Hash) bool {
 	if uint32(len(buf)) != p.Length {
 		return false
 	}
-	_, _ = h.Write(buf)
-	sum := h.Sum(nil)
-	return bytes.Equal(sum, p.Hash)
+	if p.Hash == nil && p.HashV2 == nil {
+		return false
+	}
+	if p.Hash != nil {
+		_, _ = h.Write(buf)
+		sum := h.Sum(nil)
+		if !bytes.Equal(sum, p.Hash) {
+			return false
+		}
+	}
+	if p.HashV2 != nil {
+		root := merkle.Root(buf[:p.lengthV2], p.leavesV2)
+		if !bytes.Equal(root, p.HashV2) {
+			return false
+		}
+	}
+	return true
+}
+
+// padding is the data between files that aligns files to piece boundaries.
+// It is read as zeros and writes to it are discarded.
+type padding struct{}
+
+func (padding) ReadAt(p []byte, off int64) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func (padding) WriteAt(p []byte, off int64) (int, error) {
+	return len(p), nil
 }
 
 func min[T constraints.Ordered](a, b T) T {
@@ -0,0 +1,82 @@
+package piece
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cenkalti/rain/internal/allocator"
+	"github.com/cenkalti/rain/internal/logger"
+	"github.com/cenkalti/rain/internal/metainfo"
+	"github.com/cenkalti/rain/internal/storage/memorystorage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyHashV2(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "test")
+	err := os.Mkdir(root, 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := map[string][]byte{
+		"a": bytes.Repeat([]byte{'a'}, 100<<10),
+		"b": bytes.Repeat([]byte{'b'}, 10<<10),
+		"c": bytes.Repeat([]byte{'c'}, 70<<10),
+	}
+	for name, b := range data {
+		err = os.WriteFile(filepath.Join(root, name), b, 0640)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, version := range []metainfo.Version{metainfo.V2, metainfo.Hybrid} {
+		b, pieceLayers, err := metainfo.NewInfoBytes("", []string{root}, false, 32<<10, "", version, logger.New("test"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := metainfo.NewInfo(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = info.SetPieceLayers(pieceLayers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sto := memorystorage.New()
+		files := make([]allocator.File, len(info.Files))
+		for i, f := range info.Files {
+			sf, _, err := sto.Open(f.Path, f.Length)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = sf.WriteAt(data[filepath.Base(f.Path)], 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[i] = allocator.File{Storage: sf, Name: f.Path}
+		}
+		pieces := NewPieces(info, files)
+		assert.Len(t, pieces, 8)
+		for _, p := range pieces {
+			assert.NotNil(t, p.HashV2)
+			assert.Equal(t, version == metainfo.Hybrid, p.Hash != nil)
+			buf := make([]byte, p.Length)
+			_, err = p.Data.ReadAt(buf, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.True(t, p.VerifyHash(buf, sha1.New()), "piece %d", p.Index)
+			buf[len(buf)-1] ^= 1
+			assert.False(t, p.VerifyHash(buf, sha1.New()), "piece %d", p.Index)
+		}
+		if version == metainfo.V2 {
+			// Last pieces of files are not padded in v2-only torrents.
+			assert.Equal(t, uint32(4<<10), pieces[3].Length)
+			assert.Equal(t, uint32(10<<10), pieces[4].Length)
+		} else {
+			assert.Equal(t, uint32(32<<10), pieces[3].Length)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package piecepicker
 import (
 	"fmt"
 	"sort"
+	"time"
 
 	"github.com/cenkalti/rain/internal/peer"
 	"github.com/cenkalti/rain/internal/sliceset"
@@ -17,6 +18,9 @@ These are the things to consider when selecting a piece for downloading:
 
   * Piece is done (hash checked and written to disk)
   * Piece is writing
+  * Piece is skipped (belongs only to the files that are not wanted)
+  * Priority of the piece
+  * Piece has a deadline (needed soon by a file reader)
   * Peer has the piece
   * Peer is choking us
   * Piece is marked as allowed-fast
@@ -36,6 +40,7 @@ type PiecePicker struct {
 	pieces               []myPiece
 	piecesByAvailability []*myPiece
 	piecesByStalled      []*myPiece
+	piecesByDeadline     []*myPiece
 	maxDuplicateDownload int
 	available            uint32
 	endgame              bool
@@ -50,6 +55,9 @@ type myPiece struct {
 
 	// Downloading from webseed source or marked to be downloaded later.
 	RequestedWebseed *webseedsource.WebseedSource
+
+	// Time that the piece is needed by. Zero value means no deadline.
+	Deadline time.Time
 }
 
 // RunningDownloads returns the number of pieces that are being downloaded actively.
@@ -66,7 +74,7 @@ func (p *myPiece) StalledDownloads() int {
 // AvailableForWebseed returns true if the piece can be downloaded from a webseed source.
 // If the piece is already requested from a peer, it does not become eligible for downloading from webseed until entering the endgame mode.
 func (p *myPiece) AvailableForWebseed(duplicate bool) bool {
-	if p.Done || p.Writing || p.RequestedWebseed != nil {
+	if p.Done || p.Writing || p.Priority == piece.PrioritySkip || p.RequestedWebseed != nil {
 		return false
 	}
 	if !duplicate {
@@ -182,6 +190,30 @@ func (p *PiecePicker) HandleCancelDownload(pe *peer.Peer, i uint32) {
 	p.pieces[i].Snubbed.Remove(pe)
 }
 
+// HandlePriorityChange must be called after priorities of the pieces are changed.
+func (p *PiecePicker) HandlePriorityChange() {
+	// Endgame mode is re-activated by pickRarest if there are no unrequested pieces left.
+	p.endgame = false
+}
+
+// SetDeadlines sets the times that the pieces are needed by, replacing the previously set deadlines.
+// Pieces having a deadline are picked before others in deadline order.
+// If a piece misses its deadline, it is requested from more peers like in endgame mode.
+func (p *PiecePicker) SetDeadlines(deadlines map[uint32]time.Time) {
+	for _, mp := range p.piecesByDeadline {
+		mp.Deadline = time.Time{}
+	}
+	p.piecesByDeadline = p.piecesByDeadline[:0]
+	for i, d := range deadlines {
+		mp := &p.pieces[i]
+		mp.Deadline = d
+		p.piecesByDeadline = append(p.piecesByDeadline, mp)
+	}
+	sort.Slice(p.piecesByDeadline, func(i, j int) bool {
+		return p.piecesByDeadline[i].Deadline.Before(p.piecesByDeadline[j].Deadline)
+	})
+}
+
 // HandleDisconnect must be called to remove the peer from internal indexes.
 func (p *PiecePicker) HandleDisconnect(pe *peer.Peer) {
 	for i := range p.pieces {
@@ -220,6 +252,11 @@ func (p *PiecePicker) findPiece(pe *peer.Peer) (mp *myPiece, allowedFast bool) {
 	if pe.Downloading {
 		return nil, false
 	}
+	// Pick the piece that is needed soonest
+	mp = p.pickDeadline(pe)
+	if mp != nil {
+		return mp, pe.PeerChoking
+	}
 	if p.downloadingWebseed() {
 		if pe.PeerChoking {
 			return nil, false
@@ -263,7 +300,7 @@ func (p *PiecePicker) findPiece(pe *peer.Peer) (mp *myPiece, allowedFast bool) {
 func (p *PiecePicker) pickAllowedFast(pe *peer.Peer) *myPiece {
 	for _, pi := range pe.ReceivedAllowedFast.Items {
 		mp := &p.pieces[pi.Index]
-		if mp.Done || mp.Writing {
+		if mp.Done || mp.Writing || mp.Priority == piece.PrioritySkip {
 			continue
 		}
 		if mp.Requested.Len() == 0 && mp.Having.Has(pe) {
@@ -273,16 +310,45 @@ func (p *PiecePicker) pickAllowedFast(pe *peer.Peer) *myPiece {
 	return nil
 }
 
+func (p *PiecePicker) pickDeadline(pe *peer.Peer) *myPiece {
+	if len(p.piecesByDeadline) == 0 {
+		return nil
+	}
+	now := time.Now()
+	for _, mp := range p.piecesByDeadline {
+		if mp.Done || mp.Writing || mp.Priority == piece.PrioritySkip || mp.RequestedWebseed != nil {
+			continue
+		}
+		if !mp.Having.Has(pe) || mp.Requested.Has(pe) {
+			continue
+		}
+		if pe.PeerChoking && !pe.ReceivedAllowedFast.Has(mp.Piece) {
+			continue
+		}
+		if mp.Requested.Len() == 0 {
+			return mp
+		}
+		if now.After(mp.Deadline) && mp.Requested.Len() < p.maxDuplicateDownload {
+			return mp
+		}
+	}
+	return nil
+}
+
 func (p *PiecePicker) pickRarest(pe *peer.Peer) *myPiece {
-	// Sort by rarity
+	// Sort by priority, then by rarity
 	sort.Slice(p.piecesByAvailability, func(i, j int) bool {
-		return len(p.piecesByAvailability[i].Having.Items) < len(p.piecesByAvailability[j].Having.Items)
+		pi, pj := p.piecesByAvailability[i], p.piecesByAvailability[j]
+		if pi.Priority != pj.Priority {
+			return pi.Priority > pj.Priority
+		}
+		return len(pi.Having.Items) < len(pj.Having.Items)
 	})
 	var picked *myPiece
 	var hasUnrequested bool
 	// Select unrequested piece
 	for _, mp := range p.piecesByAvailability {
-		if mp.Done || mp.Writing {
+		if mp.Done || mp.Writing || mp.Priority == piece.PrioritySkip {
 			continue
 		}
 		if mp.Requested.Len() == 0 && mp.Having.Has(pe) {
@@ -306,7 +372,7 @@ func (p *PiecePicker) pickEndgame(pe *peer.Peer) *myPiece {
 	})
 	// Select unrequested piece
 	for _, mp := range p.piecesByAvailability {
-		if mp.Done || mp.Writing {
+		if mp.Done || mp.Writing || mp.Priority == piece.PrioritySkip {
 			continue
 		}
 		if mp.Requested.Len() < p.maxDuplicateDownload && mp.Having.Has(pe) {
@@ -323,7 +389,7 @@ func (p *PiecePicker) pickStalled(pe *peer.Peer) *myPiece {
 	})
 	// Select unrequested piece
 	for _, mp := range p.piecesByStalled {
-		if mp.Done || mp.Writing {
+		if mp.Done || mp.Writing || mp.Priority == piece.PrioritySkip {
 			continue
 		}
 		if mp.RunningDownloads() > 0 {
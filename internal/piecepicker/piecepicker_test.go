@@ -2,10 +2,12 @@ package piecepicker
 
 import (
 	"testing"
+	"time"
 
 	"github.com/cenkalti/rain/internal/bitfield"
 	"github.com/cenkalti/rain/internal/peer"
 	"github.com/cenkalti/rain/internal/piece"
+	"github.com/cenkalti/rain/internal/webseedsource"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -69,6 +71,78 @@ func TestPiecePicker(t *testing.T) {
 	assert.True(t, pp.endgame)
 }
 
+func TestPiecePickerPriority(t *testing.T) {
+	pieces := make([]piece.Piece, numPieces)
+	for i := range pieces {
+		pieces[i] = newPiece(i)
+	}
+	pieces[0].Priority = piece.PrioritySkip
+	pieces[1].Priority = piece.PriorityLow
+	pieces[4].Priority = piece.PriorityHigh
+	pp := New(pieces, 2, nil)
+	pe := newPeer(0)
+	for i := range pieces {
+		pp.HandleHave(pe, uint32(i))
+	}
+	// High priority piece is picked before the normal priority ones.
+	assert.Equal(t, &pieces[4], pp.pickFor(pe))
+
+	pe2 := newPeer(2)
+	pp.HandleHave(pe2, 0)
+	pp.HandleHave(pe2, 1)
+	assert.Equal(t, &pieces[1], pp.pickFor(pe2))
+
+	pe3 := newPeer(3)
+	pp.HandleHave(pe3, 0)
+	assert.Nil(t, pp.pickFor(pe3))
+}
+
+func TestPiecePickerDeadline(t *testing.T) {
+	pieces := make([]piece.Piece, numPieces)
+	for i := range pieces {
+		pieces[i] = newPiece(i)
+	}
+	pp := New(pieces, 2, nil)
+	peers := make([]*peer.Peer, numPeers)
+	for i := range peers {
+		peers[i] = newPeer(i)
+		for j := range pieces {
+			pp.HandleHave(peers[i], uint32(j))
+		}
+	}
+	now := time.Now()
+	pp.SetDeadlines(map[uint32]time.Time{
+		5: now.Add(-time.Second),
+		6: now.Add(time.Minute),
+	})
+	// Pieces are picked in deadline order.
+	pi, _ := pp.PickFor(peers[0])
+	assert.Equal(t, &pieces[5], pi)
+	// Piece #5 is late, request it from another peer too.
+	pi, _ = pp.PickFor(peers[1])
+	assert.Equal(t, &pieces[5], pi)
+	pi, _ = pp.PickFor(peers[2])
+	assert.Equal(t, &pieces[6], pi)
+
+	// Skipped pieces and pieces requested from webseed sources are not picked.
+	pp.pieces[2].Priority = piece.PrioritySkip
+	pp.pieces[3].RequestedWebseed = &webseedsource.WebseedSource{}
+	pp.SetDeadlines(map[uint32]time.Time{
+		2: now.Add(-time.Second),
+		3: now.Add(-time.Second),
+		4: now.Add(time.Minute),
+	})
+	pi, _ = pp.PickFor(peers[0])
+	assert.Equal(t, &pieces[4], pi)
+
+	// Rarest first continues after deadlines are cleared.
+	pp.SetDeadlines(nil)
+	pe := newPeer(3)
+	pp.HandleHave(pe, 1)
+	pp.HandleHave(pe, 6)
+	assert.Equal(t, &pieces[1], pp.pickFor(pe))
+}
+
 func newPiece(i int) piece.Piece {
 	return piece.Piece{Index: uint32(i)}
 }
@@ -4,6 +4,7 @@ import (
 	"sort"
 
 	"github.com/cenkalti/rain/internal/peer"
+	"github.com/cenkalti/rain/internal/piece"
 	"github.com/cenkalti/rain/internal/webseedsource"
 )
 
@@ -84,7 +85,7 @@ func (p *PiecePicker) peerStealsFromWebseed(pe *peer.Peer) *myPiece {
 		}
 		for i := src.Downloader.End - 1; i > src.Downloader.ReadCurrent(); i-- {
 			pi := &p.pieces[i]
-			if pi.Done || pi.Writing {
+			if pi.Done || pi.Writing || pi.Priority == piece.PrioritySkip {
 				continue
 			}
 			if !pi.Having.Has(pe) {
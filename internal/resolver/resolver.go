@@ -13,13 +13,13 @@ import (
 var (
 	// ErrBlocked indicates that the resolved IP is blocked in the blocklist.
 	ErrBlocked = errors.New("ip is blocked")
-	// ErrNotIPv4Address indicates that the resolved IP address is not IPv4.
-	ErrNotIPv4Address = errors.New("not ipv4 address")
+	// ErrNoAddress indicates that the host has no IPv4 or IPv6 address.
+	ErrNoAddress = errors.New("no ip address")
 	// ErrInvalidPort indicates that the port number in the address is invalid.
 	ErrInvalidPort = errors.New("invalid port number")
 )
 
-// Resolve `hostport` to an IPv4 address.
+// Resolve `hostport` to an IP address. IPv4 addresses are preferred over IPv6 addresses.
 func Resolve(ctx context.Context, hostport string, timeout time.Duration, bl *blocklist.Blocklist) (net.IP, int, error) {
 	host, portStr, err := net.SplitHostPort(hostport)
 	if err != nil {
@@ -34,23 +34,22 @@ func Resolve(ctx context.Context, hostport string, timeout time.Duration, bl *bl
 	}
 	ip := net.ParseIP(host)
 	if ip == nil {
-		ip, err = ResolveIPv4(ctx, timeout, host)
+		ip, err = ResolveIP(ctx, timeout, host)
 		if err != nil {
 			return nil, 0, err
 		}
 	}
-	i4 := ip.To4()
-	if i4 == nil {
-		return nil, 0, ErrNotIPv4Address
-	}
 	if bl != nil && bl.Blocked(ip) {
 		return nil, 0, ErrBlocked
 	}
-	return i4, port, nil
+	if i4 := ip.To4(); i4 != nil {
+		ip = i4
+	}
+	return ip, port, nil
 }
 
-// ResolveIPv4 resolves `host` to and IPv4 address.
-func ResolveIPv4(ctx context.Context, timeout time.Duration, host string) (net.IP, error) {
+// ResolveIP resolves `host` to an IP address. IPv4 addresses are preferred over IPv6 addresses.
+func ResolveIP(ctx context.Context, timeout time.Duration, host string) (net.IP, error) {
 	var cancel func()
 	ctx, cancel = context.WithTimeout(ctx, timeout)
 	defer cancel()
@@ -64,5 +63,10 @@ func ResolveIPv4(ctx context.Context, timeout time.Duration, host string) (net.I
 			return i4, nil
 		}
 	}
-	return nil, ErrNotIPv4Address
+	for _, ia := range addrs {
+		if ia.IP.To16() != nil {
+			return ia.IP, nil
+		}
+	}
+	return nil, ErrNoAddress
 }
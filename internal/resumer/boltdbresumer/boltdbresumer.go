@@ -31,6 +31,17 @@ var Keys = struct {
 	StopAfterDownload []byte
 	StopAfterMetadata []byte
 	CompleteCmdRun    []byte
+	FilePriorities    []byte
+	IncompleteDir     []byte
+	DataDir           []byte
+	PieceLayers       []byte
+	QueuePosition     []byte
+	ForceStarted      []byte
+	SeedLimits        []byte
+	DownloadLimit     []byte
+	UploadLimit       []byte
+	Labels            []byte
+	Hooks             []byte
 }{
 	InfoHash:          []byte("info_hash"),
 	Port:              []byte("port"),
@@ -50,6 +61,17 @@ var Keys = struct {
 	StopAfterDownload: []byte("stop_after_download"),
 	StopAfterMetadata: []byte("stop_after_metadata"),
 	CompleteCmdRun:    []byte("complete_cmd_run"),
+	FilePriorities:    []byte("file_priorities"),
+	IncompleteDir:     []byte("incomplete_dir"),
+	DataDir:           []byte("data_dir"),
+	PieceLayers:       []byte("piece_layers"),
+	QueuePosition:     []byte("queue_position"),
+	ForceStarted:      []byte("force_started"),
+	SeedLimits:        []byte("seed_limits"),
+	DownloadLimit:     []byte("download_limit"),
+	UploadLimit:       []byte("upload_limit"),
+	Labels:            []byte("labels"),
+	Hooks:             []byte("hooks"),
 }
 
 // Resumer contains methods for saving/loading resume information of a torrent to a BoltDB database.
@@ -88,6 +110,18 @@ func (r *Resumer) Write(torrentID string, spec *Spec) error {
 	if err != nil {
 		return err
 	}
+	filePriorities, err := json.Marshal(spec.FilePriorities)
+	if err != nil {
+		return err
+	}
+	labels, err := json.Marshal(spec.Labels)
+	if err != nil {
+		return err
+	}
+	hooks, err := json.Marshal(spec.Hooks)
+	if err != nil {
+		return err
+	}
 	return r.db.Update(func(tx *bbolt.Tx) error {
 		b, err := tx.Bucket(r.bucket).CreateBucketIfNotExists([]byte(torrentID))
 		if err != nil {
@@ -110,10 +144,34 @@ func (r *Resumer) Write(torrentID string, spec *Spec) error {
 		_ = b.Put(Keys.StopAfterDownload, []byte(strconv.FormatBool(spec.StopAfterDownload)))
 		_ = b.Put(Keys.StopAfterMetadata, []byte(strconv.FormatBool(spec.StopAfterMetadata)))
 		_ = b.Put(Keys.CompleteCmdRun, []byte(strconv.FormatBool(spec.CompleteCmdRun)))
+		_ = b.Put(Keys.FilePriorities, filePriorities)
+		_ = b.Put(Keys.IncompleteDir, []byte(spec.IncompleteDir))
+		_ = b.Put(Keys.DataDir, []byte(spec.DataDir))
+		_ = b.Put(Keys.PieceLayers, spec.PieceLayers)
+		_ = b.Put(Keys.QueuePosition, []byte(strconv.Itoa(spec.QueuePosition)))
+		_ = b.Put(Keys.ForceStarted, []byte(strconv.FormatBool(spec.ForceStarted)))
+		if spec.SeedLimits != nil {
+			_ = b.Put(Keys.SeedLimits, spec.SeedLimits)
+		}
+		_ = b.Put(Keys.DownloadLimit, []byte(strconv.FormatInt(spec.DownloadLimit, 10)))
+		_ = b.Put(Keys.UploadLimit, []byte(strconv.FormatInt(spec.UploadLimit, 10)))
+		_ = b.Put(Keys.Labels, labels)
+		_ = b.Put(Keys.Hooks, hooks)
 		return nil
 	})
 }
 
+// WritePieceLayers writes the bencoded piece layers of a v2 torrent.
+func (r *Resumer) WritePieceLayers(torrentID string, value []byte) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		return b.Put(Keys.PieceLayers, value)
+	})
+}
+
 // WriteInfo writes only the info dict of a torrent.
 func (r *Resumer) WriteInfo(torrentID string, value []byte) error {
 	return r.db.Update(func(tx *bbolt.Tx) error {
@@ -136,14 +194,143 @@ func (r *Resumer) WriteBitfield(torrentID string, value []byte) error {
 	})
 }
 
-// WriteStarted writes the start status of a torrent.
+// WriteStarted writes the start status of a torrent. Force start status is cleared.
 func (r *Resumer) WriteStarted(torrentID string, value bool) error {
 	return r.db.Update(func(tx *bbolt.Tx) error {
 		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
 		if b == nil {
 			return nil
 		}
-		return b.Put(Keys.Started, []byte(strconv.FormatBool(value)))
+		err := b.Put(Keys.Started, []byte(strconv.FormatBool(value)))
+		if err != nil {
+			return err
+		}
+		return b.Put(Keys.ForceStarted, []byte(strconv.FormatBool(false)))
+	})
+}
+
+// WriteForceStarted marks the torrent as started regardless of the queue limits.
+func (r *Resumer) WriteForceStarted(torrentID string) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		err := b.Put(Keys.Started, []byte(strconv.FormatBool(true)))
+		if err != nil {
+			return err
+		}
+		return b.Put(Keys.ForceStarted, []byte(strconv.FormatBool(true)))
+	})
+}
+
+// WriteSeedLimits writes the JSON encoded seeding limits of a torrent. Nil value deletes the limits.
+func (r *Resumer) WriteSeedLimits(torrentID string, value []byte) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		if value == nil {
+			return b.Delete(Keys.SeedLimits)
+		}
+		return b.Put(Keys.SeedLimits, value)
+	})
+}
+
+// WriteSpeedLimits writes the download and upload speed limits of a torrent.
+func (r *Resumer) WriteSpeedLimits(torrentID string, download, upload int64) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		err := b.Put(Keys.DownloadLimit, []byte(strconv.FormatInt(download, 10)))
+		if err != nil {
+			return err
+		}
+		return b.Put(Keys.UploadLimit, []byte(strconv.FormatInt(upload, 10)))
+	})
+}
+
+// WriteLabels writes the labels of a torrent.
+func (r *Resumer) WriteLabels(torrentID string, value []string) error {
+	val, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		return b.Put(Keys.Labels, val)
+	})
+}
+
+// WriteHookPending saves the payload of a hook that is triggered but not delivered yet.
+// If overwrite is false and the hook has a record already, the record is not changed and false is returned.
+func (r *Resumer) WriteHookPending(torrentID, key string, payload []byte, overwrite bool) (written bool, err error) {
+	err = r.updateHooks(torrentID, func(hooks map[string]HookRecord) bool {
+		if _, ok := hooks[key]; ok && !overwrite {
+			return false
+		}
+		hooks[key] = HookRecord{Payload: payload}
+		written = true
+		return true
+	})
+	return
+}
+
+// WriteHookDelivered marks the hook as delivered and removes its payload.
+func (r *Resumer) WriteHookDelivered(torrentID, key string) error {
+	return r.updateHooks(torrentID, func(hooks map[string]HookRecord) bool {
+		hooks[key] = HookRecord{Delivered: true}
+		return true
+	})
+}
+
+// ReadHooks returns the hook records of a torrent.
+func (r *Resumer) ReadHooks(torrentID string) (hooks map[string]HookRecord, err error) {
+	err = r.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		value := b.Get(Keys.Hooks)
+		if value == nil {
+			return nil
+		}
+		return json.Unmarshal(value, &hooks)
+	})
+	return
+}
+
+// updateHooks reads the hook records of a torrent and saves them if the update function returns true.
+func (r *Resumer) updateHooks(torrentID string, update func(map[string]HookRecord) bool) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		var hooks map[string]HookRecord
+		if value := b.Get(Keys.Hooks); value != nil {
+			err := json.Unmarshal(value, &hooks)
+			if err != nil {
+				return err
+			}
+		}
+		if hooks == nil {
+			hooks = make(map[string]HookRecord)
+		}
+		if !update(hooks) {
+			return nil
+		}
+		val, err := json.Marshal(hooks)
+		if err != nil {
+			return err
+		}
+		return b.Put(Keys.Hooks, val)
 	})
 }
 
@@ -188,6 +375,33 @@ func (r *Resumer) WriteCompleteCmdRun(torrentID string) error {
 	})
 }
 
+// WriteFilePriorities writes the download priorities of files in a torrent.
+func (r *Resumer) WriteFilePriorities(torrentID string, value []int) error {
+	val, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		return b.Put(Keys.FilePriorities, val)
+	})
+}
+
+// WriteDataDir writes the directories that the files are saved into.
+func (r *Resumer) WriteDataDir(torrentID string, dataDir, incompleteDir string) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		_ = b.Put(Keys.DataDir, []byte(dataDir))
+		return b.Put(Keys.IncompleteDir, []byte(incompleteDir))
+	})
+}
+
 func (r *Resumer) Read(torrentID string) (spec *Spec, err error) {
 	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
 	defer func() {
@@ -349,6 +563,84 @@ func (r *Resumer) Read(torrentID string) (spec *Spec, err error) {
 			}
 		}
 
+		value = b.Get(Keys.FilePriorities)
+		if value != nil {
+			err = json.Unmarshal(value, &spec.FilePriorities)
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.IncompleteDir)
+		if value != nil {
+			spec.IncompleteDir = string(value)
+		}
+
+		value = b.Get(Keys.DataDir)
+		if value != nil {
+			spec.DataDir = string(value)
+		}
+
+		value = b.Get(Keys.PieceLayers)
+		if value != nil {
+			spec.PieceLayers = make([]byte, len(value))
+			copy(spec.PieceLayers, value)
+		}
+
+		value = b.Get(Keys.QueuePosition)
+		if value != nil {
+			spec.QueuePosition, err = strconv.Atoi(string(value))
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.ForceStarted)
+		if value != nil {
+			spec.ForceStarted, err = strconv.ParseBool(string(value))
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.SeedLimits)
+		if value != nil {
+			spec.SeedLimits = make([]byte, len(value))
+			copy(spec.SeedLimits, value)
+		}
+
+		value = b.Get(Keys.DownloadLimit)
+		if value != nil {
+			spec.DownloadLimit, err = strconv.ParseInt(string(value), 10, 64)
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.UploadLimit)
+		if value != nil {
+			spec.UploadLimit, err = strconv.ParseInt(string(value), 10, 64)
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.Labels)
+		if value != nil {
+			err = json.Unmarshal(value, &spec.Labels)
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.Hooks)
+		if value != nil {
+			err = json.Unmarshal(value, &spec.Hooks)
+			if err != nil {
+				return err
+			}
+		}
+
 		return nil
 	})
 	return
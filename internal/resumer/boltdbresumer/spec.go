@@ -9,7 +9,7 @@ import (
 // Spec contains fields for resuming an existing torrent.
 type Spec struct {
 	InfoHash          []byte
-	Port              int
+	Port              int // zero if the torrent is added in shared port mode
 	Name              string
 	Trackers          [][]string
 	URLList           []string
@@ -25,6 +25,24 @@ type Spec struct {
 	StopAfterDownload bool
 	StopAfterMetadata bool
 	CompleteCmdRun    bool
+	FilePriorities    []int
+	IncompleteDir     string
+	DataDir           string
+	PieceLayers       []byte
+	QueuePosition     int
+	ForceStarted      bool
+	SeedLimits        []byte // JSON encoded, nil if the torrent uses global limits
+	DownloadLimit     int64  // KB/s, zero means no limit
+	UploadLimit       int64  // KB/s, zero means no limit
+	Labels            []string
+	Hooks             map[string]HookRecord
+}
+
+// HookRecord is the delivery state of a hook that is triggered by an event of the torrent.
+type HookRecord struct {
+	Delivered bool
+	// JSON encoded data that is sent to the hook. Nil after the hook is delivered.
+	Payload json.RawMessage `json:",omitempty"`
 }
 
 type jsonSpec struct {
@@ -41,12 +59,23 @@ type jsonSpec struct {
 	StopAfterDownload bool
 	StopAfterMetadata bool
 	CompleteCmdRun    bool
+	FilePriorities    []int
+	IncompleteDir     string
+	DataDir           string
+	QueuePosition     int
+	ForceStarted      bool
+	SeedLimits        json.RawMessage `json:",omitempty"`
+	DownloadLimit     int64
+	UploadLimit       int64
+	Labels            []string
+	Hooks             map[string]HookRecord `json:",omitempty"`
 
 	// JSON unsafe types
-	InfoHash  string
-	Info      string
-	Bitfield  string
-	SeededFor int64
+	InfoHash    string
+	Info        string
+	Bitfield    string
+	SeededFor   int64
+	PieceLayers string
 }
 
 // MarshalJSON converts the Spec to a JSON string.
@@ -65,11 +94,22 @@ func (s Spec) MarshalJSON() ([]byte, error) {
 		StopAfterDownload: s.StopAfterDownload,
 		StopAfterMetadata: s.StopAfterMetadata,
 		CompleteCmdRun:    s.CompleteCmdRun,
+		FilePriorities:    s.FilePriorities,
+		IncompleteDir:     s.IncompleteDir,
+		DataDir:           s.DataDir,
+		QueuePosition:     s.QueuePosition,
+		ForceStarted:      s.ForceStarted,
+		SeedLimits:        s.SeedLimits,
+		DownloadLimit:     s.DownloadLimit,
+		UploadLimit:       s.UploadLimit,
+		Labels:            s.Labels,
+		Hooks:             s.Hooks,
 
-		InfoHash:  base64.StdEncoding.EncodeToString(s.InfoHash),
-		Info:      base64.StdEncoding.EncodeToString(s.Info),
-		Bitfield:  base64.StdEncoding.EncodeToString(s.Bitfield),
-		SeededFor: int64(s.SeededFor),
+		InfoHash:    base64.StdEncoding.EncodeToString(s.InfoHash),
+		Info:        base64.StdEncoding.EncodeToString(s.Info),
+		Bitfield:    base64.StdEncoding.EncodeToString(s.Bitfield),
+		SeededFor:   int64(s.SeededFor),
+		PieceLayers: base64.StdEncoding.EncodeToString(s.PieceLayers),
 	}
 	return json.Marshal(j)
 }
@@ -93,6 +133,10 @@ func (s *Spec) UnmarshalJSON(b []byte) error {
 	if err != nil {
 		return err
 	}
+	s.PieceLayers, err = base64.StdEncoding.DecodeString(j.PieceLayers)
+	if err != nil {
+		return err
+	}
 	s.SeededFor = time.Duration(j.SeededFor)
 	s.Port = j.Port
 	s.Name = j.Name
@@ -107,5 +151,15 @@ func (s *Spec) UnmarshalJSON(b []byte) error {
 	s.StopAfterDownload = j.StopAfterDownload
 	s.StopAfterMetadata = j.StopAfterMetadata
 	s.CompleteCmdRun = j.CompleteCmdRun
+	s.FilePriorities = j.FilePriorities
+	s.IncompleteDir = j.IncompleteDir
+	s.DataDir = j.DataDir
+	s.QueuePosition = j.QueuePosition
+	s.ForceStarted = j.ForceStarted
+	s.SeedLimits = j.SeedLimits
+	s.DownloadLimit = j.DownloadLimit
+	s.UploadLimit = j.UploadLimit
+	s.Labels = j.Labels
+	s.Hooks = j.Hooks
 	return nil
 }
@@ -7,8 +7,9 @@ import (
 
 func TestMarshalUnmarshalSpec(t *testing.T) {
 	s := Spec{
-		Info: []byte{1, 2, 3},
-		Name: "foo",
+		Info:           []byte{1, 2, 3},
+		Name:           "foo",
+		FilePriorities: []int{-2, 0, 1},
 	}
 	b, err := s.MarshalJSON()
 	if err != nil {
@@ -25,4 +26,7 @@ func TestMarshalUnmarshalSpec(t *testing.T) {
 	if s.Name != s2.Name {
 		t.FailNow()
 	}
+	if len(s2.FilePriorities) != 3 || s2.FilePriorities[0] != -2 || s2.FilePriorities[2] != 1 {
+		t.FailNow()
+	}
 }
@@ -7,6 +7,7 @@ type Torrent struct {
 	InfoHash string
 	Port     int
 	AddedAt  Time
+	Labels   []string
 }
 
 // Peer of a Torrent.
@@ -15,6 +16,7 @@ type Peer struct {
 	Client             string
 	Addr               string
 	Source             string
+	Transport          string
 	ConnectedAt        Time
 	Downloading        bool
 	ClientInterested   bool
@@ -36,6 +38,13 @@ type Webseed struct {
 	DownloadSpeed int
 }
 
+// File in a Torrent.
+type File struct {
+	Path     string
+	Length   int64
+	Priority string
+}
+
 // Tracker of a Torrent.
 type Tracker struct {
 	URL           string
@@ -48,6 +57,8 @@ type Tracker struct {
 	ErrorInternal string
 	LastAnnounce  Time
 	NextAnnounce  Time
+	Downloaded    int
+	LastScrape    Time
 }
 
 // SessionStats contains statistics about a Session.
@@ -80,6 +91,13 @@ type SessionStats struct {
 	SpeedUpload   int
 	SpeedRead     int
 	SpeedWrite    int
+
+	AltSpeedLimits     bool
+	SpeedLimitDownload int64
+	SpeedLimitUpload   int64
+
+	WatchDirErrors    int
+	WatchDirLastError string
 }
 
 // Stats contains statistics about a Torrent.
@@ -92,12 +110,14 @@ type Stats struct {
 		Checked   uint32
 		Have      uint32
 		Missing   uint32
+		Wanted    uint32
 		Available uint32
 		Total     uint32
 	}
 	Bytes struct {
 		Total      int64
 		Allocated  int64
+		Moved      int64
 		Completed  int64
 		Incomplete int64
 		Downloaded int64
@@ -119,6 +139,7 @@ type Stats struct {
 		Tracker int
 		DHT     int
 		PEX     int
+		LSD     int
 	}
 	Downloads struct {
 		Total   int
@@ -131,6 +152,8 @@ type Stats struct {
 		Snubbed int
 		Running int
 	}
+	DataDir     string
+	Moving      bool
 	Name        string
 	Private     bool
 	PieceLength uint32
@@ -139,7 +162,36 @@ type Stats struct {
 		Download int
 		Upload   int
 	}
-	ETA int
+	SpeedLimit struct {
+		Download int64
+		Upload   int64
+	}
+	ETA           int
+	QueuePosition int
+	ForceStarted  bool
+	SeedGoals     struct {
+		Limits SeedLimits
+		Custom bool
+		Ratio  float64
+		Idle   uint
+		// Remaining values are -1 if the limit is not set.
+		RatioRemaining float64
+		TimeRemaining  int
+		IdleRemaining  int
+	}
+	Labels []string
+}
+
+// SeedLimits contains seeding limits of a Torrent or a Session.
+// Durations are in seconds. Zero values disable the limits.
+// Actions are one of "stop", "remove" or "remove-data".
+type SeedLimits struct {
+	Ratio       float64
+	RatioAction string
+	Time        uint
+	TimeAction  string
+	Idle        uint
+	IdleAction  string
 }
 
 // GetMagnetRequest contains request arguments for Session.GetMagnet method.
@@ -164,6 +216,8 @@ type GetTorrentResponse struct {
 
 // ListTorrentsRequest contains request arguments for Session.ListTorrents method.
 type ListTorrentsRequest struct {
+	// If not empty, only the torrents that have the label are returned.
+	Label string
 }
 
 // ListTorrentsResponse contains response arguments for Session.ListTorrents method.
@@ -177,6 +231,10 @@ type AddTorrentOptions struct {
 	Stopped           bool
 	StopAfterDownload bool
 	StopAfterMetadata bool
+	FilePriorities    []string
+	IncompleteDir     string
+	DataPath          string
+	Labels            []string
 }
 
 // AddTorrentRequest contains request arguments for Session.AddTorrent method.
@@ -203,7 +261,8 @@ type AddURIResponse struct {
 
 // RemoveTorrentRequest contains request arguments for Session.RemoveTorrent method.
 type RemoveTorrentRequest struct {
-	ID string
+	ID       string
+	KeepData bool
 }
 
 // RemoveTorrentResponse contains response arguments for Session.RemoveTorrent method.
@@ -227,6 +286,15 @@ type GetSessionStatsResponse struct {
 	Stats SessionStats
 }
 
+// SetAltSpeedLimitsRequest contains request arguments for Session.SetAltSpeedLimits method.
+type SetAltSpeedLimitsRequest struct {
+	Enabled bool
+}
+
+// SetAltSpeedLimitsResponse contains response arguments for Session.SetAltSpeedLimits method.
+type SetAltSpeedLimitsResponse struct {
+}
+
 // GetTorrentStatsRequest contains request arguments for Session.GetTorrentStats method.
 type GetTorrentStatsRequest struct {
 	ID string
@@ -267,6 +335,26 @@ type GetTorrentWebseedsResponse struct {
 	Webseeds []Webseed
 }
 
+// GetTorrentFilesRequest contains request arguments for Session.GetTorrentFiles method.
+type GetTorrentFilesRequest struct {
+	ID string
+}
+
+// GetTorrentFilesResponse contains response arguments for Session.GetTorrentFiles method.
+type GetTorrentFilesResponse struct {
+	Files []File
+}
+
+// SetFilePrioritiesRequest contains request arguments for Session.SetFilePriorities method.
+type SetFilePrioritiesRequest struct {
+	ID         string
+	Priorities []string
+}
+
+// SetFilePrioritiesResponse contains response arguments for Session.SetFilePriorities method.
+type SetFilePrioritiesResponse struct {
+}
+
 // StartTorrentRequest contains request arguments for Session.StartTorrent method.
 type StartTorrentRequest struct {
 	ID string
@@ -285,6 +373,184 @@ type StopTorrentRequest struct {
 type StopTorrentResponse struct {
 }
 
+// ForceStartTorrentRequest contains request arguments for Session.ForceStartTorrent method.
+type ForceStartTorrentRequest struct {
+	ID string
+}
+
+// ForceStartTorrentResponse contains response arguments for Session.ForceStartTorrent method.
+type ForceStartTorrentResponse struct {
+}
+
+// MoveTorrentUpInQueueRequest contains request arguments for Session.MoveTorrentUpInQueue method.
+type MoveTorrentUpInQueueRequest struct {
+	ID string
+}
+
+// MoveTorrentUpInQueueResponse contains response arguments for Session.MoveTorrentUpInQueue method.
+type MoveTorrentUpInQueueResponse struct {
+}
+
+// MoveTorrentDownInQueueRequest contains request arguments for Session.MoveTorrentDownInQueue method.
+type MoveTorrentDownInQueueRequest struct {
+	ID string
+}
+
+// MoveTorrentDownInQueueResponse contains response arguments for Session.MoveTorrentDownInQueue method.
+type MoveTorrentDownInQueueResponse struct {
+}
+
+// SetTorrentSeedLimitsRequest contains request arguments for Session.SetTorrentSeedLimits method.
+type SetTorrentSeedLimitsRequest struct {
+	ID string
+	// Nil value makes the torrent use the global limits.
+	Limits *SeedLimits
+}
+
+// SetTorrentSeedLimitsResponse contains response arguments for Session.SetTorrentSeedLimits method.
+type SetTorrentSeedLimitsResponse struct {
+}
+
+// SetTorrentSpeedLimitsRequest contains request arguments for Session.SetTorrentSpeedLimits method.
+// Limits are in KB/s. Zero means no limit.
+type SetTorrentSpeedLimitsRequest struct {
+	ID       string
+	Download int64
+	Upload   int64
+}
+
+// SetTorrentSpeedLimitsResponse contains response arguments for Session.SetTorrentSpeedLimits method.
+type SetTorrentSpeedLimitsResponse struct {
+}
+
+// GetSeedLimitsRequest contains request arguments for Session.GetSeedLimits method.
+type GetSeedLimitsRequest struct {
+}
+
+// GetSeedLimitsResponse contains response arguments for Session.GetSeedLimits method.
+type GetSeedLimitsResponse struct {
+	Limits SeedLimits
+}
+
+// SetSeedLimitsRequest contains request arguments for Session.SetSeedLimits method.
+type SetSeedLimitsRequest struct {
+	Limits SeedLimits
+}
+
+// SetSeedLimitsResponse contains response arguments for Session.SetSeedLimits method.
+type SetSeedLimitsResponse struct {
+}
+
+// Label contains the default settings for torrents that have the label.
+// Speed limits are in KB/s. Zero means no limit.
+type Label struct {
+	Name               string
+	DataDir            string
+	SpeedLimitDownload int64
+	SpeedLimitUpload   int64
+	// Nil value means the global seeding limits are used.
+	SeedLimits    *SeedLimits
+	OnCompleteCmd []string
+}
+
+// ListLabelsRequest contains request arguments for Session.ListLabels method.
+type ListLabelsRequest struct {
+}
+
+// ListLabelsResponse contains response arguments for Session.ListLabels method.
+type ListLabelsResponse struct {
+	Labels []Label
+}
+
+// SetLabelRequest contains request arguments for Session.SetLabel method.
+type SetLabelRequest struct {
+	Label Label
+}
+
+// SetLabelResponse contains response arguments for Session.SetLabel method.
+type SetLabelResponse struct {
+}
+
+// RemoveLabelRequest contains request arguments for Session.RemoveLabel method.
+type RemoveLabelRequest struct {
+	Name string
+}
+
+// RemoveLabelResponse contains response arguments for Session.RemoveLabel method.
+type RemoveLabelResponse struct {
+}
+
+// SetTorrentLabelsRequest contains request arguments for Session.SetTorrentLabels method.
+type SetTorrentLabelsRequest struct {
+	ID     string
+	Labels []string
+}
+
+// SetTorrentLabelsResponse contains response arguments for Session.SetTorrentLabels method.
+type SetTorrentLabelsResponse struct {
+}
+
+// Feed is a RSS or Atom feed that is fetched for adding new torrents.
+// Interval is in seconds. Zero means the default interval of the session.
+type Feed struct {
+	Name           string
+	URL            string
+	Interval       uint
+	Include        []string
+	Exclude        []string
+	UniqueEpisodes bool
+	Label          string
+	DataDir        string
+	Stopped        bool
+	// Following fields are ignored in Session.AddFeed method.
+	LastUpdate Time
+	Error      string
+	ItemsAdded int
+}
+
+// ListFeedsRequest contains request arguments for Session.ListFeeds method.
+type ListFeedsRequest struct {
+}
+
+// ListFeedsResponse contains response arguments for Session.ListFeeds method.
+type ListFeedsResponse struct {
+	Feeds []Feed
+}
+
+// AddFeedRequest contains request arguments for Session.AddFeed method.
+type AddFeedRequest struct {
+	Feed Feed
+}
+
+// AddFeedResponse contains response arguments for Session.AddFeed method.
+type AddFeedResponse struct {
+}
+
+// RemoveFeedRequest contains request arguments for Session.RemoveFeed method.
+type RemoveFeedRequest struct {
+	Name string
+}
+
+// RemoveFeedResponse contains response arguments for Session.RemoveFeed method.
+type RemoveFeedResponse struct {
+}
+
+// Event is a change in the state of a session or a torrent.
+// Events are streamed from "/events" path of the RPC server as Server-Sent Events.
+// Fields other than Type, Time and torrent fields are only set for the related event types.
+type Event struct {
+	Type          string
+	Time          Time
+	TorrentID     string
+	TorrentName   string
+	Piece         uint32
+	File          string
+	Tracker       string
+	TrackerStatus string
+	Peer          string
+	Error         string
+}
+
 // AnnounceTorrentRequest contains request arguments for Session.AnnounceTorrent method.
 type AnnounceTorrentRequest struct {
 	ID string
@@ -313,6 +579,16 @@ type MoveTorrentRequest struct {
 type MoveTorrentResponse struct {
 }
 
+// MoveDataRequest contains request arguments for Session.MoveData method.
+type MoveDataRequest struct {
+	ID      string
+	DataDir string
+}
+
+// MoveDataResponse contains response arguments for Session.MoveData method.
+type MoveDataResponse struct {
+}
+
 // AddPeerRequest contains request arguments for Session.AddPeer method.
 type AddPeerRequest struct {
 	ID   string
@@ -0,0 +1,79 @@
+// Package speedlimit provides hierarchical limiting of transfer speeds.
+// Limiters are chained from the most specific one to the most general one (peer -> torrent -> session).
+// A transfer waits until all of the limiters in the chain allow it.
+package speedlimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/juju/ratelimit"
+)
+
+// Limiter limits the rate of transferred bytes with a token bucket.
+// A nil *Limiter is valid and does not limit anything.
+type Limiter struct {
+	parent *Limiter
+
+	m      sync.RWMutex
+	rate   int64
+	bucket *ratelimit.Bucket
+}
+
+// New returns a new unlimited Limiter. Transfers are also limited by parent if it is not nil.
+func New(parent *Limiter) *Limiter {
+	return &Limiter{parent: parent}
+}
+
+// SetRate changes the limit in bytes per second. Zero or negative value removes the limit.
+func (l *Limiter) SetRate(bytesPerSecond int64) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if bytesPerSecond <= 0 {
+		l.rate = 0
+		l.bucket = nil
+		return
+	}
+	if bytesPerSecond == l.rate {
+		return
+	}
+	l.rate = bytesPerSecond
+	l.bucket = ratelimit.NewBucketWithRate(float64(bytesPerSecond), bytesPerSecond)
+}
+
+// Rate returns the limit of this Limiter in bytes per second. Limits of the parents are not taken into account.
+// Zero means no limit.
+func (l *Limiter) Rate() int64 {
+	if l == nil {
+		return 0
+	}
+	l.m.RLock()
+	defer l.m.RUnlock()
+	return l.rate
+}
+
+// Take takes n bytes from the buckets of all limiters in the chain and
+// returns the duration that the caller must wait before transferring the bytes.
+func (l *Limiter) Take(n int64) time.Duration {
+	var d time.Duration
+	for ; l != nil; l = l.parent {
+		l.m.RLock()
+		if l.bucket != nil {
+			if d2 := l.bucket.Take(n); d2 > d {
+				d = d2
+			}
+		}
+		l.m.RUnlock()
+	}
+	return d
+}
+
+// Limited returns true if any of the limiters in the chain has a limit.
+func (l *Limiter) Limited() bool {
+	for ; l != nil; l = l.parent {
+		if l.Rate() > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package speedlimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChain(t *testing.T) {
+	session := New(nil)
+	torrent := New(session)
+	peer := New(torrent)
+	if peer.Limited() {
+		t.Fatal("limiter must not be limited")
+	}
+	if d := peer.Take(1 << 20); d != 0 {
+		t.Fatalf("unlimited take must not wait: %s", d)
+	}
+
+	// Slowest limiter in the chain determines the wait duration.
+	session.SetRate(1000)
+	torrent.SetRate(100)
+	if !peer.Limited() {
+		t.Fatal("limiter must be limited by its parents")
+	}
+	peer.Take(100)
+	if d := peer.Take(100); d < 900*time.Millisecond || d > time.Second {
+		t.Fatalf("unexpected wait duration: %s", d)
+	}
+
+	torrent.SetRate(0)
+	if torrent.Rate() != 0 {
+		t.Fatal("limit is not removed")
+	}
+	if d := peer.Take(800); d != 0 {
+		t.Fatalf("unexpected wait duration: %s", d)
+	}
+}
+
+func TestNil(t *testing.T) {
+	var l *Limiter
+	if l.Limited() || l.Rate() != 0 || l.Take(100) != 0 {
+		t.Fatal("nil limiter must not limit")
+	}
+}
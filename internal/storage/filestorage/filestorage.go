@@ -5,6 +5,8 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/cenkalti/rain/internal/storage"
 )
@@ -13,9 +15,12 @@ import (
 type FileStorage struct {
 	dest string
 	perm fs.FileMode
+	// Destination directory contains the files of a single torrent and it can be removed.
+	ownsDest bool
 }
 
 // New returns a new FileStorage at the destination.
+// The destination may be shared with other storages so it is never removed.
 func New(dest string, perm fs.FileMode) (*FileStorage, error) {
 	var err error
 	dest, err = filepath.Abs(dest)
@@ -25,7 +30,21 @@ func New(dest string, perm fs.FileMode) (*FileStorage, error) {
 	return &FileStorage{dest: dest, perm: perm}, nil
 }
 
-var _ storage.Storage = (*FileStorage)(nil)
+// NewTorrentDir returns a new FileStorage at the destination that contains the files of a single torrent.
+// Unlike New, the destination is removed by RemoveAll if it becomes empty.
+func NewTorrentDir(dest string, perm fs.FileMode) (*FileStorage, error) {
+	s, err := New(dest, perm)
+	if err != nil {
+		return nil, err
+	}
+	s.ownsDest = true
+	return s, nil
+}
+
+var (
+	_ storage.Storage = (*FileStorage)(nil)
+	_ storage.Exister = (*FileStorage)(nil)
+)
 
 // Open a file.
 func (s *FileStorage) Open(name string, size int64) (f storage.File, exists bool, err error) {
@@ -81,6 +100,46 @@ func (s *FileStorage) Open(name string, size int64) (f storage.File, exists bool
 	return
 }
 
+// Exists returns true if the file exists under the destination directory.
+func (s *FileStorage) Exists(name string) (bool, error) {
+	_, err := os.Stat(filepath.Join(s.dest, filepath.Clean(name)))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// RootDir returns the destination directory.
 func (s *FileStorage) RootDir() string {
 	return s.dest
 }
+
+// RemoveAll removes the files and the directories under the destination that become empty after removing the files.
+// The destination directory is removed only if the storage is created with NewTorrentDir.
+func (s *FileStorage) RemoveAll(names []string) error {
+	dirs := make(map[string]struct{})
+	for _, name := range names {
+		name = filepath.Join(s.dest, filepath.Clean(name))
+		err := os.Remove(name)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for dir := filepath.Dir(name); strings.HasPrefix(dir, s.dest+string(filepath.Separator)); dir = filepath.Dir(dir) {
+			dirs[dir] = struct{}{}
+		}
+	}
+	sorted := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		sorted = append(sorted, dir)
+	}
+	// Remove child directories before their parents.
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	for _, dir := range sorted {
+		_ = os.Remove(dir)
+	}
+	if s.ownsDest {
+		// Fails if the directory is not empty.
+		_ = os.Remove(s.dest)
+	}
+	return nil
+}
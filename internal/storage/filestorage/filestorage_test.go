@@ -0,0 +1,86 @@
+package filestorage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openFiles(t *testing.T, s *FileStorage, names ...string) {
+	for _, name := range names {
+		f, _, err := s.Open(name, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+}
+
+func exists(t *testing.T, path string) bool {
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return true
+}
+
+func TestRemoveAllSharedDest(t *testing.T) {
+	dest := t.TempDir()
+	s1, err := New(dest, 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := New(dest, 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	openFiles(t, s1, filepath.Join("foo", "a"), filepath.Join("foo", "bar", "b"))
+	openFiles(t, s2, filepath.Join("baz", "c"))
+
+	err = s1.RemoveAll([]string{filepath.Join("foo", "a"), filepath.Join("foo", "bar", "b")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists(t, filepath.Join(dest, "foo")) {
+		t.Fatal("empty directory is not removed")
+	}
+	if !exists(t, filepath.Join(dest, "baz", "c")) {
+		t.Fatal("file of other storage is removed")
+	}
+
+	// Destination is kept after the last files in it are removed.
+	err = s2.RemoveAll([]string{filepath.Join("baz", "c")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists(t, filepath.Join(dest, "baz")) {
+		t.Fatal("empty directory is not removed")
+	}
+	if !exists(t, dest) {
+		t.Fatal("shared destination is removed")
+	}
+}
+
+func TestRemoveAllTorrentDir(t *testing.T) {
+	root := t.TempDir()
+	dest := filepath.Join(root, "id")
+	s, err := NewTorrentDir(dest, 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	openFiles(t, s, filepath.Join("foo", "a"))
+
+	err = s.RemoveAll([]string{filepath.Join("foo", "a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists(t, dest) {
+		t.Fatal("torrent directory is not removed")
+	}
+	if !exists(t, root) {
+		t.Fatal("parent of torrent directory is removed")
+	}
+}
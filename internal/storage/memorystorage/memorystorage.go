@@ -0,0 +1,140 @@
+// Package memorystorage implements Storage interface that keeps files in memory.
+package memorystorage
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"sync"
+
+	"github.com/cenkalti/rain/internal/storage"
+)
+
+// MemoryStorage implements Storage interface for keeping files in memory.
+// Data is lost when the MemoryStorage is garbage collected.
+type MemoryStorage struct {
+	files map[string]*File
+	m     sync.Mutex
+}
+
+// New returns a new empty MemoryStorage.
+func New() *MemoryStorage {
+	return &MemoryStorage{files: make(map[string]*File)}
+}
+
+var (
+	_ storage.Storage = (*MemoryStorage)(nil)
+	_ storage.Exister = (*MemoryStorage)(nil)
+)
+
+// Open a file.
+func (s *MemoryStorage) Open(name string, size int64) (f storage.File, exists bool, err error) {
+	name = filepath.Clean(name)
+	s.m.Lock()
+	defer s.m.Unlock()
+	mf, exists := s.files[name]
+	if !exists {
+		mf = &File{}
+		s.files[name] = mf
+	}
+	mf.truncate(size)
+	return mf, exists, nil
+}
+
+// Exists returns true if the file is opened before.
+func (s *MemoryStorage) Exists(name string) (bool, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	_, ok := s.files[filepath.Clean(name)]
+	return ok, nil
+}
+
+// RootDir returns an empty string because files are not saved on disk.
+func (s *MemoryStorage) RootDir() string {
+	return ""
+}
+
+// RemoveAll deletes the files from memory.
+func (s *MemoryStorage) RemoveAll(names []string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	for _, name := range names {
+		delete(s.files, filepath.Clean(name))
+	}
+	return nil
+}
+
+// File is a file in MemoryStorage.
+// Memory is allocated when data is written to the file.
+type File struct {
+	data []byte
+	size int64
+	m    sync.RWMutex
+}
+
+var _ storage.File = (*File)(nil)
+
+func (f *File) truncate(size int64) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	if int64(len(f.data)) > size {
+		// Limit capacity so truncated data does not show up again when the file is extended.
+		f.data = f.data[:size:size]
+	}
+	f.size = size
+}
+
+// ReadAt implements io.ReaderAt interface.
+// Parts of the file that are not written yet are read as zeros.
+func (f *File) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	f.m.RLock()
+	defer f.m.RUnlock()
+	if off >= f.size {
+		return 0, io.EOF
+	}
+	n = len(p)
+	if remaining := f.size - off; int64(n) > remaining {
+		n = int(remaining)
+		err = io.EOF
+	}
+	var m int
+	if off < int64(len(f.data)) {
+		m = copy(p[:n], f.data[off:])
+	}
+	for i := m; i < n; i++ {
+		p[i] = 0
+	}
+	return n, err
+}
+
+// WriteAt implements io.WriterAt interface.
+// The file is extended if data is written past the end.
+func (f *File) WriteAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	f.m.Lock()
+	defer f.m.Unlock()
+	end := off + int64(len(p))
+	if end > int64(len(f.data)) {
+		if end > int64(cap(f.data)) {
+			data := make([]byte, end, end+end/4)
+			copy(data, f.data)
+			f.data = data
+		} else {
+			f.data = f.data[:end]
+		}
+	}
+	if end > f.size {
+		f.size = end
+	}
+	return copy(f.data[off:], p), nil
+}
+
+// Close does nothing. Data is kept in memory until the file is removed from storage.
+func (f *File) Close() error {
+	return nil
+}
@@ -0,0 +1,67 @@
+package memorystorage
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	s := New()
+	f, exists, err := s.Open("foo/bar", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("file must not exist")
+	}
+	_, err = f.WriteAt([]byte("abc"), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 10)
+	n, err := f.ReadAt(b, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 || !bytes.Equal(b, []byte{0, 0, 0, 0, 'a', 'b', 'c', 0, 0, 0}) {
+		t.Fatalf("unexpected data: %v", b[:n])
+	}
+	n, err = f.ReadAt(b, 8)
+	if err != io.EOF || n != 2 {
+		t.Fatalf("unexpected read result: %d, %v", n, err)
+	}
+
+	// Truncated data must not be visible after extending the file.
+	f2, exists, err := s.Open("foo/bar", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("file must exist")
+	}
+	_, err = f2.WriteAt([]byte("x"), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = make([]byte, 8)
+	_, err = f2.ReadAt(b, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, []byte{0, 0, 0, 0, 'a', 0, 0, 'x'}) {
+		t.Fatalf("unexpected data: %v", b)
+	}
+
+	err = s.RemoveAll([]string{"foo/bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, exists, err = s.Open("foo/bar", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("file must be removed")
+	}
+}
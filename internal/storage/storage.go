@@ -5,8 +5,19 @@ import "io"
 
 // Storage is an interface for reading/writing torrent files.
 type Storage interface {
+	// Open a file with the name. If the file does not exist, it is created with the size.
+	// If the file exists, it is truncated or extended to the size.
 	Open(name string, size int64) (f File, exists bool, err error)
+	// RootDir returns the location of the files. It is passed to OnCompleteCmd.
 	RootDir() string
+	// RemoveAll removes the files with the names and cleans up the remaining empty directories.
+	RemoveAll(names []string) error
+}
+
+// Exister is implemented by storages that can check whether a file exists without creating it.
+// Files that are not wanted are not created when they are only read.
+type Exister interface {
+	Exists(name string) (bool, error)
 }
 
 // File interface for reading/writing torrent data.
@@ -15,3 +26,8 @@ type File interface {
 	io.WriterAt
 	io.Closer
 }
+
+// Syncer is implemented by files that can commit their contents to stable storage.
+type Syncer interface {
+	Sync() error
+}
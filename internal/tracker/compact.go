@@ -58,3 +58,54 @@ func DecodePeersCompact(b []byte) ([]*net.TCPAddr, error) {
 	}
 	return addrs, nil
 }
+
+// CompactPeer6 is a struct value which consist of a 16-bytes IPv6 address and a 2-bytes port value.
+type CompactPeer6 struct {
+	IP   [net.IPv6len]byte
+	Port uint16
+}
+
+// NewCompactPeer6 returns a new CompactPeer6 from a net.TCPAddr.
+func NewCompactPeer6(addr *net.TCPAddr) CompactPeer6 {
+	p := CompactPeer6{Port: uint16(addr.Port)}
+	copy(p.IP[:], addr.IP.To16())
+	return p
+}
+
+// Addr returns a net.TCPAddr from CompactPeer6.
+func (p CompactPeer6) Addr() *net.TCPAddr {
+	return &net.TCPAddr{IP: p.IP[:], Port: int(p.Port)}
+}
+
+// MarshalBinary returns the bytes.
+func (p CompactPeer6) MarshalBinary() ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, 18))
+	err := binary.Write(buf, binary.BigEndian, p)
+	return buf.Bytes(), err
+}
+
+// UnmarshalBinary reads bytes from a slice into the CompactPeer6.
+func (p *CompactPeer6) UnmarshalBinary(data []byte) error {
+	if len(data) != 18 {
+		return errors.New("invalid compact peer length")
+	}
+	return binary.Read(bytes.NewReader(data), binary.BigEndian, p)
+}
+
+// DecodePeersCompact6 parses and returns addresses for list of CompactPeer6s.
+func DecodePeersCompact6(b []byte) ([]*net.TCPAddr, error) {
+	if len(b)%18 != 0 {
+		return nil, errors.New("invalid peer list length")
+	}
+	count := len(b) / 18
+	addrs := make([]*net.TCPAddr, 0, count)
+	for i := 0; i < len(b); i += 18 {
+		var peer CompactPeer6
+		err := peer.UnmarshalBinary(b[i : i+18])
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, peer.Addr())
+	}
+	return addrs, nil
+}
@@ -1,6 +1,7 @@
 package tracker
 
 import (
+	"net"
 	"testing"
 )
 
@@ -22,3 +23,18 @@ func TestCompactPeer(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestCompactPeer6(t *testing.T) {
+	cp := NewCompactPeer6(&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 5})
+	b, err := cp.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs, err := DecodePeersCompact6(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0].String() != "[2001:db8::1]:5" {
+		t.Fatal(addrs)
+	}
+}
@@ -14,5 +14,20 @@ type announceResponse struct {
 	Complete       int32              `bencode:"complete"`
 	Incomplete     int32              `bencode:"incomplete"`
 	Peers          bencode.RawMessage `bencode:"peers"`
+	Peers6         []byte             `bencode:"peers6"`
 	ExternalIP     []byte             `bencode:"external ip"`
 }
+
+type scrapeResponse struct {
+	FailureReason string                `bencode:"failure reason"`
+	Files         map[string]scrapeFile `bencode:"files"`
+	Flags         struct {
+		MinRequestInterval int32 `bencode:"min_request_interval"`
+	} `bencode:"flags"`
+}
+
+type scrapeFile struct {
+	Complete   int32 `bencode:"complete"`
+	Incomplete int32 `bencode:"incomplete"`
+	Downloaded int32 `bencode:"downloaded"`
+}
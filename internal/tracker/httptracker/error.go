@@ -5,7 +5,7 @@ import (
 	"strconv"
 )
 
-// StatusError is returned from HTTP tracker announces when the response code is not 200 OK.
+// StatusError is returned from HTTP tracker announces and scrapes when the response code is not 200 OK.
 type StatusError struct {
 	Code   int
 	Header http.Header
@@ -1,7 +1,6 @@
 package httptracker
 
 import (
-	"bytes"
 	"context"
 	"encoding/hex"
 	"fmt"
@@ -19,9 +18,13 @@ import (
 	"github.com/zeebo/bencode"
 )
 
+// Number of info hashes sent in a single scrape request.
+const maxScrapeInfoHashes = 50
+
 // HTTPTracker is a torrent tracker that talks HTTP.
 type HTTPTracker struct {
 	rawURL            string
+	scrapeURL         string
 	log               logger.Logger
 	http              *http.Client
 	transport         *http.Transport
@@ -36,6 +39,7 @@ var _ tracker.Tracker = (*HTTPTracker)(nil)
 func New(rawURL string, u *url.URL, timeout time.Duration, t *http.Transport, userAgent string, maxResponseLength int64) *HTTPTracker {
 	return &HTTPTracker{
 		rawURL:            rawURL,
+		scrapeURL:         scrapeURL(u),
 		log:               logger.New("tracker " + u.Host),
 		transport:         t,
 		userAgent:         userAgent,
@@ -92,33 +96,7 @@ func (t *HTTPTracker) Announce(ctx context.Context, req tracker.AnnounceRequest)
 
 	t.log.Debugf("making request to: %q", sb.String())
 
-	httpReq, err := http.NewRequest(http.MethodGet, sb.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	httpReq = httpReq.WithContext(ctx)
-
-	httpReq.Header.Set("User-Agent", t.userAgent)
-
-	doReq := func() (int, http.Header, []byte, error) {
-		resp, err := t.http.Do(httpReq)
-		if err != nil {
-			return 0, nil, nil, err
-		}
-		t.log.Debugf("tracker responded %d with %d bytes body", resp.StatusCode, resp.ContentLength)
-		defer resp.Body.Close()
-		if resp.ContentLength > t.maxResponseLength {
-			return 0, resp.Header, nil, fmt.Errorf("tracker respsonse too large: %d", resp.ContentLength)
-		}
-		r := io.LimitReader(resp.Body, t.maxResponseLength)
-		data, err := ioutil.ReadAll(r)
-		return resp.StatusCode, resp.Header, data, err
-	}
-
-	code, header, body, err := doReq()
-	if uerr, ok := err.(*url.Error); ok && uerr.Err == context.Canceled {
-		return nil, context.Canceled
-	}
+	code, header, body, err := t.get(ctx, sb.String())
 	if err != nil {
 		return nil, err
 	}
@@ -166,13 +144,21 @@ func (t *HTTPTracker) Announce(ctx context.Context, req tracker.AnnounceRequest)
 	if err != nil {
 		return nil, err
 	}
+	// IPv6 peers are always in binary model (BEP 7).
+	if len(response.Peers6) > 0 {
+		peers6, err := tracker.DecodePeersCompact6(response.Peers6)
+		if err != nil {
+			return nil, err
+		}
+		peers = append(peers, peers6...)
+	}
 	t.log.Debugf("got %d peers", len(peers))
 
 	// Filter external IP
 	if len(response.ExternalIP) != 0 {
 		var filtered int
 		for i, p := range peers {
-			if !bytes.Equal(p.IP[:], response.ExternalIP) {
+			if !p.IP.Equal(response.ExternalIP) {
 				peers[i] = p
 				filtered++
 			}
@@ -190,6 +176,125 @@ func (t *HTTPTracker) Announce(ctx context.Context, req tracker.AnnounceRequest)
 	}, nil
 }
 
+// Scrape the torrents by doing GET requests to the scrape URL of the tracker.
+// Info hashes are sent in batches to keep the URL length in limits.
+func (t *HTTPTracker) Scrape(ctx context.Context, infoHashes [][20]byte) (*tracker.ScrapeResponse, error) {
+	if t.scrapeURL == "" {
+		return nil, tracker.ErrScrapeNotSupported
+	}
+	ret := &tracker.ScrapeResponse{
+		Torrents: make(map[[20]byte]tracker.ScrapeTorrent, len(infoHashes)),
+	}
+	for len(infoHashes) > 0 {
+		n := len(infoHashes)
+		if n > maxScrapeInfoHashes {
+			n = maxScrapeInfoHashes
+		}
+		err := t.scrape(ctx, infoHashes[:n], ret)
+		if err != nil {
+			return nil, err
+		}
+		infoHashes = infoHashes[n:]
+	}
+	return ret, nil
+}
+
+func (t *HTTPTracker) scrape(ctx context.Context, infoHashes [][20]byte, ret *tracker.ScrapeResponse) error {
+	var sb strings.Builder
+	sb.WriteString(t.scrapeURL)
+	for i, ih := range infoHashes {
+		if i == 0 && !strings.ContainsRune(t.scrapeURL, '?') {
+			sb.WriteString("?info_hash=")
+		} else {
+			sb.WriteString("&info_hash=")
+		}
+		sb.WriteString(percentEscape(ih))
+	}
+
+	t.log.Debugf("making request to: %q", sb.String())
+
+	code, header, body, err := t.get(ctx, sb.String())
+	if err != nil {
+		return err
+	}
+
+	var response scrapeResponse
+	err = bencode.DecodeBytes(body, &response)
+	if err != nil {
+		if code != 200 {
+			return &StatusError{
+				Code:   code,
+				Header: header,
+				Body:   string(body),
+			}
+		}
+		return tracker.ErrDecode
+	}
+
+	if response.FailureReason != "" {
+		return &tracker.Error{FailureReason: response.FailureReason}
+	}
+
+	for key, f := range response.Files {
+		if len(key) != 20 {
+			return tracker.ErrDecode
+		}
+		var ih [20]byte
+		copy(ih[:], key)
+		ret.Torrents[ih] = tracker.ScrapeTorrent{
+			Seeders:    f.Complete,
+			Leechers:   f.Incomplete,
+			Downloaded: f.Downloaded,
+		}
+	}
+	minInterval := time.Duration(response.Flags.MinRequestInterval) * time.Second
+	if minInterval > ret.MinInterval {
+		ret.MinInterval = minInterval
+	}
+	return nil
+}
+
+// get does a GET request to the tracker and returns the status code, headers and body of the response.
+func (t *HTTPTracker) get(ctx context.Context, u string) (int, http.Header, []byte, error) {
+	httpReq, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	httpReq = httpReq.WithContext(ctx)
+
+	httpReq.Header.Set("User-Agent", t.userAgent)
+
+	resp, err := t.http.Do(httpReq)
+	if uerr, ok := err.(*url.Error); ok && uerr.Err == context.Canceled {
+		return 0, nil, nil, context.Canceled
+	}
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	t.log.Debugf("tracker responded %d with %d bytes body", resp.StatusCode, resp.ContentLength)
+	defer resp.Body.Close()
+	if resp.ContentLength > t.maxResponseLength {
+		return 0, resp.Header, nil, fmt.Errorf("tracker respsonse too large: %d", resp.ContentLength)
+	}
+	r := io.LimitReader(resp.Body, t.maxResponseLength)
+	data, err := ioutil.ReadAll(r)
+	return resp.StatusCode, resp.Header, data, err
+}
+
+// scrapeURL returns the scrape URL of the tracker by the convention in BEP 48.
+// The last path segment of the announce URL must begin with "announce", which is replaced with "scrape".
+// Returns empty string if the tracker does not support scraping.
+func scrapeURL(u *url.URL) string {
+	i := strings.LastIndexByte(u.Path, '/')
+	if i < 0 || !strings.HasPrefix(u.Path[i+1:], "announce") {
+		return ""
+	}
+	su := *u
+	su.Path = u.Path[:i+1] + "scrape" + u.Path[i+1+len("announce"):]
+	su.RawPath = ""
+	return su.String()
+}
+
 // percentEscape puts `%` before every byte.
 // Some trackers don't like the output of url.QueryEscape function because it may skip encoding safe characters.
 // This function escapes every byte explicitly.
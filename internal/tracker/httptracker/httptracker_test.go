@@ -2,7 +2,9 @@ package httptracker_test
 
 import (
 	"context"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
 	"time"
@@ -99,3 +101,120 @@ func TestHTTPTracker(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestHTTPTrackerPeers6(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peers := "\x01\x02\x03\x04\x04\x57"
+		peers6 := string(net.ParseIP("2001:db8::1")) + "\x08\xae"
+		_, _ = w.Write([]byte("d8:intervali60e5:peers6:" + peers + "6:peers618:" + peers6 + "e"))
+	}))
+	defer srv.Close()
+
+	rawURL := srv.URL + "/announce"
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trk := httptracker.New(rawURL, u, timeout, new(http.Transport), "Mozilla/5.0", 2*1024*1024)
+	resp, err := trk.Announce(context.Background(), tracker.AnnounceRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Peers) != 2 {
+		t.Fatalf("%#v", resp)
+	}
+	if s := resp.Peers[0].String(); s != "1.2.3.4:1111" {
+		t.Fatal(s)
+	}
+	if s := resp.Peers[1].String(); s != "[2001:db8::1]:2222" {
+		t.Fatal(s)
+	}
+}
+
+func TestHTTPTrackerScrape(t *testing.T) {
+	defer startHTTPTracker(t)()
+
+	const rawURL = "http://127.0.0.1:5000/announce"
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trk := httptracker.New(rawURL, u, timeout, new(http.Transport), "Mozilla/5.0", 2*1024*1024)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for i, left := range []int64{0, 1, 1} {
+		req := tracker.AnnounceRequest{
+			Torrent: tracker.Torrent{
+				InfoHash:  [20]byte{6},
+				PeerID:    [20]byte{byte(i + 1)},
+				Port:      1111 + i,
+				BytesLeft: left,
+			},
+		}
+		_, err = trk.Announce(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp, err := trk.Scrape(ctx, [][20]byte{{6}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, ok := resp.Torrents[[20]byte{6}]
+	if !ok {
+		t.Fatalf("%#v", resp)
+	}
+	if st.Seeders != 1 || st.Leechers != 2 {
+		t.Fatalf("%#v", st)
+	}
+}
+
+func TestHTTPTrackerScrapeURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/x/scrape.php" || r.URL.Query().Get("passkey") != "secret" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if ih := r.URL.Query()["info_hash"]; len(ih) != 2 {
+			t.Errorf("invalid info_hash params: %q", ih)
+		}
+		ih := string([]byte{1}) + string(make([]byte, 19))
+		_, _ = w.Write([]byte("d5:filesd20:" + ih + "d8:completei3e10:downloadedi5e10:incompletei4eee5:flagsd20:min_request_intervali900eee"))
+	}))
+	defer srv.Close()
+
+	rawURL := srv.URL + "/x/announce.php?passkey=secret"
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trk := httptracker.New(rawURL, u, timeout, new(http.Transport), "Mozilla/5.0", 2*1024*1024)
+	resp, err := trk.Scrape(context.Background(), [][20]byte{{1}, {2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := resp.Torrents[[20]byte{1}]; st.Seeders != 3 || st.Leechers != 4 || st.Downloaded != 5 {
+		t.Fatalf("%#v", st)
+	}
+	if _, ok := resp.Torrents[[20]byte{2}]; ok {
+		t.Fatal("unexpected torrent in response")
+	}
+	if resp.MinInterval != 15*time.Minute {
+		t.Fatal(resp.MinInterval)
+	}
+
+	rawURL = srv.URL + "/x/tracker"
+	u, err = url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trk = httptracker.New(rawURL, u, timeout, new(http.Transport), "Mozilla/5.0", 2*1024*1024)
+	_, err = trk.Scrape(context.Background(), [][20]byte{{1}})
+	if err != tracker.ErrScrapeNotSupported {
+		t.Fatal(err)
+	}
+}
@@ -33,6 +33,11 @@ func (t *Tier) Announce(ctx context.Context, req AnnounceRequest) (*AnnounceResp
 	return resp, err
 }
 
+// Scrape torrents on the current Tracker in the Tier.
+func (t *Tier) Scrape(ctx context.Context, infoHashes [][20]byte) (*ScrapeResponse, error) {
+	return t.Trackers[t.loadIndex()].Scrape(ctx, infoHashes)
+}
+
 // URL returns the current Tracker in the Tier.
 func (t *Tier) URL() string {
 	return t.Trackers[t.loadIndex()].URL()
@@ -1,4 +1,4 @@
-// Package tracker provides support for announcing torrents to HTTP and UDP trackers.
+// Package tracker provides support for announcing and scraping torrents on HTTP and UDP trackers.
 package tracker
 
 import (
@@ -15,6 +15,11 @@ type Tracker interface {
 	// Announce should also be called on specific events.
 	Announce(ctx context.Context, req AnnounceRequest) (*AnnounceResponse, error)
 
+	// Scrape returns the swarm statistics of the torrents with given info hashes.
+	// Implementations may split a large list of info hashes into multiple requests.
+	// ErrScrapeNotSupported is returned if the tracker does not support scraping.
+	Scrape(ctx context.Context, infoHashes [][20]byte) (*ScrapeResponse, error)
+
 	// URL of the tracker.
 	URL() string
 }
@@ -36,6 +41,23 @@ type AnnounceResponse struct {
 	Peers          []*net.TCPAddr
 }
 
+// ScrapeResponse contains the statistics of torrents returned by the tracker in response to scrape request.
+type ScrapeResponse struct {
+	// Torrents that are not known by the tracker may be missing from the map.
+	Torrents    map[[20]byte]ScrapeTorrent
+	MinInterval time.Duration
+}
+
+// ScrapeTorrent contains the statistics of a single torrent in the swarm.
+type ScrapeTorrent struct {
+	Seeders    int32
+	Leechers   int32
+	Downloaded int32
+}
+
+// ErrScrapeNotSupported is returned from Tracker.Scrape method when the tracker does not have a scrape URL.
+var ErrScrapeNotSupported = errors.New("scrape is not supported by tracker")
+
 // ErrDecode is returned from Tracker.Announce method when there is problem with the encoding of response.
 var ErrDecode = errors.New("cannot decode response")
 
@@ -108,3 +108,23 @@ func (r *transferAnnounceRequest) WriteTo(w io.Writer) (int64, error) {
 
 	return int64(buf.Buffered()), buf.Flush()
 }
+
+type scrapeRequest struct {
+	udpRequestHeader
+	InfoHashes [][20]byte
+}
+
+func (r *scrapeRequest) WriteTo(w io.Writer) (int64, error) {
+	buf := bufio.NewWriterSize(w, 16+20*len(r.InfoHashes))
+	err := binary.Write(buf, binary.BigEndian, &r.udpRequestHeader)
+	if err != nil {
+		return 0, err
+	}
+	for _, ih := range r.InfoHashes {
+		_, err = buf.Write(ih[:])
+		if err != nil {
+			return 0, err
+		}
+	}
+	return int64(buf.Buffered()), buf.Flush()
+}
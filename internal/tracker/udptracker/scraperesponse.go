@@ -0,0 +1,8 @@
+package udptracker
+
+// udpScrapeResponseItem is repeated for each info hash in the scrape response, after the message header.
+type udpScrapeResponseItem struct {
+	Seeders   int32
+	Completed int32
+	Leechers  int32
+}
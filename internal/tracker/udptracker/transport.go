@@ -77,8 +77,9 @@ func (t *Transport) listen() error {
 		return nil
 	}
 
+	// Listens on both IPv4 and IPv6 if the system supports dual-stack sockets.
 	var laddr net.UDPAddr
-	conn, err := net.ListenUDP("udp4", &laddr)
+	conn, err := net.ListenUDP("udp", &laddr)
 	if err != nil {
 		return err
 	}
@@ -138,7 +139,7 @@ func (t *Transport) Close() error {
 func (t *Transport) readLoop() {
 	// Read buffer must be big enough to hold a UDP packet of maximum expected size.
 	const maxNumWant = 1000
-	bigBuf := make([]byte, 20+6*maxNumWant)
+	bigBuf := make([]byte, 20+18*maxNumWant)
 	for {
 		n, err := t.conn.Read(bigBuf)
 		if err != nil {
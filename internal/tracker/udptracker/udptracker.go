@@ -16,6 +16,9 @@ import (
 	"github.com/cenkalti/rain/internal/tracker"
 )
 
+// Number of info hashes sent in a single scrape request. More than this would not fit in a single UDP packet.
+const maxScrapeInfoHashes = 74
+
 // UDPTracker is a torrent tracker that speaks UDP.
 type UDPTracker struct {
 	rawURL    string
@@ -69,7 +72,9 @@ func (t *UDPTracker) Announce(ctx context.Context, req tracker.AnnounceRequest)
 		return nil, err
 	}
 
-	response, peers, err := t.parseAnnounceResponse(reply)
+	// BEP 15: Trackers send IPv6 peers if the announce is done over IPv6.
+	ipv6 := trx.addr.(*net.UDPAddr).IP.To4() == nil
+	response, peers, err := t.parseAnnounceResponse(reply, ipv6)
 	if err != nil {
 		return nil, tracker.ErrDecode
 	}
@@ -83,7 +88,75 @@ func (t *UDPTracker) Announce(ctx context.Context, req tracker.AnnounceRequest)
 	}, nil
 }
 
-func (t *UDPTracker) parseAnnounceResponse(data []byte) (*udpAnnounceResponse, []*net.TCPAddr, error) {
+// Scrape the torrents on UDP tracker.
+// Info hashes are sent in batches because the response must fit in a single UDP packet.
+func (t *UDPTracker) Scrape(ctx context.Context, infoHashes [][20]byte) (*tracker.ScrapeResponse, error) {
+	ret := &tracker.ScrapeResponse{
+		Torrents: make(map[[20]byte]tracker.ScrapeTorrent, len(infoHashes)),
+	}
+	for len(infoHashes) > 0 {
+		n := len(infoHashes)
+		if n > maxScrapeInfoHashes {
+			n = maxScrapeInfoHashes
+		}
+		err := t.scrape(ctx, infoHashes[:n], ret)
+		if err != nil {
+			return nil, err
+		}
+		infoHashes = infoHashes[n:]
+	}
+	return ret, nil
+}
+
+func (t *UDPTracker) scrape(ctx context.Context, infoHashes [][20]byte, ret *tracker.ScrapeResponse) error {
+	request := &scrapeRequest{InfoHashes: infoHashes}
+	request.SetAction(actionScrape)
+	trx := newTransaction(request, t.dest)
+
+	reply, err := t.transport.Do(ctx, trx)
+	if err != nil {
+		return err
+	}
+
+	items, err := t.parseScrapeResponse(reply, len(infoHashes))
+	if err != nil {
+		return tracker.ErrDecode
+	}
+	for i, item := range items {
+		ret.Torrents[infoHashes[i]] = tracker.ScrapeTorrent{
+			Seeders:    item.Seeders,
+			Leechers:   item.Leechers,
+			Downloaded: item.Completed,
+		}
+	}
+	return nil
+}
+
+func (t *UDPTracker) parseScrapeResponse(data []byte, numInfoHashes int) ([]udpScrapeResponseItem, error) {
+	r := bytes.NewReader(data)
+	var header udpMessageHeader
+	err := binary.Read(r, binary.BigEndian, &header)
+	if err != nil {
+		return nil, err
+	}
+	if header.Action != actionScrape {
+		return nil, errors.New("invalid action")
+	}
+	// Some trackers limit the number of torrents in response. Missing ones are not included in the result.
+	n := r.Len() / binary.Size(udpScrapeResponseItem{})
+	if n > numInfoHashes {
+		n = numInfoHashes
+	}
+	items := make([]udpScrapeResponseItem, n)
+	err = binary.Read(r, binary.BigEndian, items)
+	if err != nil {
+		return nil, err
+	}
+	t.log.Debugf("scrapeResponse: %#v", items)
+	return items, nil
+}
+
+func (t *UDPTracker) parseAnnounceResponse(data []byte, ipv6 bool) (*udpAnnounceResponse, []*net.TCPAddr, error) {
 	var response udpAnnounceResponse
 	err := binary.Read(bytes.NewReader(data), binary.BigEndian, &response)
 	if err != nil {
@@ -93,7 +166,11 @@ func (t *UDPTracker) parseAnnounceResponse(data []byte) (*udpAnnounceResponse, [
 	if response.Action != actionAnnounce {
 		return nil, nil, errors.New("invalid action")
 	}
-	peers, err := tracker.DecodePeersCompact(data[binary.Size(response):])
+	decode := tracker.DecodePeersCompact
+	if ipv6 {
+		decode = tracker.DecodePeersCompact6
+	}
+	peers, err := decode(data[binary.Size(response):])
 	if err != nil {
 		return nil, nil, err
 	}
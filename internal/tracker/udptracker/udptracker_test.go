@@ -33,6 +33,8 @@ func startUDPTracker(t *testing.T, port int) func() {
 	fe, err := udp.NewFrontend(lgc, udp.Config{
 		Addr:         "127.0.0.1:" + strconv.Itoa(port),
 		MaxClockSkew: time.Minute,
+		// Same with the number of info hashes in a single scrape request of the client.
+		ParseOptions: udp.ParseOptions{MaxScrapeInfoHashes: 74},
 		PrivateKey:   "M4YlzP02iB0B46P2i3QLyMOW6nWXnVlYeJ91xIdtu8Ao7IIVKLZEaCEshTChmFrS",
 	})
 	if err != nil {
@@ -94,3 +96,52 @@ func TestUDPTracker(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestUDPTrackerScrape(t *testing.T) {
+	defer startUDPTracker(t, 5000)()
+
+	const rawURL = "udp://127.0.0.1:5000/announce"
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := udptracker.NewTransport(nil, 5*time.Second)
+	trk := udptracker.New(rawURL, u, tr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for i, left := range []int64{0, 1, 1} {
+		req := tracker.AnnounceRequest{
+			Torrent: tracker.Torrent{
+				InfoHash:  [20]byte{6},
+				Port:      1111 + i,
+				PeerID:    [20]byte{byte(i + 1)},
+				BytesLeft: left,
+			},
+		}
+		_, err = trk.Announce(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// More than fits in a single request.
+	infoHashes := make([][20]byte, 100)
+	for i := range infoHashes {
+		infoHashes[i] = [20]byte{byte(i + 6)}
+	}
+	resp, err := trk.Scrape(ctx, infoHashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Torrents) != len(infoHashes) {
+		t.Fatalf("%#v", resp)
+	}
+	if st := resp.Torrents[[20]byte{6}]; st.Seeders != 1 || st.Leechers != 2 {
+		t.Fatalf("%#v", st)
+	}
+	if st := resp.Torrents[[20]byte{7}]; st.Seeders != 0 || st.Leechers != 0 {
+		t.Fatalf("%#v", st)
+	}
+}
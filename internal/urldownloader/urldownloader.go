@@ -11,14 +11,14 @@ import (
 
 	"github.com/cenkalti/rain/internal/bufferpool"
 	"github.com/cenkalti/rain/internal/piece"
-	"github.com/juju/ratelimit"
+	"github.com/cenkalti/rain/internal/speedlimit"
 )
 
 // URLDownloader downloads files from a HTTP source.
 type URLDownloader struct {
 	URL                 string
 	Begin, End, current uint32 // piece index
-	bucket              *ratelimit.Bucket
+	limiter             *speedlimit.Limiter
 	closeC, doneC       chan struct{}
 }
 
@@ -32,13 +32,13 @@ type PieceResult struct {
 }
 
 // New returns a new URLDownloader for the given source and piece range.
-func New(source string, begin, end uint32, b *ratelimit.Bucket) *URLDownloader {
+func New(source string, begin, end uint32, limiter *speedlimit.Limiter) *URLDownloader {
 	return &URLDownloader{
 		URL:     source,
 		Begin:   begin,
 		current: begin,
 		End:     end,
-		bucket:  b,
+		limiter: limiter,
 		closeC:  make(chan struct{}),
 		doneC:   make(chan struct{}),
 	}
@@ -91,39 +91,46 @@ func (d *URLDownloader) Run(client *http.Client, pieces []piece.Piece, multifile
 	buf := pool.Get(int(pieces[d.current].Length))
 
 	processJob := func(job downloadJob) bool {
-		u := d.getURL(job.Filename, multifile)
-		req, err := http.NewRequest(http.MethodGet, u, nil)
-		if err != nil {
-			d.sendResult(resultC, &PieceResult{Downloader: d, Error: err})
-			return false
-		}
-		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", job.RangeBegin, job.RangeBegin+job.Length-1))
-		req = req.WithContext(ctx)
-		resp, err := client.Do(req)
-		if err != nil {
-			d.sendResult(resultC, &PieceResult{Downloader: d, Error: err})
-			return false
-		}
-		defer resp.Body.Close()
-		err = checkStatus(resp)
-		if err != nil {
-			d.sendResult(resultC, &PieceResult{Downloader: d, Error: err})
-			return false
+		var body io.Reader
+		if job.Filename == "" {
+			// Padding between files does not exist on the server.
+			body = zeroReader{}
+		} else {
+			u := d.getURL(job.Filename, multifile)
+			req, err := http.NewRequest(http.MethodGet, u, nil)
+			if err != nil {
+				d.sendResult(resultC, &PieceResult{Downloader: d, Error: err})
+				return false
+			}
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", job.RangeBegin, job.RangeBegin+job.Length-1))
+			req = req.WithContext(ctx)
+			resp, err := client.Do(req)
+			if err != nil {
+				d.sendResult(resultC, &PieceResult{Downloader: d, Error: err})
+				return false
+			}
+			defer resp.Body.Close()
+			err = checkStatus(resp)
+			if err != nil {
+				d.sendResult(resultC, &PieceResult{Downloader: d, Error: err})
+				return false
+			}
+			body = resp.Body
 		}
 		timer := time.AfterFunc(readTimeout, cancel)
 		defer timer.Stop()
 		var m int64 // position in response
 		for m < job.Length {
 			readSize := calcReadSize(buf, n, job, m)
-			if d.bucket != nil {
-				waitDuration := d.bucket.Take(readSize)
+			if d.limiter.Limited() && job.Filename != "" {
+				waitDuration := d.limiter.Take(readSize)
 				select {
 				case <-time.After(waitDuration):
 				case <-d.closeC:
 					return false
 				}
 			}
-			o, err := readFull(resp.Body, buf.Data[n:int64(n)+readSize], timer, readTimeout)
+			o, err := readFull(body, buf.Data[n:int64(n)+readSize], timer, readTimeout)
 			if err != nil {
 				d.sendResult(resultC, &PieceResult{Downloader: d, Error: err})
 				return false
@@ -191,6 +198,15 @@ func (d *URLDownloader) getURL(filename string, multifile bool) string {
 	return src + url.PathEscape(filename)
 }
 
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
 func (d *URLDownloader) sendResult(resultC chan *PieceResult, res *PieceResult) {
 	select {
 	case <-d.closeC:
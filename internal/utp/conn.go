@@ -0,0 +1,603 @@
+package utp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// Maximum number of bytes buffered for reading.
+	recvBufferSize = 1 << 20
+	// Maximum number of out of order packets kept until the missing packets arrive.
+	maxReorderPackets = maxSelectiveAckBits
+	// Packet is retransmitted at most this many times before giving up the connection.
+	maxRetransmissions = 6
+	// SYN is retransmitted at most this many times before dial fails.
+	maxSynRetransmissions = 3
+	// Timeouts before the first RTT measurement and the lower bound after the measurements.
+	initialTimeout = time.Second
+	minTimeout     = 500 * time.Millisecond
+	maxTimeout     = 30 * time.Second
+	// Connection is dropped if peer does not send its FIN in this duration after Close.
+	lingerTimeout = 10 * time.Second
+	// Fast retransmit is done after this many duplicate acks.
+	duplicateAckThreshold = 3
+)
+
+var (
+	errReset   = errors.New("utp: connection reset by peer")
+	errTimeout = &timeoutError{"utp: connection timed out"}
+)
+
+type timeoutError struct{ s string }
+
+func (e *timeoutError) Error() string   { return e.s }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+type connState int
+
+const (
+	stateSynSent connState = iota
+	stateConnected
+	stateFinSent
+	stateClosed
+)
+
+// outPacket is a sent packet that is waiting for an acknowledgement.
+type outPacket struct {
+	typ           uint8
+	seqNr         uint16
+	payload       []byte
+	sentAt        time.Time
+	transmissions int
+	// Received by the peer and acknowledged with a selective ack.
+	selectiveAcked bool
+	fastResent     bool
+}
+
+// Conn is a uTP connection. It implements net.Conn interface.
+type Conn struct {
+	socket *Socket
+	raddr  *net.UDPAddr
+	recvID uint16
+	sendID uint16
+
+	m       sync.Mutex
+	state   connState
+	err     error
+	closed  bool
+	closeAt time.Time
+	// Closed and replaced with a new channel on every state change for waking up blocked readers and writers.
+	changed    chan struct{}
+	connectedC chan struct{}
+
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	// Send side
+	seqNr           uint16 // sequence number of the next packet
+	outbuf          []*outPacket
+	inflight        int // number of payload bytes sent but not acknowledged
+	window          float64
+	peerWindow      uint32
+	lastAckNr       uint16
+	duplicateAcks   int
+	rtt, rttVar     time.Duration
+	rto             time.Duration // retransmission timeout calculated from RTT
+	timeout         time.Duration // rto after exponential backoff
+	timeoutAt       time.Time
+	synTransmission int
+	delays          delayHistory
+
+	// Receive side
+	ackNr              uint16 // sequence number of the last packet received in order
+	recvBuf            bytes.Buffer
+	reorder            map[uint16]*packet
+	eof                bool
+	replyMicro         uint32 // timestamp difference that is sent back to the peer
+	windowUpdateNeeded bool
+}
+
+func newConn(s *Socket, raddr *net.UDPAddr) *Conn {
+	return &Conn{
+		socket:     s,
+		raddr:      raddr,
+		changed:    make(chan struct{}),
+		connectedC: make(chan struct{}),
+		window:     4 * minWindow,
+		peerWindow: recvBufferSize,
+		rto:        initialTimeout,
+		timeout:    initialTimeout,
+		reorder:    make(map[uint16]*packet),
+	}
+}
+
+// notify wakes up the goroutines that are waiting for a state change. Must be called with lock held.
+func (c *Conn) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// wait blocks until the state of the connection is changed or the deadline is exceeded.
+func wait(changed chan struct{}, deadline time.Time) error {
+	var timeoutC <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		t := time.NewTimer(d)
+		defer t.Stop()
+		timeoutC = t.C
+	}
+	select {
+	case <-changed:
+		return nil
+	case <-timeoutC:
+		return os.ErrDeadlineExceeded
+	}
+}
+
+// Read data from the connection.
+func (c *Conn) Read(b []byte) (int, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	for {
+		if c.closed {
+			return 0, net.ErrClosed
+		}
+		if c.recvBuf.Len() > 0 {
+			n, _ := c.recvBuf.Read(b)
+			if c.windowUpdateNeeded && c.recvWindow() >= recvBufferSize/2 {
+				c.windowUpdateNeeded = false
+				c.sendState()
+			}
+			return n, nil
+		}
+		if c.eof {
+			return 0, io.EOF
+		}
+		if c.err != nil {
+			return 0, c.err
+		}
+		changed, deadline := c.changed, c.readDeadline
+		c.m.Unlock()
+		err := wait(changed, deadline)
+		c.m.Lock()
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write data to the connection. Blocks while the send window is full.
+func (c *Conn) Write(b []byte) (int, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	var n int
+	for len(b) > 0 {
+		if c.closed {
+			return n, net.ErrClosed
+		}
+		if c.err != nil {
+			return n, c.err
+		}
+		size := len(b)
+		if size > maxPayload {
+			size = maxPayload
+		}
+		if !c.canSend(size) {
+			changed, deadline := c.changed, c.writeDeadline
+			c.m.Unlock()
+			err := wait(changed, deadline)
+			c.m.Lock()
+			if err != nil {
+				return n, err
+			}
+			continue
+		}
+		payload := make([]byte, size)
+		copy(payload, b)
+		c.sendNew(stData, payload)
+		n += size
+		b = b[size:]
+	}
+	return n, nil
+}
+
+// canSend returns true if a packet of given size fits in both our congestion window and the receive window of peer.
+func (c *Conn) canSend(size int) bool {
+	if c.inflight == 0 {
+		// At least one packet is allowed, otherwise a zero window is never updated.
+		return true
+	}
+	if len(c.outbuf) >= maxReorderPackets {
+		// Peer drops the packets that are too far ahead of the first missing packet.
+		return false
+	}
+	window := int(c.window)
+	if int(c.peerWindow) < window {
+		window = int(c.peerWindow)
+	}
+	return c.inflight+size <= window
+}
+
+// Close the connection. Data that is written is sent to the peer before closing the connection.
+func (c *Conn) Close() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	c.closeAt = time.Now()
+	switch c.state {
+	case stateSynSent:
+		c.fail(net.ErrClosed)
+	case stateConnected:
+		c.sendNew(stFin, nil)
+		c.state = stateFinSent
+	}
+	c.notify()
+	return nil
+}
+
+// LocalAddr returns the address of the UDP socket.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.socket.Addr()
+}
+
+// RemoteAddr returns the UDP address of the peer.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+// SetDeadline sets the read and write deadlines.
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.readDeadline = t
+	c.writeDeadline = t
+	c.notify()
+	return nil
+}
+
+// SetReadDeadline sets the deadline for Read calls.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.readDeadline = t
+	c.notify()
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for Write calls.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.writeDeadline = t
+	c.notify()
+	return nil
+}
+
+// fail closes the connection with an error. Must be called with lock held.
+func (c *Conn) fail(err error) {
+	if c.state == stateClosed {
+		return
+	}
+	if c.err == nil {
+		c.err = err
+	}
+	if c.state == stateSynSent {
+		close(c.connectedC)
+	}
+	c.state = stateClosed
+	c.notify()
+}
+
+func (c *Conn) recvWindow() uint32 {
+	n := recvBufferSize - c.recvBuf.Len()
+	if n < 0 {
+		return 0
+	}
+	return uint32(n)
+}
+
+func nowMicro() uint32 {
+	return uint32(time.Now().UnixNano() / int64(time.Microsecond))
+}
+
+// send writes a packet to the socket after filling the common header fields.
+func (c *Conn) send(p *packet) {
+	p.connID = c.sendID
+	if p.typ == stSyn {
+		// SYN carries the ID that the peer is going to use when sending to us.
+		p.connID = c.recvID
+	}
+	p.timestamp = nowMicro()
+	p.timestampDiff = c.replyMicro
+	p.wndSize = c.recvWindow()
+	p.ackNr = c.ackNr
+	if p.wndSize < maxPayload {
+		c.windowUpdateNeeded = true
+	}
+	c.socket.writeTo(p.marshal(), c.raddr)
+}
+
+func (c *Conn) sendSyn() {
+	c.send(&packet{header: header{typ: stSyn, seqNr: c.seqNr - 1}})
+}
+
+// sendState sends an acknowledgement for the received packets.
+func (c *Conn) sendState() {
+	c.send(&packet{header: header{typ: stState, seqNr: c.seqNr}, selectiveAck: c.selectiveAck()})
+}
+
+// sendNew sends a new data or FIN packet and keeps it until it is acknowledged.
+func (c *Conn) sendNew(typ uint8, payload []byte) {
+	op := &outPacket{typ: typ, seqNr: c.seqNr, payload: payload}
+	c.seqNr++
+	if len(c.outbuf) == 0 {
+		c.timeoutAt = time.Now().Add(c.timeout)
+	}
+	c.outbuf = append(c.outbuf, op)
+	c.inflight += len(payload)
+	c.transmit(op)
+}
+
+func (c *Conn) transmit(op *outPacket) {
+	op.sentAt = time.Now()
+	op.transmissions++
+	c.send(&packet{header: header{typ: op.typ, seqNr: op.seqNr}, payload: op.payload})
+}
+
+// selectiveAck returns the bitmask of out of order packets that are received.
+func (c *Conn) selectiveAck() []byte {
+	if len(c.reorder) == 0 {
+		return nil
+	}
+	var last int
+	for seq := range c.reorder {
+		if i := int(seq - c.ackNr - 2); i > last {
+			last = i
+		}
+	}
+	if last >= maxSelectiveAckBits {
+		last = maxSelectiveAckBits - 1
+	}
+	mask := make([]byte, (last/32+1)*4)
+	for seq := range c.reorder {
+		i := int(seq - c.ackNr - 2)
+		if i < len(mask)*8 {
+			mask[i/8] |= 1 << (i % 8)
+		}
+	}
+	return mask
+}
+
+// handlePacket processes an incoming packet for the connection.
+func (c *Conn) handlePacket(p *packet, now time.Time) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.state == stateClosed {
+		return
+	}
+	if p.typ == stReset {
+		c.fail(errReset)
+		return
+	}
+	c.replyMicro = nowMicro() - p.timestamp
+	c.peerWindow = p.wndSize
+	if c.state == stateSynSent {
+		if p.typ != stState {
+			return
+		}
+		// Sequence number of STATE packet is the sequence number of the next data packet.
+		c.ackNr = p.seqNr - 1
+		c.lastAckNr = p.ackNr
+		c.state = stateConnected
+		close(c.connectedC)
+	}
+	c.handleAck(p, now)
+	if p.typ == stData || p.typ == stFin {
+		c.handleData(p)
+	}
+	c.notify()
+}
+
+func (c *Conn) handleAck(p *packet, now time.Time) {
+	if seqLess(c.seqNr-1, p.ackNr) {
+		// Acknowledges a packet that is not sent yet.
+		return
+	}
+	var bytesAcked int
+	if len(c.outbuf) > 0 && !seqLess(p.ackNr, c.outbuf[0].seqNr) {
+		// Retransmission timer is restarted only when the first packet is acknowledged.
+		c.timeout = c.rto
+		c.timeoutAt = now.Add(c.timeout)
+	}
+	for len(c.outbuf) > 0 && !seqLess(p.ackNr, c.outbuf[0].seqNr) {
+		op := c.outbuf[0]
+		c.outbuf[0] = nil
+		c.outbuf = c.outbuf[1:]
+		if !op.selectiveAcked {
+			bytesAcked += len(op.payload)
+			c.inflight -= len(op.payload)
+		}
+		if op.transmissions == 1 && !op.selectiveAcked {
+			c.updateRTT(now.Sub(op.sentAt))
+		}
+	}
+	var selectiveAcked int
+	for i := 0; i < len(p.selectiveAck)*8; i++ {
+		if p.selectiveAck[i/8]&(1<<(i%8)) == 0 {
+			continue
+		}
+		selectiveAcked++
+		seq := p.ackNr + 2 + uint16(i)
+		if len(c.outbuf) == 0 {
+			break
+		}
+		// Packets in outbuf have consecutive sequence numbers.
+		if j := int(seq - c.outbuf[0].seqNr); j < len(c.outbuf) {
+			if op := c.outbuf[j]; !op.selectiveAcked {
+				op.selectiveAcked = true
+				bytesAcked += len(op.payload)
+				c.inflight -= len(op.payload)
+				if op.transmissions == 1 {
+					c.updateRTT(now.Sub(op.sentAt))
+				}
+			}
+		}
+	}
+	if bytesAcked > 0 && p.timestampDiff != 0 {
+		c.delays.add(p.timestampDiff, now)
+		c.window += windowIncrease(c.window, bytesAcked, c.delays.queuingDelay())
+		c.clampWindow()
+	}
+	if p.ackNr != c.lastAckNr {
+		c.duplicateAcks = 0
+	} else if p.typ == stState && len(c.outbuf) > 0 {
+		c.duplicateAcks++
+	}
+	c.lastAckNr = p.ackNr
+	if len(c.outbuf) > 0 && !c.outbuf[0].fastResent &&
+		(c.duplicateAcks >= duplicateAckThreshold || selectiveAcked >= duplicateAckThreshold) {
+		// First unacknowledged packet is probably lost.
+		op := c.outbuf[0]
+		op.fastResent = true
+		c.window /= 2
+		c.clampWindow()
+		c.transmit(op)
+	}
+}
+
+func (c *Conn) clampWindow() {
+	if c.window < minWindow {
+		c.window = minWindow
+	} else if c.window > maxWindow {
+		c.window = maxWindow
+	}
+}
+
+func (c *Conn) updateRTT(sample time.Duration) {
+	if c.rtt == 0 {
+		c.rtt = sample
+		c.rttVar = sample / 2
+	} else {
+		delta := c.rtt - sample
+		if delta < 0 {
+			delta = -delta
+		}
+		c.rttVar += (delta - c.rttVar) / 4
+		c.rtt += (sample - c.rtt) / 8
+	}
+	c.rto = c.rtt + 4*c.rttVar
+	if c.rto < minTimeout {
+		c.rto = minTimeout
+	}
+}
+
+func (c *Conn) handleData(p *packet) {
+	diff := int16(p.seqNr - (c.ackNr + 1))
+	switch {
+	case diff < 0:
+		// Duplicate packet. Our ack must have been lost.
+	case diff == 0:
+		if !c.deliver(p) {
+			// No space in read buffer. Peer is going to send it again.
+			return
+		}
+		c.ackNr++
+		for {
+			q, ok := c.reorder[c.ackNr+1]
+			if !ok || !c.deliver(q) {
+				break
+			}
+			delete(c.reorder, c.ackNr+1)
+			c.ackNr++
+		}
+	case int(diff) <= maxReorderPackets:
+		if _, ok := c.reorder[p.seqNr]; !ok {
+			p.payload = append([]byte(nil), p.payload...)
+			c.reorder[p.seqNr] = p
+		}
+	default:
+		return
+	}
+	c.sendState()
+}
+
+// deliver puts the data in the packet into the read buffer. Returns false if there is no space in the buffer.
+func (c *Conn) deliver(p *packet) bool {
+	if p.typ == stFin {
+		c.eof = true
+		return true
+	}
+	if c.closed || c.eof {
+		// Nobody is going to read the data.
+		return true
+	}
+	if c.recvBuf.Len()+len(p.payload) > recvBufferSize {
+		return false
+	}
+	c.recvBuf.Write(p.payload)
+	return true
+}
+
+// tick checks timeouts of the connection. Returns true if the connection is finished and can be removed from the socket.
+func (c *Conn) tick(now time.Time) bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	switch c.state {
+	case stateClosed:
+		return true
+	case stateSynSent:
+		if now.Before(c.timeoutAt) {
+			return false
+		}
+		if c.synTransmission > maxSynRetransmissions {
+			c.fail(errTimeout)
+			return true
+		}
+		c.timeout *= 2
+		c.timeoutAt = now.Add(c.timeout)
+		c.synTransmission++
+		c.sendSyn()
+		return false
+	}
+	if c.state == stateFinSent {
+		// Wait for the FIN of peer too, otherwise peer keeps sending its FIN to a removed connection.
+		if len(c.outbuf) == 0 && (c.eof || now.Sub(c.closeAt) > lingerTimeout) {
+			c.state = stateClosed
+			return true
+		}
+	}
+	if len(c.outbuf) == 0 || now.Before(c.timeoutAt) {
+		return false
+	}
+	op := c.outbuf[0]
+	if op.transmissions > maxRetransmissions {
+		c.fail(errTimeout)
+		return true
+	}
+	c.timeout *= 2
+	if c.timeout > maxTimeout {
+		c.timeout = maxTimeout
+	}
+	c.timeoutAt = now.Add(c.timeout)
+	c.window = minWindow
+	c.transmit(op)
+	return false
+}
+
+func randomID() uint16 {
+	return uint16(rand.Intn(1 << 16)) // nolint: gosec
+}
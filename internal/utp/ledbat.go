@@ -0,0 +1,94 @@
+package utp
+
+import (
+	"time"
+)
+
+// LEDBAT congestion control parameters. See RFC 6817 and BEP 29.
+const (
+	// Target queuing delay. Window is reduced when the measured delay is above the target.
+	targetDelay = 100000 // microseconds
+	// Maximum increase of the congestion window in one round trip.
+	maxWindowIncreasePerRTT = 3000
+	// Congestion window never gets smaller than this.
+	minWindow = packetSize
+	// Congestion window never gets larger than this.
+	maxWindow = 1 << 20
+	// Base delay is the minimum of the delays measured in this many minutes.
+	baseHistory = 10
+	// Current delay is the minimum of this many last samples.
+	currentHistory = 4
+)
+
+// delayHistory keeps the one-way delay samples for calculating the queuing delay.
+// Samples contain the clock difference between hosts, which cancels out when base delay is subtracted.
+// Samples are compared with wrap around because timestamps are 32-bit microseconds.
+type delayHistory struct {
+	base          [baseHistory]uint32
+	baseIndex     int
+	baseRotatedAt time.Time
+	current       [currentHistory]uint32
+	currentIndex  int
+	initialized   bool
+}
+
+func delayLess(a, b uint32) bool {
+	return int32(a-b) < 0
+}
+
+func (h *delayHistory) add(sample uint32, now time.Time) {
+	if !h.initialized {
+		for i := range h.base {
+			h.base[i] = sample
+		}
+		for i := range h.current {
+			h.current[i] = sample
+		}
+		h.baseRotatedAt = now
+		h.initialized = true
+		return
+	}
+	if now.Sub(h.baseRotatedAt) >= time.Minute {
+		h.baseIndex = (h.baseIndex + 1) % baseHistory
+		h.base[h.baseIndex] = sample
+		h.baseRotatedAt = now
+	} else if delayLess(sample, h.base[h.baseIndex]) {
+		h.base[h.baseIndex] = sample
+	}
+	h.current[h.currentIndex] = sample
+	h.currentIndex = (h.currentIndex + 1) % currentHistory
+}
+
+// queuingDelay returns the measured delay above the base delay in microseconds.
+func (h *delayHistory) queuingDelay() uint32 {
+	base := h.base[0]
+	for _, d := range h.base[1:] {
+		if delayLess(d, base) {
+			base = d
+		}
+	}
+	current := h.current[0]
+	for _, d := range h.current[1:] {
+		if delayLess(d, current) {
+			current = d
+		}
+	}
+	if delayLess(current, base) {
+		return 0
+	}
+	return current - base
+}
+
+// windowIncrease returns the change in congestion window after bytesAcked bytes are acknowledged.
+// The window grows when the queuing delay is below the target and shrinks when it is above.
+func windowIncrease(window float64, bytesAcked int, queuingDelay uint32) float64 {
+	offTarget := float64(targetDelay-int64(queuingDelay)) / targetDelay
+	if offTarget < -1 {
+		offTarget = -1
+	}
+	acked := float64(bytesAcked)
+	if acked > window {
+		acked = window
+	}
+	return maxWindowIncreasePerRTT * offTarget * acked / window
+}
@@ -0,0 +1,116 @@
+package utp
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Packet types
+const (
+	stData uint8 = iota
+	stFin
+	stState
+	stReset
+	stSyn
+)
+
+const (
+	version    = 1
+	headerSize = 20
+	// Maximum size of a packet that is sent over UDP. It is small enough to fit in common MTUs without fragmentation.
+	packetSize = 1400
+	maxPayload = packetSize - headerSize
+
+	extensionSelectiveAck = 1
+	// Maximum number of packets that can be acknowledged with a selective ack.
+	maxSelectiveAckBits = 256
+)
+
+var errInvalidPacket = errors.New("invalid utp packet")
+
+type header struct {
+	typ           uint8
+	connID        uint16
+	timestamp     uint32
+	timestampDiff uint32
+	wndSize       uint32
+	seqNr         uint16
+	ackNr         uint16
+}
+
+type packet struct {
+	header
+	// Bitmask of the packets received after ackNr+1. Empty if there is no selective ack extension.
+	selectiveAck []byte
+	payload      []byte
+}
+
+func (p *packet) marshal() []byte {
+	size := headerSize + len(p.payload)
+	if len(p.selectiveAck) > 0 {
+		size += 2 + len(p.selectiveAck)
+	}
+	b := make([]byte, headerSize, size)
+	b[0] = p.typ<<4 | version
+	if len(p.selectiveAck) > 0 {
+		b[1] = extensionSelectiveAck
+	}
+	binary.BigEndian.PutUint16(b[2:4], p.connID)
+	binary.BigEndian.PutUint32(b[4:8], p.timestamp)
+	binary.BigEndian.PutUint32(b[8:12], p.timestampDiff)
+	binary.BigEndian.PutUint32(b[12:16], p.wndSize)
+	binary.BigEndian.PutUint16(b[16:18], p.seqNr)
+	binary.BigEndian.PutUint16(b[18:20], p.ackNr)
+	if len(p.selectiveAck) > 0 {
+		b = append(b, 0, uint8(len(p.selectiveAck)))
+		b = append(b, p.selectiveAck...)
+	}
+	return append(b, p.payload...)
+}
+
+// parsePacket parses the packet in b. Payload of the packet refers to the same memory with b.
+func parsePacket(b []byte) (*packet, error) {
+	if len(b) < headerSize {
+		return nil, errInvalidPacket
+	}
+	p := &packet{
+		header: header{
+			typ:           b[0] >> 4,
+			connID:        binary.BigEndian.Uint16(b[2:4]),
+			timestamp:     binary.BigEndian.Uint32(b[4:8]),
+			timestampDiff: binary.BigEndian.Uint32(b[8:12]),
+			wndSize:       binary.BigEndian.Uint32(b[12:16]),
+			seqNr:         binary.BigEndian.Uint16(b[16:18]),
+			ackNr:         binary.BigEndian.Uint16(b[18:20]),
+		},
+	}
+	if b[0]&0x0f != version || p.typ > stSyn {
+		return nil, errInvalidPacket
+	}
+	ext := b[1]
+	b = b[headerSize:]
+	for ext != 0 {
+		if len(b) < 2 {
+			return nil, errInvalidPacket
+		}
+		next, length := b[0], int(b[1])
+		if len(b) < 2+length {
+			return nil, errInvalidPacket
+		}
+		if ext == extensionSelectiveAck {
+			if length == 0 || length%4 != 0 {
+				return nil, errInvalidPacket
+			}
+			p.selectiveAck = b[2 : 2+length]
+		}
+		ext = next
+		b = b[2+length:]
+	}
+	p.payload = b
+	return p, nil
+}
+
+// seqLess returns true if sequence number a comes before b. Sequence numbers wrap around.
+func seqLess(a, b uint16) bool {
+	return int16(a-b) < 0
+}
@@ -0,0 +1,269 @@
+// Package utp implements uTorrent transport protocol as specified in BEP 29.
+// Congestion is controlled with LEDBAT so that uTP traffic yields to other traffic on the network.
+package utp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// Number of incoming connections waiting to be accepted.
+	acceptBacklog = 32
+	// Period of checking timeouts of connections.
+	tickInterval = 50 * time.Millisecond
+	// Maximum size of UDP packets read from the socket.
+	readBufferSize = 64 << 10
+)
+
+var errBacklogFull = errors.New("utp: accept backlog is full")
+
+type connKey struct {
+	addr string
+	id   uint16
+}
+
+// Socket multiplexes uTP connections over a single UDP socket.
+// It implements net.Listener interface for accepting incoming connections.
+type Socket struct {
+	conn    net.PacketConn
+	acceptC chan *Conn
+	closeC  chan struct{}
+	doneC   chan struct{}
+
+	m      sync.Mutex
+	conns  map[connKey]*Conn
+	closed bool
+}
+
+// Listen announces on the local UDP address and returns a Socket for sending and receiving uTP connections.
+func Listen(network, address string) (*Socket, error) {
+	pc, err := net.ListenPacket(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return New(pc), nil
+}
+
+// New returns a new Socket that is running on pc. Socket takes the ownership of pc.
+func New(pc net.PacketConn) *Socket {
+	s := &Socket{
+		conn:    pc,
+		acceptC: make(chan *Conn, acceptBacklog),
+		closeC:  make(chan struct{}),
+		doneC:   make(chan struct{}),
+		conns:   make(map[connKey]*Conn),
+	}
+	go s.run()
+	return s
+}
+
+// Addr returns the local address of the socket.
+func (s *Socket) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// Accept waits for and returns the next incoming connection.
+func (s *Socket) Accept() (net.Conn, error) {
+	select {
+	case c := <-s.acceptC:
+		return c, nil
+	case <-s.closeC:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close the socket and all connections on it.
+func (s *Socket) Close() error {
+	s.m.Lock()
+	if s.closed {
+		s.m.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.closeC)
+	for key, c := range s.conns {
+		c.m.Lock()
+		c.fail(net.ErrClosed)
+		c.m.Unlock()
+		delete(s.conns, key)
+	}
+	s.m.Unlock()
+	err := s.conn.Close()
+	<-s.doneC
+	return err
+}
+
+// Dial connects to the uTP peer at address.
+func (s *Socket) Dial(address string) (net.Conn, error) {
+	return s.DialContext(context.Background(), "utp", address)
+}
+
+// DialContext connects to the uTP peer at address. Network argument is ignored, address is always resolved as UDP address.
+// It has the same signature with net.Dialer.DialContext so Socket can be used in place of a net.Dialer.
+func (s *Socket) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	raddr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	c := newConn(s, raddr)
+	s.m.Lock()
+	if s.closed {
+		s.m.Unlock()
+		return nil, net.ErrClosed
+	}
+	for {
+		// Both IDs must be unused because peer sends SYN with recvID and other packets with sendID.
+		c.recvID = randomID()
+		c.sendID = c.recvID + 1
+		_, ok1 := s.conns[connKey{raddr.String(), c.recvID}]
+		_, ok2 := s.conns[connKey{raddr.String(), c.sendID}]
+		if !ok1 && !ok2 {
+			break
+		}
+	}
+	s.conns[connKey{raddr.String(), c.recvID}] = c
+	s.m.Unlock()
+
+	c.m.Lock()
+	c.seqNr = 2
+	c.timeoutAt = time.Now().Add(c.timeout)
+	c.sendSyn()
+	c.m.Unlock()
+
+	select {
+	case <-c.connectedC:
+	case <-ctx.Done():
+		c.Close()
+		return nil, ctx.Err()
+	}
+	c.m.Lock()
+	err = c.err
+	c.m.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *Socket) writeTo(b []byte, addr net.Addr) {
+	_, _ = s.conn.WriteTo(b, addr)
+}
+
+func (s *Socket) run() {
+	defer close(s.doneC)
+
+	done := make(chan struct{})
+	go s.tickLoop(done)
+	defer close(done)
+
+	buf := make([]byte, readBufferSize)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			select {
+			case <-s.closeC:
+				return
+			default:
+			}
+			continue
+		}
+		udpAddr, ok := addr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		p, err := parsePacket(buf[:n])
+		if err != nil {
+			continue
+		}
+		s.handlePacket(p, udpAddr)
+	}
+}
+
+func (s *Socket) handlePacket(p *packet, addr *net.UDPAddr) {
+	now := time.Now()
+	s.m.Lock()
+	if s.closed {
+		s.m.Unlock()
+		return
+	}
+	if p.typ == stSyn {
+		c, ok := s.conns[connKey{addr.String(), p.connID + 1}]
+		if !ok {
+			c = s.newIncomingConn(p, addr)
+		}
+		s.m.Unlock()
+		if c != nil {
+			c.m.Lock()
+			// Our reply may have been lost if the connection exists already.
+			c.sendState()
+			c.m.Unlock()
+		}
+		return
+	}
+	c, ok := s.conns[connKey{addr.String(), p.connID}]
+	s.m.Unlock()
+	if !ok {
+		return
+	}
+	c.handlePacket(p, now)
+}
+
+// newIncomingConn creates a new connection for the SYN packet and puts it into the accept queue.
+// Must be called with lock held.
+func (s *Socket) newIncomingConn(syn *packet, addr *net.UDPAddr) *Conn {
+	c := newConn(s, addr)
+	c.recvID = syn.connID + 1
+	c.sendID = syn.connID
+	c.seqNr = randomID()
+	c.ackNr = syn.seqNr
+	c.state = stateConnected
+	c.peerWindow = syn.wndSize
+	c.replyMicro = nowMicro() - syn.timestamp
+	close(c.connectedC)
+	select {
+	case s.acceptC <- c:
+	default:
+		c.fail(errBacklogFull)
+		c.send(&packet{header: header{typ: stReset, seqNr: c.seqNr}})
+		return nil
+	}
+	s.conns[connKey{addr.String(), c.recvID}] = c
+	return c
+}
+
+func (s *Socket) tickLoop(done chan struct{}) {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	var conns []*Conn
+	var keys []connKey
+	for {
+		select {
+		case now := <-ticker.C:
+			conns, keys = conns[:0], keys[:0]
+			s.m.Lock()
+			for key, c := range s.conns {
+				conns = append(conns, c)
+				keys = append(keys, key)
+			}
+			s.m.Unlock()
+			for i, c := range conns {
+				if c.tick(now) {
+					s.m.Lock()
+					if s.conns[keys[i]] == c {
+						delete(s.conns, keys[i])
+					}
+					s.m.Unlock()
+				}
+			}
+		case <-done:
+			return
+		}
+	}
+}
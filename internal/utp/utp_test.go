@@ -0,0 +1,186 @@
+package utp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	mrand "math/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lossyConn drops some of the packets written to it.
+type lossyConn struct {
+	net.PacketConn
+	m    sync.Mutex
+	rand *mrand.Rand
+	rate float64
+}
+
+func (c *lossyConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.m.Lock()
+	drop := c.rand.Float64() < c.rate
+	c.m.Unlock()
+	if drop {
+		return len(b), nil
+	}
+	return c.PacketConn.WriteTo(b, addr)
+}
+
+func newSocketPair(t *testing.T, lossRate float64) (*Socket, *Socket) {
+	var sockets [2]*Socket
+	for i := range sockets {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lossRate > 0 {
+			pc = &lossyConn{PacketConn: pc, rand: mrand.New(mrand.NewSource(int64(i))), rate: lossRate}
+		}
+		sockets[i] = New(pc)
+	}
+	return sockets[0], sockets[1]
+}
+
+func testTransfer(t *testing.T, lossRate float64, size int) {
+	s1, s2 := newSocketPair(t, lossRate)
+	defer s1.Close()
+	defer s2.Close()
+
+	data1 := make([]byte, size)
+	data2 := make([]byte, size)
+	_, _ = rand.Read(data1)
+	_, _ = rand.Read(data2)
+
+	acceptC := make(chan net.Conn, 1)
+	go func() {
+		c, err := s2.Accept()
+		if err != nil {
+			t.Error(err)
+			close(acceptC)
+			return
+		}
+		acceptC <- c
+	}()
+	c1, err := s1.Dial(s2.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, ok := <-acceptC
+	if !ok {
+		t.FailNow()
+	}
+	_ = c1.SetDeadline(time.Now().Add(time.Minute))
+	_ = c2.SetDeadline(time.Now().Add(time.Minute))
+
+	// Both sides send and receive at the same time.
+	var wg sync.WaitGroup
+	transfer := func(c net.Conn, out, in []byte) {
+		defer wg.Done()
+		defer c.Close()
+		errC := make(chan error, 1)
+		go func() {
+			_, err := c.Write(out)
+			errC <- err
+		}()
+		b := make([]byte, len(in))
+		if _, err := io.ReadFull(c, b); err != nil {
+			t.Error(err)
+			return
+		}
+		if !bytes.Equal(b, in) {
+			t.Error("received data does not match")
+		}
+		if err := <-errC; err != nil {
+			t.Error(err)
+		}
+	}
+	wg.Add(2)
+	go transfer(c1, data1, data2)
+	go transfer(c2, data2, data1)
+	wg.Wait()
+}
+
+func TestTransfer(t *testing.T) {
+	testTransfer(t, 0, 4<<20)
+}
+
+func TestTransferLossy(t *testing.T) {
+	testTransfer(t, 0.05, 1<<20)
+}
+
+func TestClose(t *testing.T) {
+	s1, s2 := newSocketPair(t, 0)
+	defer s1.Close()
+	defer s2.Close()
+
+	c1, err := s1.Dial(s2.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c1.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err = c1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c1.Write([]byte("hello")); err != net.ErrClosed {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c2, err := s2.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	_ = c2.SetReadDeadline(time.Now().Add(10 * time.Second))
+	b, err := io.ReadAll(c2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello" {
+		t.Fatalf("unexpected data: %q", b)
+	}
+}
+
+func TestDialTimeout(t *testing.T) {
+	s1, s2 := newSocketPair(t, 0)
+	defer s1.Close()
+	addr := s2.Addr().String()
+	s2.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := s1.DialContext(ctx, "utp", addr)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestPacket(t *testing.T) {
+	p := &packet{
+		header: header{
+			typ:           stState,
+			connID:        1234,
+			timestamp:     5,
+			timestampDiff: 6,
+			wndSize:       7,
+			seqNr:         65535,
+			ackNr:         9,
+		},
+		selectiveAck: []byte{1, 2, 3, 4},
+		payload:      []byte("foo"),
+	}
+	q, err := parsePacket(p.marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.header != p.header || !bytes.Equal(q.selectiveAck, p.selectiveAck) || !bytes.Equal(q.payload, p.payload) {
+		t.Fatalf("packets are not equal: %#v", q)
+	}
+	if !seqLess(65535, 0) || seqLess(0, 65535) {
+		t.Fatal("invalid sequence number comparison")
+	}
+}
@@ -47,7 +47,14 @@ func (v *Verifier) Run(pieces []piece.Piece, progressC chan Progress, resultC ch
 	}()
 
 	v.Bitfield = bitfield.New(uint32(len(pieces)))
-	buf := make([]byte, pieces[0].Length)
+	// First piece is not the longest in v2-only torrents if the first file is smaller than a piece.
+	var maxLength uint32
+	for _, p := range pieces {
+		if p.Length > maxLength {
+			maxLength = p.Length
+		}
+	}
+	buf := make([]byte, maxLength)
 	hash := sha1.New()
 	var numOK uint32
 	for _, p := range pieces {
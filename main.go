@@ -3,7 +3,10 @@ package main
 import (
 	"crypto/sha1"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 
@@ -24,6 +27,7 @@ import (
 	"github.com/cenkalti/rain/internal/logger"
 	"github.com/cenkalti/rain/internal/magnet"
 	"github.com/cenkalti/rain/internal/metainfo"
+	"github.com/cenkalti/rain/internal/rpctypes"
 	"github.com/cenkalti/rain/rainrpc"
 	"github.com/cenkalti/rain/torrent"
 	"github.com/hokaccha/go-prettyjson"
@@ -170,6 +174,12 @@ func main() {
 					Usage:    "list torrents",
 					Category: "Getters",
 					Action:   handleList,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "label",
+							Usage: "list only the torrents that have the label",
+						},
+					},
 				},
 				{
 					Name:     "add",
@@ -198,6 +208,22 @@ func main() {
 							Name:  "id",
 							Usage: "if id is not given, a unique id is automatically generated",
 						},
+						cli.StringFlag{
+							Name:  "file-priorities",
+							Usage: "comma separated list of priorities for each file in torrent (skip, low, normal, high)",
+						},
+						cli.StringFlag{
+							Name:  "incomplete-dir",
+							Usage: "save files into this directory while downloading and move them to data dir after download completes",
+						},
+						cli.StringFlag{
+							Name:  "data-path",
+							Usage: "seed existing data in this directory on server instead of downloading into data dir",
+						},
+						cli.StringSliceFlag{
+							Name:  "label",
+							Usage: "label of the torrent, can be given multiple times",
+						},
 					},
 				},
 				{
@@ -210,6 +236,10 @@ func main() {
 							Name:     "id",
 							Required: true,
 						},
+						cli.BoolFlag{
+							Name:  "keep-data",
+							Usage: "do not delete downloaded files",
+						},
 					},
 				},
 				{
@@ -270,6 +300,35 @@ func main() {
 						},
 					},
 				},
+				{
+					Name:     "files",
+					Usage:    "get files of torrent",
+					Category: "Getters",
+					Action:   handleFiles,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "id",
+							Required: true,
+						},
+					},
+				},
+				{
+					Name:     "set-file-priorities",
+					Usage:    "set download priorities of files in torrent",
+					Category: "Actions",
+					Action:   handleSetFilePriorities,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "id",
+							Required: true,
+						},
+						cli.StringFlag{
+							Name:     "priorities,p",
+							Usage:    "comma separated list of priorities for each file in torrent (skip, low, normal, high)",
+							Required: true,
+						},
+					},
+				},
 				{
 					Name:     "peers",
 					Usage:    "get peers of torrent",
@@ -364,6 +423,289 @@ func main() {
 						},
 					},
 				},
+				{
+					Name:     "force-start",
+					Usage:    "start torrent regardless of queue limits",
+					Category: "Actions",
+					Action:   handleForceStart,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "id",
+							Required: true,
+						},
+					},
+				},
+				{
+					Name:     "queue-up",
+					Usage:    "move torrent up in queue",
+					Category: "Actions",
+					Action:   handleQueueUp,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "id",
+							Required: true,
+						},
+					},
+				},
+				{
+					Name:     "queue-down",
+					Usage:    "move torrent down in queue",
+					Category: "Actions",
+					Action:   handleQueueDown,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "id",
+							Required: true,
+						},
+					},
+				},
+				{
+					Name:     "set-speed-limits",
+					Usage:    "set download and upload speed limits of torrent",
+					Category: "Actions",
+					Action:   handleSetSpeedLimits,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "id",
+							Required: true,
+						},
+						cli.Int64Flag{
+							Name:  "download,d",
+							Usage: "download speed limit in KB/s, 0 means no limit",
+						},
+						cli.Int64Flag{
+							Name:  "upload,u",
+							Usage: "upload speed limit in KB/s, 0 means no limit",
+						},
+					},
+				},
+				{
+					Name:     "set-alt-speed-limits",
+					Usage:    "activate or deactivate alternative speed limits",
+					Category: "Actions",
+					Action:   handleSetAltSpeedLimits,
+					Flags: []cli.Flag{
+						cli.BoolTFlag{
+							Name:  "enabled",
+							Usage: "use --enabled=false for switching back to normal speed limits",
+						},
+					},
+				},
+				{
+					Name:     "seed-limits",
+					Usage:    "get global seeding limits",
+					Category: "Getters",
+					Action:   handleSeedLimits,
+				},
+				{
+					Name:     "set-seed-limits",
+					Usage:    "set seeding limits of torrent or global limits if id is not given",
+					Category: "Actions",
+					Action:   handleSetSeedLimits,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name: "id",
+						},
+						cli.Float64Flag{
+							Name:  "ratio",
+							Usage: "share ratio limit, 0 disables the limit",
+						},
+						cli.StringFlag{
+							Name:  "ratio-action",
+							Usage: "action when ratio limit is reached (stop, remove, remove-data)",
+							Value: "stop",
+						},
+						cli.DurationFlag{
+							Name:  "time",
+							Usage: "seeding time limit, 0 disables the limit",
+						},
+						cli.StringFlag{
+							Name:  "time-action",
+							Usage: "action when seeding time limit is reached (stop, remove, remove-data)",
+							Value: "stop",
+						},
+						cli.DurationFlag{
+							Name:  "idle",
+							Usage: "idle seeding time limit, 0 disables the limit",
+						},
+						cli.StringFlag{
+							Name:  "idle-action",
+							Usage: "action when idle seeding time limit is reached (stop, remove, remove-data)",
+							Value: "stop",
+						},
+						cli.BoolFlag{
+							Name:  "reset",
+							Usage: "make torrent use global limits",
+						},
+					},
+				},
+				{
+					Name:     "set-labels",
+					Usage:    "set labels of torrent",
+					Category: "Actions",
+					Action:   handleSetLabels,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "id",
+							Required: true,
+						},
+						cli.StringSliceFlag{
+							Name:  "label",
+							Usage: "label of the torrent, can be given multiple times, omit for removing all labels",
+						},
+					},
+				},
+				{
+					Name:     "labels",
+					Usage:    "list default settings of labels",
+					Category: "Getters",
+					Action:   handleLabels,
+				},
+				{
+					Name:     "set-label",
+					Usage:    "set default settings of label",
+					Category: "Actions",
+					Action:   handleSetLabel,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "name",
+							Required: true,
+						},
+						cli.StringFlag{
+							Name:  "data-dir",
+							Usage: "directory on server to save torrents that are added with the label",
+						},
+						cli.Int64Flag{
+							Name:  "download,d",
+							Usage: "download speed limit in KB/s, 0 means no limit",
+						},
+						cli.Int64Flag{
+							Name:  "upload,u",
+							Usage: "upload speed limit in KB/s, 0 means no limit",
+						},
+						cli.Float64Flag{
+							Name:  "ratio",
+							Usage: "share ratio limit, 0 disables the limit",
+						},
+						cli.StringFlag{
+							Name:  "ratio-action",
+							Usage: "action when ratio limit is reached (stop, remove, remove-data)",
+							Value: "stop",
+						},
+						cli.DurationFlag{
+							Name:  "time",
+							Usage: "seeding time limit, 0 disables the limit",
+						},
+						cli.StringFlag{
+							Name:  "time-action",
+							Usage: "action when seeding time limit is reached (stop, remove, remove-data)",
+							Value: "stop",
+						},
+						cli.DurationFlag{
+							Name:  "idle",
+							Usage: "idle seeding time limit, 0 disables the limit",
+						},
+						cli.StringFlag{
+							Name:  "idle-action",
+							Usage: "action when idle seeding time limit is reached (stop, remove, remove-data)",
+							Value: "stop",
+						},
+						cli.StringFlag{
+							Name:  "complete-cmd",
+							Usage: "shell command to execute on torrent completion instead of the one in config",
+						},
+					},
+				},
+				{
+					Name:     "remove-label",
+					Usage:    "remove default settings of label",
+					Category: "Actions",
+					Action:   handleRemoveLabel,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "name",
+							Required: true,
+						},
+					},
+				},
+				{
+					Name:     "events",
+					Usage:    "print events of session as JSON lines until interrupted",
+					Category: "Getters",
+					Action:   handleEvents,
+					Flags: []cli.Flag{
+						cli.StringSliceFlag{
+							Name:  "type",
+							Usage: "type of events to print (e.g. torrent-added, piece-verified), can be given multiple times",
+						},
+						cli.StringFlag{
+							Name:  "id",
+							Usage: "print only the events of torrent",
+						},
+					},
+				},
+				{
+					Name:     "feeds",
+					Usage:    "list RSS and Atom feeds",
+					Category: "Getters",
+					Action:   handleFeeds,
+				},
+				{
+					Name:     "add-feed",
+					Usage:    "add RSS or Atom feed, or replace the feed that has the same name",
+					Category: "Actions",
+					Action:   handleAddFeed,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "name",
+							Required: true,
+						},
+						cli.StringFlag{
+							Name:     "url",
+							Required: true,
+						},
+						cli.DurationFlag{
+							Name:  "interval",
+							Usage: "interval of fetching the feed, 0 means the default interval of the server",
+						},
+						cli.StringSliceFlag{
+							Name:  "include",
+							Usage: "regular expression for titles of items to add, can be given multiple times",
+						},
+						cli.StringSliceFlag{
+							Name:  "exclude",
+							Usage: "regular expression for titles of items to skip, can be given multiple times",
+						},
+						cli.BoolFlag{
+							Name:  "unique-episodes",
+							Usage: "add only the first item of each episode",
+						},
+						cli.StringFlag{
+							Name:  "label",
+							Usage: "label of the added torrents",
+						},
+						cli.StringFlag{
+							Name:  "data-dir",
+							Usage: "directory on server to save the added torrents",
+						},
+						cli.BoolFlag{
+							Name:  "stopped",
+							Usage: "do not start added torrents",
+						},
+					},
+				},
+				{
+					Name:     "remove-feed",
+					Usage:    "remove RSS or Atom feed",
+					Category: "Actions",
+					Action:   handleRemoveFeed,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "name",
+							Required: true,
+						},
+					},
+				},
 				{
 					Name:     "start-all",
 					Usage:    "start all torrents",
@@ -393,6 +735,23 @@ func main() {
 						},
 					},
 				},
+				{
+					Name:     "move-data",
+					Usage:    "move files of torrent to another directory on server",
+					Category: "Actions",
+					Action:   handleMoveData,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "id",
+							Required: true,
+						},
+						cli.StringFlag{
+							Name:     "data-dir",
+							Required: true,
+							Usage:    "directory on server to move files into",
+						},
+					},
+				},
 				{
 					Name:     "torrent",
 					Usage:    "save torrent file",
@@ -521,6 +880,11 @@ func main() {
 							Name:  "webseed,w",
 							Usage: "add webseed `URL`",
 						},
+						cli.StringFlag{
+							Name:  "version",
+							Usage: "torrent version: v1, v2 or hybrid. v2 and hybrid torrents require piece length to be a power of 2.",
+							Value: "v1",
+						},
 					},
 				},
 			},
@@ -861,7 +1225,13 @@ func handleVersion(c *cli.Context) error {
 }
 
 func handleList(c *cli.Context) error {
-	resp, err := clt.ListTorrents()
+	var resp []rpctypes.Torrent
+	var err error
+	if label := c.String("label"); label != "" {
+		resp, err = clt.ListTorrentsWithLabel(label)
+	} else {
+		resp, err = clt.ListTorrents()
+	}
 	if err != nil {
 		return err
 	}
@@ -887,6 +1257,10 @@ func handleAdd(c *cli.Context) error {
 		StopAfterDownload: c.Bool("stop-after-download"),
 		StopAfterMetadata: c.Bool("stop-after-metadata"),
 		ID:                c.String("id"),
+		FilePriorities:    splitFilePriorities(c.String("file-priorities")),
+		IncompleteDir:     c.String("incomplete-dir"),
+		DataPath:          c.String("data-path"),
+		Labels:            c.StringSlice("label"),
 	}
 	if isURI(arg) {
 		resp, err := clt.AddURI(arg, addOpt)
@@ -915,7 +1289,7 @@ func handleAdd(c *cli.Context) error {
 }
 
 func handleRemove(c *cli.Context) error {
-	return clt.RemoveTorrent(c.String("id"))
+	return clt.RemoveTorrentWithOptions(c.String("id"), &rainrpc.RemoveTorrentOptions{KeepData: c.Bool("keep-data")})
 }
 
 func handleCleanDatabase(c *cli.Context) error {
@@ -1000,6 +1374,35 @@ func handlePeers(c *cli.Context) error {
 	return nil
 }
 
+func handleFiles(c *cli.Context) error {
+	resp, err := clt.GetTorrentFiles(c.String("id"))
+	if err != nil {
+		return err
+	}
+	b, err := prettyjson.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	_, _ = os.Stdout.Write(b)
+	_, _ = os.Stdout.WriteString("\n")
+	return nil
+}
+
+func handleSetFilePriorities(c *cli.Context) error {
+	return clt.SetFilePriorities(c.String("id"), splitFilePriorities(c.String("priorities")))
+}
+
+func splitFilePriorities(s string) []string {
+	if s == "" {
+		return nil
+	}
+	priorities := strings.Split(s, ",")
+	for i := range priorities {
+		priorities[i] = strings.TrimSpace(priorities[i])
+	}
+	return priorities
+}
+
 func handleAddPeer(c *cli.Context) error {
 	return clt.AddPeer(c.String("id"), c.String("addr"))
 }
@@ -1024,6 +1427,159 @@ func handleStop(c *cli.Context) error {
 	return clt.StopTorrent(c.String("id"))
 }
 
+func handleForceStart(c *cli.Context) error {
+	return clt.ForceStartTorrent(c.String("id"))
+}
+
+func handleQueueUp(c *cli.Context) error {
+	return clt.MoveTorrentUpInQueue(c.String("id"))
+}
+
+func handleQueueDown(c *cli.Context) error {
+	return clt.MoveTorrentDownInQueue(c.String("id"))
+}
+
+func handleSetSpeedLimits(c *cli.Context) error {
+	return clt.SetTorrentSpeedLimits(c.String("id"), c.Int64("download"), c.Int64("upload"))
+}
+
+func handleSetAltSpeedLimits(c *cli.Context) error {
+	return clt.SetAltSpeedLimits(c.BoolT("enabled"))
+}
+
+func handleSeedLimits(c *cli.Context) error {
+	limits, err := clt.GetSeedLimits()
+	if err != nil {
+		return err
+	}
+	b, err := prettyjson.Marshal(limits)
+	if err != nil {
+		return err
+	}
+	_, _ = os.Stdout.Write(b)
+	_, _ = os.Stdout.WriteString("\n")
+	return nil
+}
+
+func handleSetSeedLimits(c *cli.Context) error {
+	id := c.String("id")
+	if c.Bool("reset") {
+		if id == "" {
+			return errors.New("reset requires torrent id")
+		}
+		return clt.SetTorrentSeedLimits(id, nil)
+	}
+	limits := rpctypes.SeedLimits{
+		Ratio:       c.Float64("ratio"),
+		RatioAction: c.String("ratio-action"),
+		Time:        uint(c.Duration("time") / time.Second),
+		TimeAction:  c.String("time-action"),
+		Idle:        uint(c.Duration("idle") / time.Second),
+		IdleAction:  c.String("idle-action"),
+	}
+	if id == "" {
+		return clt.SetSeedLimits(limits)
+	}
+	return clt.SetTorrentSeedLimits(id, &limits)
+}
+
+func handleSetLabels(c *cli.Context) error {
+	return clt.SetTorrentLabels(c.String("id"), c.StringSlice("label"))
+}
+
+func handleLabels(c *cli.Context) error {
+	labels, err := clt.ListLabels()
+	if err != nil {
+		return err
+	}
+	b, err := prettyjson.Marshal(labels)
+	if err != nil {
+		return err
+	}
+	_, _ = os.Stdout.Write(b)
+	_, _ = os.Stdout.WriteString("\n")
+	return nil
+}
+
+func handleSetLabel(c *cli.Context) error {
+	label := rpctypes.Label{
+		Name:               c.String("name"),
+		DataDir:            c.String("data-dir"),
+		SpeedLimitDownload: c.Int64("download"),
+		SpeedLimitUpload:   c.Int64("upload"),
+		OnCompleteCmd:      strings.Fields(c.String("complete-cmd")),
+	}
+	if c.IsSet("ratio") || c.IsSet("time") || c.IsSet("idle") {
+		label.SeedLimits = &rpctypes.SeedLimits{
+			Ratio:       c.Float64("ratio"),
+			RatioAction: c.String("ratio-action"),
+			Time:        uint(c.Duration("time") / time.Second),
+			TimeAction:  c.String("time-action"),
+			Idle:        uint(c.Duration("idle") / time.Second),
+			IdleAction:  c.String("idle-action"),
+		}
+	}
+	return clt.SetLabel(label)
+}
+
+func handleRemoveLabel(c *cli.Context) error {
+	return clt.RemoveLabel(c.String("name"))
+}
+
+func handleEvents(c *cli.Context) error {
+	stream, err := clt.Events(c.StringSlice("type"), c.String("id"))
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	enc := json.NewEncoder(os.Stdout)
+	for {
+		e, err := stream.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = enc.Encode(e)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func handleFeeds(c *cli.Context) error {
+	feeds, err := clt.ListFeeds()
+	if err != nil {
+		return err
+	}
+	b, err := prettyjson.Marshal(feeds)
+	if err != nil {
+		return err
+	}
+	_, _ = os.Stdout.Write(b)
+	_, _ = os.Stdout.WriteString("\n")
+	return nil
+}
+
+func handleAddFeed(c *cli.Context) error {
+	return clt.AddFeed(rpctypes.Feed{
+		Name:           c.String("name"),
+		URL:            c.String("url"),
+		Interval:       uint(c.Duration("interval") / time.Second),
+		Include:        c.StringSlice("include"),
+		Exclude:        c.StringSlice("exclude"),
+		UniqueEpisodes: c.Bool("unique-episodes"),
+		Label:          c.String("label"),
+		DataDir:        c.String("data-dir"),
+		Stopped:        c.Bool("stopped"),
+	})
+}
+
+func handleRemoveFeed(c *cli.Context) error {
+	return clt.RemoveFeed(c.String("name"))
+}
+
 func handleStartAll(c *cli.Context) error {
 	return clt.StartAllTorrents()
 }
@@ -1036,6 +1592,10 @@ func handleMove(c *cli.Context) error {
 	return clt.MoveTorrent(c.String("id"), c.String("target"))
 }
 
+func handleMoveData(c *cli.Context) error {
+	return clt.MoveData(c.String("id"), c.String("data-dir"))
+}
+
 func handleConsole(c *cli.Context) error {
 	columns := strings.Split(c.String("columns"), " ")
 
@@ -1098,8 +1658,11 @@ func handleTorrentCreate(c *cli.Context) error {
 	comment := c.String("comment")
 	trackers := c.StringSlice("tracker")
 	webseeds := c.StringSlice("webseed")
+	version, err := metainfo.ParseVersion(c.String("version"))
+	if err != nil {
+		return err
+	}
 
-	var err error
 	out, err = homedir.Expand(out)
 	if err != nil {
 		return err
@@ -1116,11 +1679,11 @@ func handleTorrentCreate(c *cli.Context) error {
 		tiers[i] = []string{tr}
 	}
 
-	info, err := metainfo.NewInfoBytes(root, paths, private, uint32(pieceLength<<10), name, log)
+	info, pieceLayers, err := metainfo.NewInfoBytes(root, paths, private, uint32(pieceLength<<10), name, version, log)
 	if err != nil {
 		return err
 	}
-	mi, err := metainfo.NewBytes(info, tiers, webseeds, comment)
+	mi, err := metainfo.NewBytes(info, pieceLayers, tiers, webseeds, comment)
 	if err != nil {
 		return err
 	}
@@ -57,12 +57,23 @@ func (c *Client) ListTorrents() ([]rpctypes.Torrent, error) {
 	return reply.Torrents, c.client.Call("Session.ListTorrents", nil, &reply)
 }
 
+// ListTorrentsWithLabel returns the torrents that have the label.
+func (c *Client) ListTorrentsWithLabel(label string) ([]rpctypes.Torrent, error) {
+	args := rpctypes.ListTorrentsRequest{Label: label}
+	var reply rpctypes.ListTorrentsResponse
+	return reply.Torrents, c.client.Call("Session.ListTorrents", args, &reply)
+}
+
 // AddTorrentOptions contains optional parameters for adding a new Torrent.
 type AddTorrentOptions struct {
 	ID                string
 	Stopped           bool
 	StopAfterDownload bool
 	StopAfterMetadata bool
+	FilePriorities    []string
+	IncompleteDir     string
+	DataPath          string
+	Labels            []string
 }
 
 // AddTorrent adds a new torrent by reading .torrent file.
@@ -77,6 +88,10 @@ func (c *Client) AddTorrent(f io.Reader, options *AddTorrentOptions) (*rpctypes.
 		args.AddTorrentOptions.Stopped = options.Stopped
 		args.AddTorrentOptions.StopAfterDownload = options.StopAfterDownload
 		args.AddTorrentOptions.StopAfterMetadata = options.StopAfterMetadata
+		args.AddTorrentOptions.FilePriorities = options.FilePriorities
+		args.AddTorrentOptions.IncompleteDir = options.IncompleteDir
+		args.AddTorrentOptions.DataPath = options.DataPath
+		args.AddTorrentOptions.Labels = options.Labels
 	}
 	var reply rpctypes.AddTorrentResponse
 	return &reply.Torrent, c.client.Call("Session.AddTorrent", args, &reply)
@@ -90,14 +105,32 @@ func (c *Client) AddURI(uri string, options *AddTorrentOptions) (*rpctypes.Torre
 		args.AddTorrentOptions.Stopped = options.Stopped
 		args.AddTorrentOptions.StopAfterDownload = options.StopAfterDownload
 		args.AddTorrentOptions.StopAfterMetadata = options.StopAfterMetadata
+		args.AddTorrentOptions.FilePriorities = options.FilePriorities
+		args.AddTorrentOptions.IncompleteDir = options.IncompleteDir
+		args.AddTorrentOptions.DataPath = options.DataPath
+		args.AddTorrentOptions.Labels = options.Labels
 	}
 	var reply rpctypes.AddURIResponse
 	return &reply.Torrent, c.client.Call("Session.AddURI", args, &reply)
 }
 
+// RemoveTorrentOptions contains optional parameters for removing a Torrent.
+type RemoveTorrentOptions struct {
+	KeepData bool
+}
+
 // RemoveTorrent removes a torrent from remote Session and deletes its data.
 func (c *Client) RemoveTorrent(id string) error {
+	return c.RemoveTorrentWithOptions(id, nil)
+}
+
+// RemoveTorrentWithOptions removes a torrent from remote Session.
+// Data is deleted unless KeepData option is set.
+func (c *Client) RemoveTorrentWithOptions(id string, options *RemoveTorrentOptions) error {
 	args := rpctypes.RemoveTorrentRequest{ID: id}
+	if options != nil {
+		args.KeepData = options.KeepData
+	}
 	var reply rpctypes.RemoveTorrentResponse
 	return c.client.Call("Session.RemoveTorrent", args, &reply)
 }
@@ -123,6 +156,13 @@ func (c *Client) GetSessionStats() (*rpctypes.SessionStats, error) {
 	return &reply.Stats, c.client.Call("Session.GetSessionStats", args, &reply)
 }
 
+// SetAltSpeedLimits activates or deactivates the alternative speed limits of the remote Session.
+func (c *Client) SetAltSpeedLimits(enabled bool) error {
+	args := rpctypes.SetAltSpeedLimitsRequest{Enabled: enabled}
+	var reply rpctypes.SetAltSpeedLimitsResponse
+	return c.client.Call("Session.SetAltSpeedLimits", args, &reply)
+}
+
 // GetMagnet returns the torrent as a magnet link.
 func (c *Client) GetMagnet(id string) (string, error) {
 	args := rpctypes.GetMagnetRequest{ID: id}
@@ -163,6 +203,21 @@ func (c *Client) GetTorrentWebseeds(id string) ([]rpctypes.Webseed, error) {
 	return reply.Webseeds, c.client.Call("Session.GetTorrentWebseeds", args, &reply)
 }
 
+// GetTorrentFiles returns the list of files in the torrent.
+func (c *Client) GetTorrentFiles(id string) ([]rpctypes.File, error) {
+	args := rpctypes.GetTorrentFilesRequest{ID: id}
+	var reply rpctypes.GetTorrentFilesResponse
+	return reply.Files, c.client.Call("Session.GetTorrentFiles", args, &reply)
+}
+
+// SetFilePriorities changes the download priorities of files in the torrent.
+// Valid priorities are "skip", "low", "normal" and "high".
+func (c *Client) SetFilePriorities(id string, priorities []string) error {
+	args := rpctypes.SetFilePrioritiesRequest{ID: id, Priorities: priorities}
+	var reply rpctypes.SetFilePrioritiesResponse
+	return c.client.Call("Session.SetFilePriorities", args, &reply)
+}
+
 // StartTorrent starts the torrent.
 func (c *Client) StartTorrent(id string) error {
 	args := rpctypes.StartTorrentRequest{ID: id}
@@ -177,6 +232,104 @@ func (c *Client) StopTorrent(id string) error {
 	return c.client.Call("Session.StopTorrent", args, &reply)
 }
 
+// ForceStartTorrent starts the torrent regardless of the queue limits.
+func (c *Client) ForceStartTorrent(id string) error {
+	args := rpctypes.ForceStartTorrentRequest{ID: id}
+	var reply rpctypes.ForceStartTorrentResponse
+	return c.client.Call("Session.ForceStartTorrent", args, &reply)
+}
+
+// MoveTorrentUpInQueue moves the torrent one step towards the head of the queue.
+func (c *Client) MoveTorrentUpInQueue(id string) error {
+	args := rpctypes.MoveTorrentUpInQueueRequest{ID: id}
+	var reply rpctypes.MoveTorrentUpInQueueResponse
+	return c.client.Call("Session.MoveTorrentUpInQueue", args, &reply)
+}
+
+// MoveTorrentDownInQueue moves the torrent one step towards the end of the queue.
+func (c *Client) MoveTorrentDownInQueue(id string) error {
+	args := rpctypes.MoveTorrentDownInQueueRequest{ID: id}
+	var reply rpctypes.MoveTorrentDownInQueueResponse
+	return c.client.Call("Session.MoveTorrentDownInQueue", args, &reply)
+}
+
+// SetTorrentSeedLimits sets the seeding limits of the torrent. Nil value makes the torrent use the global limits.
+func (c *Client) SetTorrentSeedLimits(id string, limits *rpctypes.SeedLimits) error {
+	args := rpctypes.SetTorrentSeedLimitsRequest{ID: id, Limits: limits}
+	var reply rpctypes.SetTorrentSeedLimitsResponse
+	return c.client.Call("Session.SetTorrentSeedLimits", args, &reply)
+}
+
+// SetTorrentSpeedLimits sets the download and upload speed limits of the torrent in KB/s. Zero means no limit.
+func (c *Client) SetTorrentSpeedLimits(id string, download, upload int64) error {
+	args := rpctypes.SetTorrentSpeedLimitsRequest{ID: id, Download: download, Upload: upload}
+	var reply rpctypes.SetTorrentSpeedLimitsResponse
+	return c.client.Call("Session.SetTorrentSpeedLimits", args, &reply)
+}
+
+// GetSeedLimits returns the global seeding limits of the session.
+func (c *Client) GetSeedLimits() (*rpctypes.SeedLimits, error) {
+	args := rpctypes.GetSeedLimitsRequest{}
+	var reply rpctypes.GetSeedLimitsResponse
+	return &reply.Limits, c.client.Call("Session.GetSeedLimits", args, &reply)
+}
+
+// SetSeedLimits changes the global seeding limits of the session.
+func (c *Client) SetSeedLimits(limits rpctypes.SeedLimits) error {
+	args := rpctypes.SetSeedLimitsRequest{Limits: limits}
+	var reply rpctypes.SetSeedLimitsResponse
+	return c.client.Call("Session.SetSeedLimits", args, &reply)
+}
+
+// SetTorrentLabels replaces the labels of the torrent.
+func (c *Client) SetTorrentLabels(id string, labels []string) error {
+	args := rpctypes.SetTorrentLabelsRequest{ID: id, Labels: labels}
+	var reply rpctypes.SetTorrentLabelsResponse
+	return c.client.Call("Session.SetTorrentLabels", args, &reply)
+}
+
+// ListLabels returns the default settings of labels in the session.
+func (c *Client) ListLabels() ([]rpctypes.Label, error) {
+	args := rpctypes.ListLabelsRequest{}
+	var reply rpctypes.ListLabelsResponse
+	return reply.Labels, c.client.Call("Session.ListLabels", args, &reply)
+}
+
+// SetLabel sets the default settings of the label.
+func (c *Client) SetLabel(label rpctypes.Label) error {
+	args := rpctypes.SetLabelRequest{Label: label}
+	var reply rpctypes.SetLabelResponse
+	return c.client.Call("Session.SetLabel", args, &reply)
+}
+
+// RemoveLabel removes the default settings of the label.
+func (c *Client) RemoveLabel(name string) error {
+	args := rpctypes.RemoveLabelRequest{Name: name}
+	var reply rpctypes.RemoveLabelResponse
+	return c.client.Call("Session.RemoveLabel", args, &reply)
+}
+
+// ListFeeds returns the feeds in the session.
+func (c *Client) ListFeeds() ([]rpctypes.Feed, error) {
+	args := rpctypes.ListFeedsRequest{}
+	var reply rpctypes.ListFeedsResponse
+	return reply.Feeds, c.client.Call("Session.ListFeeds", args, &reply)
+}
+
+// AddFeed adds a new feed to the session, or replaces the feed that has the same name.
+func (c *Client) AddFeed(feed rpctypes.Feed) error {
+	args := rpctypes.AddFeedRequest{Feed: feed}
+	var reply rpctypes.AddFeedResponse
+	return c.client.Call("Session.AddFeed", args, &reply)
+}
+
+// RemoveFeed removes the feed from the session.
+func (c *Client) RemoveFeed(name string) error {
+	args := rpctypes.RemoveFeedRequest{Name: name}
+	var reply rpctypes.RemoveFeedResponse
+	return c.client.Call("Session.RemoveFeed", args, &reply)
+}
+
 // AnnounceTorrent forces the torrent to re-announce to trackers and DHT.
 func (c *Client) AnnounceTorrent(id string) error {
 	args := rpctypes.AnnounceTorrentRequest{ID: id}
@@ -199,6 +352,14 @@ func (c *Client) MoveTorrent(id, target string) error {
 	return c.client.Call("Session.MoveTorrent", args, &reply)
 }
 
+// MoveData moves the files of the torrent into another directory on the server.
+// Files are moved in background. Progress can be seen in torrent stats.
+func (c *Client) MoveData(id, dataDir string) error {
+	args := rpctypes.MoveDataRequest{ID: id, DataDir: dataDir}
+	var reply rpctypes.MoveDataResponse
+	return c.client.Call("Session.MoveData", args, &reply)
+}
+
 // StartAllTorrents starts all torrents in the Session.
 func (c *Client) StartAllTorrents() error {
 	args := rpctypes.StartAllTorrentsRequest{}
@@ -0,0 +1,81 @@
+package rainrpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/cenkalti/rain/internal/rpctypes"
+)
+
+// EventStream receives the events of a remote Session.
+type EventStream struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+}
+
+// Events opens a stream for receiving the events of the remote Session.
+// Types are the names of event types, e.g. "torrent-added". All events are received if types is empty.
+// If id is not empty, only the events of that torrent are received.
+// The stream must be closed after use.
+func (c *Client) Events(types []string, id string) (*EventStream, error) {
+	q := url.Values{}
+	if len(types) > 0 {
+		q.Set("type", strings.Join(types, ","))
+	}
+	if id != "" {
+		q.Set("id", id)
+	}
+	u := strings.TrimSuffix(c.addr, "/") + "/events"
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	// Timeout of the client is not used because the stream does not end.
+	resp, err := http.Get(u) // nolint: noctx
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("invalid status code: %d: %s", resp.StatusCode, bytes.TrimSpace(b))
+	}
+	return &EventStream{
+		body:    resp.Body,
+		scanner: bufio.NewScanner(resp.Body),
+	}, nil
+}
+
+// Next blocks until the next event is received. Returns io.EOF if the server closes the stream.
+func (s *EventStream) Next() (rpctypes.Event, error) {
+	var e rpctypes.Event
+	var data []byte
+	for s.scanner.Scan() {
+		line := s.scanner.Bytes()
+		switch {
+		case len(line) == 0:
+			if data == nil {
+				continue
+			}
+			return e, json.Unmarshal(data, &e)
+		case bytes.HasPrefix(line, []byte("data:")):
+			data = append(data, bytes.TrimSpace(line[len("data:"):])...)
+		}
+		// Comments and other fields are ignored. Type of the event is in the data too.
+	}
+	err := s.scanner.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	return e, err
+}
+
+// Close the stream.
+func (s *EventStream) Close() error {
+	return s.body.Close()
+}
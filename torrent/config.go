@@ -23,17 +23,39 @@ type Config struct {
 	Database string
 	// DataDir is where files are downloaded.
 	DataDir string
+	// If not empty, files are saved into this directory while downloading and moved into DataDir after download completes.
+	// Files are renamed if both directories are on the same file system, otherwise they are copied.
+	// Not used if StorageProvider is set.
+	IncompleteDir string
 	// If true, torrent files are saved into <data_dir>/<torrent_id>/<torrent_name>.
 	// Useful if downloading the same torrent from multiple sources.
 	DataDirIncludesTorrentID bool
-	// Host to listen for TCP Acceptor. Port is computed automatically
+	// Host to listen for TCP and uTP acceptors. Port is computed automatically
+	// If Host is an unspecified address ("0.0.0.0" or "::"), both IPv4 and IPv6 connections are accepted.
 	Host string
 	// New torrents will be listened at selected port in this range.
 	PortBegin, PortEnd uint16
+	// Listen a single port for all torrents instead of a separate port for each torrent.
+	// Incoming connections are matched to torrents by the info hash in the handshake.
+	// The shared port is announced to trackers and DHT. PortBegin and PortEnd are not used.
+	SharedPortEnabled bool
+	// TCP and UDP port number for SharedPortEnabled. A random port is selected if it is 0.
+	SharedPort uint16
+	// Max number of incoming connections that are handshaking on the shared port at the same time.
+	// New connections are closed when the limit is reached.
+	SharedPortMaxHandshakes int
 	// At start, client will set max open files limit to this number. (like "ulimit -n" command)
 	MaxOpenFiles uint64
 	// Enable peer exchange protocol.
 	PEXEnabled bool
+	// Enable Local Service Discovery (BEP 14). Torrents are announced to multicast groups for finding peers on the local network.
+	// LSD is not used for private torrents.
+	LSDEnabled bool
+	// Enable uTorrent transport protocol (BEP 29). Incoming uTP connections are accepted on the same port with TCP.
+	// Outgoing connections are tried with uTP first and TCP is used if uTP connection fails.
+	UTPEnabled bool
+	// Dial only TCP connections. Incoming uTP connections are still accepted if UTPEnabled is true.
+	DisableOutgoingUTP bool
 	// Resume data (bitfield & stats) are saved to disk at interval to keep IO lower.
 	ResumeWriteInterval time.Duration
 	// Peer id is prefixed with this string. See BEP 20. Remaining bytes of peer id will be randomized.
@@ -70,14 +92,67 @@ type Config struct {
 	SpeedLimitDownload int64
 	// Global upload speed limit in KB/s.
 	SpeedLimitUpload int64
+	// Download speed limit of a single peer in KB/s. Torrent and global limits also apply.
+	SpeedLimitPeerDownload int64
+	// Upload speed limit of a single peer in KB/s. Torrent and global limits also apply.
+	SpeedLimitPeerUpload int64
+	// Global download speed limit in KB/s that is used instead of SpeedLimitDownload while alternative speed limits are active.
+	AltSpeedLimitDownload int64
+	// Global upload speed limit in KB/s that is used instead of SpeedLimitUpload while alternative speed limits are active.
+	AltSpeedLimitUpload int64
+	// Activate alternative speed limits automatically according to AltSpeedSchedule.
+	AltSpeedScheduleEnabled bool
+	// Weekly schedule of alternative speed limits.
+	// Alternative limits are active while any of the rules matches the local time.
+	AltSpeedSchedule []AltSpeedRule
 	// Start torrent automatically if it was running when previous session was closed.
 	ResumeOnStartup bool
+	// Maximum number of torrents that are downloading at the same time. Zero means no limit.
+	// If any of the MaxActive limits is set, started torrents wait in queue until a slot becomes available.
+	// Torrents are started in queue order.
+	MaxActiveDownloads int
+	// Maximum number of torrents that are seeding at the same time. Zero means no limit.
+	MaxActiveSeeds int
+	// Maximum number of torrents that are downloading or seeding at the same time. Zero means no limit.
+	MaxActiveTorrents int
+	// Torrents that have not downloaded or uploaded any data for this duration do not count towards the MaxActive limits.
+	// Zero disables the check, all running torrents in queue count towards the limits.
+	QueueInactiveTimeout time.Duration
+	// Global seeding limits for torrents that have no limits set by Torrent.SetSeedLimits.
+	// Seeding torrents are stopped or removed when any of the limits is reached. Zero values disable the limits.
+	// Limits changed by Session.SetSeedLimits are saved in Database and they are used instead of this value.
+	SeedLimits SeedLimits
+	// Default settings of torrents by label name. See Label for details.
+	// Labels changed by Session.SetLabel and Session.RemoveLabel are saved in Database and they are used instead of this value.
+	Labels map[string]Label
+	// Directories that are watched for new .torrent and .magnet files. See WatchDir for details.
+	WatchDirs []WatchDir
+	// Interval of scanning WatchDirs for new files.
+	// On Linux, new files are also noticed immediately with inotify and scanning is only a fallback.
+	WatchDirPollInterval time.Duration
+	// RSS and Atom feeds that are fetched for adding new torrents. See Feed for details.
+	// Feeds are saved in the database and can be changed with Session.AddFeed and Session.RemoveFeed.
+	// Feeds in Config are added again when a new Session is created.
+	Feeds []Feed
+	// Interval of fetching Feeds that have no interval set.
+	FeedPollInterval time.Duration
+	// Commands and webhooks that are run on torrent events. See Hook for details.
+	Hooks []Hook
+	// Timeout of a single run of a hook.
+	HookTimeout time.Duration
+	// Number of retries after a hook fails. Hooks that still fail are retried when a new Session is created.
+	HookRetries int
+	// Time to wait before the first retry of a failed hook. Interval increases exponentially after each retry.
+	HookRetryInterval time.Duration
 	// Check each torrent loop for aliveness. Helps to detect bugs earlier.
 	HealthCheckInterval time.Duration
 	// If torrent loop is stuck for more than this duration. Program crashes with stacktrace.
 	HealthCheckTimeout time.Duration
 	// The unix permission of created files, execute bit is removed for files
 	FilePermissions fs.FileMode
+	// Returns the storage for saving torrent data. If nil, files are saved under DataDir.
+	// Use NewMemoryStorageProvider for keeping data in memory.
+	StorageProvider StorageProvider `yaml:"-"`
 
 	// Enable RPC server
 	RPCEnabled bool
@@ -87,6 +162,22 @@ type Config struct {
 	RPCPort int
 	// Time to wait for ongoing requests before shutting down RPC HTTP server.
 	RPCShutdownTimeout time.Duration
+	// Serve a subset of Transmission RPC protocol at /transmission/rpc path of the RPC server for Transmission clients.
+	// See README for the supported methods and fields.
+	TransmissionRPCEnabled bool
+	// Allow "torrent-add" requests of Transmission RPC to add .torrent files from local paths on the server.
+	// Otherwise, only magnet links, HTTP URLs and metainfo are accepted, so clients cannot read arbitrary files.
+	TransmissionRPCAllowLocalFiles bool
+
+	// Prometheus metrics are served at /metrics path of the RPC server.
+	// Set MetricsPort to serve them on a separate listener too. Zero port disables the separate listener.
+	MetricsHost string
+	MetricsPort int
+	// Maximum number of torrents that have their own series in metrics.
+	// Torrents with the highest total speed are chosen if there are more. Zero disables per-torrent series.
+	MetricsMaxTorrents int
+	// Include stopped torrents in per-torrent series of metrics.
+	MetricsStoppedTorrents bool
 
 	// Enable DHT node.
 	DHTEnabled bool
@@ -119,6 +210,9 @@ type Config struct {
 	TrackerHTTPMaxResponseSize uint
 	// Check and validate TLS ceritificates.
 	TrackerHTTPVerifyTLS bool
+	// Interval for scraping the trackers of all torrents in the session, including the stopped ones.
+	// Trackers are scraped for many torrents at once in a single request. Set to 0 for disabling scrapes.
+	TrackerScrapeInterval time.Duration
 
 	// Number of unchoked peers.
 	UnchokedPeers int
@@ -141,7 +235,7 @@ type Config struct {
 	MaxPeerAccept int
 	// Running metadata downloads, snubbed peers don't count
 	ParallelMetadataDownloads int
-	// Time to wait for TCP connection to open.
+	// Time to wait for TCP or uTP connection to open.
 	PeerConnectTimeout time.Duration
 	// Time to wait for BitTorrent handshake to complete.
 	PeerHandshakeTimeout time.Duration
@@ -192,6 +286,9 @@ type Config struct {
 	WebseedMaxDownloads int
 
 	// Shell command to execute on torrent completion.
+	// Label.OnCompleteCmd is used instead for torrents that have a label with a completion command.
+	// Command is run once without a timeout. It is not killed when the Session is closed, and Session.Close waits for it to finish.
+	// If it fails or the program exits before it finishes, it is run again in a new Session.
 	OnCompleteCmd []string
 }
 
@@ -206,6 +303,10 @@ var DefaultConfig = Config{
 	PortEnd:                                30000,
 	MaxOpenFiles:                           10240,
 	PEXEnabled:                             true,
+	LSDEnabled:                             true,
+	SharedPort:                             6881,
+	SharedPortMaxHandshakes:                100,
+	UTPEnabled:                             true,
 	ResumeWriteInterval:                    30 * time.Second,
 	PrivatePeerIDPrefix:                    "-RN" + Version + "-",
 	PrivateExtensionHandshakeClientVersion: "Rain " + Version,
@@ -224,6 +325,11 @@ var DefaultConfig = Config{
 	HealthCheckInterval:                    10 * time.Second,
 	HealthCheckTimeout:                     60 * time.Second,
 	FilePermissions:                        0o750,
+	WatchDirPollInterval:                   10 * time.Second,
+	FeedPollInterval:                       15 * time.Minute,
+	HookTimeout:                            30 * time.Second,
+	HookRetries:                            5,
+	HookRetryInterval:                      10 * time.Second,
 
 	// RPC Server
 	RPCEnabled:         true,
@@ -231,6 +337,10 @@ var DefaultConfig = Config{
 	RPCPort:            7246,
 	RPCShutdownTimeout: 5 * time.Second,
 
+	// Metrics
+	MetricsHost:        "127.0.0.1",
+	MetricsMaxTorrents: 100,
+
 	// Tracker
 	TrackerNumWant:              200,
 	TrackerStopTimeout:          5 * time.Second,
@@ -239,6 +349,7 @@ var DefaultConfig = Config{
 	TrackerHTTPPrivateUserAgent: "Rain/" + Version,
 	TrackerHTTPMaxResponseSize:  2 << 20,
 	TrackerHTTPVerifyTLS:        true,
+	TrackerScrapeInterval:       30 * time.Minute,
 
 	// DHT node
 	DHTEnabled:             true,
@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"os"
@@ -13,18 +14,21 @@ import (
 	"sync"
 	"time"
 
+	"github.com/cenkalti/rain/internal/acceptor"
 	"github.com/cenkalti/rain/internal/bitfield"
 	"github.com/cenkalti/rain/internal/blocklist"
 	"github.com/cenkalti/rain/internal/logger"
+	"github.com/cenkalti/rain/internal/lsd"
 	"github.com/cenkalti/rain/internal/peer"
 	"github.com/cenkalti/rain/internal/piececache"
 	"github.com/cenkalti/rain/internal/resolver"
 	"github.com/cenkalti/rain/internal/resourcemanager"
 	"github.com/cenkalti/rain/internal/resumer/boltdbresumer"
 	"github.com/cenkalti/rain/internal/semaphore"
+	"github.com/cenkalti/rain/internal/speedlimit"
 	"github.com/cenkalti/rain/internal/tracker"
 	"github.com/cenkalti/rain/internal/trackermanager"
-	"github.com/juju/ratelimit"
+	"github.com/cenkalti/rain/internal/utp"
 	"github.com/mitchellh/go-homedir"
 	"github.com/nictuku/dht"
 	"go.etcd.io/bbolt"
@@ -36,6 +40,8 @@ var (
 	blocklistKey          = []byte("blocklist")
 	blocklistTimestampKey = []byte("blocklist-timestamp")
 	blocklistURLHashKey   = []byte("blocklist-url-hash")
+	seedLimitsKey         = []byte("seed-limits")
+	labelsKey             = []byte("labels")
 )
 
 // Session contains torrents, DHT node, caches and other data structures shared by multiple torrents.
@@ -46,6 +52,7 @@ type Session struct {
 	log            logger.Logger
 	extensions     [8]byte
 	dht            *dht.DHT
+	lsd            *lsd.LSD
 	rpc            *rpcServer
 	trackerManager *trackermanager.TrackerManager
 	ram            *resourcemanager.ResourceManager[*peer.Peer]
@@ -54,10 +61,26 @@ type Session struct {
 	createdAt      time.Time
 	semWrite       *semaphore.Semaphore
 	metrics        *sessionMetrics
-	bucketDownload *ratelimit.Bucket
-	bucketUpload   *ratelimit.Bucket
 	closeC         chan struct{}
 
+	// Global speed limits. Limiters of torrents are chained to these.
+	downloadLimiter *speedlimit.Limiter
+	uploadLimiter   *speedlimit.Limiter
+
+	// Alternative speed limits are active instead of the normal limits.
+	// altSpeedScheduled is the state of the schedule at the last check.
+	mSpeedLimits      sync.Mutex
+	altSpeedLimits    bool
+	altSpeedScheduled bool
+
+	// Used in shared port mode for accepting connections of all torrents.
+	sharedPort        int
+	sharedConnC       chan net.Conn
+	sharedAcceptor    *acceptor.Acceptor
+	sharedUTPSocket   *utp.Socket
+	sharedUTPAcceptor *acceptor.Acceptor
+	sharedDoneC       chan struct{}
+
 	mPeerRequests   sync.Mutex
 	dhtPeerRequests map[*torrent]struct{}
 
@@ -66,6 +89,40 @@ type Session struct {
 	torrentsByInfoHash map[dht.InfoHash][]*Torrent
 	invalidTorrentIDs  []string
 
+	// Torrents ordered by their queue positions.
+	mQueue       sync.Mutex
+	queue        []*Torrent
+	queueUpdateC chan struct{}
+
+	// Global seeding limits. Initialized from Config, or from the database if changed by SetSeedLimits before.
+	mSeedLimits sync.RWMutex
+	seedLimits  SeedLimits
+
+	// Default settings of labels. Initialized from Config and can be changed by SetLabel.
+	mLabels sync.RWMutex
+	labels  map[string]Label
+
+	// Errors that occurred while adding torrents from Config.WatchDirs.
+	mWatchDirs        sync.Mutex
+	watchDirErrors    int
+	watchDirLastError error
+
+	// Feeds that are fetched for adding new torrents, by feed name.
+	mFeeds sync.Mutex
+	feeds  map[string]*feedSubscription
+
+	// Hooks that are being delivered. New hooks are not run after hooksClosed is set.
+	mHooks      sync.Mutex
+	hooksWG     sync.WaitGroup
+	hooksClosed bool
+
+	// Receivers of the events. Nil after the Session is closed.
+	mSubscriptions sync.RWMutex
+	subscriptions  map[*EventSubscription]struct{}
+
+	// Separate server for Prometheus metrics. Nil if Config.MetricsPort is not set.
+	metricsServer *http.Server
+
 	mPorts         sync.RWMutex
 	availablePorts map[int]struct{}
 
@@ -80,6 +137,21 @@ func NewSession(cfg Config) (*Session, error) {
 	if cfg.PortBegin >= cfg.PortEnd {
 		return nil, errors.New("invalid port range")
 	}
+	hookNames := make(map[string]struct{}, len(cfg.Hooks))
+	for _, h := range cfg.Hooks {
+		if err := h.validate(); err != nil {
+			return nil, fmt.Errorf("invalid hook %q: %w", h.Name, err)
+		}
+		if _, ok := hookNames[h.Name]; ok {
+			return nil, fmt.Errorf("duplicate hook name: %q", h.Name)
+		}
+		hookNames[h.Name] = struct{}{}
+	}
+	for _, f := range cfg.Feeds {
+		if _, err := newFeedSubscription(f); err != nil {
+			return nil, fmt.Errorf("invalid feed %s: %w", f.Name, err)
+		}
+	}
 	if cfg.MaxOpenFiles > 0 {
 		err := setNoFile(cfg.MaxOpenFiles)
 		if err != nil {
@@ -95,6 +167,10 @@ func NewSession(cfg Config) (*Session, error) {
 	if err != nil {
 		return nil, err
 	}
+	cfg.IncompleteDir, err = homedir.Expand(cfg.IncompleteDir)
+	if err != nil {
+		return nil, err
+	}
 	err = os.MkdirAll(filepath.Dir(cfg.Database), os.ModeDir|cfg.FilePermissions)
 	if err != nil {
 		return nil, err
@@ -117,6 +193,14 @@ func NewSession(cfg Config) (*Session, error) {
 		if err2 != nil {
 			return err2
 		}
+		_, err2 = tx.CreateBucketIfNotExists(feedsBucket)
+		if err2 != nil {
+			return err2
+		}
+		_, err2 = tx.CreateBucketIfNotExists(hooksBucket)
+		if err2 != nil {
+			return err2
+		}
 		b, err2 := tx.CreateBucketIfNotExists(torrentsBucket)
 		if err2 != nil {
 			return err2
@@ -150,6 +234,14 @@ func NewSession(cfg Config) (*Session, error) {
 			return nil, err
 		}
 	}
+	var lsdNode *lsd.LSD
+	if cfg.LSDEnabled {
+		// Multicast may not be available on the host. Session can work without LSD.
+		lsdNode, err = lsd.New()
+		if err != nil {
+			l.Warningln("cannot start local service discovery:", err.Error())
+		}
+	}
 	ports := make(map[int]struct{})
 	for p := cfg.PortBegin; p < cfg.PortEnd; p++ {
 		ports[int(p)] = struct{}{}
@@ -171,11 +263,17 @@ func NewSession(cfg Config) (*Session, error) {
 		torrentsByInfoHash: make(map[dht.InfoHash][]*Torrent),
 		availablePorts:     ports,
 		dht:                dhtNode,
+		lsd:                lsdNode,
 		pieceCache:         piececache.New(cfg.ReadCacheSize, cfg.ReadCacheTTL, cfg.ParallelReads),
 		ram:                resourcemanager.New[*peer.Peer](cfg.WriteCacheSize),
 		createdAt:          time.Now(),
 		semWrite:           semaphore.New(int(cfg.ParallelWrites)),
 		closeC:             make(chan struct{}),
+		queueUpdateC:       make(chan struct{}, 1),
+		seedLimits:         cfg.SeedLimits,
+		labels:             make(map[string]Label, len(cfg.Labels)),
+		feeds:              make(map[string]*feedSubscription),
+		subscriptions:      make(map[*EventSubscription]struct{}),
 		webseedClient: http.Client{
 			Transport: &http.Transport{
 				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
@@ -195,13 +293,15 @@ func NewSession(cfg Config) (*Session, error) {
 			},
 		},
 	}
-	dlSpeed := cfg.SpeedLimitDownload * 1024
-	if cfg.SpeedLimitDownload > 0 {
-		c.bucketDownload = ratelimit.NewBucketWithRate(float64(dlSpeed), dlSpeed)
+	c.downloadLimiter = speedlimit.New(nil)
+	c.uploadLimiter = speedlimit.New(nil)
+	if cfg.AltSpeedScheduleEnabled {
+		c.altSpeedScheduled = altSpeedScheduleActive(cfg.AltSpeedSchedule, time.Now())
+		c.altSpeedLimits = c.altSpeedScheduled
 	}
-	ulSpeed := cfg.SpeedLimitUpload * 1024
-	if cfg.SpeedLimitUpload > 0 {
-		c.bucketUpload = ratelimit.NewBucketWithRate(float64(ulSpeed), ulSpeed)
+	c.applySpeedLimits()
+	for name, l := range cfg.Labels {
+		c.labels[name] = l
 	}
 	err = c.startBlocklistReloader()
 	if err != nil {
@@ -213,23 +313,76 @@ func NewSession(cfg Config) (*Session, error) {
 	}
 	ext.Set(61) // Fast Extension (BEP 6)
 	ext.Set(43) // Extension Protocol (BEP 10)
+	ext.Set(59) // BitTorrent v2 (BEP 52)
 	if cfg.DHTEnabled {
 		ext.Set(63) // DHT Protocol (BEP 5)
 		c.dhtPeerRequests = make(map[*torrent]struct{})
 	}
 	c.initMetrics()
+	if cfg.SharedPortEnabled {
+		err = c.startSharedListener()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = c.loadSeedLimits()
+	if err != nil {
+		return nil, err
+	}
+	err = c.loadLabels()
+	if err != nil {
+		return nil, err
+	}
 	c.loadExistingTorrents(ids)
+	// Torrents are running from now on, so the Session is closed if an error occurs.
+	fail := func(err error) (*Session, error) {
+		c.mFeeds.Lock()
+		// Feeds are not started yet. Close must not wait for them.
+		c.feeds = make(map[string]*feedSubscription)
+		c.mFeeds.Unlock()
+		if err2 := c.Close(); err2 != nil {
+			c.log.Errorln("cannot close session:", err2.Error())
+		}
+		return nil, err
+	}
+	err = c.loadRemovedHooks()
+	if err != nil {
+		return fail(err)
+	}
+	err = c.loadFeeds()
+	if err != nil {
+		return fail(err)
+	}
 	if c.config.RPCEnabled {
 		c.rpc = newRPCServer(c)
 		err = c.rpc.Start(c.config.RPCHost, c.config.RPCPort)
 		if err != nil {
-			return nil, err
+			return fail(err)
+		}
+	}
+	if c.config.MetricsPort != 0 {
+		err = c.startMetricsServer()
+		if err != nil {
+			return fail(err)
 		}
 	}
 	if cfg.DHTEnabled {
 		go c.processDHTResults()
 	}
 	go c.updateStatsLoop()
+	go c.queueLoop()
+	go c.seedLimitsLoop()
+	go c.altSpeedLoop()
+	if c.lsd != nil {
+		go c.processLSDResults()
+	}
+	if cfg.TrackerScrapeInterval > 0 {
+		go c.scrapeLoop()
+	}
+	for _, wd := range cfg.WatchDirs {
+		go c.watchDirLoop(wd)
+	}
+	c.startFeeds()
 	return c, nil
 }
 
@@ -262,10 +415,17 @@ func (s *Session) getTrackerUserAgent(private bool) string {
 // Close stops all torrents and release the resources.
 func (s *Session) Close() error {
 	close(s.closeC)
+	s.waitFeeds()
 
 	if s.config.DHTEnabled {
 		s.dht.Stop()
 	}
+	if s.lsd != nil {
+		s.lsd.Close()
+	}
+	if s.sharedAcceptor != nil {
+		s.stopSharedListener()
+	}
 
 	s.updateStats()
 
@@ -282,6 +442,11 @@ func (s *Session) Close() error {
 	s.torrents = nil
 	s.mTorrents.Unlock()
 
+	s.waitHooks()
+
+	if s.metricsServer != nil {
+		s.metricsServer.Close()
+	}
 	if s.rpc != nil {
 		err := s.rpc.Stop(s.config.RPCShutdownTimeout)
 		if err != nil {
@@ -289,6 +454,7 @@ func (s *Session) Close() error {
 		}
 	}
 
+	s.closeSubscriptions()
 	s.ram.Close()
 	s.pieceCache.Close()
 	s.metrics.Close()
@@ -308,6 +474,9 @@ func (s *Session) ListTorrents() []*Torrent {
 }
 
 func (s *Session) getPort() (int, error) {
+	if s.sharedAcceptor != nil {
+		return s.sharedPort, nil
+	}
 	s.mPorts.Lock()
 	defer s.mPorts.Unlock()
 	for p := range s.availablePorts {
@@ -318,11 +487,23 @@ func (s *Session) getPort() (int, error) {
 }
 
 func (s *Session) releasePort(port int) {
+	if s.sharedAcceptor != nil {
+		return
+	}
 	s.mPorts.Lock()
 	defer s.mPorts.Unlock()
 	s.availablePorts[port] = struct{}{}
 }
 
+// resumePort returns the port number to be saved in resume data.
+// Torrents do not have their own port in shared port mode.
+func (s *Session) resumePort(port int) int {
+	if s.sharedAcceptor != nil {
+		return 0
+	}
+	return port
+}
+
 // GetTorrent by its id. Returns nil if torrent with id is not found.
 func (s *Session) GetTorrent(id string) *Torrent {
 	s.mTorrents.RLock()
@@ -330,11 +511,38 @@ func (s *Session) GetTorrent(id string) *Torrent {
 	return s.torrents[id]
 }
 
+// RemoveTorrentOptions contains options for removing a torrent.
+type RemoveTorrentOptions struct {
+	// Do not delete the files of the torrent.
+	KeepData bool
+}
+
 // RemoveTorrent removes the torrent from the session and delete its files.
 func (s *Session) RemoveTorrent(id string) error {
+	return s.RemoveTorrentWithOptions(id, nil)
+}
+
+// RemoveTorrentWithOptions removes the torrent from the session.
+// Nil value can be passed as opt for default options.
+func (s *Session) RemoveTorrentWithOptions(id string, opt *RemoveTorrentOptions) error {
+	if opt == nil {
+		opt = &RemoveTorrentOptions{}
+	}
 	t, err := s.removeTorrentFromClient(id)
-	if t != nil {
-		err = s.stopAndRemoveData(t)
+	if t == nil {
+		return err
+	}
+	defer func() {
+		t.torrent.publishEvent(Event{Type: EventTorrentRemoved})
+		t.torrent.runHooks(EventTorrentRemoved, nil)
+	}()
+	if opt.KeepData {
+		s.stopTorrent(t)
+		return err
+	}
+	err2 := s.stopAndRemoveData(t)
+	if err == nil {
+		err = err2
 	}
 	return err
 }
@@ -350,13 +558,20 @@ func (s *Session) removeTorrentFromClient(id string) (*Torrent, error) {
 	delete(s.torrents, id)
 
 	// Delete from the list of torrents with same info hash
-	ih := dht.InfoHash(t.torrent.InfoHash())
-	a := s.torrentsByInfoHash[ih]
-	for i, it := range a {
-		if it == t {
-			a[i] = a[len(a)-1]
-			s.torrentsByInfoHash[ih] = a[:len(a)-1]
-			break
+	var unusedInfoHashes []dht.InfoHash
+	for _, h := range t.torrent.infoHashes() {
+		ih := dht.InfoHash(h[:])
+		a := s.torrentsByInfoHash[ih]
+		for i, it := range a {
+			if it == t {
+				a[i] = a[len(a)-1]
+				s.torrentsByInfoHash[ih] = a[:len(a)-1]
+				break
+			}
+		}
+		if len(s.torrentsByInfoHash[ih]) == 0 {
+			delete(s.torrentsByInfoHash, ih)
+			unusedInfoHashes = append(unusedInfoHashes, ih)
 		}
 	}
 
@@ -366,29 +581,35 @@ func (s *Session) removeTorrentFromClient(id string) (*Torrent, error) {
 	// DHT.PeersRequestResults. That's why we are releasing the lock before calling DHT.RemoveInfoHash.
 	s.mTorrents.Unlock()
 
-	if s.config.DHTEnabled && len(s.torrentsByInfoHash[ih]) == 0 {
-		s.dht.RemoveInfoHash(string(ih))
+	if s.config.DHTEnabled {
+		for _, ih := range unusedInfoHashes {
+			s.dht.RemoveInfoHash(string(ih))
+		}
 	}
-	return t, s.db.Update(func(tx *bbolt.Tx) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		err := moveRemovedHooks(tx, id)
+		if err != nil {
+			return err
+		}
 		return tx.Bucket(torrentsBucket).DeleteBucket([]byte(id))
 	})
+	err2 := s.removeFromQueue(t)
+	if err == nil {
+		err = err2
+	}
+	return t, err
 }
 
-func (s *Session) stopAndRemoveData(t *Torrent) error {
+func (s *Session) stopTorrent(t *Torrent) {
 	t.torrent.Close()
 	s.releasePort(t.torrent.port)
-	var err error
-	var dest string
-	if s.config.DataDirIncludesTorrentID {
-		dest = filepath.Join(s.config.DataDir, t.torrent.id)
-	} else if t.torrent.info != nil {
-		dest = filepath.Join(s.config.DataDir, t.torrent.info.Name)
-	}
-	if dest != "" {
-		err = os.RemoveAll(dest)
-		if err != nil {
-			s.log.Errorf("cannot remove torrent data. err: %s dest: %s", err, dest)
-		}
+}
+
+func (s *Session) stopAndRemoveData(t *Torrent) error {
+	s.stopTorrent(t)
+	err := t.torrent.storage.RemoveAll(t.torrent.fileNames())
+	if err != nil {
+		s.log.Errorf("cannot remove torrent data. err: %s dest: %s", err, t.torrent.storage.RootDir())
 	}
 	return err
 }
@@ -401,6 +622,7 @@ func (s *Session) StartAll() error {
 		for _, t := range s.torrents {
 			b := tb.Bucket([]byte(t.torrent.id))
 			_ = b.Put([]byte("started"), []byte("true"))
+			_ = b.Put([]byte("force_started"), []byte("false"))
 		}
 		defer s.mTorrents.RUnlock()
 		return nil
@@ -409,7 +631,7 @@ func (s *Session) StartAll() error {
 		return err
 	}
 	for _, t := range s.torrents {
-		t.torrent.Start()
+		s.startTorrent(t)
 	}
 	return nil
 }
@@ -422,6 +644,7 @@ func (s *Session) StopAll() error {
 		for _, t := range s.torrents {
 			b := tb.Bucket([]byte(t.torrent.id))
 			_ = b.Put([]byte("started"), []byte("false"))
+			_ = b.Put([]byte("force_started"), []byte("false"))
 		}
 		defer s.mTorrents.RUnlock()
 		return nil
@@ -430,14 +653,18 @@ func (s *Session) StopAll() error {
 		return err
 	}
 	for _, t := range s.torrents {
-		t.torrent.Stop()
+		s.stopQueuedTorrent(t)
 	}
 	return nil
 }
 
 func (s *Session) getDataDir(torrentID string) string {
+	return s.getTorrentDir(s.config.DataDir, torrentID)
+}
+
+func (s *Session) getTorrentDir(root, torrentID string) string {
 	if s.config.DataDirIncludesTorrentID {
-		return filepath.Join(s.config.DataDir, torrentID)
+		return filepath.Join(root, torrentID)
 	}
-	return s.config.DataDir
+	return root
 }
@@ -1,12 +1,15 @@
 package torrent
 
 import (
+	"bytes"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -14,9 +17,9 @@ import (
 	"github.com/cenkalti/rain/internal/metainfo"
 	"github.com/cenkalti/rain/internal/resumer"
 	"github.com/cenkalti/rain/internal/resumer/boltdbresumer"
-	"github.com/cenkalti/rain/internal/storage/filestorage"
 	"github.com/cenkalti/rain/internal/webseedsource"
 	"github.com/gofrs/uuid"
+	"github.com/mitchellh/go-homedir"
 	"github.com/nictuku/dht"
 )
 
@@ -31,6 +34,23 @@ type AddTorrentOptions struct {
 	StopAfterDownload bool
 	// Stop torrent after metadata is downloaded from magnet links.
 	StopAfterMetadata bool
+	// Download priorities of files in the same order with the files in torrent.
+	// If nil, all files are downloaded with normal priority.
+	// For magnet links, priorities are discarded if they do not match the files in downloaded metadata.
+	FilePriorities []FilePriority
+	// Files are saved into this directory while downloading and moved into Config.DataDir after download completes.
+	// Overrides Config.IncompleteDir.
+	IncompleteDir string
+	// Existing directory that contains the torrent data. Files are not copied into Config.DataDir.
+	// For multi-file torrents, files are expected to be in a sub-directory that has the same name with the torrent.
+	// Existing files are verified and the torrent starts seeding if all pieces are present.
+	// IncompleteDir is not used when DataPath is set.
+	DataPath string
+	// Files are saved into this directory instead of Config.DataDir or the data directory of labels.
+	// IncompleteDir is used while downloading as usual. Ignored when DataPath is set.
+	DataDir string
+	// Labels of the torrent. Default settings of the labels in Config.Labels are applied to the torrent.
+	Labels []string
 }
 
 // AddTorrent adds a new torrent to the session by reading .torrent metainfo from reader.
@@ -66,7 +86,18 @@ func (s *Session) addTorrentStopped(r io.Reader, opt *AddTorrentOptions) (*Torre
 	if err != nil {
 		return nil, newInputError(err)
 	}
-	id, port, sto, err := s.add(opt)
+	if opt.FilePriorities != nil {
+		err = validateFilePriorities(opt.FilePriorities, len(mi.Info.Files))
+		if err != nil {
+			return nil, newInputError(err)
+		}
+	}
+	labels := cleanLabels(opt.Labels)
+	dataDir, incompleteDir, err := s.getDataDirs(opt, labels)
+	if err != nil {
+		return nil, err
+	}
+	id, port, sto, err := s.add(opt, dataDir, incompleteDir)
 	if err != nil {
 		return nil, err
 	}
@@ -81,11 +112,14 @@ func (s *Session) addTorrentStopped(r io.Reader, opt *AddTorrentOptions) (*Torre
 		time.Now(),
 		mi.Info.Hash[:],
 		sto,
+		dataDir,
+		incompleteDir,
 		mi.Info.Name,
 		port,
 		s.parseTrackers(mi.AnnounceList, mi.Info.Private),
 		nil, // fixedPeers
 		&mi.Info,
+		opt.FilePriorities,
 		nil, // bitfield
 		resumer.Stats{},
 		webseedsource.NewList(mi.URLList),
@@ -96,6 +130,7 @@ func (s *Session) addTorrentStopped(r io.Reader, opt *AddTorrentOptions) (*Torre
 	if err != nil {
 		return nil, err
 	}
+	t.setLabels(labels)
 	go s.checkTorrent(t)
 	defer func() {
 		if err != nil {
@@ -104,20 +139,28 @@ func (s *Session) addTorrentStopped(r io.Reader, opt *AddTorrentOptions) (*Torre
 	}()
 	rspec := &boltdbresumer.Spec{
 		InfoHash:          mi.Info.Hash[:],
-		Port:              port,
+		Port:              s.resumePort(port),
 		Name:              mi.Info.Name,
 		Trackers:          mi.AnnounceList,
 		URLList:           mi.URLList,
 		Info:              mi.Info.Bytes,
+		PieceLayers:       mi.Info.PieceLayers(),
 		AddedAt:           t.addedAt,
 		StopAfterDownload: opt.StopAfterDownload,
 		StopAfterMetadata: opt.StopAfterMetadata,
+		FilePriorities:    filePrioritiesToInts(opt.FilePriorities),
+		IncompleteDir:     incompleteDir,
+		DataDir:           dataDir,
+		Labels:            labels,
 	}
 	err = s.resumer.Write(id, rspec)
 	if err != nil {
 		return nil, err
 	}
 	t2 := s.insertTorrent(t)
+	s.appendToQueue(t2)
+	t.publishEvent(Event{Type: EventTorrentAdded})
+	t.runHooks(EventTorrentAdded, nil)
 	return t2, nil
 }
 
@@ -140,7 +183,7 @@ func (s *Session) AddURI(uri string, opt *AddTorrentOptions) (*Torrent, error) {
 	case "magnet":
 		return s.addMagnet(uri, opt)
 	default:
-		return nil, errors.New("unsupported uri scheme: " + u.Scheme)
+		return nil, newInputError(errors.New("unsupported uri scheme: " + u.Scheme))
 	}
 }
 
@@ -158,6 +201,15 @@ func filterOutControlChars(s string) string {
 }
 
 func (s *Session) addURL(u string, opt *AddTorrentOptions) (*Torrent, error) {
+	b, err := s.downloadTorrent(u)
+	if err != nil {
+		return nil, err
+	}
+	return s.AddTorrent(bytes.NewReader(b), opt)
+}
+
+// downloadTorrent downloads the .torrent file at the HTTP URL.
+func (s *Session) downloadTorrent(u string) ([]byte, error) {
 	client := http.Client{
 		Timeout: s.config.TorrentAddHTTPTimeout,
 	}
@@ -170,8 +222,11 @@ func (s *Session) addURL(u string, opt *AddTorrentOptions) (*Torrent, error) {
 	if resp.ContentLength > int64(s.config.MaxTorrentSize) {
 		return nil, newInputError(fmt.Errorf("torrent too large: %d", resp.ContentLength))
 	}
-	r := io.LimitReader(resp.Body, int64(s.config.MaxTorrentSize))
-	return s.AddTorrent(r, opt)
+	b, err := io.ReadAll(io.LimitReader(resp.Body, int64(s.config.MaxTorrentSize)))
+	if err != nil {
+		return nil, newInputError(err)
+	}
+	return b, nil
 }
 
 func (s *Session) addMagnet(link string, opt *AddTorrentOptions) (*Torrent, error) {
@@ -179,7 +234,12 @@ func (s *Session) addMagnet(link string, opt *AddTorrentOptions) (*Torrent, erro
 	if err != nil {
 		return nil, newInputError(err)
 	}
-	id, port, sto, err := s.add(opt)
+	labels := cleanLabels(opt.Labels)
+	dataDir, incompleteDir, err := s.getDataDirs(opt, labels)
+	if err != nil {
+		return nil, err
+	}
+	id, port, sto, err := s.add(opt, dataDir, incompleteDir)
 	if err != nil {
 		return nil, err
 	}
@@ -194,11 +254,14 @@ func (s *Session) addMagnet(link string, opt *AddTorrentOptions) (*Torrent, erro
 		time.Now(),
 		ma.InfoHash[:],
 		sto,
+		dataDir,
+		incompleteDir,
 		ma.Name,
 		port,
 		s.parseTrackers(ma.Trackers, false),
 		ma.Peers,
 		nil, // info
+		opt.FilePriorities,
 		nil, // bitfield
 		resumer.Stats{},
 		nil, // webseedSources
@@ -209,6 +272,12 @@ func (s *Session) addMagnet(link string, opt *AddTorrentOptions) (*Torrent, erro
 	if err != nil {
 		return nil, err
 	}
+	t.setLabels(labels)
+	if ma.HasV1 && ma.InfoHashV2 != [32]byte{} {
+		var ih2 [20]byte
+		copy(ih2[:], ma.InfoHashV2[:])
+		t.storeInfoHashV2(ih2)
+	}
 	go s.checkTorrent(t)
 	defer func() {
 		if err != nil {
@@ -217,26 +286,33 @@ func (s *Session) addMagnet(link string, opt *AddTorrentOptions) (*Torrent, erro
 	}()
 	rspec := &boltdbresumer.Spec{
 		InfoHash:          ma.InfoHash[:],
-		Port:              port,
+		Port:              s.resumePort(port),
 		Name:              ma.Name,
 		Trackers:          ma.Trackers,
 		FixedPeers:        ma.Peers,
 		AddedAt:           t.addedAt,
 		StopAfterDownload: opt.StopAfterDownload,
 		StopAfterMetadata: opt.StopAfterMetadata,
+		FilePriorities:    filePrioritiesToInts(opt.FilePriorities),
+		IncompleteDir:     incompleteDir,
+		DataDir:           dataDir,
+		Labels:            labels,
 	}
 	err = s.resumer.Write(id, rspec)
 	if err != nil {
 		return nil, err
 	}
 	t2 := s.insertTorrent(t)
+	s.appendToQueue(t2)
+	t.publishEvent(Event{Type: EventTorrentAdded})
+	t.runHooks(EventTorrentAdded, nil)
 	if !opt.Stopped {
 		err = t2.Start()
 	}
 	return t2, err
 }
 
-func (s *Session) add(opt *AddTorrentOptions) (id string, port int, sto *filestorage.FileStorage, err error) {
+func (s *Session) add(opt *AddTorrentOptions, dataDir, incompleteDir string) (id string, port int, sto Storage, err error) {
 	port, err = s.getPort()
 	if err != nil {
 		return
@@ -266,11 +342,76 @@ func (s *Session) add(opt *AddTorrentOptions) (id string, port int, sto *filesto
 		}
 		id = base64.RawURLEncoding.EncodeToString(u1[:])
 	}
-	sto, err = filestorage.New(s.getDataDir(id), s.config.FilePermissions)
+	sto, err = s.newStorage(id, dataDir, incompleteDir)
+	return
+}
+
+// getDataDirs returns the directories that the torrent files are saved into.
+// Empty dataDir means the default location in Config.DataDir.
+func (s *Session) getDataDirs(opt *AddTorrentOptions, labels []string) (dataDir, incompleteDir string, err error) {
+	if opt.DataPath == "" {
+		if s.config.StorageProvider == nil {
+			dataDir, err = s.labelDataDir(labels)
+			if opt.DataDir != "" {
+				dataDir, err = homedir.Expand(opt.DataDir)
+				if err == nil {
+					dataDir, err = filepath.Abs(dataDir)
+				}
+			}
+			if err != nil {
+				return "", "", newInputError(err)
+			}
+		} else if opt.DataDir != "" {
+			return "", "", newInputError(errors.New("data dir cannot be used with custom storage"))
+		}
+		return dataDir, s.getIncompleteDir(opt), nil
+	}
+	if s.config.StorageProvider != nil {
+		return "", "", newInputError(errors.New("data path cannot be used with custom storage"))
+	}
+	dataDir, err = homedir.Expand(opt.DataPath)
 	if err != nil {
-		return
+		return "", "", newInputError(err)
 	}
-	return
+	dataDir, err = filepath.Abs(dataDir)
+	if err != nil {
+		return "", "", newInputError(err)
+	}
+	fi, err := os.Stat(dataDir)
+	if err != nil {
+		return "", "", newInputError(err)
+	}
+	if !fi.IsDir() {
+		return "", "", newInputError(errors.New("data path is not a directory"))
+	}
+	return dataDir, "", nil
+}
+
+// getIncompleteDir returns the directory that the torrent is downloaded into before moving to DataDir.
+// Returns empty string if files are downloaded into DataDir directly.
+func (s *Session) getIncompleteDir(opt *AddTorrentOptions) string {
+	if s.config.StorageProvider != nil {
+		return ""
+	}
+	dir := s.config.IncompleteDir
+	if opt.IncompleteDir != "" {
+		dir = opt.IncompleteDir
+	}
+	if dir == "" {
+		return ""
+	}
+	abs, err := homedir.Expand(dir)
+	if err != nil {
+		return dir
+	}
+	abs, err = filepath.Abs(abs)
+	if err != nil {
+		return dir
+	}
+	if data, err := filepath.Abs(s.config.DataDir); err == nil && data == abs {
+		return ""
+	}
+	return abs
 }
 
 func (s *Session) insertTorrent(t *torrent) *Torrent {
@@ -281,7 +422,22 @@ func (s *Session) insertTorrent(t *torrent) *Torrent {
 	s.mTorrents.Lock()
 	defer s.mTorrents.Unlock()
 	s.torrents[t.id] = t2
-	ih := dht.InfoHash(t.InfoHash())
-	s.torrentsByInfoHash[ih] = append(s.torrentsByInfoHash[ih], t2)
+	for _, ih := range t.infoHashes() {
+		dih := dht.InfoHash(ih[:])
+		s.torrentsByInfoHash[dih] = append(s.torrentsByInfoHash[dih], t2)
+	}
 	return t2
 }
+
+// addInfoHash adds another info hash for finding the torrent after the torrent is inserted into the session.
+func (s *Session) addInfoHash(t *torrent, ih [20]byte) {
+	s.mTorrents.Lock()
+	defer s.mTorrents.Unlock()
+	t2, ok := s.torrents[t.id]
+	if !ok || t2.torrent != t {
+		// Torrent is removed.
+		return
+	}
+	dih := dht.InfoHash(ih[:])
+	s.torrentsByInfoHash[dih] = append(s.torrentsByInfoHash[dih], t2)
+}
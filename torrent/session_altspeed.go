@@ -0,0 +1,119 @@
+package torrent
+
+import "time"
+
+// Period of checking the schedule of alternative speed limits.
+const altSpeedCheckInterval = 30 * time.Second
+
+// AltSpeedRule is a rule in the weekly schedule of alternative speed limits.
+type AltSpeedRule struct {
+	// Days of the week that the rule is active on. Sunday is 0, Saturday is 6. Empty list means every day.
+	Days []time.Weekday
+	// Begin and End are the times of the day as offset from midnight in local time, e.g. 9h and 17h30m.
+	// If End is before Begin, the rule is active until End on the next day.
+	// If they are equal, the rule is active for the whole day.
+	Begin time.Duration
+	End   time.Duration
+}
+
+func (r AltSpeedRule) hasDay(d time.Weekday) bool {
+	if len(r.Days) == 0 {
+		return true
+	}
+	for _, d2 := range r.Days {
+		if d2 == d {
+			return true
+		}
+	}
+	return false
+}
+
+// active returns true if the rule matches the time.
+func (r AltSpeedRule) active(now time.Time) bool {
+	// Wall clock time of the day. Elapsed time since midnight differs on the days of DST transitions.
+	offset := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute + time.Duration(now.Second())*time.Second
+	day := now.Weekday()
+	switch {
+	case r.Begin < r.End:
+		return r.hasDay(day) && offset >= r.Begin && offset < r.End
+	case r.Begin > r.End:
+		yesterday := (day + 6) % 7
+		return (r.hasDay(day) && offset >= r.Begin) || (r.hasDay(yesterday) && offset < r.End)
+	default:
+		return r.hasDay(day)
+	}
+}
+
+// altSpeedScheduleActive returns true if any of the rules in schedule matches the time.
+func altSpeedScheduleActive(schedule []AltSpeedRule, now time.Time) bool {
+	for _, r := range schedule {
+		if r.active(now) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Session) altSpeedLoop() {
+	ticker := time.NewTicker(altSpeedCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			s.checkAltSpeedSchedule(now)
+		case <-s.closeC:
+			return
+		}
+	}
+}
+
+// checkAltSpeedSchedule switches the alternative speed limits on or off when a schedule boundary is passed.
+// Limits set by hand with SetAltSpeedLimits are kept until the next boundary.
+func (s *Session) checkAltSpeedSchedule(now time.Time) {
+	if !s.config.AltSpeedScheduleEnabled {
+		return
+	}
+	scheduled := altSpeedScheduleActive(s.config.AltSpeedSchedule, now)
+	s.mSpeedLimits.Lock()
+	defer s.mSpeedLimits.Unlock()
+	if scheduled == s.altSpeedScheduled {
+		return
+	}
+	s.altSpeedScheduled = scheduled
+	if scheduled != s.altSpeedLimits {
+		s.log.Infoln("alternative speed limits are active by schedule:", scheduled)
+		s.altSpeedLimits = scheduled
+		s.applySpeedLimits()
+	}
+}
+
+// applySpeedLimits sets the rates of global limiters from Config according to the active profile.
+// Must be called with mSpeedLimits held.
+func (s *Session) applySpeedLimits() {
+	download, upload := s.config.SpeedLimitDownload, s.config.SpeedLimitUpload
+	if s.altSpeedLimits {
+		download, upload = s.config.AltSpeedLimitDownload, s.config.AltSpeedLimitUpload
+	}
+	s.downloadLimiter.SetRate(download * 1024)
+	s.uploadLimiter.SetRate(upload * 1024)
+}
+
+// AltSpeedLimits returns true if alternative speed limits are active.
+func (s *Session) AltSpeedLimits() bool {
+	s.mSpeedLimits.Lock()
+	defer s.mSpeedLimits.Unlock()
+	return s.altSpeedLimits
+}
+
+// SetAltSpeedLimits activates or deactivates the alternative speed limits in Config.
+// If AltSpeedScheduleEnabled is set, the schedule overrides this setting at the next schedule boundary.
+func (s *Session) SetAltSpeedLimits(enabled bool) {
+	s.mSpeedLimits.Lock()
+	defer s.mSpeedLimits.Unlock()
+	if enabled == s.altSpeedLimits {
+		return
+	}
+	s.log.Infoln("alternative speed limits are active:", enabled)
+	s.altSpeedLimits = enabled
+	s.applySpeedLimits()
+}
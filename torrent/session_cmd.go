@@ -1,34 +1,38 @@
 package torrent
 
 import (
-	"encoding/hex"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
+
+	"github.com/cenkalti/backoff/v3"
 )
 
-func (s *Session) runOnCompleteCmd(torrent *torrent) {
-	command, err := exec.LookPath(s.config.OnCompleteCmd[0])
+// runHookCmd executes the command of a hook with the fields of the payload in environment variables.
+func (s *Session) runHookCmd(ctx context.Context, args []string, p *HookPayload) error {
+	command, err := exec.LookPath(args[0])
 	if err != nil {
-		s.log.Errorf("error resolving completion hook command path: %s", err)
-		return
+		return backoff.Permanent(fmt.Errorf("error resolving hook command path: %w", err))
 	}
 
-	cmd := exec.Command(command)
-	if len(s.config.OnCompleteCmd) > 1 {
-		cmd.Args = append(cmd.Args, s.config.OnCompleteCmd[1:]...)
+	cmd := exec.CommandContext(ctx, command)
+	if len(args) > 1 {
+		cmd.Args = append(cmd.Args, args[1:]...)
 	}
 
 	cmd.Env = append(os.Environ(),
-		"RAIN_TORRENT_ADDED="+fmt.Sprint(torrent.addedAt.Unix()),
-		"RAIN_TORRENT_DIR="+torrent.storage.RootDir(),
-		"RAIN_TORRENT_HASH="+hex.EncodeToString(torrent.infoHash[:]),
-		"RAIN_TORRENT_ID="+torrent.id,
-		"RAIN_TORRENT_NAME="+torrent.name)
+		"RAIN_EVENT="+p.Event.String(),
+		"RAIN_TORRENT_ADDED="+fmt.Sprint(p.AddedAt.Unix()),
+		"RAIN_TORRENT_DIR="+p.Dir,
+		"RAIN_TORRENT_ERROR="+p.Error,
+		"RAIN_TORRENT_HASH="+p.InfoHash,
+		"RAIN_TORRENT_ID="+p.ID,
+		"RAIN_TORRENT_LABELS="+strings.Join(p.Labels, ","),
+		"RAIN_TORRENT_NAME="+p.Name)
 
-	s.log.Debugf("executing completion hook for torrent %s: %s", torrent.id, cmd.String())
+	s.log.Debugf("executing hook for torrent %s: %s", p.ID, cmd.String())
 
-	if err := cmd.Run(); err != nil {
-		s.log.Errorf("completion hook execution failed: %s", err)
-	}
+	return cmd.Run()
 }
@@ -39,7 +39,10 @@ func (s *Session) handleDHTtick() {
 	s.mPeerRequests.Lock()
 	defer s.mPeerRequests.Unlock()
 	for t := range s.dhtPeerRequests {
-		s.dht.PeersRequestPort(string(t.infoHash[:]), true, t.port)
+		// Hybrid torrents are announced with both info hashes.
+		for _, ih := range t.infoHashes() {
+			s.dht.PeersRequestPort(string(ih[:]), true, t.port)
+		}
 		delete(s.dhtPeerRequests, t)
 		return
 	}
@@ -0,0 +1,272 @@
+package torrent
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Number of events that are buffered for each subscriber. Events are dropped if the buffer is full.
+const eventBufferSize = 1000
+
+// EventType is the type of an Event.
+type EventType int
+
+const (
+	// EventTorrentAdded is sent when a new torrent is added to the Session.
+	EventTorrentAdded EventType = iota
+	// EventTorrentRemoved is sent when a torrent is removed from the Session.
+	EventTorrentRemoved
+	// EventTorrentStarted is sent when a torrent is started.
+	EventTorrentStarted
+	// EventTorrentStopped is sent when a torrent is stopped. Error is set if the torrent is stopped because of an error.
+	EventTorrentStopped
+	// EventMetadataReceived is sent when the metadata of a torrent that is added with a magnet link is downloaded.
+	EventMetadataReceived
+	// EventPieceVerified is sent when a downloaded piece is written to disk after its hash is verified.
+	EventPieceVerified
+	// EventFileCompleted is sent when all pieces of a file are downloaded.
+	EventFileCompleted
+	// EventTorrentError is sent when a torrent is stopping because of an error.
+	EventTorrentError
+	// EventTrackerStatus is sent when a tracker starts or stops working.
+	EventTrackerStatus
+	// EventPeerConnected is sent when a peer completes protocol handshake.
+	EventPeerConnected
+	// EventPeerDisconnected is sent when a connected peer is disconnected.
+	EventPeerDisconnected
+	// EventTorrentCompleted is sent when all wanted pieces of a torrent are downloaded.
+	EventTorrentCompleted
+	// EventSeedLimitReached is sent when a seeding torrent reaches one of its seeding limits, before the action of the limit is applied.
+	EventSeedLimitReached
+)
+
+var eventTypes = []EventType{
+	EventTorrentAdded,
+	EventTorrentRemoved,
+	EventTorrentStarted,
+	EventTorrentStopped,
+	EventMetadataReceived,
+	EventPieceVerified,
+	EventFileCompleted,
+	EventTorrentError,
+	EventTrackerStatus,
+	EventPeerConnected,
+	EventPeerDisconnected,
+	EventTorrentCompleted,
+	EventSeedLimitReached,
+}
+
+func (e EventType) String() string {
+	m := map[EventType]string{
+		EventTorrentAdded:     "torrent-added",
+		EventTorrentRemoved:   "torrent-removed",
+		EventTorrentStarted:   "torrent-started",
+		EventTorrentStopped:   "torrent-stopped",
+		EventMetadataReceived: "metadata-received",
+		EventPieceVerified:    "piece-verified",
+		EventFileCompleted:    "file-completed",
+		EventTorrentError:     "torrent-error",
+		EventTrackerStatus:    "tracker-status",
+		EventPeerConnected:    "peer-connected",
+		EventPeerDisconnected: "peer-disconnected",
+		EventTorrentCompleted: "torrent-completed",
+		EventSeedLimitReached: "seed-limit-reached",
+	}
+	return m[e]
+}
+
+// ParseEventType converts the string representation of the event type (e.g. "torrent-added") to an EventType.
+func ParseEventType(s string) (EventType, error) {
+	for _, e := range eventTypes {
+		if strings.EqualFold(s, e.String()) {
+			return e, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid event type: %q", s)
+}
+
+// MarshalText implements encoding.TextMarshaler interface.
+func (e EventType) MarshalText() ([]byte, error) {
+	return []byte(e.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler interface.
+func (e *EventType) UnmarshalText(text []byte) error {
+	var err error
+	*e, err = ParseEventType(string(text))
+	return err
+}
+
+// Event is a change in the state of a Session or a Torrent.
+// Fields other than Type, Time and the torrent fields are only set for the related event types.
+type Event struct {
+	Type EventType
+	Time time.Time
+	// ID and name of the torrent that the event belongs to.
+	TorrentID   string
+	TorrentName string
+	// Index of the piece for EventPieceVerified.
+	Piece uint32
+	// Path of the file for EventFileCompleted, relative to the data directory of the torrent.
+	File string
+	// URL and new status of the tracker for EventTrackerStatus.
+	Tracker       string
+	TrackerStatus TrackerStatus
+	// Address of the peer for EventPeerConnected and EventPeerDisconnected.
+	Peer string
+	// Error of EventTorrentError, EventTorrentStopped and EventTrackerStatus.
+	Error error
+}
+
+// EventFilter selects the events that are sent to an EventSubscription.
+type EventFilter struct {
+	// Types of events to receive. All types are received if empty.
+	Types []EventType
+	// Receive only the events of the torrent with this ID. Events of all torrents are received if empty.
+	TorrentID string
+}
+
+func (f EventFilter) match(e *Event) bool {
+	if f.TorrentID != "" && f.TorrentID != e.TorrentID {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if t == e.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// EventSubscription receives the events of a Session that match its filter.
+// Events are not blocked by slow receivers. If the buffer of the subscription is full, new events are dropped.
+type EventSubscription struct {
+	// C receives the events. It is closed when the subscription or the Session is closed.
+	C <-chan Event
+
+	c       chan Event
+	filter  EventFilter
+	session *Session
+	dropped uint64
+}
+
+// Subscribe returns a new subscription for receiving the events that match the filter.
+// Subscription must be closed after use.
+func (s *Session) Subscribe(filter EventFilter) *EventSubscription {
+	filter.Types = append([]EventType(nil), filter.Types...)
+	c := make(chan Event, eventBufferSize)
+	sub := &EventSubscription{
+		C:       c,
+		c:       c,
+		filter:  filter,
+		session: s,
+	}
+	s.mSubscriptions.Lock()
+	defer s.mSubscriptions.Unlock()
+	if s.subscriptions == nil {
+		// Session is closed.
+		close(c)
+		return sub
+	}
+	s.subscriptions[sub] = struct{}{}
+	return sub
+}
+
+// Close stops receiving the events and closes the channel.
+func (sub *EventSubscription) Close() {
+	s := sub.session
+	s.mSubscriptions.Lock()
+	defer s.mSubscriptions.Unlock()
+	if _, ok := s.subscriptions[sub]; ok {
+		delete(s.subscriptions, sub)
+		close(sub.c)
+	}
+}
+
+// Dropped returns the number of events that are not sent because the buffer was full.
+func (sub *EventSubscription) Dropped() uint64 {
+	return atomic.LoadUint64(&sub.dropped)
+}
+
+// hasSubscriptions returns true if there is any subscriber. Used for skipping the preparation of expensive events.
+func (s *Session) hasSubscriptions() bool {
+	s.mSubscriptions.RLock()
+	defer s.mSubscriptions.RUnlock()
+	return len(s.subscriptions) > 0
+}
+
+// publish sends the event to the matching subscriptions without blocking.
+func (s *Session) publish(e Event) {
+	s.mSubscriptions.RLock()
+	defer s.mSubscriptions.RUnlock()
+	if len(s.subscriptions) == 0 {
+		return
+	}
+	e.Time = time.Now()
+	for sub := range s.subscriptions {
+		if !sub.filter.match(&e) {
+			continue
+		}
+		select {
+		case sub.c <- e:
+		default:
+			atomic.AddUint64(&sub.dropped, 1)
+		}
+	}
+}
+
+// closeSubscriptions closes the channels of all subscriptions when the Session is closed.
+func (s *Session) closeSubscriptions() {
+	s.mSubscriptions.Lock()
+	defer s.mSubscriptions.Unlock()
+	for sub := range s.subscriptions {
+		close(sub.c)
+	}
+	s.subscriptions = nil
+}
+
+// publishEvent sends an event of the torrent to the subscribers of the Session.
+func (t *torrent) publishEvent(e Event) {
+	e.TorrentID = t.id
+	e.TorrentName = t.name
+	t.session.publish(e)
+}
+
+// publishCompletedFiles sends EventFileCompleted for the files that are completed with the piece.
+func (t *torrent) publishCompletedFiles(index uint32) {
+	if !t.session.hasSubscriptions() {
+		return
+	}
+	pieceLength := int64(t.info.PieceLength)
+	var offset int64
+	for _, f := range t.info.Files {
+		if f.Length == 0 {
+			offset += f.Padding
+			continue
+		}
+		begin := uint32(offset / pieceLength)
+		end := uint32((offset + f.Length - 1) / pieceLength)
+		offset += f.Length + f.Padding
+		if index < begin {
+			break
+		}
+		if index > end {
+			continue
+		}
+		complete := true
+		for i := begin; i <= end; i++ {
+			if !t.bitfield.Test(i) {
+				complete = false
+				break
+			}
+		}
+		if complete {
+			t.publishEvent(Event{Type: EventFileCompleted, File: f.Path})
+		}
+	}
+}
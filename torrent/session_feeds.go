@@ -0,0 +1,487 @@
+package torrent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/rain/internal/feed"
+	"go.etcd.io/bbolt"
+)
+
+// Feeds larger than this size are truncated and fail to parse.
+const maxFeedSize = 10 << 20
+
+var (
+	feedsBucket         = []byte("feeds")
+	feedKey             = []byte("feed")
+	feedItemsBucket     = []byte("items")
+	feedEpisodesBucket  = []byte("episodes")
+	episodeSeasonRegex  = regexp.MustCompile(`(?i)^(.*?)\bS(\d{1,2}) ?E(\d{1,3})\b`)
+	episodeCrossRegex   = regexp.MustCompile(`(?i)^(.*?)\b(\d{1,2})x(\d{2,3})\b`)
+	episodeNonWordRegex = regexp.MustCompile(`[^\pL\pN]+`)
+)
+
+// Feed is a RSS or Atom feed that is fetched periodically for adding new torrents.
+// Items are added with Session.AddURI, so their links must be magnet links or HTTP URLs of torrent files.
+// Added items are saved in the database and are not added again.
+type Feed struct {
+	// Unique name of the feed.
+	Name string
+	// HTTP URL of the feed.
+	URL string
+	// Interval of fetching the feed. Config.FeedPollInterval is used if zero.
+	Interval time.Duration
+	// Regular expressions that are matched against the titles of items.
+	// An item is added if its title matches any of Include and none of Exclude patterns. All items are included if Include is empty.
+	Include []string
+	Exclude []string
+	// Add only the first item of each episode of a show. Episode numbers are parsed from titles in "S01E02" or "1x02" format.
+	// Other releases of the same episode are skipped.
+	UniqueEpisodes bool
+	// Label that is added to the torrents.
+	Label string
+	// Torrents are saved into this directory instead of the data directory of the label or Config.DataDir.
+	DataDir string
+	// Do not start torrents automatically after adding.
+	Stopped bool
+}
+
+// FeedStats contains the state of a Feed.
+type FeedStats struct {
+	Feed
+	// Time of the last successful fetch.
+	LastUpdate time.Time
+	// Error of the last fetch. Nil if the last fetch was successful.
+	Error error
+	// Number of torrents added from the feed since the Session is created.
+	ItemsAdded int
+}
+
+type feedSubscription struct {
+	feed    Feed
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+	closeC  chan struct{}
+	doneC   chan struct{}
+
+	m          sync.Mutex
+	lastUpdate time.Time
+	lastError  error
+	itemsAdded int
+}
+
+// Feeds returns the feeds in the Session sorted by their names.
+func (s *Session) Feeds() []FeedStats {
+	s.mFeeds.Lock()
+	defer s.mFeeds.Unlock()
+	ret := make([]FeedStats, 0, len(s.feeds))
+	for _, sub := range s.feeds {
+		ret = append(ret, sub.stats())
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+// AddFeed adds a new feed to the Session, or replaces the feed that has the same name.
+// Feeds are saved in the database. Items that are added from a replaced feed are not added again.
+func (s *Session) AddFeed(f Feed) error {
+	sub, err := newFeedSubscription(f)
+	if err != nil {
+		return err
+	}
+	s.mFeeds.Lock()
+	defer s.mFeeds.Unlock()
+	err = s.saveFeed(sub.feed)
+	if err != nil {
+		return err
+	}
+	if old, ok := s.feeds[sub.feed.Name]; ok {
+		old.stop()
+	}
+	s.feeds[sub.feed.Name] = sub
+	go s.feedLoop(sub)
+	return nil
+}
+
+// RemoveFeed removes the feed from the Session. Torrents that are added from the feed are not removed.
+func (s *Session) RemoveFeed(name string) error {
+	s.mFeeds.Lock()
+	defer s.mFeeds.Unlock()
+	sub, ok := s.feeds[name]
+	if !ok {
+		return newInputError(errors.New("feed not found"))
+	}
+	sub.stop()
+	delete(s.feeds, name)
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		err := tx.Bucket(feedsBucket).DeleteBucket([]byte(name))
+		if err == bbolt.ErrBucketNotFound {
+			err = nil
+		}
+		return err
+	})
+}
+
+// loadFeeds loads the feeds saved in the database and adds the feeds in Config.
+// Feeds in Config are validated in NewSession before this is called.
+// Feeds are not fetched until startFeeds is called.
+func (s *Session) loadFeeds() error {
+	var feeds []Feed
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(feedsBucket).ForEach(func(k, _ []byte) error {
+			b := tx.Bucket(feedsBucket).Bucket(k)
+			if b == nil {
+				return nil
+			}
+			var f Feed
+			err := json.Unmarshal(b.Get(feedKey), &f)
+			if err != nil {
+				s.log.Errorf("cannot load feed %s: %s", k, err)
+				return nil
+			}
+			feeds = append(feeds, f)
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	for _, f := range feeds {
+		sub, err := newFeedSubscription(f)
+		if err != nil {
+			s.log.Errorf("cannot load feed %s: %s", f.Name, err)
+			continue
+		}
+		s.feeds[sub.feed.Name] = sub
+	}
+	for _, f := range s.config.Feeds {
+		sub, err := newFeedSubscription(f)
+		if err != nil {
+			return fmt.Errorf("invalid feed %s: %w", f.Name, err)
+		}
+		err = s.saveFeed(sub.feed)
+		if err != nil {
+			return err
+		}
+		s.feeds[sub.feed.Name] = sub
+	}
+	return nil
+}
+
+func (s *Session) startFeeds() {
+	s.mFeeds.Lock()
+	defer s.mFeeds.Unlock()
+	for _, sub := range s.feeds {
+		go s.feedLoop(sub)
+	}
+}
+
+// waitFeeds waits until the loops of feeds return after the Session is closed,
+// so the torrents that are being added are saved before the database is closed.
+func (s *Session) waitFeeds() {
+	s.mFeeds.Lock()
+	defer s.mFeeds.Unlock()
+	for _, sub := range s.feeds {
+		<-sub.doneC
+	}
+}
+
+func newFeedSubscription(f Feed) (*feedSubscription, error) {
+	f.Name = strings.TrimSpace(f.Name)
+	if f.Name == "" {
+		return nil, newInputError(errors.New("empty feed name"))
+	}
+	u, err := url.Parse(f.URL)
+	if err != nil {
+		return nil, newInputError(err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, newInputError(errors.New("unsupported feed url scheme: " + u.Scheme))
+	}
+	if f.Interval < 0 {
+		return nil, newInputError(errors.New("negative feed interval"))
+	}
+	f.Include = append([]string(nil), f.Include...)
+	f.Exclude = append([]string(nil), f.Exclude...)
+	include, err := compileFeedPatterns(f.Include)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compileFeedPatterns(f.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	return &feedSubscription{
+		feed:    f,
+		include: include,
+		exclude: exclude,
+		closeC:  make(chan struct{}),
+		doneC:   make(chan struct{}),
+	}, nil
+}
+
+func compileFeedPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	ret := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		r, err := regexp.Compile(p)
+		if err != nil {
+			return nil, newInputError(err)
+		}
+		ret = append(ret, r)
+	}
+	return ret, nil
+}
+
+func (s *Session) saveFeed(f Feed) error {
+	b, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		fb, err := tx.Bucket(feedsBucket).CreateBucketIfNotExists([]byte(f.Name))
+		if err != nil {
+			return err
+		}
+		return fb.Put(feedKey, b)
+	})
+}
+
+func (s *Session) feedLoop(sub *feedSubscription) {
+	defer close(sub.doneC)
+	// Context is canceled for aborting the request in progress when the feed is removed or the Session is closed.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-sub.closeC:
+		case <-s.closeC:
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+
+	interval := sub.feed.Interval
+	if interval == 0 {
+		interval = s.config.FeedPollInterval
+	}
+	var tickC <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tickC = ticker.C
+	}
+
+	s.updateFeed(ctx, sub)
+	for {
+		select {
+		case <-tickC:
+			s.updateFeed(ctx, sub)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// stop stops the loop of the feed and waits until it returns. Must be called after the loop is started.
+func (sub *feedSubscription) stop() {
+	close(sub.closeC)
+	<-sub.doneC
+}
+
+func (sub *feedSubscription) stats() FeedStats {
+	sub.m.Lock()
+	defer sub.m.Unlock()
+	f := sub.feed
+	f.Include = append([]string(nil), f.Include...)
+	f.Exclude = append([]string(nil), f.Exclude...)
+	return FeedStats{
+		Feed:       f,
+		LastUpdate: sub.lastUpdate,
+		Error:      sub.lastError,
+		ItemsAdded: sub.itemsAdded,
+	}
+}
+
+// updateFeed fetches the feed and adds the new items that match the rules of the feed.
+func (s *Session) updateFeed(ctx context.Context, sub *feedSubscription) {
+	items, err := s.fetchFeed(ctx, sub.feed.URL)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		s.log.Errorf("cannot fetch feed %s: %s", sub.feed.Name, err)
+		sub.m.Lock()
+		sub.lastError = err
+		sub.m.Unlock()
+		return
+	}
+	// Feeds list the newest items first. Older releases of an episode are preferred.
+	var added int
+	for i := len(items) - 1; i >= 0 && ctx.Err() == nil; i-- {
+		if s.addFeedItem(sub, items[i]) {
+			added++
+		}
+	}
+	sub.m.Lock()
+	sub.lastUpdate = time.Now()
+	sub.lastError = nil
+	sub.itemsAdded += added
+	sub.m.Unlock()
+}
+
+func (s *Session) fetchFeed(ctx context.Context, u string) ([]feed.Item, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := http.Client{
+		Timeout: s.config.TorrentAddHTTPTimeout,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("invalid status code: %d", resp.StatusCode)
+	}
+	return feed.Parse(io.LimitReader(resp.Body, maxFeedSize))
+}
+
+// addFeedItem adds the item if it matches the rules of the feed and is not added before.
+// Returns true if a torrent is added.
+func (s *Session) addFeedItem(sub *feedSubscription, item feed.Item) bool {
+	f := sub.feed
+	if !sub.match(item.Title) {
+		return false
+	}
+	var episode string
+	if f.UniqueEpisodes {
+		episode = parseEpisode(item.Title)
+	}
+	seen, err := s.isFeedItemSeen(f.Name, item.ID, episode)
+	if err != nil {
+		s.log.Errorf("cannot read items of feed %s: %s", f.Name, err)
+		return false
+	}
+	if seen {
+		return false
+	}
+	opt := &AddTorrentOptions{
+		Stopped: f.Stopped,
+		DataDir: f.DataDir,
+	}
+	if f.Label != "" {
+		opt.Labels = []string{f.Label}
+	}
+	t, err := s.AddURI(item.URL, opt)
+	if err != nil {
+		var inputErr *InputError
+		if t == nil && !errors.As(err, &inputErr) {
+			// Session error, the item is tried again in the next update.
+			s.log.Errorf("cannot add item %q of feed %s: %s", item.Title, f.Name, err)
+			return false
+		}
+		s.log.Warningf("cannot add item %q of feed %s: %s", item.Title, f.Name, err)
+		if t == nil {
+			// Invalid item must not prevent other releases of the episode.
+			episode = ""
+		}
+	}
+	err = s.setFeedItemSeen(f.Name, item.ID, episode)
+	if err != nil {
+		s.log.Errorf("cannot save items of feed %s: %s", f.Name, err)
+	}
+	if t == nil {
+		return false
+	}
+	t.torrent.log.Infof("added torrent from feed %s: %s", f.Name, item.Title)
+	return true
+}
+
+func (sub *feedSubscription) match(title string) bool {
+	for _, r := range sub.exclude {
+		if r.MatchString(title) {
+			return false
+		}
+	}
+	if len(sub.include) == 0 {
+		return true
+	}
+	for _, r := range sub.include {
+		if r.MatchString(title) {
+			return true
+		}
+	}
+	return false
+}
+
+// isFeedItemSeen returns true if the item or another item of the same episode is added from the feed before.
+func (s *Session) isFeedItemSeen(name, id, episode string) (seen bool, err error) {
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		fb := tx.Bucket(feedsBucket).Bucket([]byte(name))
+		if fb == nil {
+			return nil
+		}
+		if b := fb.Bucket(feedItemsBucket); b != nil && b.Get([]byte(id)) != nil {
+			seen = true
+			return nil
+		}
+		if b := fb.Bucket(feedEpisodesBucket); b != nil && episode != "" && b.Get([]byte(episode)) != nil {
+			seen = true
+		}
+		return nil
+	})
+	return
+}
+
+func (s *Session) setFeedItemSeen(name, id, episode string) error {
+	now := []byte(time.Now().UTC().Format(time.RFC3339))
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		fb := tx.Bucket(feedsBucket).Bucket([]byte(name))
+		if fb == nil {
+			// Feed is removed.
+			return nil
+		}
+		b, err := fb.CreateBucketIfNotExists(feedItemsBucket)
+		if err != nil {
+			return err
+		}
+		err = b.Put([]byte(id), now)
+		if err != nil || episode == "" {
+			return err
+		}
+		b, err = fb.CreateBucketIfNotExists(feedEpisodesBucket)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(episode), now)
+	})
+}
+
+// parseEpisode returns a key that identifies the episode of a show from the title of a release, e.g. "show name s01e02".
+// Returns empty string if the title does not contain an episode number.
+func parseEpisode(title string) string {
+	m := episodeSeasonRegex.FindStringSubmatch(title)
+	if m == nil {
+		m = episodeCrossRegex.FindStringSubmatch(title)
+	}
+	if m == nil {
+		return ""
+	}
+	season, _ := strconv.Atoi(m[2])
+	episode, _ := strconv.Atoi(m[3])
+	show := strings.TrimSpace(episodeNonWordRegex.ReplaceAllString(strings.ToLower(m[1]), " "))
+	return fmt.Sprintf("%s s%02de%02d", show, season, episode)
+}
@@ -0,0 +1,447 @@
+package torrent
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v3"
+	"github.com/cenkalti/rain/internal/resumer/boltdbresumer"
+	"go.etcd.io/bbolt"
+)
+
+// Hooks of removed torrents that are not delivered yet are saved in this bucket, because resume data of the torrent is deleted.
+var hooksBucket = []byte("hooks")
+
+// Deliveries of Config.OnCompleteCmd and Label.OnCompleteCmd are recorded with this hook name.
+const completeCmdHookName = "on-complete-cmd"
+
+// Hook is run when an event of a torrent occurs.
+// Hooks are retried with exponential backoff if they fail, and are saved in the database until they are delivered,
+// so they are run again in the next Session if the program exits before a hook is delivered.
+type Hook struct {
+	// Unique name of the hook. Deliveries of the hook are recorded with this name.
+	Name string
+	// Events that trigger the hook. Supported events are EventTorrentAdded, EventMetadataReceived, EventTorrentCompleted,
+	// EventTorrentError, EventTorrentRemoved and EventSeedLimitReached.
+	Events []EventType
+	// Run only for the torrents that have this label. Hook is run for all torrents if empty.
+	Label string
+	// Command to run. Fields of HookPayload are passed in RAIN_EVENT and RAIN_TORRENT_* environment variables.
+	Cmd []string
+	// HTTP URL that HookPayload is posted to as JSON. Only one of Cmd and URL can be set.
+	URL string
+}
+
+// HookPayload contains the information about the event that triggers a Hook.
+type HookPayload struct {
+	Event EventType
+	Time  time.Time
+	// Fields of the torrent.
+	ID       string
+	Name     string
+	InfoHash string
+	Dir      string
+	Labels   []string
+	AddedAt  time.Time
+	// Error of EventTorrentError.
+	Error string `json:",omitempty"`
+}
+
+// Events that can trigger hooks.
+var hookEvents = map[EventType]struct{}{
+	EventTorrentAdded:     {},
+	EventMetadataReceived: {},
+	EventTorrentCompleted: {},
+	EventTorrentError:     {},
+	EventTorrentRemoved:   {},
+	EventSeedLimitReached: {},
+}
+
+// Events that occur once in the lifetime of a torrent. Hooks of these events are not run again after they are triggered.
+var hookEventsOnce = map[EventType]struct{}{
+	EventTorrentAdded:     {},
+	EventMetadataReceived: {},
+	EventTorrentCompleted: {},
+}
+
+func (h Hook) validate() error {
+	if strings.TrimSpace(h.Name) == "" {
+		return errors.New("empty hook name")
+	}
+	if strings.Contains(h.Name, "/") {
+		return errors.New("hook name cannot contain '/'")
+	}
+	if h.Name == completeCmdHookName {
+		return errors.New("hook name is reserved: " + h.Name)
+	}
+	if (len(h.Cmd) == 0) == (h.URL == "") {
+		return errors.New("one of command or url must be set")
+	}
+	if h.URL != "" {
+		u, err := url.Parse(h.URL)
+		if err != nil {
+			return err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return errors.New("unsupported hook url scheme: " + u.Scheme)
+		}
+	}
+	if len(h.Events) == 0 {
+		return errors.New("no hook events")
+	}
+	for _, e := range h.Events {
+		if _, ok := hookEvents[e]; !ok {
+			return fmt.Errorf("unsupported hook event: %s", e)
+		}
+	}
+	return nil
+}
+
+func (h Hook) match(e EventType, labels []string) bool {
+	if h.Label != "" {
+		var found bool
+		for _, l := range labels {
+			if l == h.Label {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, e2 := range h.Events {
+		if e2 == e {
+			return true
+		}
+	}
+	return false
+}
+
+// hookKey returns the key of a hook delivery in resume data of the torrent.
+func hookKey(e EventType, hookName string) string {
+	return e.String() + "/" + hookName
+}
+
+// parseHookKey returns the name of the hook in a key that is returned by hookKey.
+func parseHookKey(key string) (hookName string) {
+	i := strings.LastIndexByte(key, '/')
+	return key[i+1:]
+}
+
+// pendingHook is saved in hooksBucket for the hooks of removed torrents.
+type pendingHook struct {
+	Hook    string
+	Payload json.RawMessage
+}
+
+// hookPayload returns the payload of the event for the hooks. Must be called from the run loop of the torrent or after it is closed.
+func (t *torrent) hookPayload(e EventType, err error) HookPayload {
+	p := HookPayload{
+		Event:    e,
+		Time:     time.Now(),
+		ID:       t.id,
+		Name:     t.name,
+		InfoHash: hex.EncodeToString(t.infoHash[:]),
+		Labels:   t.Labels(),
+		AddedAt:  t.addedAt,
+	}
+	if t.storage != nil {
+		p.Dir = t.storage.RootDir()
+	}
+	if err != nil {
+		p.Error = err.Error()
+	}
+	return p
+}
+
+// runHooks triggers the hooks of the event. Error is only used for EventTorrentError.
+func (t *torrent) runHooks(e EventType, err error) {
+	if len(t.session.config.Hooks) == 0 {
+		return
+	}
+	t.session.triggerHooks(t.hookPayload(e, err))
+}
+
+// triggerHooks saves the matching hooks of the event to the database and starts delivering them.
+func (s *Session) triggerHooks(p HookPayload) {
+	payload, err := json.Marshal(p)
+	if err != nil {
+		s.log.Errorln("cannot marshal hook payload:", err)
+		return
+	}
+	_, once := hookEventsOnce[p.Event]
+	for _, h := range s.config.Hooks {
+		if !h.match(p.Event, p.Labels) {
+			continue
+		}
+		key := hookKey(p.Event, h.Name)
+		written := true
+		if p.Event == EventTorrentRemoved {
+			// Resume data of the torrent is deleted already.
+			err = s.writeRemovedHook(p.ID, key, h.Name, payload)
+		} else {
+			written, err = s.resumer.WriteHookPending(p.ID, key, payload, !once)
+		}
+		if err != nil {
+			s.log.Errorf("cannot save hook %s: %s", h.Name, err)
+			continue
+		}
+		if !written {
+			// Hook is triggered for this event before.
+			continue
+		}
+		s.deliverHook(h, p, key)
+	}
+}
+
+// triggerCompleteCmd saves the completion command of the torrent to the database and starts running it.
+func (s *Session) triggerCompleteCmd(cmd []string, p HookPayload) {
+	payload, err := json.Marshal(p)
+	if err != nil {
+		s.log.Errorln("cannot marshal hook payload:", err)
+		return
+	}
+	key := hookKey(p.Event, completeCmdHookName)
+	written, err := s.resumer.WriteHookPending(p.ID, key, payload, false)
+	if err != nil {
+		s.log.Errorf("cannot save hook %s: %s", completeCmdHookName, err)
+		return
+	}
+	if !written {
+		// Command is pending from the previous Session and it is run again already.
+		return
+	}
+	s.deliverHook(Hook{Name: completeCmdHookName, Cmd: cmd}, p, key)
+}
+
+func (s *Session) writeRemovedHook(torrentID, key, hookName string, payload []byte) error {
+	val, err := json.Marshal(pendingHook{Hook: hookName, Payload: payload})
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(hooksBucket).Put([]byte(torrentID+"/"+key), val)
+	})
+}
+
+// moveRemovedHooks moves the undelivered hooks of a torrent that is being removed from its resume data to hooksBucket.
+func moveRemovedHooks(tx *bbolt.Tx, torrentID string) error {
+	b := tx.Bucket(torrentsBucket).Bucket([]byte(torrentID))
+	if b == nil {
+		return nil
+	}
+	value := b.Get(boltdbresumer.Keys.Hooks)
+	if value == nil {
+		return nil
+	}
+	var hooks map[string]boltdbresumer.HookRecord
+	err := json.Unmarshal(value, &hooks)
+	if err != nil {
+		return err
+	}
+	for key, rec := range hooks {
+		if rec.Delivered {
+			continue
+		}
+		val, err := json.Marshal(pendingHook{Hook: parseHookKey(key), Payload: rec.Payload})
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(hooksBucket).Put([]byte(torrentID+"/"+key), val)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadPendingHooks delivers the hooks of a torrent that were not delivered in the previous Session.
+func (s *Session) loadPendingHooks(torrentID string, hooks map[string]boltdbresumer.HookRecord) {
+	for key, rec := range hooks {
+		if rec.Delivered {
+			continue
+		}
+		s.redeliverHook(torrentID, key, parseHookKey(key), rec.Payload)
+	}
+}
+
+// loadRemovedHooks delivers the hooks of removed torrents that were not delivered in the previous Session.
+func (s *Session) loadRemovedHooks() error {
+	pending := make(map[string]pendingHook)
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(hooksBucket).ForEach(func(k, v []byte) error {
+			var ph pendingHook
+			err := json.Unmarshal(v, &ph)
+			if err != nil {
+				s.log.Errorf("invalid hook record %s: %s", k, err)
+				return nil
+			}
+			pending[string(k)] = ph
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	for k, ph := range pending {
+		i := strings.IndexByte(k, '/')
+		if i < 0 {
+			continue
+		}
+		s.redeliverHook(k[:i], k[i+1:], ph.Hook, ph.Payload)
+	}
+	return nil
+}
+
+func (s *Session) redeliverHook(torrentID, key, hookName string, payload []byte) {
+	var p HookPayload
+	err := json.Unmarshal(payload, &p)
+	if err != nil {
+		s.log.Errorf("invalid payload of hook %s: %s", hookName, err)
+		s.markHookDelivered(torrentID, key)
+		return
+	}
+	if hookName == completeCmdHookName {
+		if cmd := s.completeCmd(p.Labels); len(cmd) > 0 {
+			s.deliverHook(Hook{Name: completeCmdHookName, Cmd: cmd}, p, key)
+			return
+		}
+	}
+	for _, h := range s.config.Hooks {
+		if h.Name == hookName {
+			s.deliverHook(h, p, key)
+			return
+		}
+	}
+	s.log.Warningf("dropping undelivered hook that is not in config: %s", hookName)
+	s.markHookDelivered(torrentID, key)
+}
+
+func (s *Session) markHookDelivered(torrentID, key string) {
+	err := s.resumer.WriteHookDelivered(torrentID, key)
+	if err == nil {
+		err = s.db.Update(func(tx *bbolt.Tx) error {
+			return tx.Bucket(hooksBucket).Delete([]byte(torrentID + "/" + key))
+		})
+	}
+	if err != nil {
+		s.log.Errorf("cannot save hook delivery: %s", err)
+	}
+}
+
+// deliverHook runs the hook in a new goroutine until it succeeds or the retries are exhausted.
+// The delivery is recorded in the database with the key after the hook succeeds.
+// Failed hooks are not marked as delivered, so they are tried again in the next Session.
+// Completion command is not retried in the same Session.
+func (s *Session) deliverHook(h Hook, p HookPayload, key string) {
+	s.mHooks.Lock()
+	defer s.mHooks.Unlock()
+	if s.hooksClosed {
+		return
+	}
+	s.hooksWG.Add(1)
+	go func() {
+		defer s.hooksWG.Done()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-s.closeC:
+			case <-ctx.Done():
+			}
+			cancel()
+		}()
+		retries := s.config.HookRetries
+		if h.Name == completeCmdHookName {
+			retries = 0
+		}
+		var bo backoff.BackOff = &backoff.StopBackOff{}
+		if retries > 0 {
+			// WithMaxRetries retries forever if the limit is zero.
+			ebo := backoff.NewExponentialBackOff()
+			ebo.InitialInterval = s.config.HookRetryInterval
+			ebo.MaxElapsedTime = 0
+			bo = backoff.WithMaxRetries(ebo, uint64(retries))
+		}
+		b := backoff.WithContext(bo, ctx)
+		notify := func(err error, d time.Duration) {
+			s.log.Warningf("hook %s failed for torrent %s, retrying in %s: %s", h.Name, p.ID, d.Round(time.Millisecond), err)
+		}
+		err := backoff.RetryNotify(func() error { return s.runHook(ctx, h, &p) }, b, notify)
+		if err != nil {
+			if ctx.Err() != nil {
+				// Session is closed.
+				return
+			}
+			s.log.Errorf("hook %s failed for torrent %s: %s", h.Name, p.ID, err)
+			return
+		}
+		s.log.Debugf("hook %s is delivered for event %s of torrent %s", h.Name, p.Event, p.ID)
+		if h.Name == completeCmdHookName {
+			err = s.resumer.WriteCompleteCmdRun(p.ID)
+			if err != nil {
+				s.log.Errorf("cannot save complete command status: %s", err)
+				return
+			}
+		}
+		s.markHookDelivered(p.ID, key)
+	}()
+}
+
+// waitHooks waits for the hooks that are being delivered after the Session is closed.
+func (s *Session) waitHooks() {
+	s.mHooks.Lock()
+	s.hooksClosed = true
+	s.mHooks.Unlock()
+	s.hooksWG.Wait()
+}
+
+// runHook runs the hook once. Context is canceled when the Session is closed.
+// Commands are not killed when the Session is closed, so Session.Close waits for them to finish.
+func (s *Session) runHook(ctx context.Context, h Hook, p *HookPayload) error {
+	if len(h.Cmd) > 0 {
+		if h.Name == completeCmdHookName {
+			// Completion command has no timeout, so it can run long tasks like moving files.
+			return s.runHookCmd(context.Background(), h.Cmd, p)
+		}
+		cmdCtx, cancel := context.WithTimeout(context.Background(), s.config.HookTimeout)
+		defer cancel()
+		return s.runHookCmd(cmdCtx, h.Cmd, p)
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.config.HookTimeout)
+	defer cancel()
+	return s.postHook(ctx, h.URL, p)
+}
+
+func (s *Session) postHook(ctx context.Context, u string, p *HookPayload) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return backoff.Permanent(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(b))
+	if err != nil {
+		return backoff.Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", trackerHTTPPublicUserAgent)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("invalid status code: %d", resp.StatusCode)
+	}
+	return nil
+}
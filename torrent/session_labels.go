@@ -0,0 +1,260 @@
+package torrent
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"go.etcd.io/bbolt"
+)
+
+// Label contains the default settings for torrents that have the label.
+// If a torrent has more than one label, the setting of the first label that has it is used.
+type Label struct {
+	// Torrents that are added with the label are saved into this directory instead of Config.DataDir.
+	// Files of the torrents that are already in the Session are not moved.
+	DataDir string
+	// Speed limits in KB/s for torrents that have no limits set by Torrent.SetSpeedLimits. Zero means no limit.
+	SpeedLimitDownload int64
+	SpeedLimitUpload   int64
+	// Seeding limits for torrents that have no limits set by Torrent.SetSeedLimits.
+	// Global limits in Config are used if nil.
+	SeedLimits *SeedLimits
+	// Shell command to execute on torrent completion instead of Config.OnCompleteCmd.
+	OnCompleteCmd []string
+}
+
+// Labels returns the default settings of labels by label name.
+func (s *Session) Labels() map[string]Label {
+	s.mLabels.RLock()
+	defer s.mLabels.RUnlock()
+	labels := make(map[string]Label, len(s.labels))
+	for name, l := range s.labels {
+		labels[name] = l
+	}
+	return labels
+}
+
+// SetLabel sets the default settings of the label.
+// Labels are saved to the database and they are used instead of the labels in Config when a new Session is created.
+func (s *Session) SetLabel(name string, label Label) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return newInputError(errors.New("empty label name"))
+	}
+	if label.SeedLimits != nil {
+		l := *label.SeedLimits
+		label.SeedLimits = &l
+	}
+	err := s.updateLabels(func(labels map[string]Label) {
+		labels[name] = label
+	})
+	if err != nil {
+		return err
+	}
+	s.updateLabelSpeedLimits(name)
+	return nil
+}
+
+// RemoveLabel removes the default settings of the label. Torrents keep the label.
+func (s *Session) RemoveLabel(name string) error {
+	err := s.updateLabels(func(labels map[string]Label) {
+		delete(labels, name)
+	})
+	if err != nil {
+		return err
+	}
+	s.updateLabelSpeedLimits(name)
+	return nil
+}
+
+// updateLabels changes the labels with the function and saves them to the database.
+func (s *Session) updateLabels(f func(labels map[string]Label)) error {
+	s.mLabels.Lock()
+	defer s.mLabels.Unlock()
+	labels := make(map[string]Label, len(s.labels))
+	for name, l := range s.labels {
+		labels[name] = l
+	}
+	f(labels)
+	value, err := json.Marshal(labels)
+	if err != nil {
+		return err
+	}
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(sessionBucket).Put(labelsKey, value)
+	})
+	if err != nil {
+		return err
+	}
+	s.labels = labels
+	return nil
+}
+
+// loadLabels loads the labels that are saved by SetLabel and RemoveLabel in a previous Session.
+func (s *Session) loadLabels() error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		value := tx.Bucket(sessionBucket).Get(labelsKey)
+		if value == nil {
+			return nil
+		}
+		var labels map[string]Label
+		err := json.Unmarshal(value, &labels)
+		if err != nil {
+			s.log.Errorln("cannot parse labels:", err)
+			return nil
+		}
+		s.labels = labels
+		return nil
+	})
+}
+
+// ListTorrentsWithLabel returns the torrents that have the label.
+func (s *Session) ListTorrentsWithLabel(label string) []*Torrent {
+	var torrents []*Torrent
+	for _, t := range s.ListTorrents() {
+		if t.torrent.hasLabel(label) {
+			torrents = append(torrents, t)
+		}
+	}
+	return torrents
+}
+
+// updateLabelSpeedLimits applies the changed speed limits of the label to the torrents that have the label.
+func (s *Session) updateLabelSpeedLimits(name string) {
+	for _, t := range s.ListTorrentsWithLabel(name) {
+		t.torrent.updateSpeedLimits()
+	}
+}
+
+// getLabel returns the settings of the first label in labels that the check function returns true for.
+func (s *Session) getLabel(labels []string, check func(Label) bool) (Label, bool) {
+	s.mLabels.RLock()
+	defer s.mLabels.RUnlock()
+	for _, name := range labels {
+		l, ok := s.labels[name]
+		if ok && check(l) {
+			return l, true
+		}
+	}
+	return Label{}, false
+}
+
+// labelDataDir returns the absolute path of the data directory of labels. Returns empty string if none of the labels has it.
+func (s *Session) labelDataDir(labels []string) (string, error) {
+	l, ok := s.getLabel(labels, func(l Label) bool { return l.DataDir != "" })
+	if !ok {
+		return "", nil
+	}
+	dir, err := homedir.Expand(l.DataDir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(dir)
+}
+
+// labelSpeedLimits returns the default speed limits of labels in KB/s.
+func (s *Session) labelSpeedLimits(labels []string) (download, upload int64) {
+	if l, ok := s.getLabel(labels, func(l Label) bool { return l.SpeedLimitDownload > 0 }); ok {
+		download = l.SpeedLimitDownload
+	}
+	if l, ok := s.getLabel(labels, func(l Label) bool { return l.SpeedLimitUpload > 0 }); ok {
+		upload = l.SpeedLimitUpload
+	}
+	return
+}
+
+// labelSeedLimits returns the default seeding limits of labels. Returns nil if none of the labels has seeding limits.
+func (s *Session) labelSeedLimits(labels []string) *SeedLimits {
+	l, ok := s.getLabel(labels, func(l Label) bool { return l.SeedLimits != nil })
+	if !ok {
+		return nil
+	}
+	return l.SeedLimits
+}
+
+// completeCmd returns the command to run when a torrent that has the labels completes.
+func (s *Session) completeCmd(labels []string) []string {
+	l, ok := s.getLabel(labels, func(l Label) bool { return len(l.OnCompleteCmd) > 0 })
+	if !ok {
+		return s.config.OnCompleteCmd
+	}
+	return l.OnCompleteCmd
+}
+
+// cleanLabels removes the surrounding whitespace of labels and drops empty and duplicate ones.
+func cleanLabels(labels []string) []string {
+	ret := make([]string, 0, len(labels))
+	seen := make(map[string]struct{}, len(labels))
+	for _, l := range labels {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+		if _, ok := seen[l]; ok {
+			continue
+		}
+		seen[l] = struct{}{}
+		ret = append(ret, l)
+	}
+	return ret
+}
+
+// Labels returns the labels of the torrent.
+func (t *torrent) Labels() []string {
+	t.mLabels.RLock()
+	defer t.mLabels.RUnlock()
+	return append([]string(nil), t.labels...)
+}
+
+func (t *torrent) hasLabel(label string) bool {
+	t.mLabels.RLock()
+	defer t.mLabels.RUnlock()
+	for _, l := range t.labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// setLabels replaces the labels of the torrent and applies the speed limits of new labels.
+func (t *torrent) setLabels(labels []string) {
+	t.mLabels.Lock()
+	t.labels = labels
+	t.mLabels.Unlock()
+	t.updateSpeedLimits()
+}
+
+// setSpeedLimits sets the speed limits of the torrent in KB/s. Zero values mean the limits of labels are used.
+func (t *torrent) setSpeedLimits(download, upload int64) {
+	t.mLabels.Lock()
+	t.speedLimitDownload = download
+	t.speedLimitUpload = upload
+	t.mLabels.Unlock()
+	t.updateSpeedLimits()
+}
+
+// speedLimits returns the speed limits that are set for the torrent in KB/s.
+func (t *torrent) speedLimits() (download, upload int64) {
+	t.mLabels.RLock()
+	defer t.mLabels.RUnlock()
+	return t.speedLimitDownload, t.speedLimitUpload
+}
+
+// updateSpeedLimits sets the rates of the limiters from the speed limits of the torrent, or of its labels if not set.
+func (t *torrent) updateSpeedLimits() {
+	t.mLabels.Lock()
+	defer t.mLabels.Unlock()
+	download, upload := t.session.labelSpeedLimits(t.labels)
+	if t.speedLimitDownload > 0 {
+		download = t.speedLimitDownload
+	}
+	if t.speedLimitUpload > 0 {
+		upload = t.speedLimitUpload
+	}
+	t.downloadLimiter.SetRate(download * 1024)
+	t.uploadLimiter.SetRate(upload * 1024)
+}
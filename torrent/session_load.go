@@ -1,13 +1,13 @@
 package torrent
 
 import (
+	"encoding/json"
 	"errors"
 
 	"github.com/cenkalti/rain/internal/bitfield"
 	"github.com/cenkalti/rain/internal/metainfo"
 	"github.com/cenkalti/rain/internal/resumer"
 	"github.com/cenkalti/rain/internal/resumer/boltdbresumer"
-	"github.com/cenkalti/rain/internal/storage/filestorage"
 	"github.com/cenkalti/rain/internal/webseedsource"
 	"go.etcd.io/bbolt"
 )
@@ -15,7 +15,7 @@ import (
 var errTooManyPieces = errors.New("too many pieces")
 
 func (s *Session) loadExistingTorrents(ids []string) {
-	var loaded int
+	var loaded []*Torrent
 	var started []*Torrent
 	for _, id := range ids {
 		t, hasStarted, err := s.loadExistingTorrent(id)
@@ -25,15 +25,20 @@ func (s *Session) loadExistingTorrents(ids []string) {
 			continue
 		}
 		s.log.Debugf("loaded existing torrent: #%s %s", id, t.Name())
-		loaded++
+		loaded = append(loaded, t)
 		if hasStarted {
 			started = append(started, t)
 		}
 	}
-	s.log.Infof("loaded %d existing torrents", loaded)
+	s.log.Infof("loaded %d existing torrents", len(loaded))
+	s.initQueue(loaded)
 	if s.config.ResumeOnStartup {
 		for _, t := range started {
-			t.torrent.Start()
+			if t.torrent.forceStarted {
+				t.torrent.Start()
+			} else {
+				s.startTorrent(t)
+			}
 		}
 	}
 }
@@ -65,6 +70,10 @@ func (s *Session) loadExistingTorrent(id string) (tt *Torrent, hasStarted bool,
 		}
 		info = info2
 		private = info.Private
+		err2 = info.SetPieceLayers(spec.PieceLayers)
+		if err2 != nil {
+			return nil, spec.Started, err2
+		}
 		if len(spec.Bitfield) > 0 {
 			bf3, err3 := bitfield.NewBytes(spec.Bitfield, info.NumPieces)
 			if err3 != nil {
@@ -73,7 +82,21 @@ func (s *Session) loadExistingTorrent(id string) (tt *Torrent, hasStarted bool,
 			bf = bf3
 		}
 	}
-	sto, err := filestorage.New(s.getDataDir(id), s.config.FilePermissions)
+	port := spec.Port
+	switch {
+	case s.sharedAcceptor != nil:
+		// Session is in shared port mode. Port of the torrent is not used, so no port is allocated from the range.
+		port = s.sharedPort
+	case port == 0:
+		// Torrent is added in shared port mode before.
+		port, err = s.getPort()
+		if err != nil {
+			return
+		}
+	default:
+		delete(s.availablePorts, port)
+	}
+	sto, err := s.newStorage(id, spec.DataDir, spec.IncompleteDir)
 	if err != nil {
 		return
 	}
@@ -83,11 +106,14 @@ func (s *Session) loadExistingTorrent(id string) (tt *Torrent, hasStarted bool,
 		spec.AddedAt,
 		spec.InfoHash,
 		sto,
+		spec.DataDir,
+		spec.IncompleteDir,
 		spec.Name,
-		spec.Port,
+		port,
 		s.parseTrackers(spec.Trackers, private),
 		spec.FixedPeers,
 		info,
+		intsToFilePriorities(spec.FilePriorities),
 		bf,
 		resumer.Stats{
 			BytesDownloaded: spec.BytesDownloaded,
@@ -105,10 +131,24 @@ func (s *Session) loadExistingTorrent(id string) (tt *Torrent, hasStarted bool,
 	}
 	t.rawTrackers = spec.Trackers
 	t.rawWebseedSources = spec.URLList
+	t.queuePosition = spec.QueuePosition
+	t.forceStarted = spec.Started && spec.ForceStarted
+	t.setLabels(spec.Labels)
+	t.setSpeedLimits(spec.DownloadLimit, spec.UploadLimit)
+	if spec.SeedLimits != nil {
+		var limits SeedLimits
+		err = json.Unmarshal(spec.SeedLimits, &limits)
+		if err != nil {
+			t.log.Errorln("cannot parse seed limits:", err)
+			err = nil
+		} else {
+			t.SetSeedLimits(&limits)
+		}
+	}
 	go s.checkTorrent(t)
-	delete(s.availablePorts, spec.Port)
 
 	tt = s.insertTorrent(t)
+	s.loadPendingHooks(id, spec.Hooks)
 	return
 }
 
@@ -152,9 +192,21 @@ func (s *Session) CompactDatabase(output string) error {
 		return err
 	}
 	for _, t := range s.torrents {
+		downloadLimit, uploadLimit := t.torrent.speedLimits()
+		var seedLimits []byte
+		if st := t.torrent.Stats(); st.SeedGoals.Custom {
+			seedLimits, err = json.Marshal(st.SeedGoals.Limits)
+			if err != nil {
+				return err
+			}
+		}
+		hooks, err := s.resumer.ReadHooks(t.torrent.id)
+		if err != nil {
+			return err
+		}
 		spec := &boltdbresumer.Spec{
 			InfoHash:          t.torrent.InfoHash(),
-			Port:              t.torrent.port,
+			Port:              s.resumePort(t.torrent.port),
 			Name:              t.torrent.name,
 			Trackers:          t.torrent.rawTrackers,
 			URLList:           t.torrent.rawWebseedSources,
@@ -163,6 +215,16 @@ func (s *Session) CompactDatabase(output string) error {
 			AddedAt:           t.torrent.addedAt,
 			StopAfterDownload: t.torrent.stopAfterDownload,
 			StopAfterMetadata: t.torrent.stopAfterMetadata,
+			FilePriorities:    filePrioritiesToInts(t.torrent.filePriorities),
+			IncompleteDir:     t.torrent.incompleteDir,
+			DataDir:           t.torrent.dataDir,
+			PieceLayers:       t.torrent.info.PieceLayers(),
+			QueuePosition:     s.queuePosition(t),
+			SeedLimits:        seedLimits,
+			DownloadLimit:     downloadLimit,
+			UploadLimit:       uploadLimit,
+			Labels:            t.torrent.Labels(),
+			Hooks:             hooks,
 		}
 		err = res.Write(t.torrent.id, spec)
 		if err != nil {
@@ -0,0 +1,265 @@
+package torrent
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Labels are written in the order of these values.
+var (
+	peerSources     = []PeerSource{SourceTracker, SourceDHT, SourcePEX, SourceIncoming, SourceManual, SourceLSD}
+	trackerStatuses = []TrackerStatus{NotContactedYet, Contacting, Working, NotWorking}
+	torrentStatuses = []Status{Stopped, DownloadingMetadata, Allocating, Verifying, Downloading, Seeding, Stopping, Queued}
+)
+
+var peerSourceLabels = map[PeerSource]string{
+	SourceTracker:  "tracker",
+	SourceDHT:      "dht",
+	SourcePEX:      "pex",
+	SourceIncoming: "incoming",
+	SourceManual:   "manual",
+	SourceLSD:      "lsd",
+}
+
+var trackerStatusLabels = map[TrackerStatus]string{
+	NotContactedYet: "not_contacted_yet",
+	Contacting:      "contacting",
+	Working:         "working",
+	NotWorking:      "not_working",
+}
+
+var torrentStatusLabels = map[Status]string{
+	Stopped:             "stopped",
+	DownloadingMetadata: "downloading_metadata",
+	Allocating:          "allocating",
+	Verifying:           "verifying",
+	Downloading:         "downloading",
+	Seeding:             "seeding",
+	Stopping:            "stopping",
+	Queued:              "queued",
+}
+
+// promFamily is a group of samples with the same metric name.
+type promFamily struct {
+	name    string
+	typ     string
+	help    string
+	samples []promSample
+}
+
+type promSample struct {
+	// Label names and values in pairs.
+	labels []string
+	value  float64
+}
+
+// promMetrics collects samples and writes them in Prometheus text exposition format.
+// Samples of a metric are grouped together regardless of the order they are added.
+type promMetrics struct {
+	families []*promFamily
+	byName   map[string]*promFamily
+}
+
+func newPromMetrics() *promMetrics {
+	return &promMetrics{byName: make(map[string]*promFamily)}
+}
+
+func (m *promMetrics) gauge(name, help string, value float64, labels ...string) {
+	m.add(name, "gauge", help, value, labels)
+}
+
+func (m *promMetrics) counter(name, help string, value float64, labels ...string) {
+	m.add(name, "counter", help, value, labels)
+}
+
+func (m *promMetrics) add(name, typ, help string, value float64, labels []string) {
+	f, ok := m.byName[name]
+	if !ok {
+		f = &promFamily{name: name, typ: typ, help: help}
+		m.byName[name] = f
+		m.families = append(m.families, f)
+	}
+	f.samples = append(f.samples, promSample{labels: labels, value: value})
+}
+
+func (m *promMetrics) write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range m.families {
+		bw.WriteString("# HELP " + f.name + " " + f.help + "\n")
+		bw.WriteString("# TYPE " + f.name + " " + f.typ + "\n")
+		for _, s := range f.samples {
+			bw.WriteString(f.name)
+			if len(s.labels) > 0 {
+				bw.WriteByte('{')
+				for i := 0; i+1 < len(s.labels); i += 2 {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+					bw.WriteString(s.labels[i] + `="` + escapeLabelValue(s.labels[i+1]) + `"`)
+				}
+				bw.WriteByte('}')
+			}
+			bw.WriteString(" " + strconv.FormatFloat(s.value, 'g', -1, 64) + "\n")
+		}
+	}
+	return bw.Flush()
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// handleMetrics serves the metrics of the Session in Prometheus text exposition format.
+func (s *Session) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	m := newPromMetrics()
+	s.collectSessionMetrics(m)
+	s.collectTorrentMetrics(m)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	err := m.write(w)
+	if err != nil {
+		s.log.Debugln("cannot write metrics:", err)
+	}
+}
+
+func (s *Session) collectSessionMetrics(m *promMetrics) {
+	st := s.Stats()
+	m.gauge("rain_uptime_seconds", "Time elapsed after the creation of the session.", st.Uptime.Seconds())
+	m.gauge("rain_torrents", "Number of torrents in the session.", float64(st.Torrents))
+	m.gauge("rain_peers", "Number of connected peers.", float64(st.Peers))
+	m.gauge("rain_ports_available", "Number of available ports for new torrents.", float64(st.PortsAvailable))
+	m.gauge("rain_blocklist_rules", "Number of rules in the blocklist.", float64(st.BlockListRules))
+	m.gauge("rain_blocklist_recency_seconds", "Time elapsed after the last successful update of the blocklist.", st.BlockListRecency.Seconds())
+	m.gauge("rain_read_cache_objects", "Number of blocks in the piece read cache.", float64(st.ReadCacheObjects))
+	m.gauge("rain_read_cache_bytes", "Size of the piece read cache.", float64(st.ReadCacheSize))
+	m.gauge("rain_read_cache_utilization_percent", "Hit ratio of the piece read cache.", float64(st.ReadCacheUtilization))
+	m.gauge("rain_reads_per_second", "Number of reads per second from disk.", float64(st.ReadsPerSecond))
+	m.gauge("rain_reads_active", "Number of active read requests from disk.", float64(st.ReadsActive))
+	m.gauge("rain_reads_pending", "Number of pending read requests from disk.", float64(st.ReadsPending))
+	m.gauge("rain_write_cache_objects", "Number of pieces in the write cache.", float64(st.WriteCacheObjects))
+	m.gauge("rain_write_cache_bytes", "Size of the write cache.", float64(st.WriteCacheSize))
+	m.gauge("rain_write_cache_pending_keys", "Number of torrents that are waiting for the write cache.", float64(st.WriteCachePendingKeys))
+	m.gauge("rain_writes_per_second", "Number of piece writes per second to disk.", float64(st.WritesPerSecond))
+	m.gauge("rain_writes_active", "Number of active write requests to disk.", float64(st.WritesActive))
+	m.gauge("rain_writes_pending", "Number of pending write requests to disk.", float64(st.WritesPending))
+	m.gauge("rain_download_speed_bytes", "Download speed from peers in bytes/s.", float64(st.SpeedDownload))
+	m.gauge("rain_upload_speed_bytes", "Upload speed to peers in bytes/s.", float64(st.SpeedUpload))
+	m.gauge("rain_read_speed_bytes", "Read speed from disk in bytes/s.", float64(st.SpeedRead))
+	m.gauge("rain_write_speed_bytes", "Write speed to disk in bytes/s.", float64(st.SpeedWrite))
+	m.counter("rain_downloaded_bytes_total", "Bytes downloaded from peers since the creation of the session.", float64(s.metrics.SpeedDownload.Count()))
+	m.counter("rain_uploaded_bytes_total", "Bytes uploaded to peers since the creation of the session.", float64(s.metrics.SpeedUpload.Count()))
+	m.counter("rain_read_bytes_total", "Bytes read from disk since the creation of the session.", float64(s.metrics.SpeedRead.Count()))
+	m.counter("rain_written_bytes_total", "Bytes written to disk since the creation of the session.", float64(s.metrics.SpeedWrite.Count()))
+	m.gauge("rain_alt_speed_limits", "Whether alternative speed limits are active.", boolToFloat(st.AltSpeedLimits))
+	m.gauge("rain_download_speed_limit_bytes", "Active global download speed limit in bytes/s. Zero means no limit.", float64(st.SpeedLimitDownload*1024))
+	m.gauge("rain_upload_speed_limit_bytes", "Active global upload speed limit in bytes/s. Zero means no limit.", float64(st.SpeedLimitUpload*1024))
+	m.counter("rain_watch_dir_errors_total", "Number of errors that occurred while adding torrents from watch directories.", float64(st.WatchDirErrors))
+}
+
+func (s *Session) collectTorrentMetrics(m *promMetrics) {
+	type torrentStats struct {
+		torrent *Torrent
+		stats   Stats
+	}
+	torrents := s.ListTorrents()
+	statusCounts := make(map[Status]int, len(torrentStatuses))
+	candidates := make([]torrentStats, 0, len(torrents))
+	for _, t := range torrents {
+		st := t.Stats()
+		statusCounts[st.Status]++
+		if st.Status == Stopped && !s.config.MetricsStoppedTorrents {
+			continue
+		}
+		candidates = append(candidates, torrentStats{torrent: t, stats: st})
+	}
+	for _, status := range torrentStatuses {
+		m.gauge("rain_torrents_by_status", "Number of torrents by status.", float64(statusCounts[status]), "status", torrentStatusLabels[status])
+	}
+	// Keep the series of the most active torrents if there are more torrents than the limit.
+	sort.Slice(candidates, func(i, j int) bool {
+		si := candidates[i].stats.Speed.Download + candidates[i].stats.Speed.Upload
+		sj := candidates[j].stats.Speed.Download + candidates[j].stats.Speed.Upload
+		if si != sj {
+			return si > sj
+		}
+		return candidates[i].torrent.ID() < candidates[j].torrent.ID()
+	})
+	if len(candidates) > s.config.MetricsMaxTorrents {
+		candidates = candidates[:s.config.MetricsMaxTorrents]
+	}
+	m.gauge("rain_torrents_without_series", "Number of torrents that are omitted from per-torrent series because of the cardinality limits.", float64(len(torrents)-len(candidates)))
+	for _, c := range candidates {
+		t, st := c.torrent, c.stats
+		l := []string{"id", t.ID(), "name", st.Name}
+		with := func(labels ...string) []string {
+			return append(append([]string(nil), l...), labels...)
+		}
+		m.gauge("rain_torrent_info", "Information about the torrent. Value is always 1.", 1, with("info_hash", st.InfoHash.String(), "status", torrentStatusLabels[st.Status])...)
+		m.gauge("rain_torrent_download_speed_bytes", "Download speed of the torrent in bytes/s.", float64(st.Speed.Download), l...)
+		m.gauge("rain_torrent_upload_speed_bytes", "Upload speed of the torrent in bytes/s.", float64(st.Speed.Upload), l...)
+		m.counter("rain_torrent_downloaded_bytes_total", "Bytes downloaded from the swarm.", float64(st.Bytes.Downloaded), l...)
+		m.counter("rain_torrent_uploaded_bytes_total", "Bytes uploaded to the swarm.", float64(st.Bytes.Uploaded), l...)
+		m.counter("rain_torrent_wasted_bytes_total", "Bytes downloaded due to duplicate or non-requested pieces.", float64(st.Bytes.Wasted), l...)
+		m.gauge("rain_torrent_completed_bytes", "Bytes that are downloaded and passed hash check.", float64(st.Bytes.Completed), l...)
+		m.gauge("rain_torrent_size_bytes", "Total size of the files in the torrent.", float64(st.Bytes.Total), l...)
+		m.counter("rain_torrent_seeded_seconds_total", "Duration while the torrent is in seeding status.", st.SeededFor.Seconds(), l...)
+		m.gauge("rain_torrent_pieces", "Number of pieces of the torrent by state.", float64(st.Pieces.Have), with("state", "have")...)
+		m.gauge("rain_torrent_pieces", "Number of pieces of the torrent by state.", float64(st.Pieces.Missing), with("state", "missing")...)
+		m.gauge("rain_torrent_pieces", "Number of pieces of the torrent by state.", float64(st.Pieces.Available), with("state", "available")...)
+		m.gauge("rain_torrent_pieces", "Number of pieces of the torrent by state.", float64(st.Pieces.Total), with("state", "total")...)
+
+		peerCounts := make(map[PeerSource]int, len(peerSources))
+		for _, p := range t.Peers() {
+			peerCounts[p.Source]++
+		}
+		for _, source := range peerSources {
+			m.gauge("rain_torrent_peers", "Number of connected peers of the torrent by source.", float64(peerCounts[source]), with("source", peerSourceLabels[source])...)
+		}
+
+		trackerCounts := make(map[TrackerStatus]int, len(trackerStatuses))
+		for _, tr := range t.Trackers() {
+			trackerCounts[tr.Status]++
+		}
+		for _, status := range trackerStatuses {
+			m.gauge("rain_torrent_trackers", "Number of trackers of the torrent by status.", float64(trackerCounts[status]), with("status", trackerStatusLabels[status])...)
+		}
+
+		for _, ws := range t.Webseeds() {
+			m.gauge("rain_torrent_webseed_download_speed_bytes", "Download speed from the webseed source in bytes/s.", float64(ws.DownloadSpeed), with("url", ws.URL)...)
+		}
+	}
+}
+
+// startMetricsServer starts a separate HTTP server that serves only Prometheus metrics.
+func (s *Session) startMetricsServer() error {
+	addr := net.JoinHostPort(s.config.MetricsHost, strconv.Itoa(s.config.MetricsPort))
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	s.metricsServer = &http.Server{Handler: mux} // nolint: gosec
+	s.log.Infoln("metrics server is listening on", listener.Addr().String())
+	go func() {
+		err := s.metricsServer.Serve(listener)
+		if err == http.ErrServerClosed {
+			return
+		}
+		s.log.Errorln("metrics server error:", err)
+	}()
+	return nil
+}
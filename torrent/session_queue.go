@@ -0,0 +1,282 @@
+package torrent
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/cenkalti/rain/internal/resumer/boltdbresumer"
+	"go.etcd.io/bbolt"
+)
+
+// Period of checking the queue for starting waiting torrents and detecting inactive torrents.
+const queueUpdateInterval = 5 * time.Second
+
+// queueEnabled returns true if any of the active torrent limits is set in Config.
+// Otherwise, torrents are started immediately and they are not kept in queue.
+func (s *Session) queueEnabled() bool {
+	return s.config.MaxActiveDownloads > 0 || s.config.MaxActiveSeeds > 0 || s.config.MaxActiveTorrents > 0
+}
+
+func (s *Session) queueLoop() {
+	ticker := time.NewTicker(queueUpdateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.updateQueue()
+		case <-s.queueUpdateC:
+			s.updateQueue()
+		case <-s.closeC:
+			return
+		}
+	}
+}
+
+// triggerQueueUpdate makes queueLoop to update the queue without waiting for the next tick.
+func (s *Session) triggerQueueUpdate() {
+	select {
+	case s.queueUpdateC <- struct{}{}:
+	default:
+	}
+}
+
+// updateQueue starts and stops the queued torrents according to the limits in Config.
+// Torrents are processed in queue order. A torrent is started if there is a free slot for it,
+// otherwise it is stopped and waits in queue until a slot becomes available.
+func (s *Session) updateQueue() {
+	s.mQueue.Lock()
+	defer s.mQueue.Unlock()
+	if !s.queueEnabled() {
+		return
+	}
+	now := time.Now()
+	var downloads, seeds int
+	for _, t := range s.queue {
+		tt := t.torrent
+		if !tt.queued {
+			continue
+		}
+		st := tt.Stats()
+		running := st.Status != Stopped && st.Status != Stopping
+		if !running && tt.queueStarted {
+			// Torrent has stopped by itself because of an error or StopAfterDownload/StopAfterMetadata options.
+			tt.queued = false
+			tt.queueStarted = false
+			continue
+		}
+		transferred := st.Bytes.Downloaded + st.Bytes.Uploaded
+		if running {
+			// Torrent may be started by Verify or ForceStart before.
+			tt.queueStarted = true
+			if transferred != tt.queueBytes {
+				tt.queueBytes = transferred
+				tt.queueActiveAt = now
+			}
+			if s.config.QueueInactiveTimeout > 0 && now.Sub(tt.queueActiveAt) > s.config.QueueInactiveTimeout {
+				// Inactive torrents do not count towards the limits.
+				continue
+			}
+		}
+		seeding := isSeeding(st)
+		switch {
+		case s.hasFreeQueueSlot(seeding, downloads, seeds):
+			if seeding {
+				seeds++
+			} else {
+				downloads++
+			}
+			if !running {
+				tt.log.Info("starting queued torrent")
+				tt.queueStarted = true
+				tt.queueBytes = transferred
+				tt.queueActiveAt = now
+				tt.Start()
+			}
+		case running:
+			tt.log.Info("queueing torrent")
+			tt.queueStarted = false
+			tt.Stop()
+		}
+	}
+}
+
+// isSeeding returns true if the torrent is seeding or it is going to seed when started.
+func isSeeding(st Stats) bool {
+	switch st.Status {
+	case Seeding:
+		return true
+	case Stopped, Stopping:
+		return st.Pieces.Total > 0 && st.Pieces.Have > 0 && st.Pieces.Missing == 0
+	default:
+		return false
+	}
+}
+
+func (s *Session) hasFreeQueueSlot(seeding bool, downloads, seeds int) bool {
+	if s.config.MaxActiveTorrents > 0 && downloads+seeds >= s.config.MaxActiveTorrents {
+		return false
+	}
+	if seeding {
+		return s.config.MaxActiveSeeds <= 0 || seeds < s.config.MaxActiveSeeds
+	}
+	return s.config.MaxActiveDownloads <= 0 || downloads < s.config.MaxActiveDownloads
+}
+
+// startTorrent starts the torrent immediately if the queue is disabled.
+// Otherwise, the torrent is put into the queue and started when a slot becomes available.
+func (s *Session) startTorrent(t *Torrent) {
+	s.mQueue.Lock()
+	t.torrent.forceStarted = false
+	if !s.queueEnabled() {
+		s.mQueue.Unlock()
+		t.torrent.Start()
+		return
+	}
+	t.torrent.queued = true
+	s.mQueue.Unlock()
+	s.triggerQueueUpdate()
+}
+
+// forceStartTorrent starts the torrent regardless of the queue limits.
+func (s *Session) forceStartTorrent(t *Torrent) {
+	s.mQueue.Lock()
+	t.torrent.queued = false
+	t.torrent.queueStarted = false
+	t.torrent.forceStarted = true
+	s.mQueue.Unlock()
+	t.torrent.Start()
+	// Torrent does not occupy a slot in queue anymore.
+	s.triggerQueueUpdate()
+}
+
+// stopQueuedTorrent removes the torrent from the active set of the queue and stops it.
+func (s *Session) stopQueuedTorrent(t *Torrent) {
+	s.mQueue.Lock()
+	t.torrent.queued = false
+	t.torrent.queueStarted = false
+	t.torrent.forceStarted = false
+	s.mQueue.Unlock()
+	t.torrent.Stop()
+	s.triggerQueueUpdate()
+}
+
+// updateQueueStats fills the queue related fields of torrent stats.
+func (s *Session) updateQueueStats(t *Torrent, stats *Stats) {
+	s.mQueue.Lock()
+	defer s.mQueue.Unlock()
+	if stats.Status == Stopped && t.torrent.queued && !t.torrent.queueStarted {
+		// Torrent is waiting in queue for a free slot.
+		stats.Status = Queued
+	}
+	stats.QueuePosition = t.torrent.queuePosition
+	stats.ForceStarted = t.torrent.forceStarted
+}
+
+func (s *Session) queuePosition(t *Torrent) int {
+	s.mQueue.Lock()
+	defer s.mQueue.Unlock()
+	return t.torrent.queuePosition
+}
+
+// initQueue puts the torrents loaded from the database into the queue in their saved order.
+func (s *Session) initQueue(torrents []*Torrent) {
+	sort.SliceStable(torrents, func(i, j int) bool {
+		a, b := torrents[i].torrent, torrents[j].torrent
+		if a.queuePosition == b.queuePosition {
+			return a.addedAt.Before(b.addedAt)
+		}
+		return a.queuePosition < b.queuePosition
+	})
+	s.mQueue.Lock()
+	defer s.mQueue.Unlock()
+	// Positions are not saved in older databases or there may be gaps because of invalid torrents.
+	var changed []*Torrent
+	for i, t := range torrents {
+		if t.torrent.queuePosition != i {
+			t.torrent.queuePosition = i
+			changed = append(changed, t)
+		}
+	}
+	s.queue = torrents
+	err := s.writeQueuePositions(changed)
+	if err != nil {
+		s.log.Errorln("cannot write queue positions:", err)
+	}
+}
+
+// appendToQueue puts the torrent at the end of the queue.
+func (s *Session) appendToQueue(t *Torrent) {
+	s.mQueue.Lock()
+	defer s.mQueue.Unlock()
+	t.torrent.queuePosition = len(s.queue)
+	s.queue = append(s.queue, t)
+	err := s.writeQueuePositions([]*Torrent{t})
+	if err != nil {
+		// Positions are fixed when the torrents are loaded on next startup.
+		t.torrent.log.Errorln("cannot write queue position:", err)
+	}
+}
+
+// removeFromQueue removes the torrent from the queue and moves the torrents behind it one step forward.
+func (s *Session) removeFromQueue(t *Torrent) error {
+	s.mQueue.Lock()
+	defer s.mQueue.Unlock()
+	i := t.torrent.queuePosition
+	if i >= len(s.queue) || s.queue[i] != t {
+		return nil
+	}
+	s.queue = append(s.queue[:i], s.queue[i+1:]...)
+	changed := s.queue[i:]
+	for j, t2 := range changed {
+		t2.torrent.queuePosition = i + j
+	}
+	err := s.writeQueuePositions(changed)
+	if err != nil {
+		return err
+	}
+	s.triggerQueueUpdate()
+	return nil
+}
+
+// moveInQueue swaps the position of the torrent with the torrent in front of it (delta=-1) or behind it (delta=1).
+func (s *Session) moveInQueue(t *Torrent, delta int) error {
+	s.mQueue.Lock()
+	defer s.mQueue.Unlock()
+	i := t.torrent.queuePosition
+	j := i + delta
+	if j < 0 || j >= len(s.queue) {
+		return nil
+	}
+	s.queue[i], s.queue[j] = s.queue[j], s.queue[i]
+	s.queue[i].torrent.queuePosition = i
+	s.queue[j].torrent.queuePosition = j
+	err := s.writeQueuePositions([]*Torrent{s.queue[i], s.queue[j]})
+	if err != nil {
+		return err
+	}
+	s.triggerQueueUpdate()
+	return nil
+}
+
+// writeQueuePositions saves the queue positions of torrents into the resume database.
+func (s *Session) writeQueuePositions(torrents []*Torrent) error {
+	if len(torrents) == 0 {
+		return nil
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		tb := tx.Bucket(torrentsBucket)
+		for _, t := range torrents {
+			b := tb.Bucket([]byte(t.torrent.id))
+			if b == nil {
+				// Torrent is removed.
+				continue
+			}
+			err := b.Put(boltdbresumer.Keys.QueuePosition, []byte(strconv.Itoa(t.torrent.queuePosition)))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -6,17 +6,19 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
-	"io/fs"
 	"io/ioutil"
+	"mime"
 	"net/http"
-	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/cenkalti/rain/internal/resumer/boltdbresumer"
 	"github.com/cenkalti/rain/internal/rpctypes"
+	"github.com/cenkalti/rain/internal/storage"
 	"github.com/powerman/rpc-codec/jsonrpc2"
 )
 
@@ -32,7 +34,12 @@ func (h *rpcHandler) Version(args struct{}, reply *string) error {
 }
 
 func (h *rpcHandler) ListTorrents(args *rpctypes.ListTorrentsRequest, reply *rpctypes.ListTorrentsResponse) error {
-	torrents := h.session.ListTorrents()
+	var torrents []*Torrent
+	if args.Label != "" {
+		torrents = h.session.ListTorrentsWithLabel(args.Label)
+	} else {
+		torrents = h.session.ListTorrents()
+	}
 	reply.Torrents = make([]rpctypes.Torrent, 0, len(torrents))
 	for _, t := range torrents {
 		reply.Torrents = append(reply.Torrents, newTorrent(t))
@@ -42,11 +49,19 @@ func (h *rpcHandler) ListTorrents(args *rpctypes.ListTorrentsRequest, reply *rpc
 
 func (h *rpcHandler) AddTorrent(args *rpctypes.AddTorrentRequest, reply *rpctypes.AddTorrentResponse) error {
 	r := base64.NewDecoder(base64.StdEncoding, strings.NewReader(args.Torrent))
+	priorities, err := parseFilePriorities(args.FilePriorities)
+	if err != nil {
+		return jsonrpc2.NewError(2, err.Error())
+	}
 	opt := &AddTorrentOptions{
 		Stopped:           args.AddTorrentOptions.Stopped,
 		ID:                args.AddTorrentOptions.ID,
 		StopAfterDownload: args.StopAfterDownload,
 		StopAfterMetadata: args.StopAfterMetadata,
+		FilePriorities:    priorities,
+		IncompleteDir:     args.IncompleteDir,
+		DataPath:          args.DataPath,
+		Labels:            args.Labels,
 	}
 	t, err := h.session.AddTorrent(r, opt)
 	var e *InputError
@@ -61,11 +76,19 @@ func (h *rpcHandler) AddTorrent(args *rpctypes.AddTorrentRequest, reply *rpctype
 }
 
 func (h *rpcHandler) AddURI(args *rpctypes.AddURIRequest, reply *rpctypes.AddURIResponse) error {
+	priorities, err := parseFilePriorities(args.FilePriorities)
+	if err != nil {
+		return jsonrpc2.NewError(2, err.Error())
+	}
 	opt := &AddTorrentOptions{
 		Stopped:           args.AddTorrentOptions.Stopped,
 		ID:                args.AddTorrentOptions.ID,
 		StopAfterDownload: args.StopAfterDownload,
 		StopAfterMetadata: args.StopAfterMetadata,
+		FilePriorities:    priorities,
+		IncompleteDir:     args.IncompleteDir,
+		DataPath:          args.DataPath,
+		Labels:            args.Labels,
 	}
 	t, err := h.session.AddURI(args.URI, opt)
 	var e *InputError
@@ -79,6 +102,21 @@ func (h *rpcHandler) AddURI(args *rpctypes.AddURIRequest, reply *rpctypes.AddURI
 	return nil
 }
 
+func parseFilePriorities(values []string) ([]FilePriority, error) {
+	if values == nil {
+		return nil, nil
+	}
+	priorities := make([]FilePriority, len(values))
+	for i, v := range values {
+		p, err := ParseFilePriority(v)
+		if err != nil {
+			return nil, err
+		}
+		priorities[i] = p
+	}
+	return priorities, nil
+}
+
 func newTorrent(t *Torrent) rpctypes.Torrent {
 	return rpctypes.Torrent{
 		ID:       t.ID(),
@@ -86,11 +124,12 @@ func newTorrent(t *Torrent) rpctypes.Torrent {
 		InfoHash: t.InfoHash().String(),
 		Port:     t.Port(),
 		AddedAt:  rpctypes.Time{Time: t.AddedAt()},
+		Labels:   t.Labels(),
 	}
 }
 
 func (h *rpcHandler) RemoveTorrent(args *rpctypes.RemoveTorrentRequest, reply *rpctypes.RemoveTorrentResponse) error {
-	return h.session.RemoveTorrent(args.ID)
+	return h.session.RemoveTorrentWithOptions(args.ID, &RemoveTorrentOptions{KeepData: args.KeepData})
 }
 
 func (h *rpcHandler) GetMagnet(args *rpctypes.GetMagnetRequest, reply *rpctypes.GetMagnetResponse) error {
@@ -151,10 +190,24 @@ func (h *rpcHandler) GetSessionStats(args *rpctypes.GetSessionStatsRequest, repl
 		SpeedUpload:   s.SpeedUpload,
 		SpeedRead:     s.SpeedRead,
 		SpeedWrite:    s.SpeedWrite,
+
+		AltSpeedLimits:     s.AltSpeedLimits,
+		SpeedLimitDownload: s.SpeedLimitDownload,
+		SpeedLimitUpload:   s.SpeedLimitUpload,
+
+		WatchDirErrors: s.WatchDirErrors,
+	}
+	if s.WatchDirLastError != nil {
+		reply.Stats.WatchDirLastError = s.WatchDirLastError.Error()
 	}
 	return nil
 }
 
+func (h *rpcHandler) SetAltSpeedLimits(args *rpctypes.SetAltSpeedLimitsRequest, reply *rpctypes.SetAltSpeedLimitsResponse) error {
+	h.session.SetAltSpeedLimits(args.Enabled)
+	return nil
+}
+
 func (h *rpcHandler) GetTorrentStats(args *rpctypes.GetTorrentStatsRequest, reply *rpctypes.GetTorrentStatsResponse) error {
 	t := h.session.GetTorrent(args.ID)
 	if t == nil {
@@ -169,18 +222,21 @@ func (h *rpcHandler) GetTorrentStats(args *rpctypes.GetTorrentStatsRequest, repl
 			Checked   uint32
 			Have      uint32
 			Missing   uint32
+			Wanted    uint32
 			Available uint32
 			Total     uint32
 		}{
 			Checked:   s.Pieces.Checked,
 			Have:      s.Pieces.Have,
 			Missing:   s.Pieces.Missing,
+			Wanted:    s.Pieces.Wanted,
 			Available: s.Pieces.Available,
 			Total:     s.Pieces.Total,
 		},
 		Bytes: struct {
 			Total      int64
 			Allocated  int64
+			Moved      int64
 			Completed  int64
 			Incomplete int64
 			Downloaded int64
@@ -189,6 +245,7 @@ func (h *rpcHandler) GetTorrentStats(args *rpctypes.GetTorrentStatsRequest, repl
 		}{
 			Total:      s.Bytes.Total,
 			Allocated:  s.Bytes.Allocated,
+			Moved:      s.Bytes.Moved,
 			Completed:  s.Bytes.Completed,
 			Incomplete: s.Bytes.Incomplete,
 			Downloaded: s.Bytes.Downloaded,
@@ -218,11 +275,13 @@ func (h *rpcHandler) GetTorrentStats(args *rpctypes.GetTorrentStatsRequest, repl
 			Tracker int
 			DHT     int
 			PEX     int
+			LSD     int
 		}{
 			Total:   s.Addresses.Total,
 			Tracker: s.Addresses.Tracker,
 			DHT:     s.Addresses.DHT,
 			PEX:     s.Addresses.PEX,
+			LSD:     s.Addresses.LSD,
 		},
 		Downloads: struct {
 			Total   int
@@ -244,6 +303,8 @@ func (h *rpcHandler) GetTorrentStats(args *rpctypes.GetTorrentStatsRequest, repl
 			Snubbed: s.MetadataDownloads.Snubbed,
 			Running: s.MetadataDownloads.Running,
 		},
+		DataDir:     s.DataDir,
+		Moving:      s.Moving,
 		Name:        s.Name,
 		Private:     s.Private,
 		PieceLength: s.PieceLength,
@@ -255,6 +316,16 @@ func (h *rpcHandler) GetTorrentStats(args *rpctypes.GetTorrentStatsRequest, repl
 			Download: s.Speed.Download,
 			Upload:   s.Speed.Upload,
 		},
+		SpeedLimit: struct {
+			Download int64
+			Upload   int64
+		}{
+			Download: s.SpeedLimit.Download,
+			Upload:   s.SpeedLimit.Upload,
+		},
+		QueuePosition: s.QueuePosition,
+		ForceStarted:  s.ForceStarted,
+		Labels:        s.Labels,
 	}
 	if s.Error != nil {
 		reply.Stats.Error = s.Error.Error()
@@ -264,6 +335,22 @@ func (h *rpcHandler) GetTorrentStats(args *rpctypes.GetTorrentStatsRequest, repl
 	} else {
 		reply.Stats.ETA = -1
 	}
+	reply.Stats.SeedGoals.Limits = seedLimitsToRPC(s.SeedGoals.Limits)
+	reply.Stats.SeedGoals.Custom = s.SeedGoals.Custom
+	reply.Stats.SeedGoals.Ratio = s.SeedGoals.Ratio
+	reply.Stats.SeedGoals.Idle = uint(s.SeedGoals.Idle / time.Second)
+	reply.Stats.SeedGoals.RatioRemaining = -1
+	if s.SeedGoals.RatioRemaining != nil {
+		reply.Stats.SeedGoals.RatioRemaining = *s.SeedGoals.RatioRemaining
+	}
+	reply.Stats.SeedGoals.TimeRemaining = -1
+	if s.SeedGoals.TimeRemaining != nil {
+		reply.Stats.SeedGoals.TimeRemaining = int(*s.SeedGoals.TimeRemaining / time.Second)
+	}
+	reply.Stats.SeedGoals.IdleRemaining = -1
+	if s.SeedGoals.IdleRemaining != nil {
+		reply.Stats.SeedGoals.IdleRemaining = int(*s.SeedGoals.IdleRemaining / time.Second)
+	}
 	return nil
 }
 
@@ -276,11 +363,12 @@ func (h *rpcHandler) GetTorrentTrackers(args *rpctypes.GetTorrentTrackersRequest
 	reply.Trackers = make([]rpctypes.Tracker, len(trackers))
 	for i, t := range trackers {
 		reply.Trackers[i] = rpctypes.Tracker{
-			URL:      t.URL,
-			Status:   trackerStatusToString(t.Status),
-			Leechers: t.Leechers,
-			Seeders:  t.Seeders,
-			Warning:  t.Warning,
+			URL:        t.URL,
+			Status:     trackerStatusToString(t.Status),
+			Leechers:   t.Leechers,
+			Seeders:    t.Seeders,
+			Warning:    t.Warning,
+			Downloaded: t.Downloaded,
 		}
 		if t.Error != nil {
 			reply.Trackers[i].Error = t.Error.Error()
@@ -293,6 +381,9 @@ func (h *rpcHandler) GetTorrentTrackers(args *rpctypes.GetTorrentTrackersRequest
 		if !t.NextAnnounce.IsZero() {
 			reply.Trackers[i].NextAnnounce = rpctypes.Time{Time: t.NextAnnounce}
 		}
+		if !t.LastScrape.IsZero() {
+			reply.Trackers[i].LastScrape = rpctypes.Time{Time: t.LastScrape}
+		}
 	}
 	return nil
 }
@@ -317,14 +408,26 @@ func (h *rpcHandler) GetTorrentPeers(args *rpctypes.GetTorrentPeersRequest, repl
 			source = "INCOMING"
 		case SourceManual:
 			source = "MANUAL"
+		case SourceLSD:
+			source = "LSD"
 		default:
 			panic("unhandled peer source")
 		}
+		var transport string
+		switch p.Transport {
+		case TransportTCP:
+			transport = "TCP"
+		case TransportUTP:
+			transport = "UTP"
+		default:
+			panic("unhandled peer transport")
+		}
 		reply.Peers[i] = rpctypes.Peer{
 			ID:                 hex.EncodeToString(p.ID[:]),
 			Client:             p.Client,
 			Addr:               p.Addr.String(),
 			Source:             source,
+			Transport:          transport,
 			ConnectedAt:        rpctypes.Time{Time: p.ConnectedAt},
 			Downloading:        p.Downloading,
 			ClientInterested:   p.ClientInterested,
@@ -361,6 +464,43 @@ func (h *rpcHandler) GetTorrentWebseeds(args *rpctypes.GetTorrentWebseedsRequest
 	return nil
 }
 
+func (h *rpcHandler) GetTorrentFiles(args *rpctypes.GetTorrentFilesRequest, reply *rpctypes.GetTorrentFilesResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	files, err := t.Files()
+	if err != nil {
+		return err
+	}
+	reply.Files = make([]rpctypes.File, len(files))
+	for i, f := range files {
+		reply.Files[i] = rpctypes.File{
+			Path:     f.Path,
+			Length:   f.Length,
+			Priority: f.Priority.String(),
+		}
+	}
+	return nil
+}
+
+func (h *rpcHandler) SetFilePriorities(args *rpctypes.SetFilePrioritiesRequest, reply *rpctypes.SetFilePrioritiesResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	priorities, err := parseFilePriorities(args.Priorities)
+	if err != nil {
+		return jsonrpc2.NewError(2, err.Error())
+	}
+	err = t.SetFilePriorities(priorities)
+	var e *InputError
+	if errors.As(err, &e) {
+		return jsonrpc2.NewError(2, e.Error())
+	}
+	return err
+}
+
 func (h *rpcHandler) StartTorrent(args *rpctypes.StartTorrentRequest, reply *rpctypes.StartTorrentResponse) error {
 	t := h.session.GetTorrent(args.ID)
 	if t == nil {
@@ -377,6 +517,216 @@ func (h *rpcHandler) StopTorrent(args *rpctypes.StopTorrentRequest, reply *rpcty
 	return t.Stop()
 }
 
+func (h *rpcHandler) ForceStartTorrent(args *rpctypes.ForceStartTorrentRequest, reply *rpctypes.ForceStartTorrentResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	return t.ForceStart()
+}
+
+func (h *rpcHandler) SetTorrentSeedLimits(args *rpctypes.SetTorrentSeedLimitsRequest, reply *rpctypes.SetTorrentSeedLimitsResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	if args.Limits == nil {
+		return t.SetSeedLimits(nil)
+	}
+	limits, err := seedLimitsFromRPC(*args.Limits)
+	if err != nil {
+		return err
+	}
+	return t.SetSeedLimits(&limits)
+}
+
+func (h *rpcHandler) SetTorrentSpeedLimits(args *rpctypes.SetTorrentSpeedLimitsRequest, reply *rpctypes.SetTorrentSpeedLimitsResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	return t.SetSpeedLimits(args.Download, args.Upload)
+}
+
+func (h *rpcHandler) GetSeedLimits(args *rpctypes.GetSeedLimitsRequest, reply *rpctypes.GetSeedLimitsResponse) error {
+	reply.Limits = seedLimitsToRPC(h.session.SeedLimits())
+	return nil
+}
+
+func (h *rpcHandler) SetSeedLimits(args *rpctypes.SetSeedLimitsRequest, reply *rpctypes.SetSeedLimitsResponse) error {
+	limits, err := seedLimitsFromRPC(args.Limits)
+	if err != nil {
+		return err
+	}
+	return h.session.SetSeedLimits(limits)
+}
+
+func (h *rpcHandler) SetTorrentLabels(args *rpctypes.SetTorrentLabelsRequest, reply *rpctypes.SetTorrentLabelsResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	return t.SetLabels(args.Labels)
+}
+
+func (h *rpcHandler) ListLabels(args *rpctypes.ListLabelsRequest, reply *rpctypes.ListLabelsResponse) error {
+	labels := h.session.Labels()
+	reply.Labels = make([]rpctypes.Label, 0, len(labels))
+	for name, l := range labels {
+		rl := rpctypes.Label{
+			Name:               name,
+			DataDir:            l.DataDir,
+			SpeedLimitDownload: l.SpeedLimitDownload,
+			SpeedLimitUpload:   l.SpeedLimitUpload,
+			OnCompleteCmd:      l.OnCompleteCmd,
+		}
+		if l.SeedLimits != nil {
+			limits := seedLimitsToRPC(*l.SeedLimits)
+			rl.SeedLimits = &limits
+		}
+		reply.Labels = append(reply.Labels, rl)
+	}
+	sort.Slice(reply.Labels, func(i, j int) bool { return reply.Labels[i].Name < reply.Labels[j].Name })
+	return nil
+}
+
+func (h *rpcHandler) SetLabel(args *rpctypes.SetLabelRequest, reply *rpctypes.SetLabelResponse) error {
+	l := Label{
+		DataDir:            args.Label.DataDir,
+		SpeedLimitDownload: args.Label.SpeedLimitDownload,
+		SpeedLimitUpload:   args.Label.SpeedLimitUpload,
+		OnCompleteCmd:      args.Label.OnCompleteCmd,
+	}
+	if args.Label.SeedLimits != nil {
+		limits, err := seedLimitsFromRPC(*args.Label.SeedLimits)
+		if err != nil {
+			return jsonrpc2.NewError(2, err.Error())
+		}
+		l.SeedLimits = &limits
+	}
+	err := h.session.SetLabel(args.Label.Name, l)
+	var e *InputError
+	if errors.As(err, &e) {
+		return jsonrpc2.NewError(2, e.Error())
+	}
+	return err
+}
+
+func (h *rpcHandler) RemoveLabel(args *rpctypes.RemoveLabelRequest, reply *rpctypes.RemoveLabelResponse) error {
+	return h.session.RemoveLabel(args.Name)
+}
+
+func (h *rpcHandler) ListFeeds(args *rpctypes.ListFeedsRequest, reply *rpctypes.ListFeedsResponse) error {
+	feeds := h.session.Feeds()
+	reply.Feeds = make([]rpctypes.Feed, 0, len(feeds))
+	for _, f := range feeds {
+		rf := rpctypes.Feed{
+			Name:           f.Name,
+			URL:            f.URL,
+			Interval:       uint(f.Interval / time.Second),
+			Include:        f.Include,
+			Exclude:        f.Exclude,
+			UniqueEpisodes: f.UniqueEpisodes,
+			Label:          f.Label,
+			DataDir:        f.DataDir,
+			Stopped:        f.Stopped,
+			ItemsAdded:     f.ItemsAdded,
+		}
+		if !f.LastUpdate.IsZero() {
+			rf.LastUpdate = rpctypes.Time{Time: f.LastUpdate}
+		}
+		if f.Error != nil {
+			rf.Error = f.Error.Error()
+		}
+		reply.Feeds = append(reply.Feeds, rf)
+	}
+	return nil
+}
+
+func (h *rpcHandler) AddFeed(args *rpctypes.AddFeedRequest, reply *rpctypes.AddFeedResponse) error {
+	err := h.session.AddFeed(Feed{
+		Name:           args.Feed.Name,
+		URL:            args.Feed.URL,
+		Interval:       time.Duration(args.Feed.Interval) * time.Second,
+		Include:        args.Feed.Include,
+		Exclude:        args.Feed.Exclude,
+		UniqueEpisodes: args.Feed.UniqueEpisodes,
+		Label:          args.Feed.Label,
+		DataDir:        args.Feed.DataDir,
+		Stopped:        args.Feed.Stopped,
+	})
+	var e *InputError
+	if errors.As(err, &e) {
+		return jsonrpc2.NewError(2, e.Error())
+	}
+	return err
+}
+
+func (h *rpcHandler) RemoveFeed(args *rpctypes.RemoveFeedRequest, reply *rpctypes.RemoveFeedResponse) error {
+	err := h.session.RemoveFeed(args.Name)
+	var e *InputError
+	if errors.As(err, &e) {
+		return jsonrpc2.NewError(2, e.Error())
+	}
+	return err
+}
+
+func seedLimitsToRPC(l SeedLimits) rpctypes.SeedLimits {
+	return rpctypes.SeedLimits{
+		Ratio:       l.Ratio,
+		RatioAction: l.RatioAction.String(),
+		Time:        uint(l.Time / time.Second),
+		TimeAction:  l.TimeAction.String(),
+		Idle:        uint(l.Idle / time.Second),
+		IdleAction:  l.IdleAction.String(),
+	}
+}
+
+func seedLimitsFromRPC(l rpctypes.SeedLimits) (SeedLimits, error) {
+	ret := SeedLimits{
+		Ratio: l.Ratio,
+		Time:  time.Duration(l.Time) * time.Second,
+		Idle:  time.Duration(l.Idle) * time.Second,
+	}
+	var err error
+	// Empty action means the default action.
+	if l.RatioAction != "" {
+		ret.RatioAction, err = ParseSeedLimitAction(l.RatioAction)
+		if err != nil {
+			return ret, err
+		}
+	}
+	if l.TimeAction != "" {
+		ret.TimeAction, err = ParseSeedLimitAction(l.TimeAction)
+		if err != nil {
+			return ret, err
+		}
+	}
+	if l.IdleAction != "" {
+		ret.IdleAction, err = ParseSeedLimitAction(l.IdleAction)
+		if err != nil {
+			return ret, err
+		}
+	}
+	return ret, nil
+}
+
+func (h *rpcHandler) MoveTorrentUpInQueue(args *rpctypes.MoveTorrentUpInQueueRequest, reply *rpctypes.MoveTorrentUpInQueueResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	return t.MoveUpInQueue()
+}
+
+func (h *rpcHandler) MoveTorrentDownInQueue(args *rpctypes.MoveTorrentDownInQueueRequest, reply *rpctypes.MoveTorrentDownInQueueResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	return t.MoveDownInQueue()
+}
+
 func (h *rpcHandler) AnnounceTorrent(args *rpctypes.AnnounceTorrentRequest, reply *rpctypes.AnnounceTorrentResponse) error {
 	t := h.session.GetTorrent(args.ID)
 	if t == nil {
@@ -418,6 +768,19 @@ func (h *rpcHandler) AddTracker(args *rpctypes.AddTrackerRequest, reply *rpctype
 	return t.AddTracker(args.URL)
 }
 
+func (h *rpcHandler) MoveData(args *rpctypes.MoveDataRequest, reply *rpctypes.MoveDataResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	err := t.SetDataDir(args.DataDir)
+	var e *InputError
+	if errors.As(err, &e) {
+		return jsonrpc2.NewError(2, e.Error())
+	}
+	return err
+}
+
 func (h *rpcHandler) MoveTorrent(args *rpctypes.MoveTorrentRequest, reply *rpctypes.MoveTorrentResponse) error {
 	t := h.session.GetTorrent(args.ID)
 	if t == nil {
@@ -503,6 +866,9 @@ func (h *rpcHandler) handleMoveTorrent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	s.Port = port
+	// Data is received into data dir.
+	s.IncompleteDir = ""
+	s.DataDir = ""
 	spec := &s
 	// case "data":
 	p, err = mr.NextPart()
@@ -515,7 +881,13 @@ func (h *rpcHandler) handleMoveTorrent(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "data expected in multipart form", http.StatusBadRequest)
 		return
 	}
-	err = readData(p, h.session.getDataDir(id), h.session.config.FilePermissions)
+	sto, err := h.session.newStorage(id, "", "")
+	if err != nil {
+		h.session.log.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = readData(p, sto)
 	if err != nil {
 		h.session.log.Error(err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -533,6 +905,7 @@ func (h *rpcHandler) handleMoveTorrent(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	h.session.appendToQueue(t)
 	if started {
 		err = t.Start()
 		if err != nil {
@@ -544,7 +917,78 @@ func (h *rpcHandler) handleMoveTorrent(w http.ResponseWriter, r *http.Request) {
 	success = true
 }
 
-func readData(r io.Reader, dir string, perm fs.FileMode) error {
+// handleStream serves a file in the torrent over HTTP while the torrent is being downloaded.
+// URL format is /stream/<torrent-id>/<file-path>.
+// Pieces covering the requested range are downloaded first and the response blocks until they are verified.
+func (h *rpcHandler) handleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/stream/"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.Error(w, "invalid stream path", http.StatusBadRequest)
+		return
+	}
+	id, path := parts[0], parts[1]
+	t := h.session.GetTorrent(id)
+	if t == nil {
+		http.Error(w, "torrent not found", http.StatusNotFound)
+		return
+	}
+	files, err := t.Files()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	index := -1
+	for i, f := range files {
+		if filepath.ToSlash(f.Path) == path {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+	fr, err := t.NewFileReader(index)
+	var e *InputError
+	if errors.As(err, &e) {
+		http.Error(w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer fr.Close()
+
+	// Unblock pending reads if the client goes away.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-r.Context().Done():
+			fr.Close()
+		case <-done:
+		}
+	}()
+
+	// Torrent data never changes, so the info hash and the file index identifies the content.
+	w.Header().Set("ETag", fmt.Sprintf("\"%s-%d\"", t.InfoHash(), index))
+	// ServeContent sniffs the content from the beginning of file if the type is not set,
+	// which blocks range requests until the first piece is downloaded.
+	ctype := mime.TypeByExtension(filepath.Ext(path))
+	if ctype == "" {
+		ctype = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", ctype)
+	http.ServeContent(w, r, path, time.Time{}, fr)
+}
+
+func readData(r io.Reader, sto Storage) error {
 	tr := tar.NewReader(r)
 	for {
 		hdr, err := tr.Next()
@@ -554,24 +998,116 @@ func readData(r io.Reader, dir string, perm fs.FileMode) error {
 		if err != nil {
 			return err
 		}
-		name := filepath.Join(dir, hdr.Name)
-		err = os.MkdirAll(filepath.Dir(name), os.ModeDir|perm)
-		if err != nil {
-			return err
-		}
-		f, err := os.Create(name)
+		f, _, err := sto.Open(hdr.Name, hdr.Size)
 		if err != nil {
 			return err
 		}
-		_, err = io.Copy(f, tr) // nolint: gosec
-		if err != nil {
-			return err
+		_, err = io.Copy(&storageFileWriter{File: f}, tr) // nolint: gosec
+		if err == nil {
+			if sf, ok := f.(storage.Syncer); ok {
+				err = sf.Sync()
+			}
 		}
-		err = f.Sync()
+		_ = f.Close()
 		if err != nil {
 			return err
 		}
-		_ = f.Close()
 	}
 	return nil
 }
+
+// storageFileWriter implements io.Writer for writing a StorageFile sequentially.
+type storageFileWriter struct {
+	File   StorageFile
+	offset int64
+}
+
+func (w *storageFileWriter) Write(p []byte) (int, error) {
+	n, err := w.File.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
+
+// handleEvents streams the events of the session as Server-Sent Events.
+// Events can be filtered with "type" and "id" query parameters. "type" can be given multiple times or separated with commas.
+func (h *rpcHandler) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	filter := EventFilter{TorrentID: r.URL.Query().Get("id")}
+	for _, v := range r.URL.Query()["type"] {
+		for _, name := range strings.Split(v, ",") {
+			et, err := ParseEventType(strings.TrimSpace(name))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			filter.Types = append(filter.Types, et)
+		}
+	}
+	sub := h.session.Subscribe(filter)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Comments are sent periodically for keeping the connection alive through proxies.
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			b, err := json.Marshal(eventToRPC(e))
+			if err != nil {
+				h.session.log.Error(err)
+				return
+			}
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, b)
+			if err != nil {
+				return
+			}
+		case <-ticker.C:
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			if err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-h.session.closeC:
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func eventToRPC(e Event) rpctypes.Event {
+	ret := rpctypes.Event{
+		Type:        e.Type.String(),
+		Time:        rpctypes.Time{Time: e.Time},
+		TorrentID:   e.TorrentID,
+		TorrentName: e.TorrentName,
+		Piece:       e.Piece,
+		File:        e.File,
+		Tracker:     e.Tracker,
+		Peer:        e.Peer,
+	}
+	if e.Type == EventTrackerStatus {
+		ret.TrackerStatus = trackerStatusToString(e.TrackerStatus)
+	}
+	if e.Error != nil {
+		ret.Error = e.Error.Error()
+	}
+	return ret
+}
@@ -27,6 +27,12 @@ func newRPCServer(ses *Session) *rpcServer {
 	mux := http.NewServeMux()
 	mux.Handle("/debug/vars", expvar.Handler())
 	mux.HandleFunc("/move-torrent", h.handleMoveTorrent)
+	mux.HandleFunc("/stream/", h.handleStream)
+	mux.HandleFunc("/events", h.handleEvents)
+	mux.HandleFunc("/metrics", ses.handleMetrics)
+	if ses.config.TransmissionRPCEnabled {
+		mux.Handle("/transmission/rpc", newTransmissionHandler(ses))
+	}
 	mux.Handle("/", jsonrpc2.HTTPHandler(srv))
 
 	return &rpcServer{
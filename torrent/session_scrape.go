@@ -0,0 +1,132 @@
+package torrent
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/rain/internal/tracker"
+)
+
+// Maximum duration for scraping all torrents on a single tracker.
+const scrapeTimeout = time.Minute
+
+type scrapeResult struct {
+	Seeders    int
+	Leechers   int
+	Downloaded int
+	Time       time.Time
+}
+
+// scrapeTarget contains the torrents that are going to be scraped from the same tracker URL.
+type scrapeTarget struct {
+	tracker  tracker.Tracker
+	torrents []*torrent
+}
+
+func (s *Session) scrapeLoop() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.closeC:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// Trackers may tell the minimum interval between scrapes.
+	nextScrape := make(map[string]time.Time)
+	ticker := time.NewTicker(s.config.TrackerScrapeInterval)
+	defer ticker.Stop()
+	for {
+		s.scrapeTrackers(ctx, nextScrape)
+		select {
+		case <-ticker.C:
+		case <-s.closeC:
+			return
+		}
+	}
+}
+
+func (s *Session) scrapeTrackers(ctx context.Context, nextScrape map[string]time.Time) {
+	targets := make(map[string]*scrapeTarget)
+	s.mTorrents.RLock()
+	for _, t := range s.torrents {
+		t.torrent.mTrackers.RLock()
+		for _, tr := range t.torrent.trackers {
+			u := tr.URL()
+			st, ok := targets[u]
+			if !ok {
+				st = &scrapeTarget{tracker: tr}
+				targets[u] = st
+			}
+			st.torrents = append(st.torrents, t.torrent)
+		}
+		t.torrent.mTrackers.RUnlock()
+	}
+	s.mTorrents.RUnlock()
+
+	now := time.Now()
+	for u := range targets {
+		if now.Before(nextScrape[u]) {
+			delete(targets, u)
+		}
+	}
+
+	var m sync.Mutex
+	var wg sync.WaitGroup
+	for u, st := range targets {
+		wg.Add(1)
+		go func(u string, st *scrapeTarget) {
+			defer wg.Done()
+			minInterval := s.scrapeTracker(ctx, u, st)
+			m.Lock()
+			nextScrape[u] = time.Now().Add(minInterval)
+			m.Unlock()
+		}(u, st)
+	}
+	wg.Wait()
+}
+
+// scrapeTracker scrapes the torrents of target and saves the results into torrents.
+// Returns the minimum interval for the next scrape of the tracker.
+func (s *Session) scrapeTracker(ctx context.Context, u string, target *scrapeTarget) time.Duration {
+	infoHashes := make([][20]byte, 0, len(target.torrents))
+	seen := make(map[[20]byte]struct{}, len(target.torrents))
+	for _, t := range target.torrents {
+		if _, ok := seen[t.infoHash]; ok {
+			continue
+		}
+		seen[t.infoHash] = struct{}{}
+		infoHashes = append(infoHashes, t.infoHash)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, scrapeTimeout)
+	defer cancel()
+	resp, err := target.tracker.Scrape(ctx, infoHashes)
+	if err == tracker.ErrScrapeNotSupported {
+		return 0
+	}
+	if err != nil {
+		s.log.Debugf("cannot scrape tracker %s: %s", u, err)
+		return 0
+	}
+
+	now := time.Now()
+	for _, t := range target.torrents {
+		ts, ok := resp.Torrents[t.infoHash]
+		if !ok {
+			continue
+		}
+		t.mTrackers.Lock()
+		t.scrapes[u] = scrapeResult{
+			Seeders:    int(ts.Seeders),
+			Leechers:   int(ts.Leechers),
+			Downloaded: int(ts.Downloaded),
+			Time:       now,
+		}
+		t.mTrackers.Unlock()
+	}
+	return resp.MinInterval
+}
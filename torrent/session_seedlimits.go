@@ -0,0 +1,94 @@
+package torrent
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// Period of checking the seeding torrents for reaching their seeding limits.
+const seedLimitsCheckInterval = 10 * time.Second
+
+func (s *Session) seedLimitsLoop() {
+	ticker := time.NewTicker(seedLimitsCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.checkSeedLimits()
+		case <-s.closeC:
+			return
+		}
+	}
+}
+
+// checkSeedLimits applies the action of the reached limit on seeding torrents.
+func (s *Session) checkSeedLimits() {
+	for _, t := range s.ListTorrents() {
+		st := t.torrent.Stats()
+		if !st.SeedGoals.Reached {
+			continue
+		}
+		t.torrent.log.Infof("seeding limit is reached (ratio: %.2f, seeded for: %s, idle: %s), action: %s",
+			st.SeedGoals.Ratio, st.SeededFor.Round(time.Second), st.SeedGoals.Idle.Round(time.Second), st.SeedGoals.Action)
+		t.torrent.publishEvent(Event{Type: EventSeedLimitReached})
+		t.torrent.RunHooks(EventSeedLimitReached)
+		var err error
+		switch st.SeedGoals.Action {
+		case SeedLimitStop:
+			err = t.Stop()
+		case SeedLimitRemove:
+			err = s.RemoveTorrentWithOptions(t.ID(), &RemoveTorrentOptions{KeepData: true})
+		case SeedLimitRemoveData:
+			err = s.RemoveTorrent(t.ID())
+		}
+		if err != nil {
+			t.torrent.log.Errorln("cannot apply seeding limit action:", err)
+		}
+	}
+}
+
+// SeedLimits returns the global seeding limits that are used for torrents without their own limits.
+func (s *Session) SeedLimits() SeedLimits {
+	s.mSeedLimits.RLock()
+	defer s.mSeedLimits.RUnlock()
+	return s.seedLimits
+}
+
+// SetSeedLimits changes the global seeding limits that are used for torrents without their own limits.
+// The limits are saved to the database and they are used instead of the limits in Config when a new Session is created.
+func (s *Session) SetSeedLimits(limits SeedLimits) error {
+	value, err := json.Marshal(limits)
+	if err != nil {
+		return err
+	}
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(sessionBucket).Put(seedLimitsKey, value)
+	})
+	if err != nil {
+		return err
+	}
+	s.mSeedLimits.Lock()
+	s.seedLimits = limits
+	s.mSeedLimits.Unlock()
+	return nil
+}
+
+// loadSeedLimits loads the global seeding limits that are saved by SetSeedLimits in a previous Session.
+func (s *Session) loadSeedLimits() error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		value := tx.Bucket(sessionBucket).Get(seedLimitsKey)
+		if value == nil {
+			return nil
+		}
+		var limits SeedLimits
+		err := json.Unmarshal(value, &limits)
+		if err != nil {
+			s.log.Errorln("cannot parse seed limits:", err)
+			return nil
+		}
+		s.seedLimits = limits
+		return nil
+	})
+}
@@ -0,0 +1,138 @@
+package torrent
+
+import (
+	"net"
+
+	"github.com/cenkalti/rain/internal/acceptor"
+	"github.com/cenkalti/rain/internal/btconn"
+	"github.com/cenkalti/rain/internal/handshaker/incominghandshaker"
+	"github.com/cenkalti/rain/internal/utp"
+	"github.com/nictuku/dht"
+)
+
+// startSharedListener starts listening on a single port for incoming connections of all torrents.
+// Connections are matched to torrents by the info hash sent in the handshake.
+func (s *Session) startSharedListener() error {
+	// Listens on both IPv4 and IPv6 if the host is unspecified address and the system supports dual-stack sockets.
+	ip := net.ParseIP(s.config.Host)
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: ip, Port: int(s.config.SharedPort)})
+	if err != nil {
+		return err
+	}
+	s.log.Info("Listening peers on tcp://" + listener.Addr().String())
+	s.sharedPort = listener.Addr().(*net.TCPAddr).Port
+	s.sharedConnC = make(chan net.Conn)
+	s.sharedDoneC = make(chan struct{})
+	s.sharedAcceptor = acceptor.New(listener, s.sharedConnC, s.log)
+	go s.sharedAcceptor.Run()
+	if s.config.UTPEnabled {
+		socket, err := utp.Listen("udp", (&net.UDPAddr{IP: ip, Port: s.sharedPort}).String())
+		if err != nil {
+			s.log.Warningf("cannot listen utp port %d: %s", s.sharedPort, err)
+		} else {
+			s.log.Info("Listening peers on utp://" + socket.Addr().String())
+			s.sharedUTPSocket = socket
+			s.sharedUTPAcceptor = acceptor.New(socket, s.sharedConnC, s.log)
+			go s.sharedUTPAcceptor.Run()
+		}
+	}
+	go s.handleSharedConnections()
+	return nil
+}
+
+func (s *Session) stopSharedListener() {
+	s.sharedAcceptor.Close()
+	if s.sharedUTPAcceptor != nil {
+		s.sharedUTPAcceptor.Close()
+	}
+	<-s.sharedDoneC
+}
+
+// handleSharedConnections does the handshake of incoming connections on the shared port and
+// sends the connections to the torrent with the info hash in the handshake.
+func (s *Session) handleSharedConnections() {
+	defer close(s.sharedDoneC)
+	handshakers := make(map[*incominghandshaker.IncomingHandshaker]struct{})
+	resultC := make(chan *incominghandshaker.IncomingHandshaker)
+	for {
+		select {
+		case conn := <-s.sharedConnC:
+			ip := btconn.RemoteAddr(conn).IP
+			if s.config.BlocklistEnabledForIncomingConnections && s.blocklist != nil && s.blocklist.Blocked(ip) {
+				s.log.Debugln("peer is blocked:", conn.RemoteAddr().String())
+				conn.Close()
+				continue
+			}
+			if len(handshakers) >= s.config.SharedPortMaxHandshakes {
+				s.log.Debugln("too many incoming handshakes, closing connection from", conn.RemoteAddr().String())
+				conn.Close()
+				continue
+			}
+			h := incominghandshaker.New(conn)
+			handshakers[h] = struct{}{}
+			go h.Run(
+				s.getPeerID,
+				s.getSKey,
+				resultC,
+				s.config.PeerHandshakeTimeout,
+				s.extensions,
+				s.config.ForceIncomingEncryption,
+			)
+		case h := <-resultC:
+			delete(handshakers, h)
+			if h.Error != nil {
+				continue
+			}
+			t := s.getTorrentByInfoHash(h.InfoHash)
+			if t == nil {
+				// Torrent is removed during handshake.
+				h.Conn.Close()
+				continue
+			}
+			select {
+			case t.incomingHandshakeC <- h:
+			case <-t.closeC:
+				h.Conn.Close()
+			case <-s.closeC:
+				h.Conn.Close()
+			}
+		case <-s.closeC:
+			for h := range handshakers {
+				h.Close()
+			}
+			return
+		}
+	}
+}
+
+// getTorrentByInfoHash returns the first torrent with the info hash.
+// The same torrent may be added to the session more than once but they cannot be distinguished by incoming connections.
+func (s *Session) getTorrentByInfoHash(infoHash [20]byte) *torrent {
+	s.mTorrents.RLock()
+	defer s.mTorrents.RUnlock()
+	torrents := s.torrentsByInfoHash[dht.InfoHash(infoHash[:])]
+	if len(torrents) == 0 {
+		return nil
+	}
+	return torrents[0].torrent
+}
+
+func (s *Session) getPeerID(infoHash [20]byte) ([20]byte, bool) {
+	t := s.getTorrentByInfoHash(infoHash)
+	if t == nil {
+		return [20]byte{}, false
+	}
+	return t.peerID, true
+}
+
+// getSKey tries the hash of SKEY against all torrents in the session for encrypted handshakes.
+func (s *Session) getSKey(sKeyHash [20]byte) []byte {
+	s.mTorrents.RLock()
+	defer s.mTorrents.RUnlock()
+	for _, t := range s.torrents {
+		if sKey := t.torrent.getSKey(sKeyHash); sKey != nil {
+			return sKey
+		}
+	}
+	return nil
+}
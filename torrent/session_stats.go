@@ -64,10 +64,22 @@ type SessionStats struct {
 	SpeedRead int
 	// Write speed to disk in bytes/s.
 	SpeedWrite int
+
+	// Alternative speed limits are active.
+	AltSpeedLimits bool
+	// Active global speed limits in KB/s. Zero means no limit.
+	SpeedLimitDownload int64
+	SpeedLimitUpload   int64
+
+	// Number of errors that occurred while adding torrents from Config.WatchDirs.
+	WatchDirErrors int
+	// Last error that occurred while adding torrents from Config.WatchDirs. Nil if there is no error.
+	WatchDirLastError error
 }
 
 // Stats returns current statistics about the Session.
 func (s *Session) Stats() SessionStats {
+	watchDirErrors, watchDirLastError := s.watchDirStats()
 	return SessionStats{
 		Uptime:         time.Duration(s.metrics.Uptime.Value()) * time.Second,
 		Torrents:       int(s.metrics.Torrents.Value()),
@@ -97,6 +109,13 @@ func (s *Session) Stats() SessionStats {
 		SpeedUpload:   int(s.metrics.SpeedUpload.Rate1()),
 		SpeedRead:     int(s.metrics.SpeedRead.Rate1()),
 		SpeedWrite:    int(s.metrics.SpeedWrite.Rate1()),
+
+		AltSpeedLimits:     s.AltSpeedLimits(),
+		SpeedLimitDownload: s.downloadLimiter.Rate() / 1024,
+		SpeedLimitUpload:   s.uploadLimiter.Rate() / 1024,
+
+		WatchDirErrors:    watchDirErrors,
+		WatchDirLastError: watchDirLastError,
 	}
 }
 
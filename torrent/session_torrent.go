@@ -4,11 +4,11 @@ import (
 	"archive/tar"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
-	"os"
 	"path/filepath"
 	"time"
 
@@ -57,7 +57,9 @@ func (t *Torrent) AddedAt() time.Time {
 
 // Stats returns statistics about the torrent.
 func (t *Torrent) Stats() Stats {
-	return t.torrent.Stats()
+	s := t.torrent.Stats()
+	t.torrent.session.updateQueueStats(t, &s)
+	return s
 }
 
 // Magnet returns the magnet link.
@@ -87,6 +89,44 @@ func (t *Torrent) Webseeds() []Webseed {
 	return t.torrent.Webseeds()
 }
 
+// Files returns the list of files in the torrent.
+// Returns error if torrent has no metadata yet.
+func (t *Torrent) Files() ([]File, error) {
+	files := t.torrent.Files()
+	if files == nil {
+		return nil, errors.New("torrent metadata not ready")
+	}
+	return files, nil
+}
+
+// SetFilePriorities changes the download priorities of files in the torrent.
+// The length of priorities must be equal to the number of files in the torrent.
+// Files with PrioritySkip are not downloaded and the torrent switches into Seeding state after all other files are downloaded.
+// Returns error if torrent has no metadata yet.
+func (t *Torrent) SetFilePriorities(priorities []FilePriority) error {
+	return t.torrent.SetFilePriorities(priorities)
+}
+
+// NewFileReader returns a reader for reading the file at index while the torrent is being downloaded.
+// Reads block until the pieces containing the data are downloaded and verified.
+// Pieces near the read position are downloaded before other pieces.
+// The amount of data to download ahead of the read position is adjusted according to the read speed.
+// The reader must be closed after use.
+// Returns error if torrent has no metadata yet or the file is skipped.
+func (t *Torrent) NewFileReader(index int) (io.ReadSeekCloser, error) {
+	return t.torrent.NewFileReader(index)
+}
+
+// SetDataDir moves the files of the torrent into dir.
+// Files are moved in background and the progress is reported in Stats.
+// Files are renamed if possible, otherwise they are copied and removed from old location after copy is done.
+// The torrent continues seeding from the files in old location while they are being moved.
+// Writes to files are paused until all files are moved.
+// If the torrent is being downloaded into an incomplete dir, files are moved into dir after download completes.
+func (t *Torrent) SetDataDir(dir string) error {
+	return t.torrent.SetDataDir(dir)
+}
+
 // Port returns the TCP port number that the torrent is listening peers.
 func (t *Torrent) Port() int {
 	return t.torrent.port
@@ -151,12 +191,26 @@ func (t *Torrent) AddTracker(uri string) error {
 }
 
 // Start downloading the torrent. If all pieces are completed, starts seeding them.
+// If any of the MaxActive limits is set in Config, the torrent switches into Queued state
+// and waits in queue until a slot becomes available.
 func (t *Torrent) Start() error {
 	err := t.torrent.session.resumer.WriteStarted(t.torrent.id, true)
 	if err != nil {
 		return err
 	}
-	t.torrent.Start()
+	t.torrent.session.startTorrent(t)
+	return nil
+}
+
+// ForceStart starts the torrent immediately regardless of the MaxActive limits in Config.
+// Force started torrents do not count towards the limits.
+// Calling Start or Stop later puts the torrent back under the control of the queue.
+func (t *Torrent) ForceStart() error {
+	err := t.torrent.session.resumer.WriteForceStarted(t.torrent.id)
+	if err != nil {
+		return err
+	}
+	t.torrent.session.forceStartTorrent(t)
 	return nil
 }
 
@@ -168,7 +222,75 @@ func (t *Torrent) Stop() error {
 	if err != nil {
 		return err
 	}
-	t.torrent.Stop()
+	t.torrent.session.stopQueuedTorrent(t)
+	return nil
+}
+
+// QueuePosition returns the position of the torrent in queue, starting from zero.
+// Queued torrents are started in order when a slot becomes available.
+func (t *Torrent) QueuePosition() int {
+	return t.torrent.session.queuePosition(t)
+}
+
+// MoveUpInQueue moves the torrent one step towards the head of the queue.
+// Does nothing if the torrent is already at the head.
+func (t *Torrent) MoveUpInQueue() error {
+	return t.torrent.session.moveInQueue(t, -1)
+}
+
+// MoveDownInQueue moves the torrent one step towards the end of the queue.
+// Does nothing if the torrent is already at the end.
+func (t *Torrent) MoveDownInQueue() error {
+	return t.torrent.session.moveInQueue(t, 1)
+}
+
+// SetSeedLimits sets the seeding limits of the torrent, overriding the global limits in Config.
+// Nil value makes the torrent use the global limits again.
+func (t *Torrent) SetSeedLimits(limits *SeedLimits) error {
+	var value []byte
+	if limits != nil {
+		var err error
+		value, err = json.Marshal(limits)
+		if err != nil {
+			return err
+		}
+		l := *limits
+		limits = &l
+	}
+	err := t.torrent.session.resumer.WriteSeedLimits(t.torrent.id, value)
+	if err != nil {
+		return err
+	}
+	t.torrent.SetSeedLimits(limits)
+	return nil
+}
+
+// SetSpeedLimits sets the download and upload speed limits of the torrent in KB/s.
+// Zero means no limit, or the limits of the labels of the torrent if set.
+// Global limits in Config also apply to the torrent.
+func (t *Torrent) SetSpeedLimits(download, upload int64) error {
+	err := t.torrent.session.resumer.WriteSpeedLimits(t.torrent.id, download, upload)
+	if err != nil {
+		return err
+	}
+	t.torrent.setSpeedLimits(download, upload)
+	return nil
+}
+
+// Labels returns the labels of the torrent.
+func (t *Torrent) Labels() []string {
+	return t.torrent.Labels()
+}
+
+// SetLabels replaces the labels of the torrent.
+// Default settings of the new labels apply to the torrent, except the data directory.
+func (t *Torrent) SetLabels(labels []string) error {
+	labels = cleanLabels(labels)
+	err := t.torrent.session.resumer.WriteLabels(t.torrent.id, labels)
+	if err != nil {
+		return err
+	}
+	t.torrent.setLabels(labels)
 	return nil
 }
 
@@ -269,49 +391,41 @@ func (t *Torrent) generateTar(pw *io.PipeWriter) {
 	defer func() { _ = pw.CloseWithError(err) }()
 
 	tw := tar.NewWriter(pw)
-	root := t.torrent.session.getDataDir(t.torrent.id)
-	walkFunc := func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.IsDir() {
-			return nil
-		}
-		hdr := &tar.Header{
-			Name: path[len(root)+1:],
-			Mode: 0600,
-			Size: info.Size(),
-		}
-		err = tw.WriteHeader(hdr)
-		if err != nil {
-			t.torrent.log.Errorln("cannot write tar header:", err)
-			return err
-		}
-		f, err := os.Open(path)
-		if err != nil {
-			t.torrent.log.Errorln("cannot open file:", err)
-			return err
-		}
-		_, err = io.Copy(tw, f)
-		f.Close()
+	// Files() returns nil if torrent has no metadata. Then, there is no data to send.
+	for _, f := range t.torrent.Files() {
+		err = t.writeTarFile(tw, f)
 		if err != nil {
-			t.torrent.log.Errorln("cannot copy storage file to tar writer:", err)
-			return err
+			return
 		}
-		return nil
 	}
-	err = filepath.Walk(root, walkFunc)
-	if os.IsNotExist(err) {
-		err = nil
+	err = tw.Close()
+	if err != nil {
+		t.torrent.log.Errorln("cannot close tar writer:", err)
 		return
 	}
+}
+
+func (t *Torrent) writeTarFile(tw *tar.Writer, f File) error {
+	sf, _, err := t.torrent.storage.Open(f.Path, f.Length)
 	if err != nil {
-		t.torrent.log.Errorln("error walking files:", err)
-		return
+		t.torrent.log.Errorln("cannot open file:", err)
+		return err
 	}
-	err = tw.Close()
+	defer sf.Close()
+	hdr := &tar.Header{
+		Name: filepath.ToSlash(f.Path),
+		Mode: 0600,
+		Size: f.Length,
+	}
+	err = tw.WriteHeader(hdr)
 	if err != nil {
-		t.torrent.log.Errorln("cannot close tar writer:", err)
-		return
+		t.torrent.log.Errorln("cannot write tar header:", err)
+		return err
 	}
+	_, err = io.Copy(tw, io.NewSectionReader(sf, 0, f.Length))
+	if err != nil {
+		t.torrent.log.Errorln("cannot copy storage file to tar writer:", err)
+		return err
+	}
+	return nil
 }
@@ -0,0 +1,833 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/rain/internal/logger"
+	"github.com/cenkalti/rain/internal/magnet"
+	"github.com/nictuku/dht"
+)
+
+// Transmission RPC protocol version that is reported to clients.
+const (
+	transmissionRPCVersion        = 15
+	transmissionRPCVersionMinimum = 1
+)
+
+const transmissionSessionIDHeader = "X-Transmission-Session-Id"
+
+// Removed torrents are reported in "recently-active" responses for this duration.
+const transmissionRemovedTTL = time.Minute
+
+// Torrent status values of Transmission.
+const (
+	transmissionStatusStopped      = 0
+	transmissionStatusCheck        = 2
+	transmissionStatusDownloadWait = 3
+	transmissionStatusDownload     = 4
+	transmissionStatusSeedWait     = 5
+	transmissionStatusSeed         = 6
+)
+
+// transmissionHandler serves a subset of Transmission RPC protocol so that the clients of Transmission can manage the Session.
+// Transmission identifies torrents with integers, so each torrent is given an integer ID when it is seen for the first time.
+// These IDs are not persisted and change when the Session is restarted.
+// Only the methods and fields that are listed in README are supported. Unsupported fields are omitted from responses.
+type transmissionHandler struct {
+	session   *Session
+	sessionID string
+	log       logger.Logger
+
+	mIDs     sync.Mutex
+	ids      map[string]int
+	torrents map[int]string
+	removed  map[int]time.Time
+	nextID   int
+}
+
+func newTransmissionHandler(s *Session) *transmissionHandler {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return &transmissionHandler{
+		session:   s,
+		sessionID: hex.EncodeToString(b),
+		log:       logger.New("transmission rpc"),
+		ids:       make(map[string]int),
+		torrents:  make(map[int]string),
+		removed:   make(map[int]time.Time),
+		nextID:    1,
+	}
+}
+
+type transmissionRequest struct {
+	Method    string          `json:"method"`
+	Arguments json.RawMessage `json:"arguments"`
+	Tag       json.RawMessage `json:"tag,omitempty"`
+}
+
+type transmissionResponse struct {
+	Result    string                 `json:"result"`
+	Arguments map[string]interface{} `json:"arguments"`
+	Tag       json.RawMessage        `json:"tag,omitempty"`
+}
+
+func (h *transmissionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(transmissionSessionIDHeader) != h.sessionID {
+		w.Header().Set(transmissionSessionIDHeader, h.sessionID)
+		http.Error(w, "409: Conflict: invalid or missing "+transmissionSessionIDHeader+" header", http.StatusConflict)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req transmissionRequest
+	// Metainfo is encoded in base64 in torrent-add requests.
+	err := json.NewDecoder(io.LimitReader(r.Body, int64(h.session.config.MaxTorrentSize)*2)).Decode(&req)
+	if err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	args, err := h.call(req.Method, req.Arguments)
+	resp := transmissionResponse{
+		Result:    "success",
+		Arguments: args,
+		Tag:       req.Tag,
+	}
+	if err != nil {
+		resp.Result = err.Error()
+	}
+	if resp.Arguments == nil {
+		resp.Arguments = map[string]interface{}{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		h.log.Debugln("cannot write response:", err)
+	}
+}
+
+func (h *transmissionHandler) call(method string, raw json.RawMessage) (map[string]interface{}, error) {
+	var args struct {
+		IDs             json.RawMessage `json:"ids"`
+		Fields          []string        `json:"fields"`
+		DeleteLocalData bool            `json:"delete-local-data"`
+		Filename        string          `json:"filename"`
+		Metainfo        string          `json:"metainfo"`
+		Paused          bool            `json:"paused"`
+		DownloadDir     string          `json:"download-dir"`
+		Labels          []string        `json:"labels"`
+	}
+	if len(raw) > 0 {
+		err := json.Unmarshal(raw, &args)
+		if err != nil {
+			return nil, err
+		}
+	}
+	switch method {
+	case "torrent-get":
+		return h.torrentGet(args.IDs, args.Fields)
+	case "torrent-add":
+		return h.torrentAdd(args.Filename, args.Metainfo, &AddTorrentOptions{
+			Stopped: args.Paused,
+			DataDir: args.DownloadDir,
+			Labels:  args.Labels,
+		})
+	case "torrent-start":
+		return nil, h.forEach(args.IDs, (*Torrent).Start)
+	case "torrent-start-now":
+		return nil, h.forEach(args.IDs, (*Torrent).ForceStart)
+	case "torrent-stop":
+		return nil, h.forEach(args.IDs, (*Torrent).Stop)
+	case "torrent-verify":
+		return nil, h.forEach(args.IDs, (*Torrent).Verify)
+	case "torrent-remove":
+		return nil, h.forEach(args.IDs, func(t *Torrent) error {
+			return h.session.RemoveTorrentWithOptions(t.ID(), &RemoveTorrentOptions{KeepData: !args.DeleteLocalData})
+		})
+	case "session-get":
+		return filterFields(h.sessionGet(), args.Fields), nil
+	case "session-stats":
+		return h.sessionStats(), nil
+	default:
+		return nil, errors.New("method name not recognized")
+	}
+}
+
+// syncIDs gives integer IDs to new torrents and forgets removed torrents after a while.
+// Returns the torrents of the Session sorted by their integer IDs.
+func (h *transmissionHandler) syncIDs() (torrents []*Torrent, removed []int) {
+	torrents = h.session.ListTorrents()
+	sort.Slice(torrents, func(i, j int) bool {
+		if !torrents[i].AddedAt().Equal(torrents[j].AddedAt()) {
+			return torrents[i].AddedAt().Before(torrents[j].AddedAt())
+		}
+		return torrents[i].ID() < torrents[j].ID()
+	})
+	h.mIDs.Lock()
+	defer h.mIDs.Unlock()
+	seen := make(map[string]struct{}, len(torrents))
+	for _, t := range torrents {
+		seen[t.ID()] = struct{}{}
+		if _, ok := h.ids[t.ID()]; !ok {
+			h.ids[t.ID()] = h.nextID
+			h.torrents[h.nextID] = t.ID()
+			h.nextID++
+		}
+	}
+	now := time.Now()
+	for id, tid := range h.torrents {
+		if _, ok := seen[tid]; !ok {
+			delete(h.torrents, id)
+			delete(h.ids, tid)
+			h.removed[id] = now
+		}
+	}
+	for id, t := range h.removed {
+		if now.Sub(t) > transmissionRemovedTTL {
+			delete(h.removed, id)
+			continue
+		}
+		removed = append(removed, id)
+	}
+	sort.Ints(removed)
+	return
+}
+
+func (h *transmissionHandler) id(t *Torrent) int {
+	h.mIDs.Lock()
+	defer h.mIDs.Unlock()
+	return h.ids[t.ID()]
+}
+
+// selectTorrents returns the torrents that are selected by the "ids" argument.
+// It can be missing for all torrents, an integer ID, "recently-active" or a list of integer IDs and info hashes.
+func (h *transmissionHandler) selectTorrents(raw json.RawMessage) (selected []*Torrent, removed []int, err error) {
+	torrents, removed := h.syncIDs()
+	if len(raw) == 0 || string(raw) == "null" {
+		return torrents, nil, nil
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil && s == "recently-active" {
+		for _, t := range torrents {
+			if t.Stats().Status != Stopped {
+				selected = append(selected, t)
+			}
+		}
+		return selected, removed, nil
+	}
+	var values []interface{}
+	var single interface{}
+	err = json.Unmarshal(raw, &single)
+	if err != nil {
+		return nil, nil, err
+	}
+	if a, ok := single.([]interface{}); ok {
+		values = a
+	} else {
+		values = []interface{}{single}
+	}
+	want := make(map[*Torrent]struct{}, len(values))
+	for _, v := range values {
+		switch v := v.(type) {
+		case float64:
+			h.mIDs.Lock()
+			tid, ok := h.torrents[int(v)]
+			h.mIDs.Unlock()
+			if !ok {
+				continue
+			}
+			if t := h.session.GetTorrent(tid); t != nil {
+				want[t] = struct{}{}
+			}
+		case string:
+			for _, t := range torrents {
+				if strings.EqualFold(t.InfoHash().String(), v) {
+					want[t] = struct{}{}
+				}
+			}
+		default:
+			return nil, nil, fmt.Errorf("invalid torrent id: %v", v)
+		}
+	}
+	for _, t := range torrents {
+		if _, ok := want[t]; ok {
+			selected = append(selected, t)
+		}
+	}
+	return selected, nil, nil
+}
+
+func (h *transmissionHandler) forEach(ids json.RawMessage, f func(*Torrent) error) error {
+	torrents, _, err := h.selectTorrents(ids)
+	if err != nil {
+		return err
+	}
+	for _, t := range torrents {
+		if err2 := f(t); err2 != nil && err == nil {
+			err = err2
+		}
+	}
+	return err
+}
+
+func (h *transmissionHandler) torrentAdd(filename, metainfo string, opt *AddTorrentOptions) (map[string]interface{}, error) {
+	var b []byte
+	var err error
+	switch {
+	case metainfo != "":
+		b, err = base64.StdEncoding.DecodeString(metainfo)
+	case filename == "":
+		return nil, errors.New("filename or metainfo must be given")
+	case isTransmissionURI(filename):
+		u, _ := url.Parse(filename)
+		if u.Scheme == "magnet" {
+			return h.torrentAddMagnet(filename, opt)
+		}
+		b, err = h.session.downloadTorrent(filename)
+	case h.session.config.TransmissionRPCAllowLocalFiles:
+		// Transmission reads .torrent files on the server too.
+		b, err = readTorrentFile(filename, h.session.config.MaxTorrentSize)
+	default:
+		// Do not reveal whether the file exists on the server.
+		return nil, errors.New("filename must be a magnet link or an HTTP URL")
+	}
+	if err != nil {
+		return nil, err
+	}
+	mi, err := h.session.parseMetaInfo(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	hashes := [][20]byte{mi.Info.Hash}
+	if ih, ok := hybridInfoHashV2(&mi.Info); ok {
+		hashes = append(hashes, ih)
+	}
+	if t := h.findTorrent(hashes); t != nil {
+		return h.torrentAddResult("torrent-duplicate", t), nil
+	}
+	t, err := h.session.AddTorrent(bytes.NewReader(b), opt)
+	if err != nil {
+		return nil, err
+	}
+	return h.torrentAddResult("torrent-added", t), nil
+}
+
+func (h *transmissionHandler) torrentAddMagnet(link string, opt *AddTorrentOptions) (map[string]interface{}, error) {
+	ma, err := magnet.New(filterOutControlChars(link))
+	if err != nil {
+		return nil, err
+	}
+	hashes := [][20]byte{ma.InfoHash}
+	if ma.HasV1 && ma.InfoHashV2 != [32]byte{} {
+		var ih [20]byte
+		copy(ih[:], ma.InfoHashV2[:])
+		hashes = append(hashes, ih)
+	}
+	if t := h.findTorrent(hashes); t != nil {
+		return h.torrentAddResult("torrent-duplicate", t), nil
+	}
+	t, err := h.session.AddURI(link, opt)
+	if err != nil {
+		return nil, err
+	}
+	return h.torrentAddResult("torrent-added", t), nil
+}
+
+// findTorrent returns a torrent in the Session that has one of the info hashes.
+func (h *transmissionHandler) findTorrent(hashes [][20]byte) *Torrent {
+	h.session.mTorrents.RLock()
+	defer h.session.mTorrents.RUnlock()
+	for _, ih := range hashes {
+		if torrents := h.session.torrentsByInfoHash[dht.InfoHash(ih[:])]; len(torrents) > 0 {
+			return torrents[0]
+		}
+	}
+	return nil
+}
+
+// torrentAddResult returns the response of "torrent-add".
+// Key is "torrent-added" for new torrents and "torrent-duplicate" for the torrents that are in the Session already.
+func (h *transmissionHandler) torrentAddResult(key string, t *Torrent) map[string]interface{} {
+	h.syncIDs()
+	return map[string]interface{}{
+		key: map[string]interface{}{
+			"id":         h.id(t),
+			"name":       t.Name(),
+			"hashString": t.InfoHash().String(),
+		},
+	}
+}
+
+func readTorrentFile(name string, maxSize uint) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, int64(maxSize)))
+}
+
+func isTransmissionURI(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "magnet" || u.Scheme == "http" || u.Scheme == "https"
+}
+
+func (h *transmissionHandler) torrentGet(ids json.RawMessage, fields []string) (map[string]interface{}, error) {
+	if len(fields) == 0 {
+		return nil, errors.New("no fields are requested")
+	}
+	torrents, removed, err := h.selectTorrents(ids)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]map[string]interface{}, 0, len(torrents))
+	for _, t := range torrents {
+		list = append(list, h.torrentFields(t, fields))
+	}
+	ret := map[string]interface{}{"torrents": list}
+	if removed != nil {
+		ret["removed"] = removed
+	}
+	return ret, nil
+}
+
+// torrentFields returns the requested fields of the torrent. Details of the torrent are only fetched if they are requested.
+func (h *transmissionHandler) torrentFields(t *Torrent, fields []string) map[string]interface{} {
+	st := t.Stats()
+	var peers []Peer
+	var peersFetched bool
+	getPeers := func() []Peer {
+		if !peersFetched {
+			peers = t.Peers()
+			peersFetched = true
+		}
+		return peers
+	}
+	var files []File
+	var filesFetched bool
+	getFiles := func() []File {
+		if !filesFetched {
+			files, _ = t.Files()
+			filesFetched = true
+		}
+		return files
+	}
+	sizeWhenDone := st.Bytes.Completed + st.Bytes.Incomplete
+	m := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		switch f {
+		case "id":
+			m[f] = h.id(t)
+		case "hashString":
+			m[f] = st.InfoHash.String()
+		case "name":
+			m[f] = st.Name
+		case "status":
+			m[f] = transmissionStatus(st)
+		case "error":
+			if st.Error != nil {
+				m[f] = 3 // local error
+			} else {
+				m[f] = 0
+			}
+		case "errorString":
+			if st.Error != nil {
+				m[f] = st.Error.Error()
+			} else {
+				m[f] = ""
+			}
+		case "addedDate":
+			m[f] = t.AddedAt().Unix()
+		case "downloadDir":
+			m[f] = st.DataDir
+		case "totalSize":
+			m[f] = st.Bytes.Total
+		case "sizeWhenDone":
+			m[f] = sizeWhenDone
+		case "leftUntilDone":
+			m[f] = st.Bytes.Incomplete
+		case "haveValid":
+			m[f] = st.Bytes.Completed
+		case "haveUnchecked":
+			m[f] = 0
+		case "percentDone":
+			if sizeWhenDone > 0 {
+				m[f] = float64(st.Bytes.Completed) / float64(sizeWhenDone)
+			} else {
+				m[f] = 0
+			}
+		case "metadataPercentComplete":
+			if st.Status == DownloadingMetadata || st.Pieces.Total == 0 {
+				m[f] = 0
+			} else {
+				m[f] = 1
+			}
+		case "recheckProgress":
+			if st.Status == Verifying && st.Pieces.Total > 0 {
+				m[f] = float64(st.Pieces.Checked) / float64(st.Pieces.Total)
+			} else {
+				m[f] = 0
+			}
+		case "rateDownload":
+			m[f] = st.Speed.Download
+		case "rateUpload":
+			m[f] = st.Speed.Upload
+		case "downloadedEver":
+			m[f] = st.Bytes.Downloaded
+		case "uploadedEver":
+			m[f] = st.Bytes.Uploaded
+		case "corruptEver":
+			m[f] = st.Bytes.Wasted
+		case "uploadRatio":
+			if st.Bytes.Downloaded == 0 && st.Bytes.Completed == 0 {
+				m[f] = -1 // not available
+			} else {
+				m[f] = st.SeedGoals.Ratio
+			}
+		case "eta":
+			if st.ETA != nil {
+				m[f] = int64(st.ETA.Seconds())
+			} else {
+				m[f] = -1 // not available
+			}
+		case "isPrivate":
+			m[f] = st.Private
+		case "pieceCount":
+			m[f] = st.Pieces.Total
+		case "pieceSize":
+			m[f] = st.PieceLength
+		case "queuePosition":
+			m[f] = st.QueuePosition
+		case "labels":
+			labels := st.Labels
+			if labels == nil {
+				labels = []string{}
+			}
+			m[f] = labels
+		case "magnetLink":
+			m[f], _ = t.Magnet()
+		case "downloadLimit":
+			m[f] = st.SpeedLimit.Download
+		case "downloadLimited":
+			m[f] = st.SpeedLimit.Download > 0
+		case "uploadLimit":
+			m[f] = st.SpeedLimit.Upload
+		case "uploadLimited":
+			m[f] = st.SpeedLimit.Upload > 0
+		case "seedRatioLimit":
+			m[f] = st.SeedGoals.Limits.Ratio
+		case "seedRatioMode":
+			m[f] = transmissionSeedMode(st.SeedGoals.Custom, st.SeedGoals.Limits.Ratio > 0)
+		case "seedIdleLimit":
+			m[f] = int64(st.SeedGoals.Limits.Idle / time.Minute)
+		case "seedIdleMode":
+			m[f] = transmissionSeedMode(st.SeedGoals.Custom, st.SeedGoals.Limits.Idle > 0)
+		case "secondsSeeding":
+			m[f] = int64(st.SeededFor.Seconds())
+		case "peersConnected":
+			m[f] = st.Peers.Total
+		case "peersGettingFromUs":
+			var n int
+			for _, p := range getPeers() {
+				if p.UploadSpeed > 0 {
+					n++
+				}
+			}
+			m[f] = n
+		case "peersSendingToUs":
+			var n int
+			for _, p := range getPeers() {
+				if p.DownloadSpeed > 0 {
+					n++
+				}
+			}
+			m[f] = n
+		case "peersFrom":
+			from := map[string]int{
+				"fromCache":    0,
+				"fromDht":      0,
+				"fromIncoming": 0,
+				"fromLpd":      0,
+				"fromLtep":     0,
+				"fromPex":      0,
+				"fromTracker":  0,
+			}
+			for _, p := range getPeers() {
+				switch p.Source {
+				case SourceTracker:
+					from["fromTracker"]++
+				case SourceDHT:
+					from["fromDht"]++
+				case SourcePEX:
+					from["fromPex"]++
+				case SourceIncoming:
+					from["fromIncoming"]++
+				case SourceLSD:
+					from["fromLpd"]++
+				}
+			}
+			m[f] = from
+		case "trackers", "trackerStats":
+			trackers := t.Trackers()
+			list := make([]map[string]interface{}, 0, len(trackers))
+			for i, tr := range trackers {
+				v := map[string]interface{}{
+					"id":       i,
+					"tier":     i,
+					"announce": tr.URL,
+					"scrape":   "",
+				}
+				if f == "trackerStats" {
+					var host string
+					if u, err := url.Parse(tr.URL); err == nil {
+						host = u.Host
+					}
+					var result string
+					if tr.Error != nil {
+						result = tr.Error.Error()
+					} else if tr.Warning != "" {
+						result = tr.Warning
+					} else if tr.Status == Working {
+						result = "Success"
+					}
+					v["host"] = host
+					v["lastAnnounceResult"] = result
+					v["lastAnnounceSucceeded"] = tr.Status == Working
+					v["lastAnnounceTime"] = unixOrZero(tr.LastAnnounce)
+					v["nextAnnounceTime"] = unixOrZero(tr.NextAnnounce)
+					v["lastScrapeTime"] = unixOrZero(tr.LastScrape)
+					v["seederCount"] = tr.Seeders
+					v["leecherCount"] = tr.Leechers
+					v["downloadCount"] = tr.Downloaded
+				}
+				list = append(list, v)
+			}
+			m[f] = list
+		case "webseeds":
+			webseeds := t.Webseeds()
+			urls := make([]string, 0, len(webseeds))
+			for _, ws := range webseeds {
+				urls = append(urls, ws.URL)
+			}
+			m[f] = urls
+		case "webseedsSendingToUs":
+			var n int
+			for _, ws := range t.Webseeds() {
+				if ws.DownloadSpeed > 0 {
+					n++
+				}
+			}
+			m[f] = n
+		case "files":
+			list := make([]map[string]interface{}, 0, len(getFiles()))
+			for _, file := range getFiles() {
+				list = append(list, map[string]interface{}{
+					"name":   file.Path,
+					"length": file.Length,
+				})
+			}
+			m[f] = list
+		case "fileStats":
+			list := make([]map[string]interface{}, 0, len(getFiles()))
+			for _, file := range getFiles() {
+				list = append(list, map[string]interface{}{
+					"wanted":   file.Priority != PrioritySkip,
+					"priority": transmissionPriority(file.Priority),
+				})
+			}
+			m[f] = list
+		case "wanted":
+			list := make([]int, 0, len(getFiles()))
+			for _, file := range getFiles() {
+				if file.Priority != PrioritySkip {
+					list = append(list, 1)
+				} else {
+					list = append(list, 0)
+				}
+			}
+			m[f] = list
+		case "priorities":
+			list := make([]int, 0, len(getFiles()))
+			for _, file := range getFiles() {
+				list = append(list, transmissionPriority(file.Priority))
+			}
+			m[f] = list
+		}
+	}
+	return m
+}
+
+func transmissionStatus(st Stats) int {
+	switch st.Status {
+	case Verifying:
+		return transmissionStatusCheck
+	case Allocating, DownloadingMetadata, Downloading:
+		return transmissionStatusDownload
+	case Seeding:
+		return transmissionStatusSeed
+	case Queued:
+		if st.Pieces.Total > 0 && st.Bytes.Incomplete == 0 {
+			return transmissionStatusSeedWait
+		}
+		return transmissionStatusDownloadWait
+	default:
+		return transmissionStatusStopped
+	}
+}
+
+// transmissionSeedMode returns the mode of a seeding limit: 0 for global limits, 1 for limits of the torrent and 2 for unlimited.
+func transmissionSeedMode(custom, limited bool) int {
+	switch {
+	case !limited:
+		return 2
+	case custom:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func transmissionPriority(p FilePriority) int {
+	switch p {
+	case PriorityLow:
+		return -1
+	case PriorityHigh:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func (h *transmissionHandler) sessionGet() map[string]interface{} {
+	cfg := h.session.config
+	st := h.session.Stats()
+	limits := h.session.SeedLimits()
+	peerPort := int(cfg.PortBegin)
+	if cfg.SharedPortEnabled {
+		peerPort = int(cfg.SharedPort)
+	}
+	encryption := "preferred"
+	if cfg.ForceIncomingEncryption && cfg.ForceOutgoingEncryption {
+		encryption = "required"
+	} else if cfg.DisableOutgoingEncryption {
+		encryption = "tolerated"
+	}
+	return map[string]interface{}{
+		"version":                    "Rain " + Version,
+		"rpc-version":                transmissionRPCVersion,
+		"rpc-version-minimum":        transmissionRPCVersionMinimum,
+		"session-id":                 h.sessionID,
+		"download-dir":               cfg.DataDir,
+		"incomplete-dir":             cfg.IncompleteDir,
+		"incomplete-dir-enabled":     cfg.IncompleteDir != "",
+		"peer-port":                  peerPort,
+		"dht-enabled":                cfg.DHTEnabled,
+		"pex-enabled":                cfg.PEXEnabled,
+		"lpd-enabled":                cfg.LSDEnabled,
+		"encryption":                 encryption,
+		"speed-limit-down":           cfg.SpeedLimitDownload,
+		"speed-limit-down-enabled":   cfg.SpeedLimitDownload > 0,
+		"speed-limit-up":             cfg.SpeedLimitUpload,
+		"speed-limit-up-enabled":     cfg.SpeedLimitUpload > 0,
+		"alt-speed-enabled":          st.AltSpeedLimits,
+		"alt-speed-down":             cfg.AltSpeedLimitDownload,
+		"alt-speed-up":               cfg.AltSpeedLimitUpload,
+		"alt-speed-time-enabled":     cfg.AltSpeedScheduleEnabled,
+		"download-queue-enabled":     cfg.MaxActiveDownloads > 0,
+		"download-queue-size":        cfg.MaxActiveDownloads,
+		"seed-queue-enabled":         cfg.MaxActiveSeeds > 0,
+		"seed-queue-size":            cfg.MaxActiveSeeds,
+		"seedRatioLimit":             limits.Ratio,
+		"seedRatioLimited":           limits.Ratio > 0,
+		"idle-seeding-limit":         int64(limits.Idle / time.Minute),
+		"idle-seeding-limit-enabled": limits.Idle > 0,
+		"units": map[string]interface{}{
+			"speed-units":  []string{"kB/s", "MB/s", "GB/s", "TB/s"},
+			"speed-bytes":  1024,
+			"size-units":   []string{"KiB", "MiB", "GiB", "TiB"},
+			"size-bytes":   1024,
+			"memory-units": []string{"KiB", "MiB", "GiB", "TiB"},
+			"memory-bytes": 1024,
+		},
+	}
+}
+
+// filterFields returns only the requested fields of m. All fields are returned if fields is empty.
+func filterFields(m map[string]interface{}, fields []string) map[string]interface{} {
+	if len(fields) == 0 {
+		return m
+	}
+	ret := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		if v, ok := m[f]; ok {
+			ret[f] = v
+		}
+	}
+	return ret
+}
+
+func (h *transmissionHandler) sessionStats() map[string]interface{} {
+	s := h.session
+	st := s.Stats()
+	var active, paused int
+	var downloaded, uploaded int64
+	torrents := s.ListTorrents()
+	for _, t := range torrents {
+		tst := t.Stats()
+		if tst.Status == Stopped {
+			paused++
+		} else {
+			active++
+		}
+		downloaded += tst.Bytes.Downloaded
+		uploaded += tst.Bytes.Uploaded
+	}
+	uptime := int64(st.Uptime.Seconds())
+	return map[string]interface{}{
+		"activeTorrentCount": active,
+		"pausedTorrentCount": paused,
+		"torrentCount":       len(torrents),
+		"downloadSpeed":      st.SpeedDownload,
+		"uploadSpeed":        st.SpeedUpload,
+		"current-stats": map[string]interface{}{
+			"downloadedBytes": s.metrics.SpeedDownload.Count(),
+			"uploadedBytes":   s.metrics.SpeedUpload.Count(),
+			"filesAdded":      0,
+			"sessionCount":    1,
+			"secondsActive":   uptime,
+		},
+		// Session statistics are not persisted. Totals of the existing torrents are reported instead.
+		"cumulative-stats": map[string]interface{}{
+			"downloadedBytes": downloaded,
+			"uploadedBytes":   uploaded,
+			"filesAdded":      0,
+			"sessionCount":    1,
+			"secondsActive":   uptime,
+		},
+	}
+}
@@ -0,0 +1,179 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/rain/internal/dirwatcher"
+	"github.com/mitchellh/go-homedir"
+)
+
+// Files that are modified more recently than this are skipped while scanning watched directories
+// because they may still be being written. They are processed in the next scan.
+const watchDirMinFileAge = time.Second
+
+// WatchDir is a directory that is watched for new torrents.
+// Files with ".torrent" extension are added with Session.AddTorrent.
+// Files with ".magnet" extension must contain a magnet link or a HTTP URL, they are added with Session.AddURI.
+// Processed files are renamed by appending ".added" to their names, or ".invalid" if the torrent cannot be added.
+type WatchDir struct {
+	// Directory to watch. It is created if it does not exist.
+	Dir string
+	// Options for adding the torrents. ID is ignored.
+	Options AddTorrentOptions
+	// Label is added to the torrents in addition to Options.Labels.
+	Label string
+}
+
+// options returns the options for adding a torrent from the directory.
+func (wd WatchDir) options() *AddTorrentOptions {
+	opt := wd.Options
+	opt.ID = ""
+	opt.Labels = append([]string(nil), wd.Options.Labels...)
+	if wd.Label != "" {
+		opt.Labels = append(opt.Labels, wd.Label)
+	}
+	return &opt
+}
+
+func isWatchDirFile(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".torrent" || ext == ".magnet"
+}
+
+func (s *Session) watchDirLoop(wd WatchDir) {
+	dir, err := homedir.Expand(wd.Dir)
+	if err == nil {
+		err = os.MkdirAll(dir, os.ModeDir|s.config.FilePermissions)
+	}
+	if err != nil {
+		s.watchDirError(fmt.Errorf("cannot watch directory %s: %w", wd.Dir, err))
+		return
+	}
+
+	var eventC <-chan string
+	w, err := dirwatcher.New(dir)
+	switch {
+	case err == nil:
+		defer w.Close()
+		eventC = w.C
+	case errors.Is(err, dirwatcher.ErrNotSupported):
+	default:
+		s.log.Warningf("cannot watch directory %s for changes, only polling is used: %s", dir, err)
+	}
+
+	var tickC <-chan time.Time
+	if s.config.WatchDirPollInterval > 0 {
+		ticker := time.NewTicker(s.config.WatchDirPollInterval)
+		defer ticker.Stop()
+		tickC = ticker.C
+	}
+
+	s.scanWatchDir(dir, wd)
+	for {
+		select {
+		case name, ok := <-eventC:
+			switch {
+			case !ok:
+				s.log.Warningf("stopped receiving changes of directory %s, only polling is used", dir)
+				eventC = nil
+			case name == "":
+				s.scanWatchDir(dir, wd)
+			case isWatchDirFile(name):
+				s.addWatchDirFile(filepath.Join(dir, name), wd)
+			}
+		case <-tickC:
+			s.scanWatchDir(dir, wd)
+		case <-s.closeC:
+			return
+		}
+	}
+}
+
+// scanWatchDir adds the torrents in all files of the directory.
+func (s *Session) scanWatchDir(dir string, wd WatchDir) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		s.watchDirError(fmt.Errorf("cannot read directory %s: %w", dir, err))
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() || !isWatchDirFile(e.Name()) {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if time.Since(fi.ModTime()) < watchDirMinFileAge {
+			continue
+		}
+		s.addWatchDirFile(filepath.Join(dir, e.Name()), wd)
+	}
+}
+
+// addWatchDirFile adds the torrent in the file and renames the file.
+// The file is not renamed if the torrent cannot be added because of an error in the Session, so it is tried again in the next scan.
+func (s *Session) addWatchDirFile(path string, wd WatchDir) {
+	var t *Torrent
+	var err error
+	switch filepath.Ext(path) {
+	case ".torrent":
+		var f *os.File
+		f, err = os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		if err == nil {
+			t, err = s.AddTorrent(f, wd.options())
+			f.Close()
+		}
+	case ".magnet":
+		var b []byte
+		b, err = os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		if err == nil {
+			t, err = s.AddURI(strings.TrimSpace(string(b)), wd.options())
+		}
+	}
+	suffix := ".added"
+	if err != nil {
+		s.watchDirError(fmt.Errorf("cannot add torrent from %s: %w", path, err))
+		var inputErr *InputError
+		switch {
+		case t != nil:
+			// Torrent is added but cannot be started.
+		case errors.As(err, &inputErr):
+			suffix = ".invalid"
+		default:
+			return
+		}
+	}
+	if t != nil {
+		t.torrent.log.Infof("added torrent from watched file: %s", path)
+	}
+	err = os.Rename(path, path+suffix)
+	if err != nil {
+		s.watchDirError(err)
+	}
+}
+
+func (s *Session) watchDirError(err error) {
+	s.log.Errorln(err)
+	s.mWatchDirs.Lock()
+	s.watchDirErrors++
+	s.watchDirLastError = err
+	s.mWatchDirs.Unlock()
+}
+
+func (s *Session) watchDirStats() (numErrors int, lastError error) {
+	s.mWatchDirs.Lock()
+	defer s.mWatchDirs.Unlock()
+	return s.watchDirErrors, s.watchDirLastError
+}
@@ -0,0 +1,92 @@
+package torrent
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sync"
+
+	"github.com/cenkalti/rain/internal/storage"
+	"github.com/cenkalti/rain/internal/storage/filestorage"
+	"github.com/cenkalti/rain/internal/storage/memorystorage"
+)
+
+// Storage is an interface for reading and writing the files of a torrent.
+// Files are identified by their paths in the torrent.
+// Set Config.StorageProvider to use an implementation other than the default one that saves files under DataDir.
+type Storage = storage.Storage
+
+// StorageFile is a file opened from a Storage.
+// If the file has a "Sync() error" method, it is called after the data of a moved torrent is written.
+type StorageFile = storage.File
+
+// StorageProvider returns the Storage for the torrent with the ID.
+// It is called when a torrent is added to or loaded into the Session.
+// It must return the Storage containing the same data for the same torrent ID during the life of the Session.
+type StorageProvider func(torrentID string) (Storage, error)
+
+// NewFileStorage returns a Storage that saves files under the directory on disk.
+func NewFileStorage(dir string, perm fs.FileMode) (Storage, error) {
+	return filestorage.New(dir, perm)
+}
+
+// NewMemoryStorageProvider returns a StorageProvider that keeps the data of torrents in memory.
+// Data is lost when the program exits.
+// The storage of a torrent is released when the data of the torrent is removed.
+func NewMemoryStorageProvider() StorageProvider {
+	var m sync.Mutex
+	storages := make(map[string]*providedMemoryStorage)
+	return func(torrentID string) (Storage, error) {
+		m.Lock()
+		defer m.Unlock()
+		sto, ok := storages[torrentID]
+		if !ok {
+			sto = &providedMemoryStorage{MemoryStorage: memorystorage.New()}
+			sto.release = func() {
+				m.Lock()
+				defer m.Unlock()
+				if storages[torrentID] == sto {
+					delete(storages, torrentID)
+				}
+			}
+			storages[torrentID] = sto
+		}
+		return sto, nil
+	}
+}
+
+// providedMemoryStorage removes itself from the StorageProvider that created it when the torrent data is removed.
+type providedMemoryStorage struct {
+	*memorystorage.MemoryStorage
+	release func()
+}
+
+func (s *providedMemoryStorage) RemoveAll(names []string) error {
+	err := s.MemoryStorage.RemoveAll(names)
+	s.release()
+	return err
+}
+
+// newStorage returns the storage for the torrent.
+// If dataDir is not empty, files are saved into dataDir instead of the default location in Config.DataDir.
+// If incompleteDir is not empty, files are saved into incompleteDir instead of data dir.
+func (s *Session) newStorage(torrentID, dataDir, incompleteDir string) (Storage, error) {
+	if s.config.StorageProvider != nil {
+		return s.config.StorageProvider(torrentID)
+	}
+	if incompleteDir != "" {
+		return s.newTorrentDirStorage(incompleteDir, torrentID)
+	}
+	if dataDir != "" {
+		return filestorage.New(dataDir, s.config.FilePermissions)
+	}
+	return s.newTorrentDirStorage(s.config.DataDir, torrentID)
+}
+
+// newTorrentDirStorage returns the storage under root directory for the torrent.
+// Root directory is shared by all torrents unless DataDirIncludesTorrentID is set.
+func (s *Session) newTorrentDirStorage(root, torrentID string) (Storage, error) {
+	if s.config.DataDirIncludesTorrentID {
+		return filestorage.NewTorrentDir(filepath.Join(root, torrentID), s.config.FilePermissions)
+	}
+	return filestorage.New(root, s.config.FilePermissions)
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/cenkalti/rain/internal/urldownloader"
 	"github.com/cenkalti/rain/internal/logger"
 	"github.com/cenkalti/rain/internal/metainfo"
+	"github.com/cenkalti/rain/internal/mover"
 	"github.com/cenkalti/rain/internal/mse"
 	"github.com/cenkalti/rain/internal/peer"
 	"github.com/cenkalti/rain/internal/pexlist"
@@ -30,10 +31,12 @@ import (
 	"github.com/cenkalti/rain/internal/piecepicker"
 	"github.com/cenkalti/rain/internal/piecewriter"
 	"github.com/cenkalti/rain/internal/resumer"
+	"github.com/cenkalti/rain/internal/speedlimit"
 	"github.com/cenkalti/rain/internal/storage"
 	"github.com/cenkalti/rain/internal/suspendchan"
 	"github.com/cenkalti/rain/internal/tracker"
 	"github.com/cenkalti/rain/internal/unchoker"
+	"github.com/cenkalti/rain/internal/utp"
 	"github.com/cenkalti/rain/internal/verifier"
 	"github.com/cenkalti/rain/internal/webseedsource"
 	"github.com/rcrowley/go-metrics"
@@ -48,10 +51,37 @@ type torrent struct {
 	// Identifies the torrent being downloaded.
 	infoHash [20]byte
 
+	// Truncated v2 info hash of a hybrid torrent. Peers may find the torrent with this hash, too.
+	// Zero if the torrent is not hybrid or it is not known yet because the metadata is not downloaded.
+	// Read from handshaker goroutines, hence protected by the mutex.
+	infoHashV2  [20]byte
+	sKeyHashV2  [20]byte
+	mInfoHashV2 sync.RWMutex
+
+	// Fields below are managed by the queue of the session and protected by Session.mQueue.
+	// Index of the torrent in Session.queue.
+	queuePosition int
+	// Torrent is started by the user and it is started/stopped by the queue according to the limits.
+	queued bool
+	// Torrent is started by the queue. Used for detecting the torrent that stops by itself.
+	queueStarted bool
+	// Torrent is started regardless of the queue limits.
+	forceStarted bool
+	// Used for detecting inactive torrents that do not count towards the queue limits.
+	queueBytes    int64
+	queueActiveAt time.Time
+
 	// List of addresses to announce this torrent.
 	trackers    []tracker.Tracker
 	rawTrackers [][]string
 
+	// Last scrape results keyed by tracker URL.
+	scrapes map[string]scrapeResult
+
+	// Protects trackers writing from torrent loop and reading from session scrape loop.
+	// Also protects scrapes.
+	mTrackers sync.RWMutex
+
 	// Peers added from magnet URLS with x.pe parameter.
 	fixedPeers []string
 
@@ -67,6 +97,9 @@ type torrent struct {
 	// Contains info about files in torrent. This can be nil at start for magnet downloads.
 	info *metainfo.Info
 
+	// Download priorities of files in torrent. Nil value means that all files have normal priority.
+	filePriorities []FilePriority
+
 	// Bitfield for pieces we have. It is created after we got info.
 	// Bits are set only after data is written to file.
 	bitfield *bitfield.Bitfield
@@ -116,6 +149,11 @@ type torrent struct {
 	infoDownloaders        map[*peer.Peer]*infodownloader.InfoDownloader
 	infoDownloadersSnubbed map[*peer.Peer]*infodownloader.InfoDownloader
 
+	// Piece layers of v2 torrents are downloaded from peers after metadata is downloaded.
+	pieceLayerDownloads map[string]*pieceLayerDownload
+	hashRequests        map[hashRequest]*peer.Peer
+	hashRejectedPeers   map[*peer.Peer]struct{}
+
 	pieceWriterResultC chan *piecewriter.PieceWriter
 
 	// This channel is closed once all torrent pieces are downloaded and verified.
@@ -155,6 +193,18 @@ type torrent struct {
 	notifyListenCommandC chan notifyListenCommand // NotifyListen()
 	addPeersCommandC     chan []*net.TCPAddr      // AddPeers()
 	addTrackersCommandC  chan []tracker.Tracker   // AddTrackers()
+	filesCommandC        chan filesRequest        // Files()
+	runHooksCommandC     chan EventType           // RunHooks()
+
+	setFilePrioritiesCommandC chan setFilePrioritiesRequest // SetFilePriorities()
+	newFileReaderCommandC     chan newFileReaderRequest     // NewFileReader()
+	readPieceCommandC         chan readPieceRequest         // fileReader.Read()
+	closeReaderCommandC       chan *fileReader              // fileReader.Close()
+	setDataDirCommandC        chan setDataDirRequest        // SetDataDir()
+	setSeedLimitsCommandC     chan *SeedLimits              // SetSeedLimits()
+
+	// Open file readers and the last pieces requested by them.
+	fileReaders map[*fileReader]readPieceRequest
 
 	// Trackers send announce responses to this channel.
 	addrsFromTrackers chan []*net.TCPAddr
@@ -171,11 +221,24 @@ type torrent struct {
 	// Listens for incoming peer connections.
 	acceptor *acceptor.Acceptor
 
+	// UDP socket for uTP connections. Used for both accepting and dialing.
+	// It is closed by utpAcceptor.
+	utpSocket   *utp.Socket
+	utpAcceptor *acceptor.Acceptor
+
+	// True if torrent is accepting connections from the shared port of the session.
+	acceptShared bool
+
+	// Connections accepted from the shared port are sent here after the handshake is completed.
+	incomingHandshakeC chan *incominghandshaker.IncomingHandshaker
+
 	// Special hash of info hash for encypted connection handshake.
 	sKeyHash [20]byte
 
 	// Announces the status of torrent to trackers to get peer addresses periodically.
 	announcers []*announcer.PeriodicalAnnouncer
+	// Announces the v2 info hash of hybrid torrents. They are not listed in tracker stats.
+	announcersV2 []*announcer.PeriodicalAnnouncer
 
 	// This announcer announces Stopped event to the trackers after
 	// all periodical trackers are closed.
@@ -185,6 +248,10 @@ type torrent struct {
 	dhtAnnouncer *announcer.DHTAnnouncer
 	dhtPeersC    chan []*net.TCPAddr
 
+	// True if torrent is registered to LSD for announcing on local network.
+	lsdRegistered bool
+	lsdPeersC     chan []*net.TCPAddr
+
 	// List of peers in handshake state.
 	incomingHandshakers map[*incominghandshaker.IncomingHandshaker]struct{}
 	outgoingHandshakers map[*outgoinghandshaker.OutgoingHandshaker]struct{}
@@ -211,6 +278,23 @@ type torrent struct {
 	verifierResultC   chan *verifier.Verifier
 	checkedPieces     uint32
 
+	// Directory of the torrent files if it is different than the default location in session data dir.
+	dataDir string
+
+	// If not empty, files are downloaded into this directory and moved into data dir after download completes.
+	incompleteDir string
+
+	// A worker that moves files into another directory.
+	mover          *mover.Mover
+	moverProgressC chan mover.Progress
+	moverResultC   chan *mover.Mover
+	bytesMoved     int64
+	// Data dir and storage that the files are being moved into.
+	moverDataDir string
+	moverStorage storage.Storage
+	// Set if the torrent needs to be stopped after download but files are being moved.
+	stopAfterMove bool
+
 	// Metrics
 	downloadSpeed   metrics.Meter
 	uploadSpeed     metrics.Meter
@@ -222,6 +306,22 @@ type torrent struct {
 	seedDurationUpdatedAt time.Time
 	seedDurationTicker    *time.Ticker
 
+	// Speed limits of the torrent. Chained to the limiters of the session.
+	downloadLimiter *speedlimit.Limiter
+	uploadLimiter   *speedlimit.Limiter
+
+	// Labels of the torrent and the speed limits set by Torrent.SetSpeedLimits in KB/s.
+	// They are accessed outside of the run loop, hence the mutex.
+	mLabels            sync.RWMutex
+	labels             []string
+	speedLimitDownload int64
+	speedLimitUpload   int64
+
+	// Seeding limits of the torrent. Global limits in Config are used if nil.
+	seedLimits *SeedLimits
+	// Last time that the torrent has uploaded data while seeding. Zero if the torrent is not seeding.
+	seedIdleSince time.Time
+
 	// Holds connected peer IPs so we don't dial/accept multiple connections to/from same IP.
 	connectedPeerIPs map[string]struct{}
 
@@ -237,7 +337,8 @@ type torrent struct {
 	// Used to calculate canonical peer priority (BEP 40).
 	// Initialized with value found in network interfaces.
 	// Then, updated from "yourip" field in BEP 10 extension handshake message.
-	externalIP net.IP
+	externalIP  net.IP
+	externalIP6 net.IP
 
 	ramNotifyC chan *peer.Peer
 
@@ -260,6 +361,9 @@ type torrent struct {
 	// True means that completeCmd has run before.
 	completeCmdRun bool
 
+	// True after the torrent is completed until the hooks of EventTorrentCompleted are triggered.
+	completionHooksPending bool
+
 	log logger.Logger
 }
 
@@ -271,11 +375,14 @@ func newTorrent2(
 	addedAt time.Time,
 	infoHash []byte,
 	sto storage.Storage,
+	dataDir string, // empty means default location in session data dir
+	incompleteDir string, // files are moved into data dir from this directory after download completes
 	name string, // display name
 	port int, // tcp peer port
 	trackers []tracker.Tracker,
 	fixedPeers []string,
 	info *metainfo.Info,
+	filePriorities []FilePriority,
 	bf *bitfield.Bitfield,
 	stats resumer.Stats, // initial stats from previous run
 	ws []*webseedsource.WebseedSource,
@@ -295,11 +402,15 @@ func newTorrent2(
 		addedAt:                   addedAt,
 		infoHash:                  ih,
 		trackers:                  trackers,
+		scrapes:                   make(map[string]scrapeResult),
 		fixedPeers:                fixedPeers,
 		name:                      name,
 		storage:                   sto,
+		dataDir:                   dataDir,
+		incompleteDir:             incompleteDir,
 		port:                      port,
 		info:                      info,
+		filePriorities:            filePriorities,
 		bitfield:                  bf,
 		log:                       logger.New("torrent " + id),
 		peerDisconnectedC:         make(chan *peer.Peer),
@@ -314,6 +425,9 @@ func newTorrent2(
 		peerSnubbedC:              make(chan *peer.Peer),
 		infoDownloaders:           make(map[*peer.Peer]*infodownloader.InfoDownloader),
 		infoDownloadersSnubbed:    make(map[*peer.Peer]*infodownloader.InfoDownloader),
+		pieceLayerDownloads:       make(map[string]*pieceLayerDownload),
+		hashRequests:              make(map[hashRequest]*peer.Peer),
+		hashRejectedPeers:         make(map[*peer.Peer]struct{}),
 		pieceWriterResultC:        make(chan *piecewriter.PieceWriter),
 		completeC:                 make(chan struct{}),
 		completeMetadataC:         make(chan struct{}),
@@ -323,6 +437,7 @@ func newTorrent2(
 		announceCommandC:          make(chan struct{}),
 		verifyCommandC:            make(chan struct{}),
 		statsCommandC:             make(chan statsRequest),
+		runHooksCommandC:          make(chan EventType),
 		trackersCommandC:          make(chan trackersRequest),
 		peersCommandC:             make(chan peersRequest),
 		webseedsCommandC:          make(chan webseedsRequest),
@@ -330,9 +445,18 @@ func newTorrent2(
 		notifyListenCommandC:      make(chan notifyListenCommand),
 		addPeersCommandC:          make(chan []*net.TCPAddr),
 		addTrackersCommandC:       make(chan []tracker.Tracker),
+		filesCommandC:             make(chan filesRequest),
+		setFilePrioritiesCommandC: make(chan setFilePrioritiesRequest),
+		newFileReaderCommandC:     make(chan newFileReaderRequest),
+		readPieceCommandC:         make(chan readPieceRequest),
+		closeReaderCommandC:       make(chan *fileReader),
+		setDataDirCommandC:        make(chan setDataDirRequest),
+		setSeedLimitsCommandC:     make(chan *SeedLimits),
+		fileReaders:               make(map[*fileReader]readPieceRequest),
 		addrsFromTrackers:         make(chan []*net.TCPAddr),
 		peerIDs:                   make(map[[20]byte]struct{}),
 		incomingConnC:             make(chan net.Conn),
+		incomingHandshakeC:        make(chan *incominghandshaker.IncomingHandshaker),
 		sKeyHash:                  mse.HashSKey(ih[:]),
 		infoDownloaderResultC:     make(chan *infodownloader.InfoDownloader),
 		incomingHandshakers:       make(map[*incominghandshaker.IncomingHandshaker]struct{}),
@@ -343,17 +467,23 @@ func newTorrent2(
 		allocatorResultC:          make(chan *allocator.Allocator),
 		verifierProgressC:         make(chan verifier.Progress),
 		verifierResultC:           make(chan *verifier.Verifier),
+		moverProgressC:            make(chan mover.Progress),
+		moverResultC:              make(chan *mover.Mover),
 		connectedPeerIPs:          make(map[string]struct{}),
 		bannedPeerIPs:             make(map[string]struct{}),
 		announcersStoppedC:        make(chan struct{}),
 		dhtPeersC:                 make(chan []*net.TCPAddr, 1),
+		lsdPeersC:                 make(chan []*net.TCPAddr, 1),
 		externalIP:                externalip.FirstExternalIP(),
+		externalIP6:               externalip.FirstExternalIP6(),
 		downloadSpeed:             metrics.NilMeter{},
 		uploadSpeed:               metrics.NilMeter{},
 		bytesDownloaded:           metrics.NewCounter(),
 		bytesUploaded:             metrics.NewCounter(),
 		bytesWasted:               metrics.NewCounter(),
 		seededFor:                 metrics.NewCounter(),
+		downloadLimiter:           speedlimit.New(s.downloadLimiter),
+		uploadLimiter:             speedlimit.New(s.uploadLimiter),
 		ramNotifyC:                make(chan *peer.Peer),
 		webseedClient:             &s.webseedClient,
 		webseedSources:            ws,
@@ -375,9 +505,14 @@ func newTorrent2(
 	if cfg.BlocklistEnabledForOutgoingConnections {
 		blocklistForOutgoingConns = s.blocklist
 	}
-	t.addrList = addrlist.New(cfg.MaxPeerAddresses, blocklistForOutgoingConns, port, &t.externalIP)
+	t.addrList = addrlist.New(cfg.MaxPeerAddresses, blocklistForOutgoingConns, port, &t.externalIP, &t.externalIP6)
 	if t.info != nil {
 		t.piecePool = bufferpool.New(int(t.info.PieceLength))
+		t.checkFilePriorities()
+		if ih2, ok := hybridInfoHashV2(t.info); ok {
+			t.infoHashV2 = ih2
+			t.sKeyHashV2 = mse.HashSKey(ih2[:])
+		}
 	}
 	n := t.copyPeerIDPrefix()
 	_, err := rand.Read(t.peerID[n:])
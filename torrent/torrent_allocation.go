@@ -34,6 +34,7 @@ func (t *torrent) handleAllocationDone(al *allocator.Allocator) {
 		return
 	}
 	t.pieces = pieces
+	t.updatePiecePriorities()
 
 	for pe := range t.peers {
 		pe.GenerateAndSendAllowedFastMessages(t.session.config.AllowedFastSet, t.info.NumPieces, t.infoHash, t.pieces)
@@ -43,6 +44,7 @@ func (t *torrent) handleAllocationDone(al *allocator.Allocator) {
 		panic("piece picker exists")
 	}
 	t.piecePicker = piecepicker.New(t.pieces, t.session.config.EndgameMaxDuplicateDownloads, t.webseedSources)
+	t.updatePieceDeadlines()
 
 	for pe := range t.peers {
 		pe.Bitfield = bitfield.New(t.info.NumPieces)
@@ -53,6 +55,7 @@ func (t *torrent) handleAllocationDone(al *allocator.Allocator) {
 		for i := uint32(0); i < t.bitfield.Len(); i++ {
 			t.pieces[i].Done = t.bitfield.Test(i)
 		}
+		t.servePieceReaders()
 		if t.checkCompletion() && t.stopAfterDownload {
 			t.stopAndSetStoppedOnComplete()
 			return
@@ -7,7 +7,9 @@ import (
 )
 
 func (t *torrent) handleNewTrackers(trackers []tracker.Tracker) {
+	t.mTrackers.Lock()
 	t.trackers = append(t.trackers, trackers...)
+	t.mTrackers.Unlock()
 	status := t.status()
 	if status != Stopping && status != Stopped {
 		for _, tr := range trackers {
@@ -24,14 +26,22 @@ func (t *torrent) announcerFields() tracker.Torrent {
 		BytesDownloaded: t.bytesDownloaded.Count(),
 		BytesUploaded:   t.bytesUploaded.Count(),
 	}
-	// t.bytesComplete() uses t.bitfied for calculation.
+	// t.bytesIncomplete() uses t.bitfied and t.pieces for calculation.
 	t.mBitfield.RLock()
 	if t.bitfield == nil {
 		// Some trackers don't send any peer address if don't tell we have missing bytes.
 		tr.BytesLeft = math.MaxUint32
 	} else {
-		tr.BytesLeft = t.info.Length - t.bytesComplete()
+		tr.BytesLeft = t.bytesIncomplete()
 	}
 	t.mBitfield.RUnlock()
 	return tr
 }
+
+func (t *torrent) announcerFieldsV2() tracker.Torrent {
+	tr := t.announcerFields()
+	t.mInfoHashV2.RLock()
+	tr.InfoHash = t.infoHashV2
+	t.mInfoHashV2.RUnlock()
+	return tr
+}
@@ -15,6 +15,9 @@ func (t *torrent) close() {
 	// Stop if running.
 	t.stop(errClosed)
 
+	// Files of a stopped torrent may be being moved.
+	t.stopMover()
+
 	// Maybe we are in "Stopping" state. Close "stopped" event announcer.
 	if t.stoppedEventAnnouncer != nil {
 		t.stoppedEventAnnouncer.Close()
@@ -32,6 +35,7 @@ func (t *torrent) closePeer(pe *peer.Peer) {
 	if id, ok := t.infoDownloaders[pe]; ok {
 		t.closeInfoDownloader(id)
 	}
+	t.cancelHashRequests(pe)
 	delete(t.peers, pe)
 	delete(t.incomingPeers, pe)
 	delete(t.outgoingPeers, pe)
@@ -44,6 +48,7 @@ func (t *torrent) closePeer(pe *peer.Peer) {
 	t.pexDropPeer(pe.Addr())
 	t.dialAddresses()
 	t.session.metrics.Peers.Dec(1)
+	t.publishEvent(Event{Type: EventPeerDisconnected, Peer: pe.Addr().String()})
 }
 
 func (t *torrent) closeWebseedDownloader(src *webseedsource.WebseedSource) {
@@ -95,10 +95,15 @@ func (t *torrent) Magnet() (string, error) {
 	}
 	m := magnet.Magnet{
 		InfoHash: t.infoHash,
+		HasV1:    true,
 		Name:     t.Name(),
 		Trackers: t.getTieredTrackers(),
 		Peers:    t.fixedPeers,
 	}
+	if t.info != nil && t.info.HasV2() {
+		m.InfoHashV2 = t.info.HashV2
+		m.HasV1 = t.info.HasV1()
+	}
 	return m.String(), nil
 }
 
@@ -110,10 +115,12 @@ func (t *torrent) Torrent() ([]byte, error) {
 	for i, ws := range t.webseedSources {
 		webseeds[i] = ws.URL
 	}
-	return metainfo.NewBytes(t.info.Bytes, t.getTieredTrackers(), webseeds, "")
+	return metainfo.NewBytes(t.info.Bytes, t.info.PieceLayers(), t.getTieredTrackers(), webseeds, "")
 }
 
 func (t *torrent) getTieredTrackers() [][]string {
+	t.mTrackers.RLock()
+	defer t.mTrackers.RUnlock()
 	var trackers [][]string
 	for _, tr := range t.trackers {
 		if tier, ok := tr.(*tracker.Tier); ok {
@@ -148,6 +155,14 @@ func (t *torrent) Stats() Stats {
 	return stats
 }
 
+// RunHooks triggers the hooks of the event from the run loop of the torrent.
+func (t *torrent) RunHooks(e EventType) {
+	select {
+	case t.runHooksCommandC <- e:
+	case <-t.closeC:
+	}
+}
+
 func (t *torrent) AddPeers(peers []*net.TCPAddr) {
 	select {
 	case t.addPeersCommandC <- peers:
@@ -196,6 +211,10 @@ type Tracker struct {
 	Warning      string
 	LastAnnounce time.Time
 	NextAnnounce time.Time
+	// Number of completed downloads reported by the tracker in scrape response.
+	Downloaded int
+	// Zero if the tracker has not been scraped yet.
+	LastScrape time.Time
 }
 
 type trackersRequest struct {
@@ -222,6 +241,7 @@ type Peer struct {
 	Client             string
 	Addr               net.Addr
 	Source             PeerSource
+	Transport          PeerTransport
 	ConnectedAt        time.Time
 	Downloading        bool
 	ClientInterested   bool
@@ -250,6 +270,18 @@ const (
 	SourceIncoming
 	// SourceManual indicates that the peer is added manually via AddPeer method.
 	SourceManual
+	// SourceLSD indicates that the peer is found on the local network.
+	SourceLSD
+)
+
+// PeerTransport is the protocol that is used for transferring data with a peer.
+type PeerTransport int
+
+const (
+	// TransportTCP indicates that the connection is made over TCP.
+	TransportTCP PeerTransport = iota
+	// TransportUTP indicates that the connection is made over uTorrent transport protocol.
+	TransportUTP
 )
 
 type peersRequest struct {
@@ -3,42 +3,58 @@ package torrent
 import (
 	"net"
 
+	"github.com/cenkalti/rain/internal/btconn"
 	"github.com/cenkalti/rain/internal/handshaker/incominghandshaker"
+	"github.com/cenkalti/rain/internal/peersource"
 )
 
 func (t *torrent) handleNewConnection(conn net.Conn) {
-	if len(t.incomingHandshakers)+len(t.incomingPeers) >= t.session.config.MaxPeerAccept {
-		t.log.Debugln("peer limit reached, rejecting peer", conn.RemoteAddr().String())
+	if !t.checkIncomingConnection(conn) {
 		conn.Close()
 		return
 	}
-	ip := conn.RemoteAddr().(*net.TCPAddr).IP
+	h := incominghandshaker.New(conn)
+	t.incomingHandshakers[h] = struct{}{}
+	t.connectedPeerIPs[btconn.RemoteAddr(conn).IP.String()] = struct{}{}
+	go h.Run(
+		t.getPeerID,
+		t.getSKey,
+		t.incomingHandshakerResultC,
+		t.session.config.PeerHandshakeTimeout,
+		t.session.extensions,
+		t.session.config.ForceIncomingEncryption,
+	)
+}
+
+// handleSharedConnection starts a peer from a connection that is accepted and handshaked by the session on the shared port.
+func (t *torrent) handleSharedConnection(h *incominghandshaker.IncomingHandshaker) {
+	if !t.acceptShared || !t.checkIncomingConnection(h.Conn) {
+		h.Conn.Close()
+		return
+	}
+	t.connectedPeerIPs[btconn.RemoteAddr(h.Conn).IP.String()] = struct{}{}
+	t.startPeer(h.Conn, peersource.Incoming, t.incomingPeers, h.PeerID, h.Extensions, h.Cipher)
+}
+
+// checkIncomingConnection returns false if the connection must be rejected.
+func (t *torrent) checkIncomingConnection(conn net.Conn) bool {
+	if len(t.incomingHandshakers)+len(t.incomingPeers) >= t.session.config.MaxPeerAccept {
+		t.log.Debugln("peer limit reached, rejecting peer", conn.RemoteAddr().String())
+		return false
+	}
+	ip := btconn.RemoteAddr(conn).IP
 	ipstr := ip.String()
 	if t.session.config.BlocklistEnabledForIncomingConnections && t.session.blocklist != nil && t.session.blocklist.Blocked(ip) {
 		t.log.Debugln("peer is blocked:", conn.RemoteAddr().String())
-		conn.Close()
-		return
+		return false
 	}
 	if _, ok := t.connectedPeerIPs[ipstr]; ok {
 		t.log.Debugln("received duplicate connection from same IP: ", ipstr)
-		conn.Close()
-		return
+		return false
 	}
 	if _, ok := t.bannedPeerIPs[ipstr]; ok {
 		t.log.Debugln("connection attempt from banned IP: ", ipstr)
-		conn.Close()
-		return
+		return false
 	}
-	h := incominghandshaker.New(conn)
-	t.incomingHandshakers[h] = struct{}{}
-	t.connectedPeerIPs[ipstr] = struct{}{}
-	go h.Run(
-		t.peerID,
-		t.getSKey,
-		t.checkInfoHash,
-		t.incomingHandshakerResultC,
-		t.session.config.PeerHandshakeTimeout,
-		t.session.extensions,
-		t.session.config.ForceIncomingEncryption,
-	)
+	return true
 }
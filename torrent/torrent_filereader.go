@@ -0,0 +1,304 @@
+package torrent
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/rain/internal/filesection"
+)
+
+const (
+	// Read rate is assumed to be this value until enough data is read from the reader.
+	defaultReadRate = 1 << 20
+	// Pieces covering the data that is going to be read in this duration are downloaded in advance.
+	readaheadDuration = 30 * time.Second
+	minReadahead      = 4 << 20
+	maxReadahead      = 256 << 20
+)
+
+var errReaderClosed = errors.New("file reader is closed")
+
+// fileReader reads a file in the torrent while the torrent is being downloaded.
+// Pieces near the read position are prioritized by setting deadlines on them.
+type fileReader struct {
+	torrent *torrent
+
+	// Position of the file in torrent data.
+	fileOffset  int64
+	length      int64
+	pieceLength int64
+	numPieces   uint32
+
+	pos int64
+
+	// Last piece returned from the torrent.
+	piece      filesection.Piece
+	pieceIndex uint32
+
+	// For calculating read rate.
+	readStart time.Time
+	bytesRead int64
+
+	closeC    chan struct{}
+	closeOnce sync.Once
+}
+
+type newFileReaderRequest struct {
+	Index    int
+	Response chan newFileReaderResponse
+}
+
+type newFileReaderResponse struct {
+	Reader *fileReader
+	Error  error
+}
+
+type readPieceRequest struct {
+	Reader    *fileReader
+	Index     uint32
+	Deadlines map[uint32]time.Time
+	Response  chan filesection.Piece
+}
+
+func (t *torrent) NewFileReader(index int) (io.ReadSeekCloser, error) {
+	req := newFileReaderRequest{Index: index, Response: make(chan newFileReaderResponse, 1)}
+	select {
+	case t.newFileReaderCommandC <- req:
+	case <-t.closeC:
+		return nil, errClosed
+	}
+	select {
+	case resp := <-req.Response:
+		return resp.Reader, resp.Error
+	case <-t.closeC:
+		return nil, errClosed
+	}
+}
+
+func (t *torrent) handleNewFileReader(req newFileReaderRequest) {
+	var resp newFileReaderResponse
+	defer func() { req.Response <- resp }()
+	if t.info == nil {
+		resp.Error = errors.New("torrent metadata not ready")
+		return
+	}
+	if req.Index < 0 || req.Index >= len(t.info.Files) {
+		resp.Error = newInputError(errors.New("invalid file index"))
+		return
+	}
+	if t.filePriority(req.Index) == PrioritySkip {
+		resp.Error = newInputError(errors.New("file is skipped"))
+		return
+	}
+	var offset int64
+	for i := 0; i < req.Index; i++ {
+		offset += t.info.Files[i].Length + t.info.Files[i].Padding
+	}
+	resp.Reader = &fileReader{
+		torrent:     t,
+		fileOffset:  offset,
+		length:      t.info.Files[req.Index].Length,
+		pieceLength: int64(t.info.PieceLength),
+		numPieces:   t.info.NumPieces,
+		closeC:      make(chan struct{}),
+	}
+}
+
+// Read reads from the file at the current position.
+// Read blocks until the piece at the current position is downloaded and verified.
+func (r *fileReader) Read(p []byte) (n int, err error) {
+	select {
+	case <-r.closeC:
+		return 0, errReaderClosed
+	default:
+	}
+	if r.pos >= r.length {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if r.readStart.IsZero() {
+		r.readStart = time.Now()
+	}
+	off := r.fileOffset + r.pos
+	index := uint32(off / r.pieceLength)
+	if r.piece == nil || r.pieceIndex != index {
+		r.piece = nil
+		pi, err := r.readPiece(index)
+		if err != nil {
+			return 0, err
+		}
+		r.piece = pi
+		r.pieceIndex = index
+	}
+	begin := off % r.pieceLength
+	var pieceLength int64
+	for _, sec := range r.piece {
+		pieceLength += sec.Length
+	}
+	if remaining := pieceLength - begin; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	if remaining := r.length - r.pos; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err = r.piece.ReadAt(p, begin)
+	if err != nil {
+		// Files may be closed if the torrent is stopped. Get the piece again on next read.
+		r.piece = nil
+	}
+	r.pos += int64(n)
+	r.bytesRead += int64(n)
+	return n, err
+}
+
+// readPiece waits until the piece with the index is available and returns it for reading.
+func (r *fileReader) readPiece(index uint32) (filesection.Piece, error) {
+	req := readPieceRequest{
+		Reader:    r,
+		Index:     index,
+		Deadlines: r.deadlines(),
+		Response:  make(chan filesection.Piece, 1),
+	}
+	select {
+	case r.torrent.readPieceCommandC <- req:
+	case <-r.closeC:
+		return nil, errReaderClosed
+	case <-r.torrent.closeC:
+		return nil, errClosed
+	}
+	select {
+	case pi := <-req.Response:
+		return pi, nil
+	case <-r.closeC:
+		return nil, errReaderClosed
+	case <-r.torrent.closeC:
+		return nil, errClosed
+	}
+}
+
+// readRate returns the speed of the consumer in bytes per second.
+func (r *fileReader) readRate() float64 {
+	elapsed := time.Since(r.readStart).Seconds()
+	if r.bytesRead < minReadahead || elapsed <= 0 {
+		return defaultReadRate
+	}
+	return float64(r.bytesRead) / elapsed
+}
+
+// deadlines calculates the times that the pieces after the current position are going to be needed.
+// The amount of data to read ahead grows and shrinks with the read rate.
+func (r *fileReader) deadlines() map[uint32]time.Time {
+	rate := r.readRate()
+	readahead := int64(rate * readaheadDuration.Seconds())
+	if readahead < minReadahead {
+		readahead = minReadahead
+	} else if readahead > maxReadahead {
+		readahead = maxReadahead
+	}
+	end := r.pos + readahead
+	if end > r.length {
+		end = r.length
+	}
+	begin := r.fileOffset + r.pos
+	first := uint32(begin / r.pieceLength)
+	last := uint32((r.fileOffset + end - 1) / r.pieceLength)
+	if last >= r.numPieces {
+		last = r.numPieces - 1
+	}
+	now := time.Now()
+	deadlines := make(map[uint32]time.Time, last-first+1)
+	for i := first; i <= last; i++ {
+		var distance int64
+		if pieceBegin := int64(i) * r.pieceLength; pieceBegin > begin {
+			distance = pieceBegin - begin
+		}
+		deadlines[i] = now.Add(time.Duration(float64(distance) / rate * float64(time.Second)))
+	}
+	return deadlines
+}
+
+// Seek sets the position for the next Read.
+func (r *fileReader) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = r.pos + offset
+	case io.SeekEnd:
+		pos = r.length + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if pos < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.pos = pos
+	return pos, nil
+}
+
+// Close the reader and remove the deadlines of the pieces that are requested by the reader.
+func (r *fileReader) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.closeC)
+		select {
+		case r.torrent.closeReaderCommandC <- r:
+		case <-r.torrent.closeC:
+		}
+	})
+	return nil
+}
+
+func (t *torrent) handleReadPiece(req readPieceRequest) {
+	// Deadlines of the reader are kept until the reader is closed.
+	if t.pieces != nil && t.pieces[req.Index].Done {
+		req.Response <- t.pieces[req.Index].Data
+		req.Response = nil
+	}
+	t.fileReaders[req.Reader] = req
+	t.updatePieceDeadlines()
+	t.startPieceDownloaders()
+}
+
+func (t *torrent) handleCloseReader(r *fileReader) {
+	if _, ok := t.fileReaders[r]; !ok {
+		return
+	}
+	delete(t.fileReaders, r)
+	t.updatePieceDeadlines()
+}
+
+// servePieceReaders returns the pieces to the readers waiting for them.
+// It must be called when pieces are marked as done.
+func (t *torrent) servePieceReaders() {
+	if t.pieces == nil {
+		return
+	}
+	for r, req := range t.fileReaders {
+		if req.Response != nil && t.pieces[req.Index].Done {
+			req.Response <- t.pieces[req.Index].Data
+			req.Response = nil
+			t.fileReaders[r] = req
+		}
+	}
+}
+
+// updatePieceDeadlines merges the deadlines of the open readers and sets them in piece picker.
+func (t *torrent) updatePieceDeadlines() {
+	if t.piecePicker == nil {
+		return
+	}
+	deadlines := make(map[uint32]time.Time)
+	for _, req := range t.fileReaders {
+		for i, d := range req.Deadlines {
+			if cur, ok := deadlines[i]; !ok || d.Before(cur) {
+				deadlines[i] = d
+			}
+		}
+	}
+	t.piecePicker.SetDeadlines(deadlines)
+}
@@ -0,0 +1,287 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cenkalti/rain/internal/piece"
+	"github.com/cenkalti/rain/internal/piecepicker"
+)
+
+// FilePriority determines if and in which order a file in the torrent is downloaded.
+type FilePriority int
+
+const (
+	// PrioritySkip files are not downloaded.
+	PrioritySkip = FilePriority(piece.PrioritySkip)
+	// PriorityLow files are downloaded after files with higher priority.
+	PriorityLow = FilePriority(piece.PriorityLow)
+	// PriorityNormal is the default priority of files.
+	PriorityNormal = FilePriority(piece.PriorityNormal)
+	// PriorityHigh files are downloaded before files with lower priority.
+	PriorityHigh = FilePriority(piece.PriorityHigh)
+)
+
+func (p FilePriority) String() string {
+	m := map[FilePriority]string{
+		PrioritySkip:   "skip",
+		PriorityLow:    "low",
+		PriorityNormal: "normal",
+		PriorityHigh:   "high",
+	}
+	return m[p]
+}
+
+// ParseFilePriority converts the string representation of the priority ("skip", "low", "normal" or "high") to a FilePriority.
+func ParseFilePriority(s string) (FilePriority, error) {
+	for _, p := range []FilePriority{PrioritySkip, PriorityLow, PriorityNormal, PriorityHigh} {
+		if strings.EqualFold(s, p.String()) {
+			return p, nil
+		}
+	}
+	return PriorityNormal, fmt.Errorf("invalid file priority: %q", s)
+}
+
+// File is a file in the torrent.
+type File struct {
+	// Path of the file relative to the data directory of the torrent.
+	Path string
+	// Length of the file in bytes.
+	Length int64
+	// Download priority of the file.
+	Priority FilePriority
+}
+
+type filesRequest struct {
+	Response chan []File
+}
+
+func (t *torrent) Files() []File {
+	var files []File
+	req := filesRequest{Response: make(chan []File, 1)}
+	select {
+	case t.filesCommandC <- req:
+	case <-t.closeC:
+	}
+	select {
+	case files = <-req.Response:
+	case <-t.closeC:
+	}
+	return files
+}
+
+type setFilePrioritiesRequest struct {
+	Priorities []FilePriority
+	Response   chan error
+}
+
+func (t *torrent) SetFilePriorities(priorities []FilePriority) error {
+	req := setFilePrioritiesRequest{Priorities: priorities, Response: make(chan error, 1)}
+	select {
+	case t.setFilePrioritiesCommandC <- req:
+	case <-t.closeC:
+		return errClosed
+	}
+	select {
+	case err := <-req.Response:
+		return err
+	case <-t.closeC:
+		return errClosed
+	}
+}
+
+func (t *torrent) getFiles() []File {
+	if t.info == nil {
+		return nil
+	}
+	files := make([]File, len(t.info.Files))
+	for i, f := range t.info.Files {
+		files[i] = File{
+			Path:     f.Path,
+			Length:   f.Length,
+			Priority: t.filePriority(i),
+		}
+	}
+	return files
+}
+
+func (t *torrent) filePriority(i int) FilePriority {
+	if t.filePriorities == nil {
+		return PriorityNormal
+	}
+	return t.filePriorities[i]
+}
+
+func validateFilePriorities(priorities []FilePriority, numFiles int) error {
+	if len(priorities) != numFiles {
+		return fmt.Errorf("number of file priorities (%d) does not match the number of files (%d)", len(priorities), numFiles)
+	}
+	for _, p := range priorities {
+		if p < PrioritySkip || p > PriorityHigh {
+			return fmt.Errorf("invalid file priority: %d", p)
+		}
+	}
+	return nil
+}
+
+func filePrioritiesToInts(priorities []FilePriority) []int {
+	if priorities == nil {
+		return nil
+	}
+	ret := make([]int, len(priorities))
+	for i, p := range priorities {
+		ret[i] = int(p)
+	}
+	return ret
+}
+
+func intsToFilePriorities(values []int) []FilePriority {
+	if values == nil {
+		return nil
+	}
+	ret := make([]FilePriority, len(values))
+	for i, v := range values {
+		ret[i] = FilePriority(v)
+	}
+	return ret
+}
+
+// checkFilePriorities discards file priorities that do not match the files in the torrent.
+// This may happen when priorities are given for a magnet link.
+func (t *torrent) checkFilePriorities() {
+	if t.filePriorities == nil {
+		return
+	}
+	err := validateFilePriorities(t.filePriorities, len(t.info.Files))
+	if err != nil {
+		t.log.Warningf("discarding file priorities: %s", err)
+		t.filePriorities = nil
+		err = t.session.resumer.WriteFilePriorities(t.id, nil)
+		if err != nil {
+			t.log.Errorf("cannot write file priorities to resume db: %s", err)
+		}
+	}
+}
+
+// skippedFiles returns a slice that marks the files that are not going to be downloaded.
+func (t *torrent) skippedFiles() []bool {
+	if t.filePriorities == nil {
+		return nil
+	}
+	skip := make([]bool, len(t.filePriorities))
+	for i, p := range t.filePriorities {
+		skip[i] = p == PrioritySkip
+	}
+	return skip
+}
+
+// updatePiecePriorities sets the priority of each piece to the highest priority of the files that the piece belongs to.
+func (t *torrent) updatePiecePriorities() {
+	// Announcer reads piece priorities for calculating the bytes left.
+	t.mBitfield.Lock()
+	defer t.mBitfield.Unlock()
+	if t.filePriorities == nil {
+		for i := range t.pieces {
+			t.pieces[i].Priority = piece.PriorityNormal
+		}
+		return
+	}
+	for i := range t.pieces {
+		t.pieces[i].Priority = piece.PrioritySkip
+	}
+	pieceLength := int64(t.info.PieceLength)
+	var offset int64
+	for i, f := range t.info.Files {
+		if f.Length == 0 {
+			offset += f.Padding
+			continue
+		}
+		prio := piece.Priority(t.filePriorities[i])
+		begin := offset / pieceLength
+		end := (offset + f.Length - 1) / pieceLength
+		for j := begin; j <= end; j++ {
+			if prio > t.pieces[j].Priority {
+				t.pieces[j].Priority = prio
+			}
+		}
+		offset += f.Length + f.Padding
+	}
+}
+
+// haveAllWantedPieces returns true if all pieces, except the skipped ones, are downloaded.
+func (t *torrent) haveAllWantedPieces() bool {
+	if t.filePriorities == nil {
+		return t.bitfield.All()
+	}
+	for i := range t.pieces {
+		if t.pieces[i].Priority != piece.PrioritySkip && !t.bitfield.Test(uint32(i)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *torrent) handleSetFilePriorities(req setFilePrioritiesRequest) {
+	req.Response <- t.setFilePriorities(req.Priorities)
+}
+
+func (t *torrent) setFilePriorities(priorities []FilePriority) error {
+	if t.info == nil {
+		return errors.New("torrent metadata not ready")
+	}
+	err := validateFilePriorities(priorities, len(t.info.Files))
+	if err != nil {
+		return newInputError(err)
+	}
+	err = t.session.resumer.WriteFilePriorities(t.id, filePrioritiesToInts(priorities))
+	if err != nil {
+		return err
+	}
+	t.filePriorities = make([]FilePriority, len(priorities))
+	copy(t.filePriorities, priorities)
+
+	// Priorities are applied to pieces after allocation or verification is done.
+	if t.pieces == nil || t.bitfield == nil || t.verifier != nil {
+		return nil
+	}
+	t.updatePiecePriorities()
+
+	if t.completed && !t.haveAllWantedPieces() {
+		t.log.Info("new files are selected, continuing download")
+		t.restartDownload()
+	}
+	if t.piecePicker != nil {
+		t.piecePicker.HandlePriorityChange()
+	}
+	for pe := range t.peers {
+		t.updateInterestedState(pe)
+	}
+	if t.checkCompletion() {
+		if t.stopAfterDownload {
+			t.stopAndSetStoppedOnComplete()
+		}
+		return nil
+	}
+	t.dialAddresses()
+	t.startPieceDownloaders()
+	return nil
+}
+
+// restartDownload switches the torrent from Seeding to Downloading state.
+func (t *torrent) restartDownload() {
+	t.completed = false
+	t.completeC = make(chan struct{})
+	t.piecePicker = piecepicker.New(t.pieces, t.session.config.EndgameMaxDuplicateDownloads, t.webseedSources)
+	t.updatePieceDeadlines()
+	for pe := range t.peers {
+		if pe.Bitfield == nil {
+			continue
+		}
+		for i := uint32(0); i < pe.Bitfield.Len(); i++ {
+			if pe.Bitfield.Test(i) {
+				t.piecePicker.HandleHave(pe, i)
+			}
+		}
+	}
+}
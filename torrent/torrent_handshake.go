@@ -1,10 +1,11 @@
 package torrent
 
 import (
-	"net"
-
+	"github.com/cenkalti/rain/internal/btconn"
 	"github.com/cenkalti/rain/internal/handshaker/incominghandshaker"
 	"github.com/cenkalti/rain/internal/handshaker/outgoinghandshaker"
+	"github.com/cenkalti/rain/internal/metainfo"
+	"github.com/cenkalti/rain/internal/mse"
 	"github.com/cenkalti/rain/internal/peersource"
 )
 
@@ -12,17 +13,83 @@ func (t *torrent) getSKey(sKeyHash [20]byte) []byte {
 	if sKeyHash == t.sKeyHash {
 		return t.infoHash[:]
 	}
+	t.mInfoHashV2.RLock()
+	defer t.mInfoHashV2.RUnlock()
+	if t.infoHashV2 != [20]byte{} && sKeyHash == t.sKeyHashV2 {
+		return t.infoHashV2[:]
+	}
 	return nil
 }
 
-func (t *torrent) checkInfoHash(infoHash [20]byte) bool {
-	return infoHash == t.infoHash
+func (t *torrent) getPeerID(infoHash [20]byte) ([20]byte, bool) {
+	return t.peerID, t.hasInfoHash(infoHash)
+}
+
+// hasInfoHash returns true if the torrent can be found with the info hash.
+func (t *torrent) hasInfoHash(infoHash [20]byte) bool {
+	for _, ih := range t.infoHashes() {
+		if ih == infoHash {
+			return true
+		}
+	}
+	return false
+}
+
+// infoHashes returns the info hash of the torrent and the truncated v2 info hash if the torrent is hybrid.
+// The torrent is announced and accepts peers with all of them.
+func (t *torrent) infoHashes() [][20]byte {
+	t.mInfoHashV2.RLock()
+	defer t.mInfoHashV2.RUnlock()
+	if t.infoHashV2 == [20]byte{} {
+		return [][20]byte{t.infoHash}
+	}
+	return [][20]byte{t.infoHash, t.infoHashV2}
+}
+
+// hybridInfoHashV2 returns the truncated v2 info hash if the info belongs to a hybrid torrent.
+// V2-only torrents are already identified by the truncated v2 info hash.
+func hybridInfoHashV2(info *metainfo.Info) (ih [20]byte, ok bool) {
+	if !info.HasV1() || !info.HasV2() {
+		return
+	}
+	copy(ih[:], info.HashV2[:])
+	return ih, true
+}
+
+// storeInfoHashV2 sets the truncated v2 info hash of a hybrid torrent.
+// Returns false if the hash is already set.
+func (t *torrent) storeInfoHashV2(ih [20]byte) bool {
+	t.mInfoHashV2.Lock()
+	defer t.mInfoHashV2.Unlock()
+	if t.infoHashV2 != [20]byte{} || ih == t.infoHash {
+		return false
+	}
+	t.infoHashV2 = ih
+	t.sKeyHashV2 = mse.HashSKey(ih[:])
+	return true
+}
+
+// setInfoHashV2 makes the torrent available with the truncated v2 info hash after the torrent is added to the session.
+// Torrent starts announcing the new hash if it is running.
+func (t *torrent) setInfoHashV2(ih [20]byte) {
+	if !t.storeInfoHashV2(ih) {
+		return
+	}
+	t.session.addInfoHash(t, ih)
+	if len(t.announcers) > 0 {
+		for _, an := range t.announcers {
+			t.startNewAnnouncerV2(an.Tracker)
+		}
+	}
+	if t.lsdRegistered {
+		t.session.lsd.Register(ih, t.port)
+	}
 }
 
 func (t *torrent) handleIncomingHandshakeDone(ih *incominghandshaker.IncomingHandshaker) {
 	delete(t.incomingHandshakers, ih)
 	if ih.Error != nil {
-		delete(t.connectedPeerIPs, ih.Conn.RemoteAddr().(*net.TCPAddr).IP.String())
+		delete(t.connectedPeerIPs, btconn.RemoteAddr(ih.Conn).IP.String())
 		return
 	}
 	t.startPeer(ih.Conn, peersource.Incoming, t.incomingPeers, ih.PeerID, ih.Extensions, ih.Cipher)
@@ -0,0 +1,254 @@
+package torrent
+
+import (
+	"errors"
+
+	"github.com/cenkalti/rain/internal/merkle"
+	"github.com/cenkalti/rain/internal/metainfo"
+	"github.com/cenkalti/rain/internal/peer"
+	"github.com/cenkalti/rain/internal/peerprotocol"
+)
+
+// Max number of hashes in the base layer that is requested or served in a single message.
+const maxHashesPerRequest = 512
+
+var errInvalidHashes = errors.New("invalid hashes received")
+
+// hashRequest identifies a chunk of a piece layer that is requested from a peer.
+type hashRequest struct {
+	root  string
+	index uint32
+}
+
+// pieceLayerDownload keeps the hashes of a piece layer while it is being downloaded in chunks.
+type pieceLayerDownload struct {
+	layer    []byte
+	received map[uint32]struct{}
+}
+
+// needPieceLayers returns true if pieces of the torrent cannot be verified before downloading piece layers from peers.
+// Hybrid torrents can be verified with v1 hashes, so piece layers are downloaded only for v2-only torrents.
+func (t *torrent) needPieceLayers() bool {
+	return t.info != nil && !t.info.HasV1() && len(t.info.MissingPieceLayers()) > 0
+}
+
+// startPieceLayerDownload starts downloading the piece layers of a v2-only torrent added with a magnet link.
+// Allocator is started after all piece layers are downloaded.
+func (t *torrent) startPieceLayerDownload() {
+	t.addFixedPeers()
+	t.startAcceptor()
+	t.startAnnouncers()
+	t.requestPieceLayers()
+}
+
+// requestPieceLayers sends hash requests to peers for the chunks of piece layers that are not requested yet.
+func (t *torrent) requestPieceLayers() {
+	if !t.needPieceLayers() || t.errC == nil {
+		return
+	}
+	baseLayer := uint32(merkle.Log2(int(t.info.PieceLength / merkle.BlockSize)))
+	for _, f := range t.info.Files {
+		root := string(f.PiecesRoot)
+		if f.Length <= int64(t.info.PieceLength) || t.info.PieceLayer(f.PiecesRoot) != nil {
+			continue
+		}
+		numPieces := t.info.NumFilePieces(f)
+		width := merkle.NextPowerOfTwo(numPieces)
+		length := hashRequestLength(width)
+		for index := 0; index < numPieces; index += length {
+			req := hashRequest{root: root, index: uint32(index)}
+			if _, ok := t.hashRequests[req]; ok {
+				continue
+			}
+			if d, ok := t.pieceLayerDownloads[root]; ok {
+				if _, ok = d.received[req.index]; ok {
+					continue
+				}
+			}
+			pe := t.nextHashPeer()
+			if pe == nil {
+				return
+			}
+			msg := peerprotocol.HashRequestMessage{
+				BaseLayer:   baseLayer,
+				Index:       uint32(index),
+				Length:      uint32(length),
+				ProofLayers: uint32(merkle.Log2(width) - merkle.Log2(length)),
+			}
+			copy(msg.PiecesRoot[:], f.PiecesRoot)
+			pe.SendMessage(msg)
+			t.hashRequests[req] = pe
+		}
+	}
+}
+
+// hashRequestLength returns the number of hashes requested in a single message for a piece layer with width.
+func hashRequestLength(width int) int {
+	if width > maxHashesPerRequest {
+		return maxHashesPerRequest
+	}
+	return width
+}
+
+// nextHashPeer returns the peer with the least number of pending hash requests.
+func (t *torrent) nextHashPeer() *peer.Peer {
+	pending := make(map[*peer.Peer]int)
+	for _, pe := range t.hashRequests {
+		pending[pe]++
+	}
+	var selected *peer.Peer
+	for pe := range t.peers {
+		if !pe.V2Enabled {
+			continue
+		}
+		if _, ok := t.hashRejectedPeers[pe]; ok {
+			continue
+		}
+		if selected == nil || pending[pe] < pending[selected] {
+			selected = pe
+		}
+	}
+	return selected
+}
+
+// cancelHashRequests removes the pending hash requests of the peer. They are requested from other peers later.
+func (t *torrent) cancelHashRequests(pe *peer.Peer) {
+	for req, pe2 := range t.hashRequests {
+		if pe2 == pe {
+			delete(t.hashRequests, req)
+		}
+	}
+	delete(t.hashRejectedPeers, pe)
+}
+
+func (t *torrent) handleHashRequest(pe *peer.Peer, msg peerprotocol.HashRequestMessage) {
+	hashes, ok := t.getHashes(msg)
+	if !ok {
+		pe.SendMessage(peerprotocol.HashRejectMessage{HashRequestMessage: msg})
+		return
+	}
+	pe.SendMessage(&peerprotocol.HashesMessage{HashRequestMessage: msg, Hashes: hashes})
+}
+
+// getHashes returns the requested hashes in piece layer followed by the uncle hashes.
+// Requests for the layers other than the piece layer are not supported.
+func (t *torrent) getHashes(msg peerprotocol.HashRequestMessage) ([]byte, bool) {
+	if t.info == nil || !t.info.HasV2() {
+		return nil, false
+	}
+	layer := t.info.PieceLayer(msg.PiecesRoot[:])
+	if layer == nil {
+		return nil, false
+	}
+	leavesPerPiece := int(t.info.PieceLength / merkle.BlockSize)
+	if msg.BaseLayer != uint32(merkle.Log2(leavesPerPiece)) {
+		return nil, false
+	}
+	numPieces := len(layer) / merkle.HashSize
+	width := merkle.NextPowerOfTwo(numPieces)
+	index, length := int(msg.Index), int(msg.Length)
+	if length == 0 || length > maxHashesPerRequest || length > width || length&(length-1) != 0 || index%length != 0 || index >= numPieces {
+		return nil, false
+	}
+	padHash := merkle.PadHash(leavesPerPiece)
+	proof := merkle.Proof(layer, width, padHash, index, length, int(msg.ProofLayers))
+	hashes := make([]byte, 0, (length+len(proof))*merkle.HashSize)
+	for i := index; i < index+length; i++ {
+		if i < numPieces {
+			hashes = append(hashes, layer[i*merkle.HashSize:(i+1)*merkle.HashSize]...)
+		} else {
+			hashes = append(hashes, padHash...)
+		}
+	}
+	for _, h := range proof {
+		hashes = append(hashes, h...)
+	}
+	return hashes, true
+}
+
+func (t *torrent) handleHashReject(pe *peer.Peer, msg peerprotocol.HashRejectMessage) {
+	req := hashRequest{root: string(msg.PiecesRoot[:]), index: msg.Index}
+	if t.hashRequests[req] != pe {
+		return
+	}
+	pe.Logger().Debugln("hash request rejected for index:", msg.Index)
+	delete(t.hashRequests, req)
+	t.hashRejectedPeers[pe] = struct{}{}
+	t.requestPieceLayers()
+}
+
+func (t *torrent) handleHashes(pe *peer.Peer, msg peerprotocol.HashesMessage) {
+	req := hashRequest{root: string(msg.PiecesRoot[:]), index: msg.Index}
+	if t.hashRequests[req] != pe {
+		pe.Logger().Debugln("received hashes that are not requested for index:", msg.Index)
+		return
+	}
+	delete(t.hashRequests, req)
+	err := t.gotHashes(req, msg)
+	if err != nil {
+		pe.Logger().Error(err)
+		t.closePeer(pe)
+		t.requestPieceLayers()
+		return
+	}
+	if t.needPieceLayers() {
+		t.requestPieceLayers()
+		return
+	}
+	t.log.Info("all piece layers are downloaded")
+	t.pieceLayerDownloads = make(map[string]*pieceLayerDownload)
+	t.hashRequests = make(map[hashRequest]*peer.Peer)
+	err = t.session.resumer.WritePieceLayers(t.id, t.info.PieceLayers())
+	if err != nil {
+		t.stop(err)
+		return
+	}
+	t.startAllocator()
+}
+
+// gotHashes verifies the received hashes and saves them into the piece layer.
+func (t *torrent) gotHashes(req hashRequest, msg peerprotocol.HashesMessage) error {
+	var f *metainfo.File
+	for i := range t.info.Files {
+		if string(t.info.Files[i].PiecesRoot) == req.root {
+			f = &t.info.Files[i]
+			break
+		}
+	}
+	if f == nil || t.info.PieceLayer(f.PiecesRoot) != nil {
+		return nil
+	}
+	numPieces := t.info.NumFilePieces(*f)
+	width := merkle.NextPowerOfTwo(numPieces)
+	length := hashRequestLength(width)
+	numProof := merkle.Log2(width) - merkle.Log2(length)
+	if int(msg.Length) != length || len(msg.Hashes) != (length+numProof)*merkle.HashSize {
+		return errInvalidHashes
+	}
+	hashes := msg.Hashes[:length*merkle.HashSize]
+	proof := make([][]byte, numProof)
+	for i := range proof {
+		begin := (length + i) * merkle.HashSize
+		proof[i] = msg.Hashes[begin : begin+merkle.HashSize]
+	}
+	err := merkle.Verify(f.PiecesRoot, width, hashes, int(msg.Index), proof)
+	if err != nil {
+		return errInvalidHashes
+	}
+	d, ok := t.pieceLayerDownloads[req.root]
+	if !ok {
+		d = &pieceLayerDownload{
+			layer:    make([]byte, numPieces*merkle.HashSize),
+			received: make(map[uint32]struct{}),
+		}
+		t.pieceLayerDownloads[req.root] = d
+	}
+	// Hashes after the end of the layer are padding.
+	copy(d.layer[int(msg.Index)*merkle.HashSize:], hashes)
+	d.received[msg.Index] = struct{}{}
+	if len(d.received)*length < numPieces {
+		return nil
+	}
+	delete(t.pieceLayerDownloads, req.root)
+	return t.info.SetPieceLayer(f.PiecesRoot, d.layer)
+}
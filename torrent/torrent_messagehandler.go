@@ -3,6 +3,7 @@ package torrent
 import (
 	"fmt"
 	"net"
+	"time"
 
 	"github.com/cenkalti/rain/internal/bitfield"
 	"github.com/cenkalti/rain/internal/cachedpiece"
@@ -10,6 +11,7 @@ import (
 	"github.com/cenkalti/rain/internal/peerconn/peerwriter"
 	"github.com/cenkalti/rain/internal/peerprotocol"
 	"github.com/cenkalti/rain/internal/peersource"
+	"github.com/cenkalti/rain/internal/piece"
 	"github.com/cenkalti/rain/internal/piecedownloader"
 	"github.com/cenkalti/rain/internal/piecewriter"
 	"github.com/cenkalti/rain/internal/tracker"
@@ -304,6 +306,12 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 				Length: msg.Length,
 			}})
 		}
+	case peerprotocol.HashRequestMessage:
+		t.handleHashRequest(pe, msg)
+	case peerprotocol.HashesMessage:
+		t.handleHashes(pe, msg)
+	case peerprotocol.HashRejectMessage:
+		t.handleHashReject(pe, msg)
 	case peerprotocol.PortMessage:
 		if t.session.dht != nil {
 			t.session.dht.AddNode(fmt.Sprintf("%s:%d", pe.IP(), msg.Port))
@@ -313,6 +321,9 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 		t.uploadSpeed.Mark(l)
 		t.bytesUploaded.Inc(l)
 		t.session.metrics.SpeedUpload.Mark(l)
+		if !t.seedIdleSince.IsZero() {
+			t.seedIdleSince = time.Now()
+		}
 	case peerprotocol.ExtensionHandshakeMessage:
 		pe.Logger().Debugln("extension handshake received:", msg)
 		if pe.ExtensionHandshake != nil {
@@ -321,8 +332,11 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 		}
 		pe.ExtensionHandshake = &msg
 
-		if len(msg.YourIP) == 4 {
+		switch len(msg.YourIP) {
+		case net.IPv4len:
 			t.externalIP = net.IP(msg.YourIP)
+		case net.IPv6len:
+			t.externalIP6 = net.IP(msg.YourIP)
 		}
 		if _, ok := msg.M[peerprotocol.ExtensionKeyMetadata]; ok {
 			t.startInfoDownloaders()
@@ -352,6 +366,18 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 			break
 		}
 		t.handleNewPeers(addrs, peersource.PEX)
+		addrs, err = tracker.DecodePeersCompact6([]byte(msg.Added6))
+		if err != nil {
+			t.log.Error(err)
+			break
+		}
+		t.handleNewPeers(addrs, peersource.PEX)
+		addrs, err = tracker.DecodePeersCompact6([]byte(msg.Dropped6))
+		if err != nil {
+			t.log.Error(err)
+			break
+		}
+		t.handleNewPeers(addrs, peersource.PEX)
 	default:
 		panic(fmt.Sprintf("unhandled peer message type: %T", msg))
 	}
@@ -366,7 +392,8 @@ func (t *torrent) updateInterestedState(pe *peer.Peer) {
 		for i := uint32(0); i < t.bitfield.Len(); i++ {
 			weHave := t.bitfield.Test(i)
 			peerHave := pe.Bitfield.Test(i)
-			if !weHave && peerHave {
+			skipped := t.pieces[i].Priority == piece.PrioritySkip
+			if !weHave && peerHave && !skipped {
 				interested = true
 				break
 			}
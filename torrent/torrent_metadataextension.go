@@ -3,6 +3,7 @@ package torrent
 import (
 	"bytes"
 	"crypto/sha1"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 
@@ -71,9 +72,7 @@ func (t *torrent) handleMetadataMessage(pe *peer.Peer, msg peerprotocol.Extensio
 		}
 		pe.StopSnubTimer()
 
-		hash := sha1.New()
-		_, _ = hash.Write(id.Bytes)
-		if !bytes.Equal(hash.Sum(nil), t.infoHash[:]) {
+		if !t.verifyInfo(id.Bytes) {
 			pe.Logger().Errorln("received info does not match with hash")
 			t.closePeer(id.Peer.(*peer.Peer))
 			t.startInfoDownloaders()
@@ -92,6 +91,10 @@ func (t *torrent) handleMetadataMessage(pe *peer.Peer, msg peerprotocol.Extensio
 		}
 		t.info = info
 		t.piecePool = bufferpool.New(int(info.PieceLength))
+		t.checkFilePriorities()
+		if ih2, ok := hybridInfoHashV2(info); ok {
+			t.setInfoHashV2(ih2)
+		}
 		err = t.session.resumer.WriteInfo(t.id, t.info.Bytes)
 		if err != nil {
 			t.stop(fmt.Errorf("cannot write resume info: %s", err))
@@ -101,6 +104,8 @@ func (t *torrent) handleMetadataMessage(pe *peer.Peer, msg peerprotocol.Extensio
 		case <-t.completeMetadataC:
 		default:
 			close(t.completeMetadataC)
+			t.publishEvent(Event{Type: EventMetadataReceived})
+			t.runHooks(EventMetadataReceived, nil)
 		}
 		if t.stopAfterMetadata {
 			t.stopAndSetStoppedOnMetadata()
@@ -116,6 +121,17 @@ func (t *torrent) handleMetadataMessage(pe *peer.Peer, msg peerprotocol.Extensio
 	}
 }
 
+// verifyInfo returns true if the info dictionary matches the info hash of the torrent.
+// Info hash is truncated SHA-256 hash of the info dictionary for v2 torrents.
+func (t *torrent) verifyInfo(b []byte) bool {
+	sum := sha1.Sum(b)
+	if bytes.Equal(sum[:], t.infoHash[:]) {
+		return true
+	}
+	sumV2 := sha256.Sum256(b)
+	return bytes.Equal(sumV2[:20], t.infoHash[:])
+}
+
 func (t *torrent) sendMetadataReject(pe *peer.Peer, i uint32, msgID uint8) {
 	dataMsg := peerprotocol.ExtensionMetadataMessage{
 		Type:  peerprotocol.ExtensionMetadataMessageTypeReject,
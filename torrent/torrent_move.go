@@ -0,0 +1,220 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/cenkalti/rain/internal/mover"
+	"github.com/mitchellh/go-homedir"
+)
+
+type setDataDirRequest struct {
+	Dir      string
+	Response chan error
+}
+
+func (t *torrent) SetDataDir(dir string) error {
+	req := setDataDirRequest{Dir: dir, Response: make(chan error, 1)}
+	select {
+	case t.setDataDirCommandC <- req:
+	case <-t.closeC:
+		return errClosed
+	}
+	select {
+	case err := <-req.Response:
+		return err
+	case <-t.closeC:
+		return errClosed
+	}
+}
+
+func (t *torrent) handleSetDataDir(req setDataDirRequest) {
+	req.Response <- t.setDataDir(req.Dir)
+}
+
+func (t *torrent) setDataDir(dir string) error {
+	if t.session.config.StorageProvider != nil {
+		return errors.New("torrent files are not saved on disk")
+	}
+	if dir == "" {
+		return newInputError(errors.New("empty dir"))
+	}
+	dir, err := homedir.Expand(dir)
+	if err != nil {
+		return newInputError(err)
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return newInputError(err)
+	}
+	if t.mover != nil {
+		return errors.New("files are already being moved")
+	}
+	if t.allocator != nil || t.verifier != nil {
+		return errors.New("files cannot be moved while allocating or verifying")
+	}
+	if t.incompleteDir != "" || t.info == nil {
+		// There are no files in data dir yet.
+		err = t.session.resumer.WriteDataDir(t.id, dir, t.incompleteDir)
+		if err != nil {
+			return err
+		}
+		if t.incompleteDir == "" {
+			sto, err := t.session.newStorage(t.id, dir, "")
+			if err != nil {
+				return err
+			}
+			t.storage = sto
+		}
+		t.dataDir = dir
+		return nil
+	}
+	if dir == t.storage.RootDir() {
+		// Files are in dir already.
+		return nil
+	}
+	return t.startMover(dir)
+}
+
+// startMover starts moving files into dataDir.
+// Torrent keeps seeding from the files in old location while they are being moved.
+// Writes to files are paused until the move is done.
+func (t *torrent) startMover(dataDir string) error {
+	if t.mover != nil {
+		panic("mover exists")
+	}
+	sto, err := t.session.newStorage(t.id, dataDir, "")
+	if err != nil {
+		return err
+	}
+	// Files are removed from old location after they are moved, so the directories must be separate.
+	if overlaps(t.storage.RootDir(), sto.RootDir()) {
+		return newInputError(fmt.Errorf("cannot move files from %s to %s", t.storage.RootDir(), sto.RootDir()))
+	}
+	t.log.Infof("moving files to %s", sto.RootDir())
+	for _, f := range t.files {
+		f.PauseWrites()
+	}
+	t.moverDataDir = dataDir
+	t.moverStorage = sto
+	t.bytesMoved = 0
+	t.mover = mover.New()
+	go t.mover.Run(t.storage.RootDir(), sto.RootDir(), t.fileNames(), t.session.config.FilePermissions, t.moverProgressC, t.moverResultC)
+	return nil
+}
+
+// moveCompletedFiles moves files from incomplete dir into data dir after download completes.
+func (t *torrent) moveCompletedFiles() {
+	if t.incompleteDir == "" || t.mover != nil || t.files == nil {
+		return
+	}
+	err := t.startMover(t.dataDir)
+	if err != nil {
+		t.stop(fmt.Errorf("cannot move files: %s", err))
+	}
+}
+
+func (t *torrent) handleMoverDone(mv *mover.Mover) {
+	if t.mover != mv {
+		panic("invalid mover")
+	}
+	t.mover = nil
+	sto := t.moverStorage
+	t.moverStorage = nil
+
+	fail := func(err error) {
+		t.resumeWrites()
+		if t.status() == Stopped {
+			// Files of a stopped torrent can be moved.
+			t.lastError = err
+			t.log.Error(err)
+			return
+		}
+		t.stop(err)
+	}
+	if mv.Error != nil {
+		fail(fmt.Errorf("cannot move files: %s", mv.Error))
+		return
+	}
+
+	// Files are in new data dir now. Do not look for them in old location on next start.
+	err := t.session.resumer.WriteDataDir(t.id, t.moverDataDir, "")
+	if err != nil {
+		fail(fmt.Errorf("cannot write data dir to resume db: %s", err))
+		return
+	}
+	for _, f := range t.files {
+		err = f.Reopen(sto)
+		if err != nil {
+			fail(fmt.Errorf("cannot open moved file: %s", err))
+			return
+		}
+	}
+	t.resumeWrites()
+	old := t.storage
+	t.storage = sto
+	t.dataDir = t.moverDataDir
+	t.incompleteDir = ""
+	// Copied files still exist in old location.
+	err = old.RemoveAll(t.fileNames())
+	if err != nil {
+		t.log.Errorf("cannot remove files from old location: %s", err)
+	}
+	t.log.Info("files are moved")
+
+	// Allocator is not started if the torrent is started while moving files.
+	if t.errC != nil && t.info != nil && t.pieces == nil && t.allocator == nil && t.stoppedEventAnnouncer == nil {
+		t.startAllocator()
+	}
+
+	if t.completed {
+		t.finishCompletion()
+	}
+	if t.stopAfterMove {
+		t.stopAfterMove = false
+		t.stopAndSetStoppedOnComplete()
+	}
+}
+
+// overlaps returns true if the directories are same or one of them is inside the other.
+func overlaps(dir1, dir2 string) bool {
+	return isSubDir(dir1, dir2) || isSubDir(dir2, dir1)
+}
+
+// isSubDir returns true if dir is same with parent or inside it.
+func isSubDir(parent, dir string) bool {
+	parent, err := filepath.Abs(parent)
+	if err != nil {
+		return false
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(parent, dir)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (t *torrent) resumeWrites() {
+	for _, f := range t.files {
+		f.ResumeWrites()
+	}
+}
+
+// fileNames returns the paths of the files in torrent.
+// Returns nil if torrent does not have metadata yet.
+func (t *torrent) fileNames() []string {
+	if t.info == nil {
+		return nil
+	}
+	names := make([]string, len(t.info.Files))
+	for i, f := range t.info.Files {
+		names[i] = f.Path
+	}
+	return names
+}
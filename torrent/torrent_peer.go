@@ -6,18 +6,23 @@ import (
 	"strconv"
 
 	"github.com/cenkalti/rain/internal/bitfield"
+	"github.com/cenkalti/rain/internal/btconn"
 	"github.com/cenkalti/rain/internal/handshaker/outgoinghandshaker"
 	"github.com/cenkalti/rain/internal/mse"
 	"github.com/cenkalti/rain/internal/peer"
 	"github.com/cenkalti/rain/internal/peerprotocol"
 	"github.com/cenkalti/rain/internal/peersource"
 	"github.com/cenkalti/rain/internal/resolver"
+	"github.com/cenkalti/rain/internal/speedlimit"
 )
 
 func (t *torrent) setNeedMorePeers(val bool) {
 	for _, an := range t.announcers {
 		an.NeedMorePeers(val)
 	}
+	for _, an := range t.announcersV2 {
+		an.NeedMorePeers(val)
+	}
 	if t.dhtAnnouncer != nil {
 		t.dhtAnnouncer.NeedMorePeers(val)
 	}
@@ -56,7 +61,7 @@ func (t *torrent) resolveAndAddPeer(host string, port int) {
 		}
 		cancel()
 	}()
-	ip, err := resolver.ResolveIPv4(ctx, t.session.config.DNSResolveTimeout, host)
+	ip, err := resolver.ResolveIP(ctx, t.session.config.DNSResolveTimeout, host)
 	if err != nil {
 		return
 	}
@@ -104,6 +109,11 @@ func (t *torrent) dialAddresses() {
 		if _, ok := t.connectedPeerIPs[ip]; ok {
 			continue
 		}
+		// Interface value must be nil if there is no uTP socket.
+		var utpDialer btconn.Dialer
+		if t.utpSocket != nil && !t.session.config.DisableOutgoingUTP {
+			utpDialer = t.utpSocket
+		}
 		h := outgoinghandshaker.New(addr, src)
 		t.outgoingHandshakers[h] = struct{}{}
 		t.connectedPeerIPs[ip] = struct{}{}
@@ -116,6 +126,7 @@ func (t *torrent) dialAddresses() {
 			t.session.extensions,
 			t.session.config.DisableOutgoingEncryption,
 			t.session.config.ForceOutgoingEncryption,
+			utpDialer,
 		)
 	}
 }
@@ -128,7 +139,7 @@ func (t *torrent) startPeer(
 	extensions [8]byte,
 	cipher mse.CryptoMethod,
 ) {
-	addr := conn.RemoteAddr().(*net.TCPAddr)
+	addr := btconn.RemoteAddr(conn)
 	t.pexAddPeer(addr)
 	_, ok := t.peerIDs[peerID]
 	if ok {
@@ -140,7 +151,11 @@ func (t *torrent) startPeer(
 	}
 	t.peerIDs[peerID] = struct{}{}
 
-	pe := peer.New(conn, source, peerID, extensions, cipher, t.session.config.PieceReadTimeout, t.session.config.RequestTimeout, t.session.config.MaxRequestsIn, t.session.bucketDownload, t.session.bucketUpload)
+	br := speedlimit.New(t.downloadLimiter)
+	br.SetRate(t.session.config.SpeedLimitPeerDownload * 1024)
+	bw := speedlimit.New(t.uploadLimiter)
+	bw.SetRate(t.session.config.SpeedLimitPeerUpload * 1024)
+	pe := peer.New(conn, source, peerID, extensions, cipher, t.session.config.PieceReadTimeout, t.session.config.RequestTimeout, t.session.config.MaxRequestsIn, br, bw)
 	t.peers[pe] = struct{}{}
 	peers[pe] = struct{}{}
 	if t.info != nil {
@@ -148,8 +163,12 @@ func (t *torrent) startPeer(
 	}
 	go pe.Run(t.messages, t.pieceMessagesC.SendC(), t.peerSnubbedC, t.peerDisconnectedC)
 	t.session.metrics.Peers.Inc(1)
+	t.publishEvent(Event{Type: EventPeerConnected, Peer: addr.String()})
 	t.sendFirstMessage(pe)
 	t.recentlySeen.Add(pe.Addr())
+	if pe.V2Enabled {
+		t.requestPieceLayers()
+	}
 }
 
 func (t *torrent) sendFirstMessage(p *peer.Peer) {
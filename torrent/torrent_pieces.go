@@ -16,9 +16,11 @@ func (t *torrent) writeBitfield() error {
 
 func (t *torrent) checkCompletion() bool {
 	if t.completed {
+		// Files may not be moved yet if the torrent is stopped while moving.
+		t.finishCompletion()
 		return true
 	}
-	if !t.bitfield.All() {
+	if !t.haveAllWantedPieces() {
 		return false
 	}
 	t.completed = true
@@ -42,13 +44,38 @@ func (t *torrent) checkCompletion() bool {
 	}
 	t.piecePicker = nil
 	t.updateSeedDuration(time.Now())
-	if !t.completeCmdRun && len(t.session.config.OnCompleteCmd) > 0 {
-		go t.session.runOnCompleteCmd(t)
+	t.publishEvent(Event{Type: EventTorrentCompleted})
+	t.completionHooksPending = true
+	t.finishCompletion()
+	return true
+}
+
+// finishCompletion moves files from incomplete dir and runs complete command and hooks.
+// It is called again after files are moved.
+func (t *torrent) finishCompletion() {
+	if t.mover != nil {
+		return
+	}
+	if t.incompleteDir != "" {
+		t.moveCompletedFiles()
+		return
+	}
+	t.runCompleteCmd()
+}
+
+func (t *torrent) runCompleteCmd() {
+	if !t.completionHooksPending {
+		// Torrent is checked again after it is completed.
+		return
+	}
+	t.completionHooksPending = false
+	t.runHooks(EventTorrentCompleted, nil)
+	if t.completeCmdRun {
+		return
+	}
+	if cmd := t.session.completeCmd(t.Labels()); len(cmd) > 0 {
+		// Saved to the database by the Session after the command succeeds.
 		t.completeCmdRun = true
-		err := t.session.resumer.WriteCompleteCmdRun(t.id)
-		if err != nil {
-			t.stop(err)
-		}
+		t.session.triggerCompleteCmd(cmd, t.hookPayload(EventTorrentCompleted, nil))
 	}
-	return true
 }
@@ -42,6 +42,22 @@ func (t *torrent) run() {
 			req.Response <- t.getPeers()
 		case req := <-t.webseedsCommandC:
 			req.Response <- t.getWebseeds()
+		case req := <-t.filesCommandC:
+			req.Response <- t.getFiles()
+		case e := <-t.runHooksCommandC:
+			t.runHooks(e, nil)
+		case req := <-t.setFilePrioritiesCommandC:
+			t.handleSetFilePriorities(req)
+		case req := <-t.newFileReaderCommandC:
+			t.handleNewFileReader(req)
+		case req := <-t.readPieceCommandC:
+			t.handleReadPiece(req)
+		case r := <-t.closeReaderCommandC:
+			t.handleCloseReader(r)
+		case req := <-t.setDataDirCommandC:
+			t.handleSetDataDir(req)
+		case l := <-t.setSeedLimitsCommandC:
+			t.seedLimits = l
 		case p := <-t.allocatorProgressC:
 			t.bytesAllocated = p.AllocatedSize
 		case al := <-t.allocatorResultC:
@@ -50,6 +66,10 @@ func (t *torrent) run() {
 			t.checkedPieces = p.Checked
 		case ve := <-t.verifierResultC:
 			t.handleVerificationDone(ve)
+		case p := <-t.moverProgressC:
+			t.bytesMoved = p.MovedSize
+		case mv := <-t.moverResultC:
+			t.handleMoverDone(mv)
 		case data := <-t.ramNotifyC:
 			t.startSinglePieceDownloader(data)
 		case addrs := <-t.addrsFromTrackers:
@@ -58,10 +78,17 @@ func (t *torrent) run() {
 			t.handleNewPeers(addrs, peersource.Manual)
 		case addrs := <-t.dhtPeersC:
 			t.handleNewPeers(addrs, peersource.DHT)
+		case addrs := <-t.lsdPeersC:
+			// Peers announcing the same info hash on local network must not be used for private torrents.
+			if t.info == nil || !t.info.Private {
+				t.handleNewPeers(addrs, peersource.LSD)
+			}
 		case trackers := <-t.addTrackersCommandC:
 			t.handleNewTrackers(trackers)
 		case conn := <-t.incomingConnC:
 			t.handleNewConnection(conn)
+		case h := <-t.incomingHandshakeC:
+			t.handleSharedConnection(h)
 		case res := <-t.webseedPieceResultC.ReceiveC():
 			t.handleWebseedPieceResult(res)
 		case src := <-t.webseedRetryC:
@@ -0,0 +1,155 @@
+package torrent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SeedLimitAction is the action taken on the torrent when one of its seeding limits is reached.
+type SeedLimitAction int
+
+const (
+	// SeedLimitStop stops the torrent.
+	SeedLimitStop SeedLimitAction = iota
+	// SeedLimitRemove removes the torrent from the session. Files of the torrent are kept.
+	SeedLimitRemove
+	// SeedLimitRemoveData removes the torrent from the session and deletes its files.
+	SeedLimitRemoveData
+)
+
+func (a SeedLimitAction) String() string {
+	m := map[SeedLimitAction]string{
+		SeedLimitStop:       "stop",
+		SeedLimitRemove:     "remove",
+		SeedLimitRemoveData: "remove-data",
+	}
+	return m[a]
+}
+
+// ParseSeedLimitAction converts the string representation of the action ("stop", "remove" or "remove-data") to a SeedLimitAction.
+func ParseSeedLimitAction(s string) (SeedLimitAction, error) {
+	for _, a := range []SeedLimitAction{SeedLimitStop, SeedLimitRemove, SeedLimitRemoveData} {
+		if strings.EqualFold(s, a.String()) {
+			return a, nil
+		}
+	}
+	return SeedLimitStop, fmt.Errorf("invalid seed limit action: %q", s)
+}
+
+// MarshalText implements encoding.TextMarshaler interface for saving the action in config files.
+func (a SeedLimitAction) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler interface for reading the action from config files.
+func (a *SeedLimitAction) UnmarshalText(text []byte) error {
+	var err error
+	*a, err = ParseSeedLimitAction(string(text))
+	return err
+}
+
+// SeedLimits contains the goals for seeding a torrent.
+// When any of the limits is reached, the torrent is stopped or removed depending on the action of the limit.
+// Zero value of a limit disables it.
+type SeedLimits struct {
+	// Share ratio of the torrent. See Stats.SeedGoals.Ratio for the calculation.
+	Ratio       float64
+	RatioAction SeedLimitAction
+	// Total duration of seeding.
+	Time       time.Duration
+	TimeAction SeedLimitAction
+	// Duration of seeding without uploading any data to peers.
+	Idle       time.Duration
+	IdleAction SeedLimitAction
+}
+
+// reached returns the action of the limits that are reached.
+// If more than one limit is reached, the most destructive action is returned.
+func (l SeedLimits) reached(ratio float64, seededFor, idle time.Duration) (action SeedLimitAction, ok bool) {
+	check := func(reached bool, a SeedLimitAction) {
+		if !reached {
+			return
+		}
+		if !ok || a > action {
+			action = a
+		}
+		ok = true
+	}
+	check(l.Ratio > 0 && ratio >= l.Ratio, l.RatioAction)
+	check(l.Time > 0 && seededFor >= l.Time, l.TimeAction)
+	check(l.Idle > 0 && idle >= l.Idle, l.IdleAction)
+	return
+}
+
+// getSeedLimits returns the limits that are set for the torrent, or limits of its labels, or global limits of the session if not set.
+func (t *torrent) getSeedLimits() SeedLimits {
+	if t.seedLimits != nil {
+		return *t.seedLimits
+	}
+	if l := t.session.labelSeedLimits(t.Labels()); l != nil {
+		return *l
+	}
+	return t.session.SeedLimits()
+}
+
+// shareRatio returns the ratio of uploaded bytes to downloaded bytes.
+// Size of the torrent is used instead of downloaded bytes if the torrent is added with existing data.
+func (t *torrent) shareRatio() float64 {
+	downloaded := t.bytesDownloaded.Count()
+	if downloaded == 0 && t.info != nil {
+		downloaded = t.info.Length
+	}
+	if downloaded == 0 {
+		return 0
+	}
+	return float64(t.bytesUploaded.Count()) / float64(downloaded)
+}
+
+// seedIdleDuration returns the duration that the torrent has not uploaded any data while seeding.
+func (t *torrent) seedIdleDuration(now time.Time) time.Duration {
+	if t.seedIdleSince.IsZero() {
+		return 0
+	}
+	return now.Sub(t.seedIdleSince)
+}
+
+func (t *torrent) updateSeedGoalStats(s *Stats, now time.Time) {
+	limits := t.getSeedLimits()
+	s.SeedGoals.Limits = limits
+	s.SeedGoals.Custom = t.seedLimits != nil
+	s.SeedGoals.Ratio = t.shareRatio()
+	s.SeedGoals.Idle = t.seedIdleDuration(now)
+	if limits.Ratio > 0 {
+		r := limits.Ratio - s.SeedGoals.Ratio
+		if r < 0 {
+			r = 0
+		}
+		s.SeedGoals.RatioRemaining = &r
+	}
+	if limits.Time > 0 {
+		d := limits.Time - s.SeededFor
+		if d < 0 {
+			d = 0
+		}
+		s.SeedGoals.TimeRemaining = &d
+	}
+	if limits.Idle > 0 {
+		d := limits.Idle - s.SeedGoals.Idle
+		if d < 0 {
+			d = 0
+		}
+		s.SeedGoals.IdleRemaining = &d
+	}
+	if s.Status == Seeding {
+		s.SeedGoals.Action, s.SeedGoals.Reached = limits.reached(s.SeedGoals.Ratio, s.SeededFor, s.SeedGoals.Idle)
+	}
+}
+
+// SetSeedLimits overrides the global seeding limits for the torrent. Nil value restores the global limits.
+func (t *torrent) SetSeedLimits(limits *SeedLimits) {
+	select {
+	case t.setSeedLimitsCommandC <- limits:
+	case <-t.closeC:
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/cenkalti/rain/internal/piecepicker"
 	"github.com/cenkalti/rain/internal/tracker"
 	"github.com/cenkalti/rain/internal/urldownloader"
+	"github.com/cenkalti/rain/internal/utp"
 	"github.com/cenkalti/rain/internal/verifier"
 	"github.com/cenkalti/rain/internal/webseedsource"
 	"github.com/rcrowley/go-metrics"
@@ -34,6 +35,7 @@ func (t *torrent) start() {
 	t.lastError = nil
 	t.downloadSpeed = metrics.NewMeter()
 	t.uploadSpeed = metrics.NewMeter()
+	t.publishEvent(Event{Type: EventTorrentStarted})
 
 	if t.info != nil {
 		if t.pieces != nil {
@@ -45,7 +47,8 @@ func (t *torrent) start() {
 			} else {
 				t.startVerifier()
 			}
-		} else {
+		} else if t.mover == nil {
+			// Allocator is started after files are moved.
 			t.startAllocator()
 		}
 	} else {
@@ -71,8 +74,12 @@ func (t *torrent) startAllocator() {
 	if t.allocator != nil {
 		panic("allocator exists")
 	}
+	if t.needPieceLayers() {
+		t.startPieceLayerDownload()
+		return
+	}
 	t.allocator = allocator.New()
-	go t.allocator.Run(t.info, t.storage, t.allocatorProgressC, t.allocatorResultC)
+	go t.allocator.Run(t.info, t.storage, t.skippedFiles(), t.allocatorProgressC, t.allocatorResultC)
 }
 
 func (t *torrent) addFixedPeers() {
@@ -91,6 +98,12 @@ func (t *torrent) startAnnouncers() {
 		t.dhtAnnouncer = announcer.NewDHTAnnouncer()
 		go t.dhtAnnouncer.Run(t.announceDHT, t.session.config.DHTAnnounceInterval, t.session.config.DHTMinAnnounceInterval, t.log)
 	}
+	if !t.lsdRegistered && t.session.lsd != nil && (t.info == nil || !t.info.Private) {
+		for _, ih := range t.infoHashes() {
+			t.session.lsd.Register(ih, t.port)
+		}
+		t.lsdRegistered = true
+	}
 }
 
 func (t *torrent) startNewAnnouncer(tr tracker.Tracker) {
@@ -103,16 +116,49 @@ func (t *torrent) startNewAnnouncer(tr tracker.Tracker) {
 		t.addrsFromTrackers,
 		t.log,
 	)
+	an.StatusChanged = func(st announcer.Stats) {
+		e := Event{Type: EventTrackerStatus, Tracker: tr.URL(), TrackerStatus: TrackerStatus(st.Status)}
+		if st.Error != nil {
+			e.Error = &AnnounceError{st.Error}
+		}
+		t.publishEvent(e)
+	}
 	t.announcers = append(t.announcers, an)
 	go an.Run()
+	if len(t.infoHashes()) > 1 {
+		t.startNewAnnouncerV2(tr)
+	}
+}
+
+// startNewAnnouncerV2 starts announcing the truncated v2 info hash of a hybrid torrent to the tracker.
+func (t *torrent) startNewAnnouncerV2(tr tracker.Tracker) {
+	an := announcer.NewPeriodicalAnnouncer(
+		tr,
+		t.session.config.TrackerNumWant,
+		t.session.config.TrackerMinAnnounceInterval,
+		t.announcerFieldsV2,
+		t.completeC,
+		t.addrsFromTrackers,
+		t.log,
+	)
+	t.announcersV2 = append(t.announcersV2, an)
+	go an.Run()
 }
 
 func (t *torrent) startAcceptor() {
-	if t.acceptor != nil {
+	if t.acceptor != nil || t.acceptShared {
+		return
+	}
+	if t.session.sharedAcceptor != nil {
+		// Session accepts connections on the shared port and sends them to the torrent.
+		t.acceptShared = true
+		t.utpSocket = t.session.sharedUTPSocket
+		t.portC <- t.port
 		return
 	}
+	// Listens on both IPv4 and IPv6 if the host is unspecified address and the system supports dual-stack sockets.
 	ip := net.ParseIP(t.session.config.Host)
-	listener, err := net.ListenTCP("tcp4", &net.TCPAddr{IP: ip, Port: t.port})
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: ip, Port: t.port})
 	if err != nil {
 		t.log.Warningf("cannot listen port %d: %s", t.port, err)
 	} else {
@@ -121,7 +167,25 @@ func (t *torrent) startAcceptor() {
 		t.portC <- t.port
 		t.acceptor = acceptor.New(listener, t.incomingConnC, t.log)
 		go t.acceptor.Run()
+		t.startUTPAcceptor(ip)
+	}
+}
+
+func (t *torrent) startUTPAcceptor(ip net.IP) {
+	if !t.session.config.UTPEnabled {
+		return
+	}
+	// DHT library opens its own UDP socket, so uTP connections cannot share it.
+	// uTP socket is opened on the same port number with TCP listener instead.
+	socket, err := utp.Listen("udp", (&net.UDPAddr{IP: ip, Port: t.port}).String())
+	if err != nil {
+		t.log.Warningf("cannot listen utp port %d: %s", t.port, err)
+		return
 	}
+	t.log.Info("Listening peers on utp://" + socket.Addr().String())
+	t.utpSocket = socket
+	t.utpAcceptor = acceptor.New(socket, t.incomingConnC, t.log)
+	go t.utpAcceptor.Run()
 }
 
 func (t *torrent) startInfoDownloaders() {
@@ -177,7 +241,7 @@ func (t *torrent) startPieceDownloaderForWebseed(src *webseedsource.WebseedSourc
 
 func (t *torrent) startWebseedDownloader(sp *piecepicker.WebseedDownloadSpec) {
 	t.log.Debugf("downloading pieces %d-%d from webseed %s", sp.Begin, sp.End, sp.Source.URL)
-	ud := urldownloader.New(sp.Source.URL, sp.Begin, sp.End, t.session.bucketDownload)
+	ud := urldownloader.New(sp.Source.URL, sp.Begin, sp.End, t.downloadLimiter)
 	for _, src := range t.webseedSources {
 		if src != sp.Source {
 			continue
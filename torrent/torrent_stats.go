@@ -5,6 +5,7 @@ import (
 
 	"github.com/cenkalti/rain/internal/mse"
 	"github.com/cenkalti/rain/internal/peersource"
+	"github.com/cenkalti/rain/internal/piece"
 	"github.com/cenkalti/rain/internal/stringutil"
 )
 
@@ -25,7 +26,11 @@ type Stats struct {
 		Have uint32
 		// Number of pieces that need to be downloaded. Some of them may be being downloaded.
 		// Pieces that are being downloaded may counted as missing until they are downloaded and passed hash check.
+		// Pieces of skipped files are not counted.
 		Missing uint32
+		// Number of pieces that are not skipped.
+		// Wanted = Total if no file is skipped.
+		Wanted uint32
 		// Number of unique pieces available on swarm.
 		// If this number is less then the number of total pieces, the download may never finish.
 		Available uint32
@@ -36,8 +41,10 @@ type Stats struct {
 		// Bytes that are downloaded and passed hash check.
 		Completed int64
 		// The number of bytes that is needed to complete all missing pieces.
+		// Pieces of skipped files are not counted.
 		Incomplete int64
-		// The number of total bytes of files in torrent.  Total = Completed + Incomplete
+		// The number of total bytes of files in torrent.
+		// Total = Completed + Incomplete if no file is skipped.
 		Total int64
 		// Downloaded is the number of bytes downloaded from swarm.
 		// Because some pieces may be downloaded more than once, this number may be greater than completed bytes.
@@ -48,6 +55,8 @@ type Stats struct {
 		Wasted int64
 		// Bytes allocated on storage.
 		Allocated int64
+		// Bytes moved into new data dir while Moving is true.
+		Moved int64
 	}
 	Peers struct {
 		// Number of peers that are connected, handshaked and ready to send and receive messages.
@@ -74,6 +83,8 @@ type Stats struct {
 		DHT int
 		// Peers found via peer exchange.
 		PEX int
+		// Peers found via local service discovery.
+		LSD int
 	}
 	Downloads struct {
 		// Number of active piece downloads.
@@ -93,6 +104,10 @@ type Stats struct {
 		// Number of peers that are being downloaded normally.
 		Running int
 	}
+	// Directory that torrent files are saved into. Empty if files are not saved on disk.
+	DataDir string
+	// True while files are being moved into another directory.
+	Moving bool
 	// Name can change after metadata is downloaded.
 	Name string
 	// Is private torrent?
@@ -108,12 +123,47 @@ type Stats struct {
 		// Uploaded bytes per second.
 		Upload int
 	}
+	// Speed limits of the torrent in KB/s, or the limits of its labels if not set. Zero means no limit.
+	// Global limits in Config are not reflected here.
+	SpeedLimit struct {
+		Download int64
+		Upload   int64
+	}
 	// Time remaining to complete download. nil value means infinity.
 	ETA *time.Duration
+	// Position of the torrent in queue. Torrents closer to the head of the queue are started first.
+	QueuePosition int
+	// Torrent is started regardless of the queue limits.
+	ForceStarted bool
+	// Labels of the torrent.
+	Labels []string
+	// Seeding limits of the torrent and the progress towards them.
+	SeedGoals struct {
+		// Effective limits of the torrent.
+		Limits SeedLimits
+		// True if the limits are set for this torrent, false if limits of its labels or global limits in Config are used.
+		Custom bool
+		// Uploaded bytes divided by downloaded bytes.
+		// If nothing is downloaded (torrent is added with existing files), size of the torrent is used as divisor.
+		Ratio float64
+		// Duration of seeding without uploading any data.
+		Idle time.Duration
+		// Ratio needed to reach the ratio limit. nil value means no limit.
+		RatioRemaining *float64
+		// Seeding time needed to reach the time limit. nil value means no limit.
+		TimeRemaining *time.Duration
+		// Time remaining until the idle limit is reached. nil value means no limit.
+		IdleRemaining *time.Duration
+		// True if any of the limits is reached while seeding.
+		Reached bool
+		// Action of the reached limit. Valid only if Reached is true.
+		Action SeedLimitAction
+	}
 }
 
 func (t *torrent) stats() Stats {
-	t.updateSeedDuration(time.Now())
+	now := time.Now()
+	t.updateSeedDuration(now)
 
 	var s Stats
 	s.InfoHash = t.infoHash
@@ -124,6 +174,7 @@ func (t *torrent) stats() Stats {
 	s.Addresses.Tracker = t.addrList.LenSource(peersource.Tracker)
 	s.Addresses.DHT = t.addrList.LenSource(peersource.DHT)
 	s.Addresses.PEX = t.addrList.LenSource(peersource.PEX)
+	s.Addresses.LSD = t.addrList.LenSource(peersource.LSD)
 	s.Handshakes.Incoming = len(t.incomingHandshakers)
 	s.Handshakes.Outgoing = len(t.outgoingHandshakers)
 	s.Handshakes.Total = len(t.incomingHandshakers) + len(t.outgoingHandshakers)
@@ -143,26 +194,35 @@ func (t *torrent) stats() Stats {
 	s.Bytes.Wasted = t.bytesWasted.Count()
 	s.SeededFor = time.Duration(t.seededFor.Count())
 	s.Bytes.Allocated = t.bytesAllocated
+	s.DataDir = t.storage.RootDir()
+	if t.mover != nil {
+		s.Moving = true
+		s.Bytes.Moved = t.bytesMoved
+	}
 	s.Pieces.Checked = t.checkedPieces
 	s.Speed.Download = int(t.downloadSpeed.Rate1())
 	s.Speed.Upload = int(t.uploadSpeed.Rate1())
+	s.SpeedLimit.Download = t.downloadLimiter.Rate() / 1024
+	s.SpeedLimit.Upload = t.uploadLimiter.Rate() / 1024
+	s.Labels = t.Labels()
 
 	if t.info != nil {
 		s.Bytes.Total = t.info.Length
 		s.Bytes.Completed = t.bytesComplete()
-		s.Bytes.Incomplete = s.Bytes.Total - s.Bytes.Completed
+		s.Bytes.Incomplete = t.bytesIncomplete()
 
 		s.Name = t.info.Name
 		s.Private = t.info.Private
 		s.PieceLength = t.info.PieceLength
 		s.Pieces.Total = t.info.NumPieces
+		s.Pieces.Wanted = t.wantedPieceCount()
 	} else {
 		s.Name = t.name
 	}
 	s.Name = stringutil.Printable(s.Name)
 	if t.bitfield != nil {
 		s.Pieces.Have = t.bitfield.Count()
-		s.Pieces.Missing = s.Pieces.Total - s.Pieces.Have
+		s.Pieces.Missing = t.missingPieceCount()
 	}
 	if s.Status == Downloading {
 		bps := int64(s.Speed.Download)
@@ -189,6 +249,7 @@ func (t *torrent) stats() Stats {
 			s.ETA = &eta
 		}
 	}
+	t.updateSeedGoalStats(&s, now)
 	return s
 }
 
@@ -203,6 +264,16 @@ func (t *torrent) bytesComplete() int64 {
 	if t.bitfield == nil || len(t.pieces) == 0 {
 		return 0
 	}
+	if !t.info.HasV1() {
+		// Pieces at the end of files are shorter in v2-only torrents.
+		var n int64
+		for i := range t.pieces {
+			if t.bitfield.Test(uint32(i)) {
+				n += int64(t.pieces[i].Length)
+			}
+		}
+		return n
+	}
 	n := int64(t.info.PieceLength) * int64(t.bitfield.Count())
 	if t.bitfield.Test(t.bitfield.Len() - 1) {
 		n -= int64(t.info.PieceLength)
@@ -211,21 +282,93 @@ func (t *torrent) bytesComplete() int64 {
 	return n
 }
 
+// bytesIncomplete returns the number of bytes needed to complete all pieces that are not skipped.
+func (t *torrent) bytesIncomplete() int64 {
+	if t.filePriorities == nil || len(t.pieces) == 0 {
+		return t.info.Length - t.bytesComplete()
+	}
+	var n int64
+	for i := range t.pieces {
+		pi := &t.pieces[i]
+		if pi.Priority == piece.PrioritySkip {
+			continue
+		}
+		if t.bitfield != nil && t.bitfield.Test(pi.Index) {
+			continue
+		}
+		n += int64(pi.Length)
+	}
+	return n
+}
+
+func (t *torrent) wantedPieceCount() uint32 {
+	if t.filePriorities == nil || len(t.pieces) == 0 {
+		return t.info.NumPieces
+	}
+	var n uint32
+	for i := range t.pieces {
+		if t.pieces[i].Priority != piece.PrioritySkip {
+			n++
+		}
+	}
+	return n
+}
+
+func (t *torrent) missingPieceCount() uint32 {
+	if t.filePriorities == nil || len(t.pieces) == 0 {
+		return t.bitfield.Len() - t.bitfield.Count()
+	}
+	var n uint32
+	for i := range t.pieces {
+		if t.pieces[i].Priority != piece.PrioritySkip && !t.bitfield.Test(uint32(i)) {
+			n++
+		}
+	}
+	return n
+}
+
 func (t *torrent) getTrackers() []Tracker {
-	trackers := make([]Tracker, len(t.announcers))
-	for i, an := range t.announcers {
-		st := an.Stats()
-		trackers[i] = Tracker{
-			URL:          an.Tracker.URL(),
-			Status:       TrackerStatus(st.Status),
-			Seeders:      st.Seeders,
-			Leechers:     st.Leechers,
-			Warning:      st.Warning,
-			LastAnnounce: st.LastAnnounce,
-			NextAnnounce: st.NextAnnounce,
+	t.mTrackers.RLock()
+	defer t.mTrackers.RUnlock()
+	var trackers []Tracker
+	if len(t.announcers) == 0 {
+		// Torrent is not running. Trackers are listed with the results of the last scrape.
+		trackers = make([]Tracker, len(t.trackers))
+		for i, tr := range t.trackers {
+			trackers[i] = Tracker{
+				URL:    tr.URL(),
+				Status: NotContactedYet,
+			}
 		}
-		if st.Error != nil {
-			trackers[i].Error = &AnnounceError{st.Error}
+	} else {
+		trackers = make([]Tracker, len(t.announcers))
+		for i, an := range t.announcers {
+			st := an.Stats()
+			trackers[i] = Tracker{
+				URL:          an.Tracker.URL(),
+				Status:       TrackerStatus(st.Status),
+				Seeders:      st.Seeders,
+				Leechers:     st.Leechers,
+				Warning:      st.Warning,
+				LastAnnounce: st.LastAnnounce,
+				NextAnnounce: st.NextAnnounce,
+			}
+			if st.Error != nil {
+				trackers[i].Error = &AnnounceError{st.Error}
+			}
+		}
+	}
+	for i := range trackers {
+		sr, ok := t.scrapes[trackers[i].URL]
+		if !ok {
+			continue
+		}
+		trackers[i].Downloaded = sr.Downloaded
+		trackers[i].LastScrape = sr.Time
+		// Swarm statistics in the announce response are preferred if they are more recent.
+		if sr.Time.After(trackers[i].LastAnnounce) {
+			trackers[i].Seeders = sr.Seeders
+			trackers[i].Leechers = sr.Leechers
 		}
 	}
 	return trackers
@@ -246,9 +389,20 @@ func (t *torrent) getPeers() []Peer {
 			source = SourceIncoming
 		case peersource.Manual:
 			source = SourceManual
+		case peersource.LSD:
+			source = SourceLSD
 		default:
 			panic("unhandled peer source")
 		}
+		var transport PeerTransport
+		switch pe.Transport() {
+		case "tcp":
+			transport = TransportTCP
+		case "utp":
+			transport = TransportUTP
+		default:
+			panic("unhandled peer transport")
+		}
 		p := Peer{
 			ID:                 pe.ID,
 			Client:             pe.Client(),
@@ -264,6 +418,7 @@ func (t *torrent) getPeers() []Peer {
 			EncryptedHandshake: pe.EncryptionCipher != 0,
 			EncryptedStream:    pe.EncryptionCipher == mse.RC4,
 			Source:             source,
+			Transport:          transport,
 			DownloadSpeed:      pe.DownloadSpeed(),
 			UploadSpeed:        pe.UploadSpeed(),
 		}
@@ -288,8 +443,12 @@ func (t *torrent) getWebseeds() []Webseed {
 func (t *torrent) updateSeedDuration(now time.Time) {
 	if t.status() != Seeding {
 		t.seedDurationUpdatedAt = time.Time{}
+		t.seedIdleSince = time.Time{}
 		return
 	}
+	if t.seedIdleSince.IsZero() {
+		t.seedIdleSince = now
+	}
 	if t.seedDurationUpdatedAt.IsZero() {
 		t.seedDurationUpdatedAt = now
 		return
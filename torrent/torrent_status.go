@@ -9,6 +9,7 @@ const (
 	Stopped Status = iota
 	// DownloadingMetadata indicates that the torrent is in the process of downloadin metadata.
 	// When torrent is added via magnet link, torrent has no metadata and it needs to be downloaded from peers before starting to download files.
+	// Piece layers of v2 torrents are downloaded in this state too.
 	DownloadingMetadata
 	// Allocating indicates that the torrent is in the process of creating/opening files on the disk.
 	Allocating
@@ -20,6 +21,9 @@ const (
 	Seeding
 	// Stopping the torrent. This is the status after Stop() is called. All peers are disconnected and files are closed. A stop event sent to all trackers. After trackers responded the torrent switches into Stopped state.
 	Stopping
+	// Queued indicates that the torrent is started but it is waiting in queue for other torrents to finish.
+	// Torrents are queued if any of the MaxActive limits is set in Config.
+	Queued
 )
 
 func (s Status) String() string {
@@ -31,6 +35,7 @@ func (s Status) String() string {
 		Downloading:         "Downloading",
 		Seeding:             "Seeding",
 		Stopping:            "Stopping",
+		Queued:              "Queued",
 	}
 	return m[s]
 }
@@ -47,7 +52,7 @@ func (t *torrent) status() Status {
 		return Verifying
 	case t.completed:
 		return Seeding
-	case t.info == nil:
+	case t.info == nil, t.needPieceLayers():
 		return DownloadingMetadata
 	default:
 		return Downloading
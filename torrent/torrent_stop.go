@@ -13,6 +13,11 @@ func (t *torrent) handleStopped() {
 	t.errC <- t.lastError
 	t.errC = nil
 	t.portC = nil
+	e := Event{Type: EventTorrentStopped}
+	if t.lastError != errClosed {
+		e.Error = t.lastError
+	}
+	t.publishEvent(e)
 	if t.doVerify {
 		t.bitfield = nil
 		t.start()
@@ -22,6 +27,11 @@ func (t *torrent) handleStopped() {
 }
 
 func (t *torrent) stopAndSetStoppedOnComplete() {
+	if t.mover != nil {
+		// Torrent is stopped after files are moved.
+		t.stopAfterMove = true
+		return
+	}
 	err := t.session.resumer.HandleStopAfterDownload(t.id)
 	if err != nil {
 		t.log.Errorf("cannot write status to resume db: %s", err)
@@ -45,8 +55,11 @@ func (t *torrent) stop(err error) {
 
 	t.log.Info("stopping torrent")
 	t.lastError = err
+	t.stopAfterMove = false
 	if err != nil && err != errClosed {
 		t.log.Error(err)
+		t.publishEvent(Event{Type: EventTorrentError, Error: err})
+		t.runHooks(EventTorrentError, err)
 	}
 
 	t.stopAcceptor()
@@ -64,8 +77,11 @@ func (t *torrent) stop(err error) {
 	// If the announcer goroutine is active during close it is a data race.
 	// Bug details: https://github.com/cenkalti/rain/issues/33
 	announcers := t.announcers // keep a reference to the list before nilling in order to start StopAnnouncer
+	announcersV2 := t.announcersV2
 	t.stopPeriodicalAnnouncers()
 
+	// Mover resumes paused writes on files before they are closed.
+	t.stopMover()
 	// Closing data is necessary to cancel ongoing IO operations on files.
 	t.closeData()
 	// Data must be closed before closing Allocator.
@@ -81,16 +97,30 @@ func (t *torrent) stop(err error) {
 	// Start new announcer to announce Stopped event to the trackers.
 	// The torrent enters "Stopping" state.
 	// This announcer times out in 5 seconds. After it's done the torrent is in "Stopped" status.
-	trackers := make([]tracker.Tracker, 0, len(announcers))
+	// Hybrid torrents are also announced with their v2 info hash.
+	fields := t.announcerFields()
+	fieldsV2 := fields
+	t.mInfoHashV2.RLock()
+	fieldsV2.InfoHash = t.infoHashV2
+	t.mInfoHashV2.RUnlock()
+	trackers := make([]tracker.Tracker, 0, len(announcers)+len(announcersV2))
+	torrents := make([]tracker.Torrent, 0, len(announcers)+len(announcersV2))
 	for _, an := range announcers {
 		if an.HasAnnounced {
 			trackers = append(trackers, an.Tracker)
+			torrents = append(torrents, fields)
+		}
+	}
+	for _, an := range announcersV2 {
+		if an.HasAnnounced {
+			trackers = append(trackers, an.Tracker)
+			torrents = append(torrents, fieldsV2)
 		}
 	}
 	if t.stoppedEventAnnouncer != nil {
 		panic("stopped event announcer exists")
 	}
-	t.stoppedEventAnnouncer = announcer.NewStopAnnouncer(trackers, t.announcerFields(), t.session.config.TrackerStopTimeout, t.announcersStoppedC, t.log)
+	t.stoppedEventAnnouncer = announcer.NewStopAnnouncer(trackers, torrents, t.session.config.TrackerStopTimeout, t.announcersStoppedC, t.log)
 
 	go t.stoppedEventAnnouncer.Run()
 
@@ -113,6 +143,16 @@ func (t *torrent) stopVerifier() {
 	}
 }
 
+func (t *torrent) stopMover() {
+	t.log.Debugln("stopping mover")
+	if t.mover != nil {
+		t.mover.Close()
+		t.mover = nil
+		t.moverStorage = nil
+		t.resumeWrites()
+	}
+}
+
 func (t *torrent) stopWebseedDownloads() {
 	for _, src := range t.webseedSources {
 		t.closeWebseedDownloader(src)
@@ -163,10 +203,20 @@ func (t *torrent) stopPeriodicalAnnouncers() {
 		an.Close()
 	}
 	t.announcers = nil
+	for _, an := range t.announcersV2 {
+		an.Close()
+	}
+	t.announcersV2 = nil
 	if t.dhtAnnouncer != nil {
 		t.dhtAnnouncer.Close()
 		t.dhtAnnouncer = nil
 	}
+	if t.lsdRegistered {
+		for _, ih := range t.infoHashes() {
+			t.session.lsd.Unregister(ih, t.port)
+		}
+		t.lsdRegistered = false
+	}
 }
 
 func (t *torrent) stopAcceptor() {
@@ -175,6 +225,12 @@ func (t *torrent) stopAcceptor() {
 		t.acceptor.Close()
 	}
 	t.acceptor = nil
+	if t.utpAcceptor != nil {
+		t.utpAcceptor.Close()
+	}
+	t.utpAcceptor = nil
+	t.utpSocket = nil
+	t.acceptShared = false
 }
 
 func (t *torrent) stopPeers() {
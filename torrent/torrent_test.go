@@ -1,23 +1,41 @@
 package torrent
 
 import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/cenkalti/rain/internal/logger"
+	"github.com/cenkalti/rain/internal/lsd"
+	"github.com/cenkalti/rain/internal/magnet"
+	"github.com/cenkalti/rain/internal/metainfo"
+	"github.com/cenkalti/rain/internal/resumer/boltdbresumer"
+	"github.com/cenkalti/rain/internal/storage/memorystorage"
 	"github.com/cenkalti/rain/internal/webseedsource"
+	"github.com/cenkalti/rain/rainrpc"
 	fhttp "github.com/chihaya/chihaya/frontend/http"
 	"github.com/chihaya/chihaya/middleware"
 	"github.com/chihaya/chihaya/storage"
 	_ "github.com/chihaya/chihaya/storage/memory"
 	"github.com/fortytw2/leaktest"
+	"go.etcd.io/bbolt"
 )
 
 var (
@@ -40,6 +58,7 @@ func newTestSession(t *testing.T) (*Session, func()) {
 	cfg.DataDir = tmp
 	cfg.DHTEnabled = false
 	cfg.PEXEnabled = false
+	cfg.LSDEnabled = false
 	cfg.RPCEnabled = false
 	cfg.Host = "127.0.0.1"
 	s, err := NewSession(cfg)
@@ -245,3 +264,2427 @@ func assertCompleted(t *testing.T, tor *Torrent) {
 		t.Fatal(err)
 	}
 }
+
+func TestDownloadSelectedFiles(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// Skip "data/zero.bin". Only the first and the last pieces are shared with other files.
+	opt := &AddTorrentOptions{
+		Stopped:        true,
+		FilePriorities: []FilePriority{PriorityNormal, PriorityHigh, PrioritySkip, PriorityNormal, PriorityLow, PriorityNormal},
+	}
+	tor, err := s.AddTorrent(f, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.Start()
+	tor.AddPeer(addr)
+
+	select {
+	case <-tor.torrent.NotifyComplete():
+	case err := <-tor.torrent.NotifyError():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("download did not finish")
+	}
+	stats := tor.Stats()
+	if stats.Pieces.Have != 2 {
+		t.Fatalf("unexpected number of downloaded pieces: %d", stats.Pieces.Have)
+	}
+	if stats.Bytes.Incomplete != 0 {
+		t.Fatalf("unexpected incomplete bytes: %d", stats.Bytes.Incomplete)
+	}
+	files, err := tor.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files[2].Priority != PrioritySkip {
+		t.Fatalf("unexpected priority: %s", files[2].Priority)
+	}
+	for _, name := range []string{"README", filepath.Join("data", "file1.bin"), filepath.Join("folder", "file2.txt")} {
+		cmd := exec.Command("cmp", filepath.Join(torrentDataDir, torrentName, name), filepath.Join(s.config.DataDir, tor.ID(), torrentName, name))
+		err = cmd.Run()
+		if err != nil {
+			t.Fatal(name, err)
+		}
+	}
+}
+
+func TestVerifySkippedFiles(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tor, err := s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.AddPeer(addr)
+
+	select {
+	case <-tor.torrent.NotifyComplete():
+	case err := <-tor.torrent.NotifyError():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("download did not finish")
+	}
+	err = tor.SetFilePriorities([]FilePriority{PriorityNormal, PriorityNormal, PrioritySkip, PriorityNormal, PriorityNormal, PriorityNormal})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := s.Subscribe(EventFilter{Types: []EventType{EventTorrentStopped}, TorrentID: tor.ID()})
+	defer sub.Close()
+	err = tor.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Torrent is stopped before and after verification.
+	for i := 0; i < 2; i++ {
+		select {
+		case <-sub.C:
+		case <-time.After(timeout):
+			t.Fatal("verification did not finish")
+		}
+	}
+	// Data of the skipped file is kept after verification.
+	stats := tor.Stats()
+	if stats.Pieces.Have != stats.Pieces.Total {
+		t.Fatalf("unexpected number of pieces: %d/%d", stats.Pieces.Have, stats.Pieces.Total)
+	}
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(timeout)
+	for stats = tor.Stats(); stats.Status != Seeding; stats = tor.Stats() {
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected status: %s", stats.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stats.Pieces.Wanted != 2 || stats.Pieces.Missing != 0 {
+		t.Fatalf("unexpected number of wanted pieces: %d, missing: %d", stats.Pieces.Wanted, stats.Pieces.Missing)
+	}
+}
+
+func TestFileReader(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tor, err := s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.AddPeer(addr)
+
+	// Read the last file in the torrent. It is not in the first piece.
+	r, err := tor.NewFileReader(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := os.ReadFile(filepath.Join(torrentDataDir, torrentName, "README"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, expected) {
+		t.Fatalf("unexpected content: %q", b)
+	}
+
+	// Seek to somewhere in the middle of a file spanning many pieces.
+	r2, err := tor.NewFileReader(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r2.Close()
+	n, err := r2.Seek(-100, io.SeekEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10485760-100 {
+		t.Fatalf("unexpected position: %d", n)
+	}
+	b, err = io.ReadAll(r2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, make([]byte, 100)) {
+		t.Fatalf("unexpected content: %v", b)
+	}
+}
+
+func TestStream(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tor, err := s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.AddPeer(addr)
+
+	h := &rpcHandler{session: s}
+	req := httptest.NewRequest(http.MethodGet, "/stream/"+tor.ID()+"/sample_torrent/README", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	rec := httptest.NewRecorder()
+	h.handleStream(rec, req)
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	expected, err := os.ReadFile(filepath.Join(torrentDataDir, torrentName, "README"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rec.Body.Bytes(), expected[2:6]) {
+		t.Fatalf("unexpected content: %q", rec.Body.Bytes())
+	}
+	// Content type is not sniffed from the beginning of file.
+	if ct := rec.Header().Get("Content-Type"); ct != "application/octet-stream" {
+		t.Fatalf("unexpected content type: %s", ct)
+	}
+	etag := rec.Header().Get("ETag")
+
+	// If-Range does not match, whole file is returned.
+	req = httptest.NewRequest(http.MethodGet, "/stream/"+tor.ID()+"/sample_torrent/README", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	req.Header.Set("If-Range", `"foo"`)
+	rec = httptest.NewRecorder()
+	h.handleStream(rec, req)
+	if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), expected) {
+		t.Fatalf("unexpected response: %d %q", rec.Code, rec.Body.Bytes())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/stream/"+tor.ID()+"/sample_torrent/README", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	req.Header.Set("If-Range", etag)
+	rec = httptest.NewRecorder()
+	h.handleStream(rec, req)
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodHead, "/stream/"+tor.ID()+"/sample_torrent/data/zero.bin", nil)
+	rec = httptest.NewRecorder()
+	h.handleStream(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	if rec.Header().Get("Content-Length") != "10485760" {
+		t.Fatalf("unexpected length: %s", rec.Header().Get("Content-Length"))
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/stream/"+tor.ID()+"/sample_torrent/missing", nil)
+	rec = httptest.NewRecorder()
+	h.handleStream(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+}
+
+type syncStorage struct {
+	Storage
+	synced []string
+}
+
+type syncFile struct {
+	StorageFile
+	name    string
+	storage *syncStorage
+}
+
+func (s *syncStorage) Open(name string, size int64) (StorageFile, bool, error) {
+	f, exists, err := s.Storage.Open(name, size)
+	if err != nil {
+		return nil, false, err
+	}
+	return &syncFile{StorageFile: f, name: name, storage: s}, exists, nil
+}
+
+func (f *syncFile) Sync() error {
+	f.storage.synced = append(f.storage.synced, f.name)
+	return nil
+}
+
+func TestReadDataSync(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range []string{"a", "b"} {
+		err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tw.Write([]byte("foo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := tw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sto := &syncStorage{Storage: memorystorage.New()}
+	err = readData(&buf, sto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(sto.synced, ",") != "a,b" {
+		t.Fatalf("unexpected synced files: %v", sto.synced)
+	}
+}
+
+func TestDownloadMemoryStorage(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+	cfg := DefaultConfig
+	cfg.Database = filepath.Join(tmp, "session.db")
+	cfg.DataDir = filepath.Join(tmp, "data")
+	cfg.DHTEnabled = false
+	cfg.PEXEnabled = false
+	cfg.RPCEnabled = false
+	cfg.Host = "127.0.0.1"
+	provider := NewMemoryStorageProvider()
+	cfg.StorageProvider = provider
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tor, err := s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.AddPeer(addr)
+
+	select {
+	case <-tor.torrent.NotifyComplete():
+	case err := <-tor.torrent.NotifyError():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("download did not finish")
+	}
+	if _, err = os.Stat(cfg.DataDir); !os.IsNotExist(err) {
+		t.Fatal("data must not be written to disk")
+	}
+	sto, err := provider(tor.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, exists, err := sto.Open(filepath.Join(torrentName, "README"), 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("file does not exist in storage")
+	}
+	b := make([]byte, 30)
+	_, err = sf.ReadAt(b, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := os.ReadFile(filepath.Join(torrentDataDir, torrentName, "README"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, expected) {
+		t.Fatalf("unexpected content: %q", b)
+	}
+
+	err = s.RemoveTorrent(tor.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, exists, err = sto.Open(filepath.Join(torrentName, "README"), 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("file is not removed from storage")
+	}
+	sto2, err := provider(tor.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sto2 == sto {
+		t.Fatal("storage is not released")
+	}
+}
+
+func TestDownloadIncompleteDir(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	incompleteDir, closeIncompleteDir := tempdir(t)
+	defer closeIncompleteDir()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{IncompleteDir: incompleteDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.AddPeer(addr)
+
+	select {
+	case <-tor.torrent.NotifyComplete():
+	case err := <-tor.torrent.NotifyError():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("download did not finish")
+	}
+	// Files are moved after download completes.
+	deadline := time.Now().Add(timeout)
+	for {
+		_, err = os.Stat(filepath.Join(incompleteDir, tor.ID()))
+		if os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("files are not moved")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	dir1 := filepath.Join(torrentDataDir, torrentName)
+	dir2 := filepath.Join(s.config.DataDir, tor.ID(), torrentName)
+	cmd := exec.Command("diff", "-rq", dir1, dir2)
+	err = cmd.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tor.Stats().Status != Seeding {
+		t.Fatalf("unexpected status: %s", tor.Stats().Status)
+	}
+}
+
+func TestSetDataDir(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	tor, err := s.AddURI(torrentMagnetLink+"&x.pe="+addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t, tor)
+
+	dataDir, closeDataDir := tempdir(t)
+	defer closeDataDir()
+	dataDir = filepath.Join(dataDir, "moved")
+	err = tor.SetDataDir(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(timeout)
+	for tor.Stats().Moving {
+		if time.Now().After(deadline) {
+			t.Fatal("files are not moved")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	stats := tor.Stats()
+	if stats.Status != Seeding {
+		t.Fatalf("unexpected status: %s", stats.Status)
+	}
+	if stats.DataDir != dataDir {
+		t.Fatalf("unexpected data dir: %s", stats.DataDir)
+	}
+	cmd := exec.Command("diff", "-rq", filepath.Join(torrentDataDir, torrentName), filepath.Join(dataDir, torrentName))
+	err = cmd.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(s.config.DataDir, tor.ID())); !os.IsNotExist(err) {
+		t.Fatal("old data dir is not removed")
+	}
+	spec, err := s.resumer.Read(tor.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.DataDir != dataDir {
+		t.Fatalf("unexpected data dir in resume db: %s", spec.DataDir)
+	}
+}
+
+func TestSetDataDirOverlap(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	tor, err := s.AddURI(torrentMagnetLink+"&x.pe="+addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t, tor)
+
+	dataDir := tor.Stats().DataDir
+	err = tor.SetDataDir(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tor.Stats().Moving {
+		t.Fatal("files are moved into same dir")
+	}
+	for _, dir := range []string{filepath.Join(dataDir, "sub"), filepath.Dir(dataDir)} {
+		if err = tor.SetDataDir(dir); err == nil {
+			t.Fatalf("files are moved into overlapping dir: %s", dir)
+		}
+	}
+	stats := tor.Stats()
+	if stats.Status != Seeding {
+		t.Fatalf("unexpected status: %s", stats.Status)
+	}
+	if stats.DataDir != dataDir {
+		t.Fatalf("unexpected data dir: %s", stats.DataDir)
+	}
+	cmd := exec.Command("diff", "-rq", filepath.Join(torrentDataDir, torrentName), filepath.Join(dataDir, torrentName))
+	err = cmd.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddTorrentDataPath(t *testing.T) {
+	defer leaktest.Check(t)()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	dataPath, closeDataPath := tempdir(t)
+	defer closeDataPath()
+	err := CopyDir(filepath.Join(torrentDataDir, torrentName), filepath.Join(dataPath, torrentName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{DataPath: dataPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-tor.torrent.NotifyComplete():
+	case err := <-tor.torrent.NotifyError():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("existing data is not verified")
+	}
+	stats := tor.Stats()
+	if stats.Bytes.Downloaded != 0 {
+		t.Fatalf("unexpected downloaded bytes: %d", stats.Bytes.Downloaded)
+	}
+	if stats.DataDir != dataPath {
+		t.Fatalf("unexpected data dir: %s", stats.DataDir)
+	}
+	if _, err = os.Stat(filepath.Join(s.config.DataDir, tor.ID())); !os.IsNotExist(err) {
+		t.Fatal("files must not be created in session data dir")
+	}
+	spec, err := s.resumer.Read(tor.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.DataDir != dataPath {
+		t.Fatalf("unexpected data dir in resume db: %s", spec.DataDir)
+	}
+
+	_, err = s.AddTorrent(f, &AddTorrentOptions{DataPath: filepath.Join(dataPath, "missing")})
+	var e *InputError
+	if !errors.As(err, &e) {
+		t.Fatalf("expected input error, got: %v", err)
+	}
+}
+
+func TestRemoveTorrentKeepData(t *testing.T) {
+	defer leaktest.Check(t)()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	dataPath, closeDataPath := tempdir(t)
+	defer closeDataPath()
+	err := CopyDir(filepath.Join(torrentDataDir, torrentName), filepath.Join(dataPath, torrentName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{DataPath: dataPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.RemoveTorrentWithOptions(tor.ID(), &RemoveTorrentOptions{KeepData: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.GetTorrent(tor.ID()) != nil {
+		t.Fatal("torrent is not removed")
+	}
+	cmd := exec.Command("diff", "-rq", filepath.Join(torrentDataDir, torrentName), filepath.Join(dataPath, torrentName))
+	err = cmd.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemoveTorrentSharedDataDir(t *testing.T) {
+	defer leaktest.Check(t)()
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+	cfg := DefaultConfig
+	cfg.Database = filepath.Join(tmp, "session.db")
+	cfg.DataDir = filepath.Join(tmp, "data")
+	cfg.DataDirIncludesTorrentID = false
+	cfg.DHTEnabled = false
+	cfg.PEXEnabled = false
+	cfg.LSDEnabled = false
+	cfg.RPCEnabled = false
+	cfg.Host = "127.0.0.1"
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tor, err := s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(timeout)
+	for st := tor.Stats(); st.Status == Allocating || st.Status == Stopped; st = tor.Stats() {
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected status: %s", st.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err = os.Stat(filepath.Join(cfg.DataDir, torrentName)); err != nil {
+		t.Fatal(err)
+	}
+	// Data of another torrent in the same directory.
+	other := filepath.Join(cfg.DataDir, "other", "file.bin")
+	err = os.MkdirAll(filepath.Dir(other), 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(other, []byte("foo"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.RemoveTorrent(tor.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(cfg.DataDir, torrentName)); !os.IsNotExist(err) {
+		t.Fatal("torrent data is not removed")
+	}
+	if _, err = os.Stat(other); err != nil {
+		t.Fatal(err)
+	}
+
+	// Data dir is not removed after the last torrent in it is removed.
+	err = os.RemoveAll(filepath.Dir(other))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f2.Close()
+	tor, err = s.AddTorrent(f2, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.RemoveTorrent(tor.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(cfg.DataDir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDownloadMagnetV2(t *testing.T) {
+	defer leaktest.Check(t)()
+	info, pieceLayers, err := metainfo.NewInfoBytes("", []string{filepath.Join(torrentDataDir, torrentName)}, false, 32<<10, "", metainfo.V2, logger.New("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := metainfo.NewBytes(info, pieceLayers, nil, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s1, closeSession1 := newTestSession(t)
+	defer closeSession1()
+	tor1, err := s1.AddTorrent(bytes.NewReader(b), &AddTorrentOptions{DataPath: torrentDataDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var port int
+	select {
+	case port = <-tor1.torrent.NotifyListen():
+	case err = <-tor1.torrent.NotifyError():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("seeder is not ready")
+	}
+	select {
+	case <-tor1.torrent.NotifyComplete():
+	case err = <-tor1.torrent.NotifyError():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("existing data is not verified")
+	}
+
+	s2, closeSession2 := newTestSession(t)
+	defer closeSession2()
+	link, err := tor1.Magnet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(link, "btih") {
+		t.Fatalf("v2-only magnet must not contain btih: %s", link)
+	}
+	tor2, err := s2.AddURI(link+"&x.pe=127.0.0.1:"+strconv.Itoa(port), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t, tor2)
+}
+
+func TestDownloadHybridWithV2InfoHash(t *testing.T) {
+	defer leaktest.Check(t)()
+	info, pieceLayers, err := metainfo.NewInfoBytes("", []string{filepath.Join(torrentDataDir, torrentName)}, false, 32<<10, "", metainfo.Hybrid, logger.New("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := metainfo.NewBytes(info, pieceLayers, nil, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s1, closeSession1 := newTestSession(t)
+	defer closeSession1()
+	tor1, err := s1.AddTorrent(bytes.NewReader(b), &AddTorrentOptions{DataPath: torrentDataDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var port int
+	select {
+	case port = <-tor1.torrent.NotifyListen():
+	case err = <-tor1.torrent.NotifyError():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("seeder is not ready")
+	}
+	select {
+	case <-tor1.torrent.NotifyComplete():
+	case err = <-tor1.torrent.NotifyError():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("existing data is not verified")
+	}
+
+	// Downloader knows only the v2 info hash and does the handshake with the truncated v2 info hash.
+	// Encryption makes the seeder find the torrent from the hash of SKEY, too.
+	s2, closeSession2 := newTestSession(t)
+	defer closeSession2()
+	s2.config.ForceOutgoingEncryption = true
+	m := magnet.Magnet{InfoHashV2: tor1.torrent.info.HashV2}
+	copy(m.InfoHash[:], m.InfoHashV2[:])
+	tor2, err := s2.AddURI(m.String()+"&x.pe=127.0.0.1:"+strconv.Itoa(port), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tor2.InfoHash() == tor1.InfoHash() {
+		t.Fatal("downloader must use the v2 info hash")
+	}
+	assertCompleted(t, tor2)
+}
+
+func TestDownloadIPv6(t *testing.T) {
+	defer leaktest.Check(t)()
+	s1, closeSession1 := newTestSession(t)
+	defer closeSession1()
+	s1.config.Host = "::1"
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor1, err := s1.AddTorrent(f, &AddTorrentOptions{DataPath: torrentDataDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var port int
+	select {
+	case port = <-tor1.torrent.NotifyListen():
+	case err = <-tor1.torrent.NotifyError():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("seeder is not ready")
+	}
+
+	s2, closeSession2 := newTestSession(t)
+	defer closeSession2()
+	tor2, err := s2.AddURI(torrentMagnetLink+"&x.pe=[::1]:"+strconv.Itoa(port), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t, tor2)
+}
+
+func TestDownloadUTP(t *testing.T) {
+	defer leaktest.Check(t)()
+	s1, closeSession1 := newTestSession(t)
+	defer closeSession1()
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor1, err := s1.AddTorrent(f, &AddTorrentOptions{DataPath: torrentDataDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var port int
+	select {
+	case port = <-tor1.torrent.NotifyListen():
+	case err = <-tor1.torrent.NotifyError():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("seeder is not ready")
+	}
+
+	s2, closeSession2 := newTestSession(t)
+	defer closeSession2()
+	tor2, err := s2.AddURI(torrentMagnetLink+"&x.pe=127.0.0.1:"+strconv.Itoa(port), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Seeder closes the connection after the download is completed, so peers are checked while downloading.
+	transportC := make(chan PeerTransport, 1)
+	go func() {
+		for {
+			select {
+			case <-tor2.NotifyComplete():
+				close(transportC)
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			if peers := tor1.Peers(); len(peers) > 0 {
+				transportC <- peers[0].Transport
+				return
+			}
+		}
+	}()
+	assertCompleted(t, tor2)
+	if tr, ok := <-transportC; !ok || tr != TransportUTP {
+		t.Fatalf("peer is not connected with uTP: %v", tr)
+	}
+}
+
+// enableLSD starts local service discovery on a session created with newTestSession.
+// Must be called before adding torrents.
+func enableLSD(t *testing.T, s *Session) {
+	var err error
+	s.lsd, err = lsd.New()
+	if err != nil {
+		t.Skip("multicast is not available:", err)
+	}
+	go s.processLSDResults()
+}
+
+func TestDownloadLSD(t *testing.T) {
+	s1, closeSession1 := newTestSession(t)
+	defer closeSession1()
+	enableLSD(t, s1)
+	// Announces are received from the address of network interface, not from loopback.
+	s1.config.Host = ""
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor1, err := s1.AddTorrent(f, &AddTorrentOptions{DataPath: torrentDataDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-tor1.torrent.NotifyListen():
+	case err = <-tor1.torrent.NotifyError():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("seeder is not ready")
+	}
+
+	s2, closeSession2 := newTestSession(t)
+	defer closeSession2()
+	enableLSD(t, s2)
+	tor2, err := s2.AddURI(torrentMagnetLink, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t, tor2)
+}
+
+func TestDownloadSharedPort(t *testing.T) {
+	s1, closeSession1 := newTestSession(t)
+	defer closeSession1()
+	s1.config.SharedPortEnabled = true
+	s1.config.SharedPort = 0
+	err := s1.startSharedListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor1, err := s1.AddTorrent(f, &AddTorrentOptions{DataPath: torrentDataDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-tor1.torrent.NotifyListen():
+	case err = <-tor1.torrent.NotifyError():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("seeder is not ready")
+	}
+	if tor1.Port() != s1.sharedPort {
+		t.Fatalf("torrent port: %d, shared port: %d", tor1.Port(), s1.sharedPort)
+	}
+	addr := "127.0.0.1:" + strconv.Itoa(s1.sharedPort)
+
+	// Session must find the torrent from encryption key in encrypted handshakes.
+	for _, encrypt := range []bool{false, true} {
+		s2, closeSession2 := newTestSession(t)
+		s2.config.ForceOutgoingEncryption = encrypt
+		tor2, err := s2.AddURI(torrentMagnetLink+"&x.pe="+addr, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertCompleted(t, tor2)
+		closeSession2()
+	}
+}
+
+func TestLoadTorrentSharedPort(t *testing.T) {
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+
+	cfg := DefaultConfig
+	cfg.Database = filepath.Join(tmp, "session.db")
+	cfg.DataDir = filepath.Join(tmp, "data")
+	cfg.DHTEnabled = false
+	cfg.PEXEnabled = false
+	cfg.LSDEnabled = false
+	cfg.RPCEnabled = false
+	cfg.Host = "127.0.0.1"
+	cfg.PortEnd = cfg.PortBegin + 1
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Port of the torrent is not allocated in shared port mode.
+	cfg.SharedPortEnabled = true
+	cfg.SharedPort = 0
+	s, err = NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	tor = s.GetTorrent(tor.ID())
+	if tor == nil {
+		t.Fatal("torrent is not loaded")
+	}
+	if tor.Port() != s.sharedPort {
+		t.Fatalf("torrent port: %d, shared port: %d", tor.Port(), s.sharedPort)
+	}
+	if len(s.availablePorts) != 1 {
+		t.Fatalf("port is allocated: %v", s.availablePorts)
+	}
+}
+
+func TestSharedPortMaxHandshakes(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	s.config.SharedPortEnabled = true
+	s.config.SharedPort = 0
+	s.config.SharedPortMaxHandshakes = 2
+	err := s.startSharedListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := "127.0.0.1:" + strconv.Itoa(s.sharedPort)
+	var conns []net.Conn
+	for i := 0; i < 3; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+	// Connections that are over the limit are closed before the handshake.
+	err = conns[2].SetReadDeadline(time.Now().Add(timeout))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conns[2].Read(make([]byte, 1))
+	if err != io.EOF {
+		t.Fatalf("connection is not closed: %v", err)
+	}
+	for _, conn := range conns[:2] {
+		err = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = conn.Read(make([]byte, 1))
+		if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+			t.Fatalf("handshaking connection is closed: %v", err)
+		}
+	}
+}
+
+func TestQueue(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	s.config.MaxActiveDownloads = 1
+
+	var torrents []*Torrent
+	for i := 0; i < 3; i++ {
+		tor, err := s.AddURI(torrentMagnetLink, &AddTorrentOptions{Stopped: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		torrents = append(torrents, tor)
+	}
+	a, b, c := torrents[0], torrents[1], torrents[2]
+	assertQueue := func(running, queued []*Torrent) {
+		t.Helper()
+		s.updateQueue()
+		for _, tor := range running {
+			if st := tor.Stats().Status; st != DownloadingMetadata {
+				t.Errorf("torrent at position %d is not running: %s", tor.QueuePosition(), st)
+			}
+		}
+		for _, tor := range queued {
+			if st := tor.Stats().Status; st != Queued && st != Stopping {
+				t.Errorf("torrent at position %d is not queued: %s", tor.QueuePosition(), st)
+			}
+		}
+	}
+	for _, tor := range torrents {
+		if err := tor.Start(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertQueue([]*Torrent{a}, []*Torrent{b, c})
+
+	// Torrent at the head of the queue takes the slot.
+	if err := c.MoveUpInQueue(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.MoveUpInQueue(); err != nil {
+		t.Fatal(err)
+	}
+	if c.QueuePosition() != 0 || a.QueuePosition() != 1 || b.QueuePosition() != 2 {
+		t.Fatalf("invalid queue positions: %d %d %d", a.QueuePosition(), b.QueuePosition(), c.QueuePosition())
+	}
+	assertQueue([]*Torrent{c}, []*Torrent{a, b})
+
+	// Force started torrents do not count towards the limits.
+	if err := b.ForceStart(); err != nil {
+		t.Fatal(err)
+	}
+	assertQueue([]*Torrent{c, b}, []*Torrent{a})
+
+	// Slot is freed after removing the torrent.
+	if err := s.RemoveTorrent(c.ID()); err != nil {
+		t.Fatal(err)
+	}
+	assertQueue([]*Torrent{a, b}, nil)
+	if a.QueuePosition() != 0 || b.QueuePosition() != 1 {
+		t.Fatalf("invalid queue positions: %d %d", a.QueuePosition(), b.QueuePosition())
+	}
+	spec, err := s.resumer.Read(b.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.QueuePosition != 1 || !spec.ForceStarted {
+		t.Fatalf("invalid resume data: position: %d, force started: %v", spec.QueuePosition, spec.ForceStarted)
+	}
+}
+
+func TestSeedLimits(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	dataPath, closeDataPath := tempdir(t)
+	defer closeDataPath()
+	err := CopyDir(filepath.Join(torrentDataDir, torrentName), filepath.Join(dataPath, torrentName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hookOutput := filepath.Join(dataPath, "hook")
+	s.config.HookRetries = 0
+	s.config.Hooks = []Hook{{
+		Name:   "limit",
+		Events: []EventType{EventSeedLimitReached},
+		Cmd:    []string{"sh", "-c", "echo $RAIN_EVENT $RAIN_TORRENT_ID $RAIN_TORRENT_DIR >> " + hookOutput},
+	}}
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{DataPath: dataPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Waits until the torrent is seeding and the idle limit is reached.
+	waitSeedLimit := func() Stats {
+		t.Helper()
+		deadline := time.Now().Add(timeout)
+		for {
+			st := tor.Stats()
+			if st.SeedGoals.Reached {
+				return st
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("seed limit is not reached, status: %s", st.Status)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// Global limit stops the torrent.
+	err = s.SetSeedLimits(SeedLimits{Idle: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := waitSeedLimit()
+	if st.SeedGoals.Custom || st.SeedGoals.Action != SeedLimitStop || st.SeedGoals.IdleRemaining == nil || *st.SeedGoals.IdleRemaining != 0 {
+		t.Fatalf("invalid seed goals: %+v", st.SeedGoals)
+	}
+	if st.SeedGoals.RatioRemaining != nil || st.SeedGoals.TimeRemaining != nil {
+		t.Fatalf("invalid seed goals: %+v", st.SeedGoals)
+	}
+	s.checkSeedLimits()
+	deadline := time.Now().Add(timeout)
+	for tor.Stats().Status != Stopped {
+		if time.Now().After(deadline) {
+			t.Fatalf("torrent is not stopped: %s", tor.Stats().Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	expected := fmt.Sprintf("seed-limit-reached %s %s\n", tor.ID(), dataPath)
+	var output []byte
+	for i := 0; i < 100 && string(output) != expected; i++ {
+		time.Sleep(10 * time.Millisecond)
+		output, _ = os.ReadFile(hookOutput)
+	}
+	if string(output) != expected {
+		t.Fatalf("unexpected hook output: %q", output)
+	}
+
+	// Torrent limits override the global limits.
+	err = tor.SetSeedLimits(&SeedLimits{Time: time.Hour, Idle: time.Millisecond, IdleAction: SeedLimitRemove})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, err := s.resumer.Read(tor.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.SeedLimits == nil {
+		t.Fatal("seed limits are not saved")
+	}
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st = waitSeedLimit()
+	if !st.SeedGoals.Custom || st.SeedGoals.Action != SeedLimitRemove || st.SeedGoals.TimeRemaining == nil || *st.SeedGoals.TimeRemaining <= 0 {
+		t.Fatalf("invalid seed goals: %+v", st.SeedGoals)
+	}
+	s.checkSeedLimits()
+	if s.GetTorrent(tor.ID()) != nil {
+		t.Fatal("torrent is not removed")
+	}
+	cmd := exec.Command("diff", "-rq", filepath.Join(torrentDataDir, torrentName), filepath.Join(dataPath, torrentName))
+	err = cmd.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSeedLimitsSaved(t *testing.T) {
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+	cfg := DefaultConfig
+	cfg.Database = filepath.Join(tmp, "session.db")
+	cfg.DataDir = tmp
+	cfg.DHTEnabled = false
+	cfg.PEXEnabled = false
+	cfg.LSDEnabled = false
+	cfg.RPCEnabled = false
+	cfg.SeedLimits = SeedLimits{Ratio: 1}
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits := SeedLimits{Ratio: 2, RatioAction: SeedLimitRemove, Idle: time.Hour}
+	err = s.SetSeedLimits(limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Saved limits are used instead of the limits in Config.
+	s, err = NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if l := s.SeedLimits(); l != limits {
+		t.Fatalf("unexpected seed limits: %+v", l)
+	}
+}
+
+func TestSpeedLimits(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	tor, err := s.AddURI(torrentMagnetLink, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.SetSpeedLimits(100, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := tor.Stats()
+	if st.SpeedLimit.Download != 100 || st.SpeedLimit.Upload != 50 {
+		t.Fatalf("invalid speed limits: %+v", st.SpeedLimit)
+	}
+	spec, err := s.resumer.Read(tor.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.DownloadLimit != 100 || spec.UploadLimit != 50 {
+		t.Fatalf("invalid resume data: download: %d, upload: %d", spec.DownloadLimit, spec.UploadLimit)
+	}
+
+	// Global limits still apply after the torrent limits are removed.
+	err = tor.SetSpeedLimits(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tor.torrent.downloadLimiter.Limited() {
+		t.Fatal("torrent must not be limited")
+	}
+	s.downloadLimiter.SetRate(1024)
+	if !tor.torrent.downloadLimiter.Limited() {
+		t.Fatal("torrent must be limited by the session")
+	}
+}
+
+func TestAltSpeedSchedule(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	s.config.SpeedLimitUpload = 100
+	s.config.AltSpeedLimitUpload = 10
+	s.config.AltSpeedScheduleEnabled = true
+	s.config.AltSpeedSchedule = []AltSpeedRule{
+		// Office hours
+		{Days: []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}, Begin: 9 * time.Hour, End: 18 * time.Hour},
+		// Friday night
+		{Days: []time.Weekday{time.Friday}, Begin: 22 * time.Hour, End: 2 * time.Hour},
+	}
+	at := func(day, hour int) time.Time {
+		// 2024-01-01 is Monday.
+		return time.Date(2024, 1, day, hour, 0, 0, 0, time.Local)
+	}
+	cases := []struct {
+		t      time.Time
+		active bool
+	}{
+		{at(1, 8), false},
+		{at(1, 9), true},
+		{at(1, 17), true},
+		{at(1, 18), false},
+		{at(5, 23), true},
+		{at(6, 1), true},
+		{at(6, 2), false},
+		{at(6, 10), false},
+	}
+	for _, c := range cases {
+		if active := altSpeedScheduleActive(s.config.AltSpeedSchedule, c.t); active != c.active {
+			t.Errorf("unexpected state at %s: %v", c.t, active)
+		}
+	}
+
+	// Rules use the wall clock time on the days of DST transitions.
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// DST starts at 02:00 on 2024-03-10 (Sunday) and ends at 02:00 on 2024-11-03 (Sunday).
+	sunday := []AltSpeedRule{{Days: []time.Weekday{time.Sunday}, Begin: 9 * time.Hour, End: 18 * time.Hour}}
+	for _, c := range []struct {
+		t      time.Time
+		active bool
+	}{
+		{time.Date(2024, 3, 10, 8, 30, 0, 0, ny), false},
+		{time.Date(2024, 3, 10, 9, 0, 0, 0, ny), true},
+		{time.Date(2024, 3, 10, 18, 0, 0, 0, ny), false},
+		{time.Date(2024, 11, 3, 8, 30, 0, 0, ny), false},
+		{time.Date(2024, 11, 3, 17, 30, 0, 0, ny), true},
+	} {
+		if active := altSpeedScheduleActive(sunday, c.t); active != c.active {
+			t.Errorf("unexpected state at %s: %v", c.t, active)
+		}
+	}
+
+	assertLimit := func(alt bool, upload int64) {
+		t.Helper()
+		st := s.Stats()
+		if st.AltSpeedLimits != alt || st.SpeedLimitUpload != upload {
+			t.Fatalf("unexpected speed limits: alternative: %v, upload: %d", st.AltSpeedLimits, st.SpeedLimitUpload)
+		}
+	}
+	s.checkAltSpeedSchedule(at(1, 8))
+	s.checkAltSpeedSchedule(at(1, 9))
+	assertLimit(true, 10)
+
+	// Manual change is kept until the next boundary.
+	s.SetAltSpeedLimits(false)
+	assertLimit(false, 100)
+	s.checkAltSpeedSchedule(at(1, 10))
+	assertLimit(false, 100)
+	s.SetAltSpeedLimits(true)
+	s.checkAltSpeedSchedule(at(1, 18))
+	assertLimit(false, 100)
+}
+
+func TestLabels(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	labelDir, closeLabelDir := tempdir(t)
+	defer closeLabelDir()
+	err := s.SetLabel("movies", Label{
+		DataDir:            labelDir,
+		SpeedLimitDownload: 100,
+		SeedLimits:         &SeedLimits{Ratio: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor, err := s.AddURI(torrentMagnetLink, &AddTorrentOptions{Stopped: true, Labels: []string{" movies ", "hd", "movies", ""}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.AddURI(torrentMagnetLink, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labels := tor.Labels(); len(labels) != 2 || labels[0] != "movies" || labels[1] != "hd" {
+		t.Fatalf("invalid labels: %q", labels)
+	}
+	if torrents := s.ListTorrentsWithLabel("hd"); len(torrents) != 1 || torrents[0].ID() != tor.ID() {
+		t.Fatalf("invalid torrents with label: %v", torrents)
+	}
+	st := tor.Stats()
+	if st.DataDir != labelDir {
+		t.Fatalf("invalid data dir: %s", st.DataDir)
+	}
+	if st.SpeedLimit.Download != 100 || st.SpeedLimit.Upload != 0 {
+		t.Fatalf("invalid speed limits: %+v", st.SpeedLimit)
+	}
+	if st.SeedGoals.Limits.Ratio != 2 || st.SeedGoals.Custom {
+		t.Fatalf("invalid seed limits: %+v", st.SeedGoals.Limits)
+	}
+
+	// Torrent limits override the label limits.
+	err = tor.SetSpeedLimits(50, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st = tor.Stats(); st.SpeedLimit.Download != 50 {
+		t.Fatalf("invalid download speed limit: %d", st.SpeedLimit.Download)
+	}
+	err = tor.SetSpeedLimits(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st = tor.Stats(); st.SpeedLimit.Download != 100 {
+		t.Fatalf("invalid download speed limit: %d", st.SpeedLimit.Download)
+	}
+
+	// Changes in label settings apply to existing torrents.
+	err = s.SetLabel("movies", Label{SpeedLimitDownload: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st = tor.Stats()
+	if st.SpeedLimit.Download != 200 {
+		t.Fatalf("invalid download speed limit: %d", st.SpeedLimit.Download)
+	}
+	if st.SeedGoals.Limits.Ratio != 0 {
+		t.Fatalf("invalid seed limits: %+v", st.SeedGoals.Limits)
+	}
+
+	err = tor.SetLabels([]string{"hd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st = tor.Stats(); st.SpeedLimit.Download != 0 {
+		t.Fatalf("invalid download speed limit: %d", st.SpeedLimit.Download)
+	}
+	spec, err := s.resumer.Read(tor.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spec.Labels) != 1 || spec.Labels[0] != "hd" {
+		t.Fatalf("invalid resume data: %q", spec.Labels)
+	}
+	if spec.DataDir != labelDir {
+		t.Fatalf("invalid resume data dir: %s", spec.DataDir)
+	}
+}
+
+func TestLabelsSaved(t *testing.T) {
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+	cfg := DefaultConfig
+	cfg.Database = filepath.Join(tmp, "session.db")
+	cfg.DataDir = tmp
+	cfg.DHTEnabled = false
+	cfg.PEXEnabled = false
+	cfg.LSDEnabled = false
+	cfg.RPCEnabled = false
+	cfg.Labels = map[string]Label{"movies": {SpeedLimitDownload: 100}, "music": {SpeedLimitUpload: 10}}
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.SetLabel("movies", Label{SpeedLimitDownload: 200, SeedLimits: &SeedLimits{Ratio: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.RemoveLabel("music")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Saved labels are used instead of the labels in Config.
+	s, err = NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	labels := s.Labels()
+	if len(labels) != 1 {
+		t.Fatalf("unexpected labels: %+v", labels)
+	}
+	if l := labels["movies"]; l.SpeedLimitDownload != 200 || l.SeedLimits == nil || l.SeedLimits.Ratio != 2 {
+		t.Fatalf("unexpected label: %+v", l)
+	}
+}
+
+func TestWatchDir(t *testing.T) {
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+	watchDir := filepath.Join(tmp, "watch")
+	err := os.Mkdir(watchDir, 0o750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig
+	cfg.Database = filepath.Join(tmp, "session.db")
+	cfg.DataDir = filepath.Join(tmp, "data")
+	cfg.DHTEnabled = false
+	cfg.PEXEnabled = false
+	cfg.LSDEnabled = false
+	cfg.RPCEnabled = false
+	cfg.Host = "127.0.0.1"
+	cfg.WatchDirPollInterval = 100 * time.Millisecond
+	cfg.WatchDirs = []WatchDir{{Dir: watchDir, Options: AddTorrentOptions{Stopped: true}, Label: "watched"}}
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	b, err := os.ReadFile(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"sample.torrent": b,
+		"sample.magnet":  []byte(torrentMagnetLink + "\n"),
+		"bad.torrent":    []byte("not a torrent"),
+		"other.txt":      []byte("not watched"),
+	}
+	for name, data := range files {
+		err = os.WriteFile(filepath.Join(watchDir, name), data, 0o640)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	processed := []string{"sample.torrent.added", "sample.magnet.added", "bad.torrent.invalid"}
+	deadline := time.Now().Add(timeout)
+	for _, name := range processed {
+		for {
+			_, err = os.Stat(filepath.Join(watchDir, name))
+			if err == nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("file is not processed: %s", name)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if _, err = os.Stat(filepath.Join(watchDir, "other.txt")); err != nil {
+		t.Fatal(err)
+	}
+	torrents := s.ListTorrentsWithLabel("watched")
+	if len(torrents) != 2 {
+		t.Fatalf("invalid number of torrents: %d", len(torrents))
+	}
+	for _, tor := range torrents {
+		if st := tor.Stats(); st.Status != Stopped {
+			t.Fatalf("torrent must be stopped: %s", st.Status)
+		}
+	}
+	st := s.Stats()
+	if st.WatchDirErrors != 1 || st.WatchDirLastError == nil {
+		t.Fatalf("invalid watch dir errors: %d, %v", st.WatchDirErrors, st.WatchDirLastError)
+	}
+}
+
+func TestFeeds(t *testing.T) {
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+
+	const item = `<item><title>%s</title><guid>%s</guid><link>%s</link></item>`
+	magnet := func(i int) string {
+		return fmt.Sprintf("magnet:?xt=urn:btih:%040d", i)
+	}
+	var items atomic.Value
+	items.Store([]string{
+		fmt.Sprintf(item, "Other Movie 2024", "4", magnet(4)),
+		fmt.Sprintf(item, "Show S01E02 720p", "2", magnet(2)),
+		fmt.Sprintf(item, "Show S01E01 1080p", "3", magnet(3)),
+		fmt.Sprintf(item, "Show S01E01 CAM", "5", magnet(5)),
+		fmt.Sprintf(item, "Show S01E01 720p", "1", "%s/sample.torrent"),
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sample.torrent":
+			http.ServeFile(w, r, torrentFile)
+		case "/feed.xml":
+			body := `<?xml version="1.0"?><rss version="2.0"><channel>` + strings.Join(items.Load().([]string), "") + `</channel></rss>`
+			_, _ = io.WriteString(w, strings.ReplaceAll(body, "%s", "http://"+r.Host))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig
+	cfg.Database = filepath.Join(tmp, "session.db")
+	cfg.DataDir = filepath.Join(tmp, "data")
+	cfg.DHTEnabled = false
+	cfg.PEXEnabled = false
+	cfg.LSDEnabled = false
+	cfg.RPCEnabled = false
+	cfg.Host = "127.0.0.1"
+	cfg.Feeds = []Feed{{
+		Name:           "shows",
+		URL:            srv.URL + "/feed.xml",
+		Include:        []string{`(?i)^show\b`},
+		Exclude:        []string{`CAM`},
+		UniqueEpisodes: true,
+		Label:          "feed",
+		DataDir:        filepath.Join(tmp, "shows"),
+		Stopped:        true,
+	}}
+	waitFeed := func(s *Session, numTorrents int) {
+		deadline := time.Now().Add(timeout)
+		for {
+			feeds := s.Feeds()
+			if len(feeds) != 1 {
+				t.Fatalf("invalid number of feeds: %d", len(feeds))
+			}
+			if feeds[0].Error != nil {
+				t.Fatal(feeds[0].Error)
+			}
+			if !feeds[0].LastUpdate.IsZero() {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("feed is not updated")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		torrents := s.ListTorrentsWithLabel("feed")
+		if len(torrents) != numTorrents {
+			t.Fatalf("invalid number of torrents: %d", len(torrents))
+		}
+		for _, tor := range torrents {
+			if tor.torrent.dataDir != filepath.Join(tmp, "shows") {
+				t.Fatalf("invalid data dir: %s", tor.torrent.dataDir)
+			}
+		}
+	}
+
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFeed(s, 2)
+	names := make(map[string]bool)
+	for _, tor := range s.ListTorrents() {
+		names[tor.Name()] = true
+	}
+	if !names[torrentName] {
+		t.Fatal("torrent file in feed is not added")
+	}
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Feed is loaded from the database and added items are not added again.
+	items.Store(append([]string{fmt.Sprintf(item, "Show S01E03", "6", magnet(6))}, items.Load().([]string)...))
+	cfg.Feeds = nil
+	s, err = NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	waitFeed(s, 3)
+	if n := s.Feeds()[0].ItemsAdded; n != 1 {
+		t.Fatalf("invalid number of added items: %d", n)
+	}
+
+	err = s.RemoveFeed("shows")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Feeds()) != 0 {
+		t.Fatal("feed is not removed")
+	}
+	err = s.AddFeed(Feed{Name: "bad", URL: srv.URL, Include: []string{"("}})
+	var inputErr *InputError
+	if !errors.As(err, &inputErr) {
+		t.Fatalf("input error expected: %v", err)
+	}
+}
+
+func TestNewSessionError(t *testing.T) {
+	defer leaktest.Check(t)()
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+
+	cfg := DefaultConfig
+	cfg.Database = filepath.Join(tmp, "session.db")
+	cfg.DataDir = filepath.Join(tmp, "data")
+	cfg.DHTEnabled = false
+	cfg.PEXEnabled = false
+	cfg.LSDEnabled = false
+	cfg.RPCEnabled = false
+	cfg.Host = "127.0.0.1"
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, err = s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	invalidFeeds := cfg
+	invalidFeeds.Feeds = []Feed{{Name: "bad", URL: "ftp://example.com/feed.xml"}}
+	portInUse := cfg
+	portInUse.RPCEnabled = true
+	portInUse.RPCHost = "127.0.0.1"
+	portInUse.RPCPort = l.Addr().(*net.TCPAddr).Port
+	for _, c := range []Config{invalidFeeds, portInUse} {
+		_, err = NewSession(c)
+		if err == nil {
+			t.Fatal("error expected")
+		}
+	}
+
+	// Database and ports are released after an error.
+	s, err = NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.ListTorrents()) != 1 {
+		t.Fatal("torrent is not loaded")
+	}
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	sub := s.Subscribe(EventFilter{Types: []EventType{EventTorrentAdded, EventTorrentStarted, EventTorrentStopped, EventTorrentRemoved}})
+	defer sub.Close()
+
+	h := &rpcHandler{session: s}
+	srv := httptest.NewServer(http.HandlerFunc(h.handleEvents))
+	defer srv.Close()
+	stream, err := rainrpc.NewClient(srv.URL).Events([]string{"torrent-added", "torrent-removed"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := func(et EventType) {
+		select {
+		case e := <-sub.C:
+			if e.Type != et || e.TorrentID != tor.ID() || e.TorrentName != torrentName {
+				t.Fatalf("unexpected event: %+v", e)
+			}
+		case <-time.After(timeout):
+			t.Fatalf("event is not received: %s", et)
+		}
+	}
+	expect(EventTorrentAdded)
+	expect(EventTorrentStarted)
+	err = tor.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(EventTorrentStopped)
+	err = s.RemoveTorrent(tor.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(EventTorrentRemoved)
+
+	for _, et := range []string{"torrent-added", "torrent-removed"} {
+		e, err := stream.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Type != et || e.TorrentID != tor.ID() {
+			t.Fatalf("unexpected event from stream: %+v", e)
+		}
+	}
+	if sub.Dropped() != 0 {
+		t.Fatalf("events are dropped: %d", sub.Dropped())
+	}
+	sub.Close()
+	if _, ok := <-sub.C; ok {
+		t.Fatal("channel is not closed")
+	}
+}
+
+func TestHooks(t *testing.T) {
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+
+	var requests, failing int32
+	payloads := make(chan HookPayload, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fail the first delivery of each event.
+		if atomic.LoadInt32(&failing) == 1 || atomic.AddInt32(&requests, 1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var p HookPayload
+		err := json.NewDecoder(r.Body).Decode(&p)
+		if err != nil {
+			t.Error(err)
+		}
+		payloads <- p
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig
+	cfg.Database = filepath.Join(tmp, "session.db")
+	cfg.DataDir = filepath.Join(tmp, "data")
+	cfg.DHTEnabled = false
+	cfg.PEXEnabled = false
+	cfg.LSDEnabled = false
+	cfg.RPCEnabled = false
+	cfg.Host = "127.0.0.1"
+	cfg.HookRetryInterval = 10 * time.Millisecond
+	cfg.Hooks = []Hook{
+		{Name: "web", Events: []EventType{EventTorrentAdded, EventTorrentRemoved}, URL: srv.URL},
+		{Name: "other", Events: []EventType{EventTorrentAdded}, Label: "other", URL: srv.URL},
+	}
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := func(et EventType) {
+		select {
+		case p := <-payloads:
+			if p.Event != et || p.ID != tor.ID() || p.Name != torrentName || p.InfoHash != tor.InfoHash().String() {
+				t.Fatalf("unexpected payload: %+v", p)
+			}
+		case <-time.After(timeout):
+			t.Fatalf("hook is not delivered: %s", et)
+		}
+	}
+	expect(EventTorrentAdded)
+	var hooks map[string]boltdbresumer.HookRecord
+	for i := 0; i < 100 && !hooks["torrent-added/web"].Delivered; i++ {
+		time.Sleep(10 * time.Millisecond)
+		hooks, err = s.resumer.ReadHooks(tor.ID())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(hooks) != 1 || !hooks["torrent-added/web"].Delivered {
+		t.Fatalf("unexpected hook records: %+v", hooks)
+	}
+	err = s.RemoveTorrent(tor.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(EventTorrentRemoved)
+	// Hooks of removed torrents are saved in session until they are delivered.
+	pending := true
+	for i := 0; i < 100 && pending; i++ {
+		time.Sleep(10 * time.Millisecond)
+		err = s.db.View(func(tx *bbolt.Tx) error {
+			k, _ := tx.Bucket(hooksBucket).Cursor().First()
+			pending = k != nil
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if pending {
+		t.Fatal("removed hook is not marked as delivered")
+	}
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 4 {
+		t.Fatalf("unexpected number of requests: %d", n)
+	}
+
+	// Hooks that are not delivered are run again in the next session.
+	atomic.StoreInt32(&failing, 1)
+	cfg.HookRetries = 0
+	s, err = NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor, err = s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&failing, 0)
+	cfg.HookRetries = DefaultConfig.HookRetries
+	s, err = NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(EventTorrentAdded)
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Hooks = append(cfg.Hooks, Hook{Name: "web", Events: []EventType{EventTorrentError}, Cmd: []string{"true"}})
+	_, err = NewSession(cfg)
+	if err == nil {
+		t.Fatal("duplicate hook name is accepted")
+	}
+}
+
+func TestCompleteCmd(t *testing.T) {
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+
+	runs := filepath.Join(tmp, "runs")
+	ok := filepath.Join(tmp, "ok")
+	cfg := DefaultConfig
+	cfg.Database = filepath.Join(tmp, "session.db")
+	cfg.DataDir = filepath.Join(tmp, "data")
+	cfg.DHTEnabled = false
+	cfg.PEXEnabled = false
+	cfg.LSDEnabled = false
+	cfg.RPCEnabled = false
+	cfg.Host = "127.0.0.1"
+	cfg.HookRetryInterval = 10 * time.Millisecond
+	cfg.OnCompleteCmd = []string{"sh", "-c", "echo $RAIN_TORRENT_ID >> " + runs + " && test -f " + ok}
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(filepath.Join(cfg.DataDir, tor.ID()), 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = CopyDir(filepath.Join(torrentDataDir, torrentName), filepath.Join(cfg.DataDir, tor.ID(), torrentName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	countRuns := func(n int) {
+		var lines []string
+		for i := 0; i < 100; i++ {
+			b, err := os.ReadFile(runs)
+			if err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+			lines = strings.Fields(string(b))
+			if len(lines) >= n {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if len(lines) != n {
+			t.Fatalf("unexpected number of runs: %d, expected: %d", len(lines), n)
+		}
+	}
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t, tor)
+	// Failed command is not retried in the same Session.
+	countRuns(1)
+	time.Sleep(100 * time.Millisecond)
+	countRuns(1)
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Failed command is run again in the next Session.
+	err = os.WriteFile(ok, nil, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	countRuns(2)
+	tor = s.GetTorrent(tor.ID())
+	assertCompleted(t, tor)
+	// Command is not run again when the completed torrent is checked again.
+	err = tor.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t, tor)
+	time.Sleep(100 * time.Millisecond)
+	countRuns(2)
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Command is not run again after it succeeds.
+	s, err = NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t, s.GetTorrent(tor.ID()))
+	time.Sleep(100 * time.Millisecond)
+	countRuns(2)
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompleteCmdSessionClose(t *testing.T) {
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+
+	runs := filepath.Join(tmp, "runs")
+	started := filepath.Join(tmp, "started")
+	cfg := DefaultConfig
+	cfg.Database = filepath.Join(tmp, "session.db")
+	cfg.DataDir = filepath.Join(tmp, "data")
+	cfg.DHTEnabled = false
+	cfg.PEXEnabled = false
+	cfg.LSDEnabled = false
+	cfg.RPCEnabled = false
+	cfg.Host = "127.0.0.1"
+	cfg.OnCompleteCmd = []string{"sh", "-c", "touch " + started + " && sleep 0.5 && echo $RAIN_TORRENT_ID >> " + runs}
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(filepath.Join(cfg.DataDir, tor.ID()), 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = CopyDir(filepath.Join(torrentDataDir, torrentName), filepath.Join(cfg.DataDir, tor.ID(), torrentName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t, tor)
+	for i := 0; i < 100; i++ {
+		if _, err = os.Stat(started); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal("command is not started")
+	}
+	// Running command is not killed when the Session is closed.
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(runs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != tor.ID()+"\n" {
+		t.Fatalf("unexpected runs: %q", b)
+	}
+
+	// Command is not run again in the next Session.
+	err = os.Remove(started)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t, s.GetTorrent(tor.ID()))
+	time.Sleep(100 * time.Millisecond)
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(started); !os.IsNotExist(err) {
+		t.Fatal("command is run again")
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func() string {
+		srv := httptest.NewServer(http.HandlerFunc(s.handleMetrics))
+		defer srv.Close()
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	labels := `id="` + tor.ID() + `",name="` + torrentName + `"`
+	body := get()
+	for _, line := range []string{
+		"# TYPE rain_torrents gauge\nrain_torrents 1\n",
+		`rain_torrents_by_status{status="stopped"} 1`,
+		"rain_torrents_without_series 1\n",
+	} {
+		if !strings.Contains(body, line) {
+			t.Fatalf("metric not found: %q\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, labels) {
+		t.Fatalf("stopped torrent has series:\n%s", body)
+	}
+
+	s.config.MetricsStoppedTorrents = true
+	body = get()
+	for _, line := range []string{
+		"rain_torrents_without_series 0\n",
+		`rain_torrent_info{` + labels + `,info_hash="` + torrentInfoHashString + `",status="stopped"} 1`,
+		`rain_torrent_pieces{` + labels + `,state="total"} 11`,
+		`rain_torrent_peers{` + labels + `,source="dht"} 0`,
+		`rain_torrent_trackers{` + labels + `,status="not_contacted_yet"} 1`,
+	} {
+		if !strings.Contains(body, line) {
+			t.Fatalf("metric not found: %q\n%s", line, body)
+		}
+	}
+	if strings.Count(body, "# TYPE rain_torrent_pieces gauge") != 1 {
+		t.Fatalf("samples are not grouped:\n%s", body)
+	}
+}
+
+func TestTransmissionRPC(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	srv := httptest.NewServer(newTransmissionHandler(s))
+	defer srv.Close()
+
+	var sessionID string
+	do := func(method string, args interface{}) (string, map[string]interface{}) {
+		b, err := json.Marshal(map[string]interface{}{"method": method, "arguments": args, "tag": 7})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			req, err := http.NewRequest(http.MethodPost, srv.URL, bytes.NewReader(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("X-Transmission-Session-Id", sessionID)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode == http.StatusConflict {
+				resp.Body.Close()
+				sessionID = resp.Header.Get("X-Transmission-Session-Id")
+				continue
+			}
+			var ret struct {
+				Result    string
+				Arguments map[string]interface{}
+				Tag       int
+			}
+			err = json.NewDecoder(resp.Body).Decode(&ret)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ret.Tag != 7 {
+				t.Fatalf("invalid tag: %d", ret.Tag)
+			}
+			return ret.Result, ret.Arguments
+		}
+		t.Fatal("session id is not accepted")
+		return "", nil
+	}
+	call := func(method string, args interface{}) map[string]interface{} {
+		result, ret := do(method, args)
+		if result != "success" {
+			t.Fatalf("%s failed: %s", method, result)
+		}
+		return ret
+	}
+
+	metainfo, err := os.ReadFile(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret := call("torrent-add", map[string]interface{}{"metainfo": base64.StdEncoding.EncodeToString(metainfo), "paused": true})
+	added := ret["torrent-added"].(map[string]interface{})
+	if added["id"] != float64(1) || added["hashString"] != torrentInfoHashString || added["name"] != torrentName {
+		t.Fatalf("unexpected response: %v", added)
+	}
+	for _, args := range []map[string]interface{}{
+		{"metainfo": base64.StdEncoding.EncodeToString(metainfo)},
+		{"filename": "magnet:?xt=urn:btih:" + torrentInfoHashString},
+	} {
+		ret = call("torrent-add", args)
+		duplicate, ok := ret["torrent-duplicate"].(map[string]interface{})
+		if !ok || duplicate["id"] != float64(1) || duplicate["hashString"] != torrentInfoHashString {
+			t.Fatalf("unexpected response: %v", ret)
+		}
+	}
+	if len(s.ListTorrents()) != 1 {
+		t.Fatal("duplicate torrent is added")
+	}
+	// Local files are not read unless they are allowed in config.
+	abs, err := filepath.Abs(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{abs, abs + ".missing"} {
+		result, _ := do("torrent-add", map[string]interface{}{"filename": name})
+		if result != "filename must be a magnet link or an HTTP URL" {
+			t.Fatalf("unexpected result: %s", result)
+		}
+	}
+	s.config.TransmissionRPCAllowLocalFiles = true
+	ret = call("torrent-add", map[string]interface{}{"filename": abs})
+	if _, ok := ret["torrent-duplicate"]; !ok {
+		t.Fatalf("unexpected response: %v", ret)
+	}
+	s.config.TransmissionRPCAllowLocalFiles = false
+
+	get := func() map[string]interface{} {
+		ret := call("torrent-get", map[string]interface{}{"ids": []interface{}{1}, "fields": []string{"id", "name", "status", "pieceCount", "trackers", "unknown"}})
+		torrents := ret["torrents"].([]interface{})
+		if len(torrents) != 1 {
+			t.Fatalf("unexpected torrents: %v", torrents)
+		}
+		return torrents[0].(map[string]interface{})
+	}
+	tor := get()
+	if tor["name"] != torrentName || tor["status"] != float64(transmissionStatusStopped) || tor["pieceCount"] != float64(11) || len(tor["trackers"].([]interface{})) != 1 {
+		t.Fatalf("unexpected torrent: %v", tor)
+	}
+	if _, ok := tor["unknown"]; ok {
+		t.Fatal("unknown field is returned")
+	}
+
+	call("torrent-start", map[string]interface{}{"ids": torrentInfoHashString})
+	if get()["status"] == float64(transmissionStatusStopped) {
+		t.Fatal("torrent is not started")
+	}
+	call("torrent-stop", map[string]interface{}{"ids": 1})
+	if get()["status"] != float64(transmissionStatusStopped) {
+		t.Fatal("torrent is not stopped")
+	}
+
+	ret = call("session-get", map[string]interface{}{"fields": []string{"rpc-version", "download-dir"}})
+	if len(ret) != 2 || ret["download-dir"] != s.config.DataDir {
+		t.Fatalf("unexpected session: %v", ret)
+	}
+	ret = call("session-stats", nil)
+	if ret["torrentCount"] != float64(1) || ret["pausedTorrentCount"] != float64(1) {
+		t.Fatalf("unexpected session stats: %v", ret)
+	}
+
+	call("torrent-remove", map[string]interface{}{"ids": []int{1}})
+	if len(s.ListTorrents()) != 0 {
+		t.Fatal("torrent is not removed")
+	}
+	ret = call("torrent-get", map[string]interface{}{"ids": "recently-active", "fields": []string{"id"}})
+	if removed := ret["removed"].([]interface{}); len(removed) != 1 || removed[0] != float64(1) {
+		t.Fatalf("unexpected removed torrents: %v", ret)
+	}
+}
+
+func TestScrapeStoppedTorrent(t *testing.T) {
+	defer startHTTPTracker(t)()
+
+	_, cl := seeder(t, false)
+	defer cl()
+
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Seeder announces to the tracker after it starts.
+	deadline := time.Now().Add(timeout)
+	for {
+		s.scrapeTrackers(context.Background(), make(map[string]time.Time))
+		trackers := tor.Trackers()
+		if len(trackers) != 1 {
+			t.Fatalf("invalid number of trackers: %d", len(trackers))
+		}
+		tr := trackers[0]
+		if !tr.LastScrape.IsZero() && tr.Seeders == 1 {
+			if tr.Status != NotContactedYet {
+				t.Fatalf("unexpected tracker status: %d", tr.Status)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("torrent is not scraped: %#v", tr)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -51,8 +51,13 @@ func (t *torrent) handleVerificationDone(ve *verifier.Verifier) {
 		}
 	}
 
+	// File priorities may have been changed during verification.
+	t.updatePiecePriorities()
+
+	t.servePieceReaders()
+
 	// We may detect missing pieces after verification. Then, status must be set from Seeding to Downloading.
-	if !t.bitfield.All() {
+	if !t.haveAllWantedPieces() {
 		t.completed = false
 		t.completeC = make(chan struct{})
 	}
@@ -46,6 +46,8 @@ func (t *torrent) handlePieceWriteDone(pw *piecewriter.PieceWriter) {
 	t.mBitfield.Lock()
 	t.bitfield.Set(pw.Piece.Index)
 	t.mBitfield.Unlock()
+	t.publishEvent(Event{Type: EventPieceVerified, Piece: pw.Piece.Index})
+	t.publishCompletedFiles(pw.Piece.Index)
 
 	if t.piecePicker != nil {
 		_, ok := pw.Source.(*urldownloader.URLDownloader)
@@ -66,6 +68,8 @@ func (t *torrent) handlePieceWriteDone(pw *piecewriter.PieceWriter) {
 		}
 	}
 
+	t.servePieceReaders()
+
 	// Tell everyone that we have this piece
 	for pe := range t.peers {
 		t.updateInterestedState(pe)